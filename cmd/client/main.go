@@ -4,21 +4,31 @@ import (
 	"context"
 	"flag"
 	"log"
+	"strings"
 	"time"
 
+	usergrpc "github.com/atulsm/user-service/internal/grpc"
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/requestid"
 	pb "github.com/atulsm/user-service/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
 	// Parse command line flags
 	page := flag.Int("page", 1, "Page number")
 	pageSize := flag.Int("page_size", 10, "Number of items per page")
+	requestID := flag.String("request_id", "", "X-Request-ID to send (generated when empty)")
+	token := flag.String("token", "", "access token from POST /api/v1/auth/login")
 	flag.Parse()
 
 	// Set up connection to the server
-	conn, err := grpc.Dial("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial("localhost:50051",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(usergrpc.RequestIDUnaryClientInterceptor()),
+	)
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
@@ -30,6 +40,10 @@ func main() {
 	// Set timeout for the request
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
+	if *requestID != "" {
+		ctx = logging.WithRequestID(ctx, *requestID)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, usergrpc.AuthorizationMetadataKey, "Bearer "+*token)
 
 	// Make the request
 	req := &pb.GetUsersRequest{
@@ -37,9 +51,10 @@ func main() {
 		PageSize: int32(*pageSize),
 	}
 
-	resp, err := client.GetUsers(ctx, req)
+	var header metadata.MD
+	resp, err := client.GetUsers(ctx, req, grpc.Header(&header))
 	if err != nil {
-		log.Fatalf("Failed to get users: %v", err)
+		log.Fatalf("Failed to get users (request ID %s): %v", strings.Join(header.Get(requestid.MetadataKey), ","), err)
 	}
 
 	// Print the response
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/atulsm/user-service/internal/config"
+)
+
+const configUsage = `Usage: server config print [flags]
+
+Print the effective configuration, after files, environment variables and
+defaults have been applied, as YAML that can be used as a config file.
+
+Flags:
+`
+
+// runConfig implements the "config" subcommand.
+func runConfig(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	redacted := fs.Bool("redacted", false, "replace secrets such as the JWT secret and database password")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), configUsage)
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "print" {
+		fs.Usage()
+		return fmt.Errorf("expected the print command")
+	}
+	fs.Parse(args[1:])
+
+	return cfg.Print(os.Stdout, *redacted)
+}
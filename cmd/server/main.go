@@ -3,93 +3,83 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/atulsm/user-service/internal/config"
-	"github.com/atulsm/user-service/internal/grpc"
-	"github.com/atulsm/user-service/internal/handlers"
-	"github.com/atulsm/user-service/internal/repository"
-	"github.com/gin-gonic/gin"
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/server"
+	"github.com/atulsm/user-service/internal/tracing"
 )
 
-// Dummy implementations for demonstration
-// Replace with your actual implementations
-
-type dummyTokenGen struct{}
-
-func (d *dummyTokenGen) GenerateToken(userID string) (string, error) { return "dummy-token", nil }
-
-type dummyPwHasher struct{}
-
-func (d *dummyPwHasher) CheckPasswordHash(password, hash string) bool { return password == hash }
-func (d *dummyPwHasher) HashPassword(password string) (string, error) { return password, nil }
-
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		// Validation reports every problem at once, one per line
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
 	}
-
-	userRepo := repository.NewUserRepository(cfg.DatabaseURL)
-
-	grpcServer := grpc.NewServer(userRepo)
-	go func() {
-		if err := grpcServer.Start(50051); err != nil {
-			log.Fatalf("Failed to start gRPC server: %v", err)
+	// The level is a LevelVar so a configuration reload can change it
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel)
+	logging.Setup(logging.Config{Format: cfg.LogFormat, Level: logLevel})
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			fatal("Migration failed", err)
 		}
-	}()
-
-	router := gin.Default()
-
-	// router.Use(middleware.CORS())
-	// router.Use(middleware.RequestID())
-	// router.Use(middleware.Logger())
-
-	tokenGen := &dummyTokenGen{}
-	pwHasher := &dummyPwHasher{}
-	userHandler := handlers.NewUserHandler(userRepo, tokenGen, pwHasher)
-
-	router.POST("/api/users/register", userHandler.Register)
-	router.POST("/api/users/login", userHandler.Login)
-
-	protected := router.Group("/api")
-	// protected.Use(middleware.Auth(cfg.JWTSecret))
-	{
-		protected.GET("/users/profile", userHandler.GetProfile)
-		protected.PUT("/users/profile", userHandler.UpdateProfile)
-		protected.GET("/users", userHandler.ListUsers)
-		protected.GET("/users/:id", userHandler.GetUser)
-		protected.DELETE("/users/:id", userHandler.DeleteUser)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(cfg, os.Args[2:]); err != nil {
+			fatal("Config command failed", err)
+		}
+		return
 	}
 
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", cfg.Port),
-		Handler: router,
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		ServiceName:  "user-service",
+		Environment:  cfg.Environment,
+		Exporter:     cfg.TracingExporter,
+		OTLPEndpoint: cfg.TracingOTLPEndpoint,
+		OTLPInsecure: cfg.TracingOTLPInsecure,
+		FilePath:     cfg.TracingFile,
+		SampleRatio:  cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
 	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start HTTP server: %v", err)
-		}
-	}()
+	srv, err := server.New(ctx, cfg)
+	if err != nil {
+		fatal("Failed to start", err)
+	}
+	srv.Reloader().Register("log level", func(cfg *config.Config) error {
+		logLevel.Set(cfg.LogLevel)
+		return nil
+	})
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	runErr := srv.Run(ctx)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("HTTP server forced to shutdown: %v", err)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
 	}
 
-	grpcServer.Stop()
+	if runErr != nil {
+		fatal("Server stopped with an error", runErr)
+	}
+	slog.Info("Servers shutdown complete")
+}
 
-	log.Println("Servers shutdown complete")
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/atulsm/user-service/db/migrations"
+	"github.com/atulsm/user-service/internal/config"
+	"github.com/atulsm/user-service/internal/migrate"
+	"github.com/atulsm/user-service/internal/repository"
+)
+
+const migrateUsage = `Usage: server migrate <up|down|status> [flags]
+
+Commands:
+  up       Apply all pending migrations
+  down     Revert the most recently applied migrations (see -steps)
+  status   List migrations and whether they have been applied
+
+Flags:
+`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	contexts := fs.String("contexts", "", "comma separated migration contexts to include (e.g. test)")
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	// Flags may come before or after the command, so "migrate -steps 2 down"
+	// and "migrate down -steps 2" are the same
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one migrate command")
+	}
+	command := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments after %q: %s", command, strings.Join(fs.Args(), " "))
+	}
+
+	ctx := context.Background()
+	db, err := repository.Connect(ctx, cfg.DatabaseURL, repository.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	}, repository.ConnectRetry{
+		Timeout:        cfg.DBConnectTimeout,
+		InitialBackoff: cfg.DBConnectBackoff,
+		MaxBackoff:     cfg.DBConnectMaxBackoff,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS, strings.Split(*contexts, ",")...)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tCONTEXT\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, s.Context, appliedAt)
+		}
+		return w.Flush()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id            UUID         PRIMARY KEY,
+    email         VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    first_name    VARCHAR(100) NOT NULL,
+    last_name     VARCHAR(100) NOT NULL,
+    created_at    TIMESTAMP    NOT NULL,
+    updated_at    TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX idx_users_email ON users (email);
+
+COMMENT ON TABLE users IS 'Stores user account information';
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN phone_number VARCHAR(20);
+
+CREATE INDEX idx_users_phone_number ON users (phone_number);
+
+COMMENT ON COLUMN users.phone_number IS 'User phone number in E.164 format';
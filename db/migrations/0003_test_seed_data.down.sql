@@ -0,0 +1,8 @@
+-- context: test
+
+DELETE FROM users WHERE id IN (
+    'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11',
+    'b0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12',
+    'c0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13',
+    'd0eebc99-9c0b-4ef8-bb6d-6bb9bd380a14'
+);
@@ -0,0 +1,20 @@
+-- context: test
+-- Seed users for the API test suite. Passwords are documented in README.md.
+
+INSERT INTO users (id, email, password_hash, first_name, last_name, phone_number, created_at, updated_at) VALUES
+    -- Password: Admin123!
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11', 'admin@example.com',
+     '$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK', 'Admin', 'User', '+1234567890',
+     '2024-01-01 00:00:00', '2024-01-01 00:00:00'),
+    -- Password: User123!
+    ('b0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12', 'user@example.com',
+     '$2a$14$5zf7dNLjHT4XmP8/L.J2celzZdJ6HCjYPwVxPd0vxAQ71KXQ/3TzG', 'Regular', 'User', '+1987654321',
+     '2024-01-02 00:00:00', '2024-01-02 00:00:00'),
+    -- Password: Test123!
+    ('c0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13', 'nophone@example.com',
+     '$2a$14$QeVs4r6MrOuYBEF12VNWkOdZGBw.Xs8Df1Td5hVx2R2rHHUpBdyRO', 'No', 'Phone', NULL,
+     '2024-01-03 00:00:00', '2024-01-03 00:00:00'),
+    -- Password: Inactive123!
+    ('d0eebc99-9c0b-4ef8-bb6d-6bb9bd380a14', 'inactive@example.com',
+     '$2a$14$wfkhdJKHf8YJxJ0P7RFOh.ZC6zv0jmxoGy1Rl7YyQ8xtVXPfW0FvC', 'Inactive', 'User', '+1555555555',
+     '2024-01-04 00:00:00', '2024-01-04 00:00:00');
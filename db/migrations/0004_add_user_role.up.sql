@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
+
+COMMENT ON COLUMN users.role IS 'Authorization role: user or admin';
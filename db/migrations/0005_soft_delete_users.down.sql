@@ -0,0 +1,11 @@
+-- Soft-deleted rows may share an email with an active user, so they have to
+-- go before the global unique constraint can be restored.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+
+DROP INDEX IF EXISTS users_email_active_key;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Deleted accounts release their email address, so uniqueness only applies
+-- to users that have not been deleted.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX users_email_active_key ON users (email) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMENT ON COLUMN users.deleted_at IS 'Set when the user is soft deleted; purged after the retention window';
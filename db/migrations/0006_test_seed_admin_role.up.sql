@@ -0,0 +1,3 @@
+-- context: test
+
+UPDATE users SET role = 'admin' WHERE id = 'a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11';
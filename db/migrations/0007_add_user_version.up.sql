@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN users.version IS 'Incremented on every write; exposed as the ETag for optimistic concurrency';
@@ -0,0 +1,29 @@
+CREATE TABLE audit_log (
+    id             UUID         PRIMARY KEY,
+    occurred_at    TIMESTAMPTZ  NOT NULL,
+    actor_id       UUID,
+    action         VARCHAR(64)  NOT NULL,
+    target_user_id UUID,
+    ip             VARCHAR(64)  NOT NULL DEFAULT '',
+    user_agent     TEXT         NOT NULL DEFAULT '',
+    changes        JSONB        NOT NULL DEFAULT '{}',
+    metadata       JSONB        NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX idx_audit_log_occurred_at ON audit_log (occurred_at DESC, id DESC);
+CREATE INDEX idx_audit_log_actor_id ON audit_log (actor_id, occurred_at DESC);
+CREATE INDEX idx_audit_log_target_user_id ON audit_log (target_user_id, occurred_at DESC);
+CREATE INDEX idx_audit_log_action ON audit_log (action, occurred_at DESC);
+
+-- The audit log is append-only: reject any attempt to rewrite history.
+CREATE FUNCTION audit_log_reject_modification() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_reject_modification();
+
+COMMENT ON TABLE audit_log IS 'Append-only record of account and admin actions';
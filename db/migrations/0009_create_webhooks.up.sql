@@ -0,0 +1,44 @@
+CREATE TABLE webhook_subscriptions (
+    id         UUID         PRIMARY KEY,
+    url        TEXT         NOT NULL,
+    events     TEXT[]       NOT NULL,
+    secret     TEXT         NOT NULL,
+    active     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per (subscription, event): the durable delivery queue. Rows move
+-- from pending to succeeded, or to dead once every attempt has failed.
+CREATE TABLE webhook_deliveries (
+    id               UUID         PRIMARY KEY,
+    subscription_id  UUID         NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id         UUID         NOT NULL,
+    event_type       VARCHAR(64)  NOT NULL,
+    payload          JSONB        NOT NULL,
+    status           VARCHAR(16)  NOT NULL DEFAULT 'pending',
+    attempts         INTEGER      NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_status_code INTEGER,
+    last_error       TEXT         NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'succeeded', 'dead')),
+    CONSTRAINT webhook_deliveries_event_key UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, created_at DESC);
+
+-- Every HTTP attempt, successful or not
+CREATE TABLE webhook_delivery_attempts (
+    id           BIGSERIAL    PRIMARY KEY,
+    delivery_id  UUID         NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+    attempt      INTEGER      NOT NULL,
+    status_code  INTEGER,
+    error        TEXT         NOT NULL DEFAULT '',
+    duration_ms  INTEGER      NOT NULL,
+    attempted_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts (delivery_id, attempt);
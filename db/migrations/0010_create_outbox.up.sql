@@ -0,0 +1,17 @@
+-- Domain events written in the same transaction as the change that caused
+-- them. The relay publishes rows and marks them published; the event id is
+-- the idempotency key consumers use to discard redelivered events.
+CREATE TABLE outbox (
+    id           UUID         PRIMARY KEY,
+    event_type   VARCHAR(64)  NOT NULL,
+    aggregate_id UUID         NOT NULL,
+    payload      JSONB        NOT NULL,
+    occurred_at  TIMESTAMPTZ  NOT NULL,
+    available_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attempts     INTEGER      NOT NULL DEFAULT 0,
+    last_error   TEXT         NOT NULL DEFAULT '',
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_unpublished ON outbox (available_at) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_published_at ON outbox (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE audit_log ADD COLUMN request_id VARCHAR(128) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_audit_log_request_id ON audit_log (request_id) WHERE request_id <> '';
+
+COMMENT ON COLUMN audit_log.request_id IS 'X-Request-ID of the request that produced the event, for correlating with logs';
@@ -0,0 +1,16 @@
+-- Fails if two organizations have active users with the same email, since
+-- emails become globally unique again
+ALTER TABLE outbox DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_webhook_subscriptions_organization_id;
+ALTER TABLE webhook_subscriptions DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_audit_log_organization_id;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_users_organization_id;
+DROP INDEX IF EXISTS users_organization_email_active_key;
+CREATE UNIQUE INDEX users_email_active_key ON users (email) WHERE deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
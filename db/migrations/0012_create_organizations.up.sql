@@ -0,0 +1,41 @@
+CREATE TABLE organizations (
+    id         UUID         PRIMARY KEY,
+    slug       VARCHAR(63)  NOT NULL UNIQUE,
+    name       VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT organizations_slug_check CHECK (slug ~ '^[a-z0-9]([a-z0-9-]*[a-z0-9])?$')
+);
+
+-- Every existing account moves into the default organization
+INSERT INTO organizations (id, slug, name)
+VALUES ('00000000-0000-0000-0000-000000000001', 'default', 'Default');
+
+ALTER TABLE users
+    ADD COLUMN organization_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001'
+    REFERENCES organizations (id);
+ALTER TABLE users ALTER COLUMN organization_id DROP DEFAULT;
+
+-- Emails are unique within an organization, not across the whole service
+DROP INDEX users_email_active_key;
+CREATE UNIQUE INDEX users_organization_email_active_key ON users (organization_id, email) WHERE deleted_at IS NULL;
+CREATE INDEX idx_users_organization_id ON users (organization_id, created_at DESC);
+
+ALTER TABLE audit_log ADD COLUMN organization_id UUID;
+CREATE INDEX idx_audit_log_organization_id ON audit_log (organization_id, occurred_at DESC, id DESC);
+
+ALTER TABLE webhook_subscriptions
+    ADD COLUMN organization_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001'
+    REFERENCES organizations (id) ON DELETE CASCADE;
+ALTER TABLE webhook_subscriptions ALTER COLUMN organization_id DROP DEFAULT;
+CREATE INDEX idx_webhook_subscriptions_organization_id ON webhook_subscriptions (organization_id);
+
+ALTER TABLE outbox
+    ADD COLUMN organization_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001';
+ALTER TABLE outbox ALTER COLUMN organization_id DROP DEFAULT;
+
+COMMENT ON TABLE organizations IS 'Tenants; every user belongs to exactly one';
+COMMENT ON COLUMN users.organization_id IS 'Tenant the account belongs to; emails are unique per tenant';
+COMMENT ON COLUMN audit_log.organization_id IS 'Tenant the action happened in; NULL for events recorded before organizations existed';
+COMMENT ON COLUMN webhook_subscriptions.organization_id IS 'Tenant whose events the subscription receives';
+COMMENT ON COLUMN outbox.organization_id IS 'Tenant of the user the event is about';
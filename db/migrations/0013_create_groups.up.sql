@@ -0,0 +1,36 @@
+CREATE TABLE groups (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name            VARCHAR(255)  NOT NULL,
+    description     TEXT          NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT groups_organization_name_key UNIQUE (organization_id, name)
+);
+
+CREATE TABLE group_members (
+    group_id   UUID         NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    user_id    UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role       VARCHAR(16)  NOT NULL DEFAULT 'member',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    CONSTRAINT group_members_role_check CHECK (role IN ('owner', 'member'))
+);
+
+CREATE INDEX idx_group_members_user_id ON group_members (user_id);
+
+-- Nesting: the members of child_id are also members of parent_id. The
+-- repository keeps the graph acyclic and within one organization.
+CREATE TABLE group_subgroups (
+    parent_id  UUID         NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    child_id   UUID         NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (parent_id, child_id),
+    CONSTRAINT group_subgroups_self_check CHECK (parent_id <> child_id)
+);
+
+CREATE INDEX idx_group_subgroups_child_id ON group_subgroups (child_id);
+
+COMMENT ON TABLE groups IS 'Named sets of users within an organization';
+COMMENT ON TABLE group_members IS 'Direct group membership; owners manage the group';
+COMMENT ON TABLE group_subgroups IS 'Nested groups; members of the child are inherited by the parent';
@@ -0,0 +1,26 @@
+CREATE TABLE invitations (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email           VARCHAR(255)  NOT NULL,
+    role            VARCHAR(20)   NOT NULL DEFAULT 'user',
+    inviter_id      UUID          REFERENCES users (id) ON DELETE SET NULL,
+    token_hash      VARCHAR(64)   NOT NULL,
+    expires_at      TIMESTAMPTZ   NOT NULL,
+    sent_at         TIMESTAMPTZ   NOT NULL,
+    send_count      INTEGER       NOT NULL DEFAULT 1,
+    accepted_at     TIMESTAMPTZ,
+    user_id         UUID          REFERENCES users (id) ON DELETE SET NULL,
+    revoked_at      TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT invitations_role_check CHECK (role IN ('user', 'admin'))
+);
+
+-- At most one open invitation per email and organization
+CREATE UNIQUE INDEX invitations_organization_email_open_key ON invitations (organization_id, email)
+    WHERE accepted_at IS NULL AND revoked_at IS NULL;
+CREATE INDEX idx_invitations_organization_id ON invitations (organization_id, created_at DESC);
+
+COMMENT ON TABLE invitations IS 'Invitations to join an organization, accepted by setting a password';
+COMMENT ON COLUMN invitations.token_hash IS 'SHA-256 of the current invite token; resending replaces it';
+COMMENT ON COLUMN invitations.user_id IS 'Account created by accepting the invitation';
@@ -0,0 +1,3 @@
+ALTER TABLE invitations ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN invitations.locale IS 'Language of the invitation message; empty for the default';
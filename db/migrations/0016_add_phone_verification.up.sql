@@ -0,0 +1,24 @@
+ALTER TABLE users ADD COLUMN phone_verified_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN users.phone_verified_at IS 'When the current phone number was verified; cleared when it changes';
+
+CREATE TABLE one_time_codes (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id         UUID          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose         VARCHAR(50)   NOT NULL,
+    target          VARCHAR(255)  NOT NULL,
+    code_hash       VARCHAR(64)   NOT NULL,
+    expires_at      TIMESTAMPTZ   NOT NULL,
+    attempts        INTEGER       NOT NULL DEFAULT 0,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A user has at most one outstanding code per purpose; a new one replaces it
+CREATE UNIQUE INDEX one_time_codes_user_purpose_key ON one_time_codes (user_id, purpose);
+CREATE INDEX idx_one_time_codes_expires_at ON one_time_codes (expires_at);
+
+COMMENT ON TABLE one_time_codes IS 'Short-lived codes sent to users to prove they control a phone number or email';
+COMMENT ON COLUMN one_time_codes.target IS 'Phone number or email the code was sent to';
+COMMENT ON COLUMN one_time_codes.code_hash IS 'SHA-256 of the code; the code itself is never stored';
+COMMENT ON COLUMN one_time_codes.attempts IS 'Wrong guesses so far';
@@ -0,0 +1,69 @@
+CREATE TABLE oauth_clients (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name            VARCHAR(255)  NOT NULL,
+    secret_hash     VARCHAR(64)   NOT NULL DEFAULT '',
+    redirect_uris   TEXT[]        NOT NULL,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_clients_organization_id ON oauth_clients (organization_id, created_at);
+
+COMMENT ON TABLE oauth_clients IS 'Applications that sign users in through the OpenID Connect provider';
+COMMENT ON COLUMN oauth_clients.secret_hash IS 'SHA-256 of the client secret; empty for public clients, which rely on PKCE';
+COMMENT ON COLUMN oauth_clients.redirect_uris IS 'Registered redirect URIs, matched exactly';
+
+CREATE TABLE oauth_consents (
+    user_id         UUID          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id       UUID          NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    scope           TEXT          NOT NULL,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
+
+COMMENT ON TABLE oauth_consents IS 'Scopes each user has granted to each client';
+
+CREATE TABLE oauth_authorization_codes (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    client_id       UUID          NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id         UUID          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash       VARCHAR(64)   NOT NULL,
+    redirect_uri    TEXT          NOT NULL,
+    scope           TEXT          NOT NULL,
+    nonce           TEXT          NOT NULL DEFAULT '',
+    code_challenge  VARCHAR(128)  NOT NULL,
+    expires_at      TIMESTAMPTZ   NOT NULL,
+    used_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX oauth_authorization_codes_code_hash_key ON oauth_authorization_codes (code_hash);
+CREATE INDEX idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes (expires_at);
+
+COMMENT ON TABLE oauth_authorization_codes IS 'Single-use codes a client exchanges for tokens';
+COMMENT ON COLUMN oauth_authorization_codes.code_hash IS 'SHA-256 of the code; the code itself is never stored';
+COMMENT ON COLUMN oauth_authorization_codes.code_challenge IS 'PKCE S256 code challenge';
+COMMENT ON COLUMN oauth_authorization_codes.used_at IS 'When the code was exchanged; using it again revokes the tokens it issued';
+
+CREATE TABLE oauth_access_tokens (
+    id                    UUID          PRIMARY KEY,
+    organization_id       UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    client_id             UUID          NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id               UUID          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    authorization_code_id UUID          REFERENCES oauth_authorization_codes (id) ON DELETE SET NULL,
+    token_hash            VARCHAR(64)   NOT NULL,
+    scope                 TEXT          NOT NULL,
+    expires_at            TIMESTAMPTZ   NOT NULL,
+    revoked_at            TIMESTAMPTZ,
+    created_at            TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX oauth_access_tokens_token_hash_key ON oauth_access_tokens (token_hash);
+CREATE INDEX idx_oauth_access_tokens_authorization_code_id ON oauth_access_tokens (authorization_code_id);
+
+COMMENT ON TABLE oauth_access_tokens IS 'Opaque access tokens issued to clients for the userinfo endpoint';
+COMMENT ON COLUMN oauth_access_tokens.token_hash IS 'SHA-256 of the token; the token itself is never stored';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS federated_logins;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS identity_providers;
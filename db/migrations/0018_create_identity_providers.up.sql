@@ -0,0 +1,58 @@
+CREATE TABLE identity_providers (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    slug            VARCHAR(63)   NOT NULL,
+    name            VARCHAR(255)  NOT NULL,
+    issuer          TEXT          NOT NULL,
+    client_id       TEXT          NOT NULL,
+    client_secret   TEXT          NOT NULL DEFAULT '',
+    scopes          TEXT[]        NOT NULL,
+    provision_users BOOLEAN       NOT NULL DEFAULT FALSE,
+    link_by_email   BOOLEAN       NOT NULL DEFAULT FALSE,
+    enabled         BOOLEAN       NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT identity_providers_slug_check CHECK (slug ~ '^[a-z0-9]([a-z0-9-]*[a-z0-9])?$')
+);
+
+CREATE UNIQUE INDEX identity_providers_organization_slug_key ON identity_providers (organization_id, slug);
+
+COMMENT ON TABLE identity_providers IS 'External OpenID Providers the users of an organization can sign in with';
+COMMENT ON COLUMN identity_providers.client_secret IS 'Secret the service authenticates to the provider with; empty for public clients';
+COMMENT ON COLUMN identity_providers.provision_users IS 'Create an account on first sign-in when none has the verified email';
+COMMENT ON COLUMN identity_providers.link_by_email IS 'Link the account with the verified email on first sign-in';
+
+CREATE TABLE user_identities (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id         UUID          NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider_id     UUID          NOT NULL REFERENCES identity_providers (id) ON DELETE CASCADE,
+    subject         TEXT          NOT NULL,
+    email           VARCHAR(255)  NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at   TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX user_identities_provider_subject_key ON user_identities (provider_id, subject);
+CREATE UNIQUE INDEX user_identities_user_provider_key ON user_identities (user_id, provider_id);
+
+COMMENT ON TABLE user_identities IS 'External accounts linked to users, identified by provider and subject';
+COMMENT ON COLUMN user_identities.email IS 'Email the provider asserted when the identity was last used';
+
+CREATE TABLE federated_logins (
+    id              UUID          PRIMARY KEY,
+    organization_id UUID          NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    provider_id     UUID          NOT NULL REFERENCES identity_providers (id) ON DELETE CASCADE,
+    state_hash      VARCHAR(64)   NOT NULL,
+    nonce           TEXT          NOT NULL,
+    code_verifier   TEXT          NOT NULL,
+    expires_at      TIMESTAMPTZ   NOT NULL,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX federated_logins_state_hash_key ON federated_logins (state_hash);
+CREATE INDEX idx_federated_logins_expires_at ON federated_logins (expires_at);
+
+COMMENT ON TABLE federated_logins IS 'Sign-ins in progress at an identity provider, consumed by the callback';
+COMMENT ON COLUMN federated_logins.state_hash IS 'SHA-256 of the state parameter; the state itself is never stored';
+COMMENT ON COLUMN federated_logins.code_verifier IS 'PKCE code verifier sent with the authorization code';
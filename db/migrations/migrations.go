@@ -0,0 +1,12 @@
+// Package migrations embeds the versioned SQL schema migrations so they ship
+// inside the service binary.
+//
+// Files are named <version>_<name>.<up|down>.sql. A migration whose first
+// lines contain a "-- context: <name>" directive only runs when that context
+// is requested (for example the test seed data).
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionRegister       = "auth.register"
+	ActionLogin          = "auth.login"
+	ActionLoginFailed    = "auth.login_failed"
+	ActionLogout         = "auth.logout"
+	ActionPasswordReset  = "auth.password_reset"
+	ActionMagicLinkSent  = "auth.magic_link_sent"
+	ActionProfileUpdated = "user.profile_updated"
+	ActionUserCreated    = "user.created"
+	ActionUserUpdated    = "user.updated"
+	ActionUserDeleted    = "user.deleted"
+	ActionUserRestored   = "user.restored"
+
+	ActionPhoneVerificationSent = "user.phone_verification_sent"
+	ActionPhoneVerified         = "user.phone_verified"
+
+	ActionOrganizationCreated = "organization.created"
+	ActionOrganizationUpdated = "organization.updated"
+
+	ActionGroupCreated         = "group.created"
+	ActionGroupUpdated         = "group.updated"
+	ActionGroupDeleted         = "group.deleted"
+	ActionGroupMemberSet       = "group.member_set"
+	ActionGroupMemberRemoved   = "group.member_removed"
+	ActionGroupSubgroupAdded   = "group.subgroup_added"
+	ActionGroupSubgroupRemoved = "group.subgroup_removed"
+
+	ActionInvitationCreated  = "invitation.created"
+	ActionInvitationResent   = "invitation.resent"
+	ActionInvitationRevoked  = "invitation.revoked"
+	ActionInvitationAccepted = "invitation.accepted"
+
+	ActionOAuthClientCreated = "oauth_client.created"
+	ActionOAuthClientUpdated = "oauth_client.updated"
+	ActionOAuthClientDeleted = "oauth_client.deleted"
+	ActionOAuthAuthorized    = "oauth.authorized"
+	ActionOAuthDenied        = "oauth.denied"
+
+	ActionIdentityProviderCreated = "identity_provider.created"
+	ActionIdentityProviderUpdated = "identity_provider.updated"
+	ActionIdentityProviderDeleted = "identity_provider.deleted"
+	ActionIdentityLinked          = "user.identity_linked"
+	ActionIdentityUnlinked        = "user.identity_unlinked"
+)
+
+const (
+	redactedValue     = "[REDACTED]"
+	defaultQueryLimit = 50
+	maxQueryLimit     = 200
+)
+
+// sensitiveKeys are matched case-insensitively against field names; any field
+// containing one of them is redacted in diffs and metadata.
+var sensitiveKeys = []string{"password", "secret", "token", "hash", "authorization"}
+
+// Change is the before and after value of a single field
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Event is one entry in the audit log
+type Event struct {
+	ID             uuid.UUID              `json:"id"`
+	OccurredAt     time.Time              `json:"occurredAt"`
+	OrganizationID *uuid.UUID             `json:"organizationId,omitempty"`
+	ActorID        *uuid.UUID             `json:"actorId,omitempty"`
+	Action         string                 `json:"action"`
+	TargetUserID   *uuid.UUID             `json:"targetUserId,omitempty"`
+	IP             string                 `json:"ip"`
+	UserAgent      string                 `json:"userAgent"`
+	RequestID      string                 `json:"requestId,omitempty"`
+	Changes        map[string]Change      `json:"changes,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Recorder appends events to the audit log
+type Recorder interface {
+	Record(ctx context.Context, event *Event) error
+}
+
+// Filter narrows an audit log query. Zero values are ignored.
+type Filter struct {
+	OrganizationID *uuid.UUID
+	ActorID        *uuid.UUID
+	TargetUserID   *uuid.UUID
+	Action         string
+	RequestID      string
+	Since          time.Time
+	Until          time.Time
+	Limit          int
+	Cursor         string
+}
+
+// Page is one page of audit events, newest first
+type Page struct {
+	Events     []*Event `json:"events"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// Store records and queries audit events
+type Store interface {
+	Recorder
+	Query(ctx context.Context, filter Filter) (*Page, error)
+}
+
+// Nop discards every event. It is used when no audit store is configured.
+type Nop struct{}
+
+func (Nop) Record(ctx context.Context, event *Event) error { return nil }
+
+// Diff compares two snapshots and returns the fields whose values differ.
+// Sensitive fields are reported as changed without revealing their values.
+func Diff(before, after interface{}) map[string]Change {
+	b, a := toMap(before), toMap(after)
+
+	changes := map[string]Change{}
+	for key, beforeValue := range b {
+		afterValue, ok := a[key]
+		if !ok || !reflect.DeepEqual(beforeValue, afterValue) {
+			changes[key] = Change{Before: beforeValue, After: afterValue}
+		}
+	}
+	for key, afterValue := range a {
+		if _, ok := b[key]; !ok {
+			changes[key] = Change{Before: nil, After: afterValue}
+		}
+	}
+
+	for key := range changes {
+		if IsSensitive(key) {
+			changes[key] = RedactedChange()
+		}
+	}
+	return changes
+}
+
+// RedactedChange records that a sensitive field changed without its values
+func RedactedChange() Change {
+	return Change{Before: redactedValue, After: redactedValue}
+}
+
+// Redact returns a copy of metadata with sensitive values replaced
+func Redact(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		if IsSensitive(key) {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// IsSensitive reports whether a field name refers to a secret
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// toMap flattens a struct (or map) into its JSON field representation
+func toMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return m
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(data, &m)
+	return m
+}
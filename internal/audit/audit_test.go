@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	type snapshot struct {
+		Email        string  `json:"email"`
+		PhoneNumber  *string `json:"phoneNumber,omitempty"`
+		PasswordHash string  `json:"passwordHash"`
+	}
+	phone := "+14155552671"
+
+	before := snapshot{Email: "old@example.com", PasswordHash: "a"}
+	after := snapshot{Email: "new@example.com", PhoneNumber: &phone, PasswordHash: "b"}
+
+	changes := Diff(before, after)
+	assert.Equal(t, Change{Before: "old@example.com", After: "new@example.com"}, changes["email"])
+	assert.Equal(t, Change{Before: nil, After: phone}, changes["phoneNumber"])
+	assert.Equal(t, RedactedChange(), changes["passwordHash"])
+
+	assert.Empty(t, Diff(before, before))
+	assert.Len(t, Diff(nil, &after), 3)
+}
+
+func TestRedact(t *testing.T) {
+	redacted := Redact(map[string]interface{}{
+		"email":         "test@example.com",
+		"refresh_token": "abc",
+		"Authorization": "Bearer abc",
+	})
+	assert.Equal(t, "test@example.com", redacted["email"])
+	assert.Equal(t, redactedValue, redacted["refresh_token"])
+	assert.Equal(t, redactedValue, redacted["Authorization"])
+	assert.Nil(t, Redact(nil))
+}
+
+func TestCursor(t *testing.T) {
+	occurredAt := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	id := uuid.New()
+
+	gotTime, gotID, err := DecodeCursor(EncodeCursor(occurredAt, id))
+	require.NoError(t, err)
+	assert.True(t, occurredAt.Equal(gotTime))
+	assert.Equal(t, id, gotID)
+
+	for _, cursor := range []string{"!!!", "bm8tc2VwYXJhdG9y", EncodeCursor(occurredAt, id)[:10]} {
+		_, _, err := DecodeCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
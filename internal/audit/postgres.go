@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidCursor is returned by Query when the pagination cursor is malformed
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PostgresStore keeps the audit log in the audit_log table
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresStore creates an audit store on top of an existing connection pool
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+type eventRow struct {
+	ID             uuid.UUID  `db:"id"`
+	OccurredAt     time.Time  `db:"occurred_at"`
+	OrganizationID *uuid.UUID `db:"organization_id"`
+	ActorID        *uuid.UUID `db:"actor_id"`
+	Action         string     `db:"action"`
+	TargetUserID   *uuid.UUID `db:"target_user_id"`
+	IP             string     `db:"ip"`
+	UserAgent      string     `db:"user_agent"`
+	RequestID      string     `db:"request_id"`
+	Changes        []byte     `db:"changes"`
+	Metadata       []byte     `db:"metadata"`
+}
+
+// Record appends an event. ID and OccurredAt are filled in when unset.
+func (s *PostgresStore) Record(ctx context.Context, event *Event) error {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	changes, err := json.Marshal(nonNilChanges(event.Changes))
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(nonNilMetadata(Redact(event.Metadata)))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (id, occurred_at, organization_id, actor_id, action, target_user_id, ip, user_agent, request_id, changes, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, event.ID, event.OccurredAt, event.OrganizationID, event.ActorID, event.Action, event.TargetUserID,
+		event.IP, event.UserAgent, event.RequestID, changes, metadata)
+	return err
+}
+
+// Query returns events matching filter, newest first, one page at a time
+func (s *PostgresStore) Query(ctx context.Context, filter Filter) (*Page, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, values ...interface{}) {
+		for _, v := range values {
+			args = append(args, v)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.OrganizationID != nil {
+		add("organization_id = ?", *filter.OrganizationID)
+	}
+	if filter.ActorID != nil {
+		add("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetUserID != nil {
+		add("target_user_id = ?", *filter.TargetUserID)
+	}
+	if filter.Action != "" {
+		add("action = ?", filter.Action)
+	}
+	if filter.RequestID != "" {
+		add("request_id = ?", filter.RequestID)
+	}
+	if !filter.Since.IsZero() {
+		add("occurred_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("occurred_at < ?", filter.Until)
+	}
+	if filter.Cursor != "" {
+		occurredAt, id, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		add("(occurred_at, id) < (?, ?)", occurredAt, id)
+	}
+
+	query := "SELECT * FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(" ORDER BY occurred_at DESC, id DESC LIMIT %d", limit+1)
+
+	rows := []eventRow{}
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	page := &Page{Events: make([]*Event, 0, len(rows))}
+	for i, row := range rows {
+		if i == limit {
+			last := page.Events[limit-1]
+			page.NextCursor = EncodeCursor(last.OccurredAt, last.ID)
+			break
+		}
+		event := &Event{
+			ID:             row.ID,
+			OccurredAt:     row.OccurredAt,
+			OrganizationID: row.OrganizationID,
+			ActorID:        row.ActorID,
+			Action:         row.Action,
+			TargetUserID:   row.TargetUserID,
+			IP:             row.IP,
+			UserAgent:      row.UserAgent,
+			RequestID:      row.RequestID,
+		}
+		if err := json.Unmarshal(row.Changes, &event.Changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(row.Metadata, &event.Metadata); err != nil {
+			return nil, err
+		}
+		page.Events = append(page.Events, event)
+	}
+	return page, nil
+}
+
+// EncodeCursor builds an opaque pagination cursor pointing after the given event
+func EncodeCursor(occurredAt time.Time, id uuid.UUID) string {
+	raw := occurredAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor
+func DecodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	occurredAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return occurredAt, id, nil
+}
+
+func nonNilChanges(changes map[string]Change) map[string]Change {
+	if changes == nil {
+		return map[string]Change{}
+	}
+	return changes
+}
+
+func nonNilMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return map[string]interface{}{}
+	}
+	return metadata
+}
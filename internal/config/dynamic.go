@@ -0,0 +1,55 @@
+package config
+
+import "reflect"
+
+// dynamicKeys are the settings that can change while the service is running.
+// Everything else is only read at startup.
+var dynamicKeys = map[string]bool{
+	"cors_allowed_origins": true,
+	"cors_allowed_headers": true,
+	"cors_allowed_methods": true,
+	"cors_exposed_headers": true,
+	"cors_max_age":         true,
+	"rate_limit_rps":       true,
+	"rate_limit_burst":     true,
+	"log_level":            true,
+	"jwt_secret":           true,
+	"jwt_previous_secrets": true,
+}
+
+// IsDynamic reports whether the setting named key can be reloaded
+func IsDynamic(key string) bool {
+	return dynamicKeys[key]
+}
+
+// Changed lists the settings whose values differ between c and other
+func (c *Config) Changed(other *Config) []string {
+	theirs := map[string]interface{}{}
+	for _, setting := range other.Settings() {
+		theirs[setting.Key] = setting.Value
+	}
+
+	var changed []string
+	for _, setting := range c.Settings() {
+		if !reflect.DeepEqual(setting.Value, theirs[setting.Key]) {
+			changed = append(changed, setting.Key)
+		}
+	}
+	return changed
+}
+
+// WithDynamic returns a copy of c with the dynamic settings taken from other
+func (c *Config) WithDynamic(other *Config) *Config {
+	merged := *c
+	merged.CORSAllowedOrigins = other.CORSAllowedOrigins
+	merged.CORSAllowedHeaders = other.CORSAllowedHeaders
+	merged.CORSAllowedMethods = other.CORSAllowedMethods
+	merged.CORSExposedHeaders = other.CORSExposedHeaders
+	merged.CORSMaxAge = other.CORSMaxAge
+	merged.RateLimitRPS = other.RateLimitRPS
+	merged.RateLimitBurst = other.RateLimitBurst
+	merged.LogLevel = other.LogLevel
+	merged.JWTSecret = other.JWTSecret
+	merged.JWTPreviousSecrets = other.JWTPreviousSecrets
+	return &merged
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces secret values in printed configuration
+const Redacted = "[REDACTED]"
+
+// Setting is one resolved configuration value, named as in a config file
+type Setting struct {
+	Key    string
+	Value  interface{}
+	Secret bool
+}
+
+// Settings lists every resolved value in config file order
+func (c *Config) Settings() []Setting {
+	return []Setting{
+		{Key: "environment", Value: c.Environment},
+		{Key: "insecure_dev_mode", Value: c.InsecureDevMode},
+		{Key: "port", Value: c.Port},
+		{Key: "metrics_port", Value: c.MetricsPort},
+		{Key: "grpc_port", Value: c.GRPCPort},
+		{Key: "shutdown_timeout", Value: c.ShutdownTimeout.String()},
+		{Key: "shutdown_drain_delay", Value: c.ShutdownDrainDelay.String()},
+		{Key: "health_check_timeout", Value: c.HealthCheckTimeout.String()},
+		{Key: "database_url", Value: c.DatabaseURL, Secret: true},
+		{Key: "database_max_open_conns", Value: c.DBMaxOpenConns},
+		{Key: "database_max_idle_conns", Value: c.DBMaxIdleConns},
+		{Key: "database_conn_max_lifetime", Value: c.DBConnMaxLifetime.String()},
+		{Key: "database_connect_timeout", Value: c.DBConnectTimeout.String()},
+		{Key: "database_connect_backoff", Value: c.DBConnectBackoff.String()},
+		{Key: "database_connect_max_backoff", Value: c.DBConnectMaxBackoff.String()},
+		{Key: "jwt_secret", Value: c.JWTSecret, Secret: true},
+		{Key: "jwt_previous_secrets", Value: c.JWTPreviousSecrets, Secret: true},
+		{Key: "access_token_ttl", Value: c.AccessTokenTTL.String()},
+		{Key: "jwt_group_claims", Value: c.JWTGroupClaims},
+		{Key: "bcrypt_cost", Value: c.BcryptCost},
+		{Key: "invitation_ttl", Value: c.InvitationTTL.String()},
+		{Key: "invitation_url", Value: c.InvitationURL},
+		{Key: "notify_transport", Value: c.NotifyTransport},
+		{Key: "notify_from", Value: c.NotifyFrom},
+		{Key: "notify_file", Value: c.NotifyFile},
+		{Key: "notify_queue_size", Value: c.NotifyQueueSize},
+		{Key: "notify_max_attempts", Value: c.NotifyMaxAttempts},
+		{Key: "smtp_host", Value: c.SMTPHost},
+		{Key: "smtp_port", Value: c.SMTPPort},
+		{Key: "smtp_username", Value: c.SMTPUsername},
+		{Key: "smtp_password", Value: c.SMTPPassword, Secret: true},
+		{Key: "sms_transport", Value: c.SMSTransport},
+		{Key: "sms_gateway_url", Value: c.SMSGatewayURL},
+		{Key: "sms_gateway_token", Value: c.SMSGatewayToken, Secret: true},
+		{Key: "sms_from", Value: c.SMSFrom},
+		{Key: "phone_verification_code_ttl", Value: c.PhoneCodeTTL.String()},
+		{Key: "phone_verification_max_attempts", Value: c.PhoneCodeMaxAttempts},
+		{Key: "phone_verification_resend_interval", Value: c.PhoneCodeResendInterval.String()},
+		{Key: "magic_link_ttl", Value: c.MagicLinkTTL.String()},
+		{Key: "magic_link_url", Value: c.MagicLinkURL},
+		{Key: "magic_link_max_attempts", Value: c.MagicLinkMaxAttempts},
+		{Key: "magic_link_resend_interval", Value: c.MagicLinkResendInterval.String()},
+		{Key: "oidc_issuer", Value: c.OIDCIssuer},
+		{Key: "oidc_signing_key", Value: c.OIDCSigningKey, Secret: true},
+		{Key: "oidc_consent_url", Value: c.OIDCConsentURL},
+		{Key: "oidc_code_ttl", Value: c.OIDCCodeTTL.String()},
+		{Key: "oidc_access_token_ttl", Value: c.OIDCAccessTokenTTL.String()},
+		{Key: "sso_callback_url", Value: c.SSOCallbackURL},
+		{Key: "sso_login_ttl", Value: c.SSOLoginTTL.String()},
+		{Key: "cors_allowed_origins", Value: c.CORSAllowedOrigins},
+		{Key: "cors_allowed_headers", Value: c.CORSAllowedHeaders},
+		{Key: "cors_allowed_methods", Value: c.CORSAllowedMethods},
+		{Key: "cors_exposed_headers", Value: c.CORSExposedHeaders},
+		{Key: "cors_max_age", Value: c.CORSMaxAge.String()},
+		{Key: "rate_limit_rps", Value: c.RateLimitRPS},
+		{Key: "rate_limit_burst", Value: c.RateLimitBurst},
+		{Key: "trusted_proxies", Value: c.TrustedProxies},
+		{Key: "config_watch_interval", Value: c.ConfigWatchInterval.String()},
+		{Key: "soft_delete_retention", Value: c.SoftDeleteRetention.String()},
+		{Key: "purge_interval", Value: c.PurgeInterval.String()},
+		{Key: "webhook_max_attempts", Value: c.WebhookMaxAttempts},
+		{Key: "webhook_poll_interval", Value: c.WebhookPollInterval.String()},
+		{Key: "webhook_timeout", Value: c.WebhookTimeout.String()},
+		{Key: "outbox_poll_interval", Value: c.OutboxPollInterval.String()},
+		{Key: "outbox_max_lag", Value: c.OutboxMaxLag.String()},
+		{Key: "tracing_exporter", Value: c.TracingExporter},
+		{Key: "tracing_otlp_endpoint", Value: c.TracingOTLPEndpoint},
+		{Key: "tracing_otlp_insecure", Value: c.TracingOTLPInsecure},
+		{Key: "tracing_file", Value: c.TracingFile},
+		{Key: "tracing_sample_ratio", Value: c.TracingSampleRatio},
+		{Key: "log_format", Value: c.LogFormat},
+		{Key: "log_level", Value: c.LogLevel.String()},
+	}
+}
+
+// Print writes the configuration as YAML that LoadFile accepts. With redacted
+// set, secrets are replaced; a database URL keeps everything but its
+// password, which is masked.
+func (c *Config) Print(w io.Writer, redacted bool) error {
+	for _, setting := range c.Settings() {
+		value := setting.Value
+		if redacted && setting.Secret {
+			value = redact(setting.Key, value)
+		}
+		out, err := yaml.Marshal(map[string]interface{}{setting.Key: value})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func redact(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return ""
+		}
+		// Keep the host and database of a URL, which are useful when
+		// debugging; url.Redacted masks only the password
+		if u, err := url.Parse(v); key == "database_url" && err == nil && u.Scheme != "" && u.Host != "" {
+			return u.Redacted()
+		}
+	case []string:
+		redacted := make([]string, len(v))
+		for i := range v {
+			redacted[i] = Redacted
+		}
+		return redacted
+	}
+	return Redacted
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// source resolves settings from, in order of precedence, the environment
+// (KEY or KEY_FILE) and the config file (key or key_file), and collects
+// every problem it finds so they can be reported together.
+type source struct {
+	file map[string]string
+	// used records which file keys were looked up, to reject unknown ones
+	used map[string]bool
+	errs []error
+}
+
+func newSource(path string) (*source, error) {
+	s := &source{file: map[string]string{}, used: map[string]bool{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := flatten("", raw, s.file); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// flatten turns nested sections into underscore-joined keys, so that
+// database: {url: ...} and database_url: ... mean the same thing
+func flatten(prefix string, raw map[string]interface{}, out map[string]string) error {
+	for key, value := range raw {
+		key = strings.ToLower(key)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := flatten(key, v, out); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// lookup returns the raw value of the setting named by the environment
+// variable key, and whether it was set anywhere
+func (s *source) lookup(key string) (string, bool) {
+	fileKey := strings.ToLower(key)
+	s.used[fileKey] = true
+	s.used[fileKey+"_file"] = true
+
+	value, ok, err := fromEnvOrSecret(key, os.Getenv(key), os.Getenv(key+"_FILE"))
+	if !ok && err == nil {
+		value, ok, err = fromEnvOrSecret(fileKey, s.file[fileKey], s.file[fileKey+"_file"])
+	}
+	if err != nil {
+		s.errs = append(s.errs, err)
+	}
+	return value, ok
+}
+
+// fromEnvOrSecret picks between a literal value and a path to a file holding
+// it, as mounted by Docker and Kubernetes secrets
+func fromEnvOrSecret(key, value, path string) (string, bool, error) {
+	if value != "" && path != "" {
+		return "", false, fmt.Errorf("%s and %s_FILE are mutually exclusive", strings.ToUpper(key), strings.ToUpper(key))
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", strings.ToUpper(key), err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+	return value, value != "", nil
+}
+
+func (s *source) fail(format string, args ...interface{}) {
+	s.errs = append(s.errs, fmt.Errorf(format, args...))
+}
+
+// err reports every problem found, including file keys nothing asked for
+func (s *source) err() error {
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		s.fail("unknown setting %q in config file", key)
+	}
+	return errors.Join(s.errs...)
+}
+
+func (s *source) string(key, fallback string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// oneOf reads a string that must be one of allowed
+func (s *source) oneOf(key, fallback string, allowed ...string) string {
+	value := s.string(key, fallback)
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	s.fail("%s must be one of %s", key, strings.Join(allowed, ", "))
+	return fallback
+}
+
+// duration reads a positive time.Duration such as "720h"
+func (s *source) duration(key string, fallback time.Duration) time.Duration {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		s.fail("%s must be a positive duration such as \"720h\"", key)
+		return fallback
+	}
+	return d
+}
+
+// durationOrZero reads a time.Duration that may also be 0, meaning off
+func (s *source) durationOrZero(key string, fallback time.Duration) time.Duration {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		s.fail("%s must be a duration such as \"10s\", or 0 to disable", key)
+		return fallback
+	}
+	return d
+}
+
+// int reads a positive integer
+func (s *source) int(key string, fallback int) int {
+	return s.intBetween(key, fallback, 1, int(^uint(0)>>1), "%s must be a positive integer")
+}
+
+// port reads a TCP port number
+func (s *source) port(key string, fallback int) int {
+	return s.intBetween(key, fallback, 1, 65535, "%s must be a port between 1 and 65535")
+}
+
+// portString reads a TCP port number that is used as a string
+func (s *source) portString(key, fallback string) string {
+	value := s.string(key, fallback)
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		s.fail("%s must be a port between 1 and 65535", key)
+		return fallback
+	}
+	return value
+}
+
+func (s *source) intBetween(key string, fallback, min, max int, message string) int {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		s.fail(message, key)
+		return fallback
+	}
+	return n
+}
+
+func (s *source) float(key string, fallback float64) float64 {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		s.fail("%s must be a number", key)
+		return fallback
+	}
+	return f
+}
+
+func (s *source) bool(key string, fallback bool) bool {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		s.fail("%s must be true or false", key)
+		return fallback
+	}
+	return b
+}
+
+// list reads a comma separated list
+func (s *source) list(key string, fallback []string) []string {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
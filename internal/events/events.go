@@ -0,0 +1,63 @@
+// Package events defines the user lifecycle events published to other
+// systems.
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	UserRegistered     = "user.registered"
+	UserPhoneVerified  = "user.phone_verified"
+	UserProfileUpdated = "user.profile_updated"
+	UserDeleted        = "user.deleted"
+	UserRestored       = "user.restored"
+)
+
+// Types lists every event type subscribers may ask for
+var Types = []string{
+	UserRegistered,
+	UserPhoneVerified,
+	UserProfileUpdated,
+	UserDeleted,
+	UserRestored,
+}
+
+// IsValidType reports whether eventType is a known event type
+func IsValidType(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a single domain event. ID is unique per event and lets consumers
+// discard duplicates. OrganizationID is the organization the event happened
+// in; only that organization's webhook subscriptions receive it.
+type Event struct {
+	ID             uuid.UUID       `json:"id"`
+	Type           string          `json:"type"`
+	OrganizationID uuid.UUID       `json:"organizationId"`
+	OccurredAt     time.Time       `json:"occurredAt"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// New creates an event of the given type with data encoded as JSON
+func New(eventType string, data interface{}) (*Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		ID:         uuid.New(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       raw,
+	}, nil
+}
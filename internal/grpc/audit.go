@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// recordAudit fills in the call details of event and appends it to the
+// audit log, like the REST handlers do. Failures are logged but never fail
+// the call.
+func (s *Server) recordAudit(ctx context.Context, event *audit.Event) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		event.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(event.IP); err == nil {
+			event.IP = host
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			event.UserAgent = values[0]
+		}
+	}
+	event.RequestID = logging.RequestID(ctx)
+	if event.ActorID == nil {
+		if id, err := callerID(ctx); err == nil {
+			event.ActorID = &id
+		}
+	}
+	if event.OrganizationID == nil {
+		if organizationID, ok := tenant.Organization(ctx); ok {
+			event.OrganizationID = &organizationID
+		}
+	}
+
+	if err := s.auditor.Record(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit event", "action", event.Action, "error", err)
+	}
+}
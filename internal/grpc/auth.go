@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadataKey is the metadata key carrying the caller's access
+// token as "Bearer {token}", the same token the REST API accepts
+const AuthorizationMetadataKey = "authorization"
+
+type claimsKey struct{}
+
+// authInterceptor is the gRPC counterpart of middleware.AuthMiddleware: it
+// rejects calls without a valid bearer token signed with one of keys and puts
+// the token's claims in the handler's context.
+func authInterceptor(keys *middleware.JWTKeys) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var header string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(AuthorizationMetadataKey); len(values) > 0 {
+				header = values[0]
+			}
+		}
+		if header == "" {
+			return nil, status.Error(codes.Unauthenticated, "authorization metadata is required")
+		}
+		parts := strings.Split(header, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil, status.Error(codes.Unauthenticated, "authorization metadata format must be Bearer {token}")
+		}
+
+		claims, err := middleware.ValidateToken(parts[1], keys.Verification()...)
+		if err != nil {
+			slog.InfoContext(ctx, "Token validation failed", "method", info.FullMethod, "error", err)
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+		}
+
+		ctx = context.WithValue(ctx, claimsKey{}, claims)
+		return handler(logging.WithUserID(ctx, claims.UserID), req)
+	}
+}
+
+// callerClaims returns the claims of the caller's access token
+func callerClaims(ctx context.Context) (*middleware.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*middleware.Claims)
+	return claims, ok
+}
+
+// callerID returns the authenticated caller's user ID
+func callerID(ctx context.Context) (uuid.UUID, error) {
+	claims, ok := callerClaims(ctx)
+	if !ok {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	id, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "invalid user ID in token")
+	}
+	return id, nil
+}
+
+// isAdmin reports whether the user has the admin role. Like
+// middleware.RequireAdmin, the role is looked up on every call so that
+// demoting an admin takes effect immediately.
+func (s *Server) isAdmin(ctx context.Context, userID uuid.UUID) bool {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	return err == nil && user.Role == models.RoleAdmin
+}
+
+// requireSelfOrAdmin lets the caller act on their own account, or on any
+// account if they are an admin
+func (s *Server) requireSelfOrAdmin(ctx context.Context, userID uuid.UUID) error {
+	caller, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	if caller == userID || s.isAdmin(ctx, caller) {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "admin role required")
+}
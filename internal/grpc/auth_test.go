@@ -0,0 +1,285 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+	pb "github.com/atulsm/user-service/proto"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// memoryUsers implements the user lookups and patches the RPCs under test
+// make; every other method panics
+type memoryUsers struct {
+	repository.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func (m *memoryUsers) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryUsers) PatchUser(ctx context.Context, id uuid.UUID, patch *models.UserPatch, expectedVersion int64) (*models.User, *models.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return nil, nil, repository.ErrUserNotFound
+	}
+	before := *user
+	if patch.Email.Set {
+		user.Email = patch.Email.Value
+	}
+	user.Version++
+	after := *user
+	return &before, &after, nil
+}
+
+// recordingAuditor collects audit events in memory
+type recordingAuditor struct {
+	events []*audit.Event
+}
+
+func (r *recordingAuditor) Record(ctx context.Context, event *audit.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func bearer(t *testing.T, keys *middleware.JWTKeys, userID uuid.UUID) context.Context {
+	t.Helper()
+	token, err := middleware.NewTokenGenerator(keys, time.Hour).GenerateToken(userID.String(), tenant.DefaultOrganizationID.String())
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error: %v", err)
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationMetadataKey, "Bearer "+token))
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	keys := middleware.NewJWTKeys("secret")
+	userID := uuid.New()
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUsers"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return callerID(ctx)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{name: "no metadata", ctx: context.Background(), want: codes.Unauthenticated},
+		{
+			name: "malformed header",
+			ctx:  metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationMetadataKey, "Token abc")),
+			want: codes.Unauthenticated,
+		},
+		{name: "token signed with another secret", ctx: bearer(t, middleware.NewJWTKeys("other"), userID), want: codes.Unauthenticated},
+		{name: "valid token", ctx: bearer(t, keys, userID), want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := authInterceptor(keys)(tt.ctx, nil, info, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("authInterceptor() code = %v, want %v (%v)", got, tt.want, err)
+			}
+			if err == nil && resp != userID {
+				t.Errorf("caller = %v, want %v", resp, userID)
+			}
+		})
+	}
+}
+
+func TestUpdateUserAuthorization(t *testing.T) {
+	keys := middleware.NewJWTKeys("secret")
+	admin := &models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.RoleAdmin}
+	member := &models.User{ID: uuid.New(), Email: "member@example.com", Role: models.RoleUser}
+	target := &models.User{ID: uuid.New(), Email: "target@example.com", Role: models.RoleUser}
+	users := &memoryUsers{users: map[uuid.UUID]*models.User{admin.ID: admin, member.ID: member, target.ID: target}}
+	auditor := &recordingAuditor{}
+	s := NewServer(users, nil, keys, auditor)
+
+	call := func(caller uuid.UUID, email string) error {
+		_, err := authInterceptor(keys)(bearer(t, keys, caller), &pb.UpdateUserRequest{
+			User:       &pb.User{Id: target.ID.String(), Email: email},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+		}, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			ctx = tenant.WithOrganization(ctx, tenant.DefaultOrganizationID)
+			return s.UpdateUser(ctx, req.(*pb.UpdateUserRequest))
+		})
+		return err
+	}
+
+	if err := call(member.ID, "stolen@example.com"); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("UpdateUser() by another member = %v, want PermissionDenied", err)
+	}
+	if target.Email != "target@example.com" || len(auditor.events) != 0 {
+		t.Fatalf("a denied update changed the user or was audited")
+	}
+
+	if err := call(target.ID, "self@example.com"); err != nil {
+		t.Fatalf("UpdateUser() by the user = %v", err)
+	}
+	if err := call(admin.ID, "admin-set@example.com"); err != nil {
+		t.Fatalf("UpdateUser() by an admin = %v", err)
+	}
+
+	if len(auditor.events) != 2 {
+		t.Fatalf("recorded %d audit events, want 2", len(auditor.events))
+	}
+	event := auditor.events[1]
+	if event.Action != audit.ActionUserUpdated || *event.ActorID != admin.ID || *event.TargetUserID != target.ID {
+		t.Errorf("audit event = %+v, want a user update of the target by the admin", event)
+	}
+	if change := event.Changes["email"]; change.Before != "self@example.com" || change.After != "admin-set@example.com" {
+		t.Errorf("audit email change = %+v", change)
+	}
+}
+
+func TestTenantInterceptorUsesTokenOrganization(t *testing.T) {
+	keys := middleware.NewJWTKeys("secret")
+	organizationID := uuid.New()
+	token, err := middleware.NewTokenGenerator(keys, time.Hour).GenerateToken(uuid.New().String(), organizationID.String())
+	if err != nil {
+		t.Fatalf("GenerateToken() unexpected error: %v", err)
+	}
+	// Metadata naming another organization is ignored
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		AuthorizationMetadataKey, "Bearer "+token,
+		"x-organization-id", tenant.DefaultOrganizationID.String(),
+	))
+
+	resp, err := authInterceptor(keys)(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return tenantInterceptor(ctx, req, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return tenant.Require(ctx)
+		})
+	})
+	if err != nil {
+		t.Fatalf("tenantInterceptor() unexpected error: %v", err)
+	}
+	if resp != organizationID {
+		t.Errorf("organization = %v, want %v", resp, organizationID)
+	}
+
+	if _, err := tenantInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, nil); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("tenantInterceptor() without claims = %v, want Unauthenticated", err)
+	}
+}
+
+// memoryGroups implements the group calls the authorization tests make
+type memoryGroups struct {
+	repository.GroupRepository
+	owners  map[uuid.UUID]uuid.UUID
+	updated int
+	removed int
+}
+
+func (m *memoryGroups) CreateGroup(ctx context.Context, group *models.Group, ownerID uuid.UUID) error {
+	group.ID = uuid.New()
+	m.owners[group.ID] = ownerID
+	return nil
+}
+
+func (m *memoryGroups) GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error) {
+	if m.owners[groupID] != userID {
+		return nil, repository.ErrMemberNotFound
+	}
+	return &models.GroupMember{GroupID: groupID, UserID: userID, Role: models.GroupRoleOwner}, nil
+}
+
+func (m *memoryGroups) UpdateGroup(ctx context.Context, id uuid.UUID, req *models.UpdateGroupRequest) (*models.Group, error) {
+	m.updated++
+	return &models.Group{ID: id, Name: req.Name}, nil
+}
+
+func (m *memoryGroups) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	m.removed++
+	return nil
+}
+
+func TestGroupRPCAuthorization(t *testing.T) {
+	keys := middleware.NewJWTKeys("secret")
+	admin := &models.User{ID: uuid.New(), Role: models.RoleAdmin}
+	owner := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	member := &models.User{ID: uuid.New(), Role: models.RoleUser}
+	users := &memoryUsers{users: map[uuid.UUID]*models.User{admin.ID: admin, owner.ID: owner, member.ID: member}}
+	groups := &memoryGroups{owners: map[uuid.UUID]uuid.UUID{}}
+	s := NewServer(users, groups, keys, nil)
+
+	call := func(caller uuid.UUID, rpc func(ctx context.Context) (interface{}, error)) error {
+		_, err := authInterceptor(keys)(bearer(t, keys, caller), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return rpc(tenant.WithOrganization(ctx, tenant.DefaultOrganizationID))
+		})
+		return err
+	}
+	create := func(ownerID string) func(ctx context.Context) (interface{}, error) {
+		return func(ctx context.Context) (interface{}, error) {
+			return s.CreateGroup(ctx, &pb.CreateGroupRequest{Name: "ops", OwnerId: ownerID})
+		}
+	}
+
+	// Members can only create groups they own themselves
+	if err := call(member.ID, create(owner.ID.String())); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("CreateGroup() for another owner = %v, want PermissionDenied", err)
+	}
+	if err := call(owner.ID, create("")); err != nil {
+		t.Fatalf("CreateGroup() = %v", err)
+	}
+	if err := call(admin.ID, create(owner.ID.String())); err != nil {
+		t.Fatalf("CreateGroup() by an admin for another owner = %v", err)
+	}
+	var groupID uuid.UUID
+	for id := range groups.owners {
+		groupID = id
+	}
+	if groups.owners[groupID] != owner.ID {
+		t.Fatalf("group owner = %v, want %v", groups.owners[groupID], owner.ID)
+	}
+
+	update := func(ctx context.Context) (interface{}, error) {
+		return s.UpdateGroup(ctx, &pb.UpdateGroupRequest{Id: groupID.String(), Name: "platform"})
+	}
+	if err := call(member.ID, update); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("UpdateGroup() by a non-owner = %v, want PermissionDenied", err)
+	}
+	if err := call(owner.ID, update); err != nil {
+		t.Fatalf("UpdateGroup() by the owner = %v", err)
+	}
+	if err := call(admin.ID, update); err != nil {
+		t.Fatalf("UpdateGroup() by an admin = %v", err)
+	}
+	if groups.updated != 2 {
+		t.Errorf("updated %d times, want 2", groups.updated)
+	}
+
+	// Members may leave a group but not remove others
+	remove := func(userID uuid.UUID) func(ctx context.Context) (interface{}, error) {
+		return func(ctx context.Context) (interface{}, error) {
+			return s.RemoveGroupMember(ctx, &pb.RemoveGroupMemberRequest{GroupId: groupID.String(), UserId: userID.String()})
+		}
+	}
+	if err := call(member.ID, remove(owner.ID)); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("RemoveGroupMember() of another user = %v, want PermissionDenied", err)
+	}
+	if err := call(member.ID, remove(member.ID)); err != nil {
+		t.Fatalf("RemoveGroupMember() of the caller = %v", err)
+	}
+	if groups.removed != 1 {
+		t.Errorf("removed %d members, want 1", groups.removed)
+	}
+}
@@ -0,0 +1,299 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+	pb "github.com/atulsm/user-service/proto"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The group RPCs authorize like the REST GroupHandler: anyone may read groups
+// and create one, changing a group takes one of its owners or an admin.
+
+// CreateGroup creates a group owned by owner_id, which defaults to the
+// caller. Only admins may create groups owned by someone else.
+func (s *Server) CreateGroup(ctx context.Context, req *pb.CreateGroupRequest) (*pb.Group, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	ownerID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.OwnerId != "" {
+		if ownerID, err = parseUUID(req.OwnerId, "owner_id"); err != nil {
+			return nil, err
+		}
+		if err := s.requireSelfOrAdmin(ctx, ownerID); err != nil {
+			return nil, err
+		}
+	}
+
+	group := &models.Group{Name: req.Name, Description: req.Description}
+	if err := s.groupRepo.CreateGroup(ctx, group, ownerID); err != nil {
+		return nil, groupStatus(err, "failed to create group")
+	}
+	return groupToPB(group), nil
+}
+
+func (s *Server) GetGroup(ctx context.Context, req *pb.GetGroupRequest) (*pb.Group, error) {
+	id, err := parseUUID(req.Id, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.GetGroup(ctx, id)
+	if err != nil {
+		return nil, groupStatus(err, "failed to get group")
+	}
+	return groupToPB(group), nil
+}
+
+func (s *Server) ListGroups(ctx context.Context, req *pb.ListGroupsRequest) (*pb.ListGroupsResponse, error) {
+	groups, err := s.groupRepo.ListGroups(ctx, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, groupStatus(err, "failed to list groups")
+	}
+
+	resp := &pb.ListGroupsResponse{Groups: make([]*pb.Group, len(groups))}
+	for i, group := range groups {
+		resp.Groups[i] = groupToPB(group)
+	}
+	return resp, nil
+}
+
+func (s *Server) UpdateGroup(ctx context.Context, req *pb.UpdateGroupRequest) (*pb.Group, error) {
+	id, err := parseUUID(req.Id, "id")
+	if err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := s.requireGroupManager(ctx, id); err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.UpdateGroup(ctx, id, &models.UpdateGroupRequest{Name: req.Name, Description: req.Description})
+	if err != nil {
+		return nil, groupStatus(err, "failed to update group")
+	}
+	return groupToPB(group), nil
+}
+
+func (s *Server) DeleteGroup(ctx context.Context, req *pb.DeleteGroupRequest) (*pb.DeleteGroupResponse, error) {
+	id, err := parseUUID(req.Id, "id")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireGroupManager(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.DeleteGroup(ctx, id); err != nil {
+		return nil, groupStatus(err, "failed to delete group")
+	}
+	return &pb.DeleteGroupResponse{}, nil
+}
+
+func (s *Server) SetGroupMember(ctx context.Context, req *pb.SetGroupMemberRequest) (*pb.GroupMember, error) {
+	groupID, err := parseUUID(req.GroupId, "group_id")
+	if err != nil {
+		return nil, err
+	}
+	userID, err := parseUUID(req.UserId, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	role := req.Role
+	switch role {
+	case "":
+		role = models.GroupRoleMember
+	case models.GroupRoleOwner, models.GroupRoleMember:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "role must be %s or %s", models.GroupRoleOwner, models.GroupRoleMember)
+	}
+	if err := s.requireGroupManager(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	member, err := s.groupRepo.SetMember(ctx, groupID, userID, role)
+	if err != nil {
+		return nil, groupStatus(err, "failed to set group member")
+	}
+	return groupMemberToPB(member), nil
+}
+
+// RemoveGroupMember removes a user from a group. Members may always leave a
+// group themselves.
+func (s *Server) RemoveGroupMember(ctx context.Context, req *pb.RemoveGroupMemberRequest) (*pb.RemoveGroupMemberResponse, error) {
+	groupID, err := parseUUID(req.GroupId, "group_id")
+	if err != nil {
+		return nil, err
+	}
+	userID, err := parseUUID(req.UserId, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	if caller, err := callerID(ctx); err != nil || caller != userID {
+		if err := s.requireGroupManager(ctx, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.groupRepo.RemoveMember(ctx, groupID, userID); err != nil {
+		return nil, groupStatus(err, "failed to remove group member")
+	}
+	return &pb.RemoveGroupMemberResponse{}, nil
+}
+
+func (s *Server) ListGroupMembers(ctx context.Context, req *pb.ListGroupMembersRequest) (*pb.ListGroupMembersResponse, error) {
+	groupID, err := parseUUID(req.GroupId, "group_id")
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.groupRepo.ListMembers(ctx, groupID, req.Expand)
+	if err != nil {
+		return nil, groupStatus(err, "failed to list group members")
+	}
+
+	resp := &pb.ListGroupMembersResponse{Members: make([]*pb.GroupMember, len(members))}
+	for i, member := range members {
+		resp.Members[i] = groupMemberToPB(member)
+	}
+	return resp, nil
+}
+
+func (s *Server) ListUserGroups(ctx context.Context, req *pb.ListUserGroupsRequest) (*pb.ListUserGroupsResponse, error) {
+	userID, err := parseUUID(req.UserId, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, groupStatus(err, "failed to get user")
+	}
+
+	groups, err := s.groupRepo.ListUserGroups(ctx, userID, req.Expand)
+	if err != nil {
+		return nil, groupStatus(err, "failed to list user groups")
+	}
+
+	resp := &pb.ListUserGroupsResponse{Groups: make([]*pb.Group, len(groups))}
+	for i, group := range groups {
+		resp.Groups[i] = groupToPB(&group.Group)
+		resp.Groups[i].Role = group.Role
+		resp.Groups[i].Inherited = group.Inherited
+	}
+	return resp, nil
+}
+
+func (s *Server) AddSubgroup(ctx context.Context, req *pb.SubgroupRequest) (*pb.SubgroupResponse, error) {
+	parentID, childID, err := parseSubgroupRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireGroupManager(ctx, parentID); err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.AddSubgroup(ctx, parentID, childID); err != nil {
+		return nil, groupStatus(err, "failed to add subgroup")
+	}
+	return &pb.SubgroupResponse{}, nil
+}
+
+func (s *Server) RemoveSubgroup(ctx context.Context, req *pb.SubgroupRequest) (*pb.SubgroupResponse, error) {
+	parentID, childID, err := parseSubgroupRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireGroupManager(ctx, parentID); err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.RemoveSubgroup(ctx, parentID, childID); err != nil {
+		return nil, groupStatus(err, "failed to remove subgroup")
+	}
+	return &pb.SubgroupResponse{}, nil
+}
+
+// requireGroupManager is the counterpart of GroupHandler.canManage: the
+// caller must own the group or be an admin. The group itself may not exist;
+// the repository reports that afterwards.
+func (s *Server) requireGroupManager(ctx context.Context, groupID uuid.UUID) error {
+	caller, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	member, err := s.groupRepo.GetMember(ctx, groupID, caller)
+	if err == nil && member.Role == models.GroupRoleOwner {
+		return nil
+	}
+	if s.isAdmin(ctx, caller) {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "group owner or admin role required")
+}
+
+func parseSubgroupRequest(req *pb.SubgroupRequest) (parentID, childID uuid.UUID, err error) {
+	if parentID, err = parseUUID(req.ParentId, "parent_id"); err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if childID, err = parseUUID(req.ChildId, "child_id"); err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return parentID, childID, nil
+}
+
+// parseUUID parses an ID field, returning InvalidArgument if it is malformed
+func parseUUID(value, field string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid %s", field)
+	}
+	return id, nil
+}
+
+// groupStatus maps group repository errors to gRPC status codes
+func groupStatus(err error, msg string) error {
+	switch {
+	case errors.Is(err, repository.ErrGroupNotFound),
+		errors.Is(err, repository.ErrMemberNotFound),
+		errors.Is(err, repository.ErrSubgroupNotFound),
+		errors.Is(err, repository.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrGroupNameInUse):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, repository.ErrLastOwner),
+		errors.Is(err, repository.ErrGroupCycle):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func groupToPB(group *models.Group) *pb.Group {
+	return &pb.Group{
+		Id:             group.ID.String(),
+		OrganizationId: group.OrganizationID.String(),
+		Name:           group.Name,
+		Description:    group.Description,
+		CreatedAt:      group.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:      group.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+func groupMemberToPB(member *models.GroupMember) *pb.GroupMember {
+	return &pb.GroupMember{
+		GroupId:   member.GroupID.String(),
+		UserId:    member.UserID.String(),
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
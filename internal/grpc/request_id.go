@@ -0,0 +1,42 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/requestid"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDInterceptor is the gRPC counterpart of middleware.RequestID: it
+// adopts the caller's x-request-id metadata or generates one, puts it in the
+// handler's context and returns it in the response header metadata.
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var incoming string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestid.MetadataKey); len(values) > 0 {
+			incoming = values[0]
+		}
+	}
+	id := requestid.Resolve(incoming)
+
+	ctx = logging.WithRequestID(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestid.MetadataKey, id))
+	return handler(ctx, req)
+}
+
+// RequestIDUnaryClientInterceptor forwards the request ID carried by the
+// call's context in the x-request-id metadata, generating one if there is
+// none, so calls made while serving a request stay correlated with it.
+func RequestIDUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		id := logging.RequestID(ctx)
+		if id == "" {
+			id = requestid.New()
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, id)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
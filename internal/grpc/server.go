@@ -2,24 +2,48 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
 	"github.com/atulsm/user-service/internal/repository"
 	pb "github.com/atulsm/user-service/proto"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type Server struct {
 	pb.UnimplementedUserServiceServer
 	userRepo   repository.UserRepository
+	groupRepo  repository.GroupRepository
+	auditor    audit.Recorder
 	grpcServer *grpc.Server
 }
 
-func NewServer(userRepo repository.UserRepository) *Server {
+// NewServer creates the gRPC server. Every call must carry an access token
+// signed with one of keys, and writes are recorded with auditor.
+func NewServer(userRepo repository.UserRepository, groupRepo repository.GroupRepository, keys *middleware.JWTKeys, auditor audit.Recorder) *Server {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	grpcServer := grpc.NewServer(
+		// Continues W3C trace context from incoming metadata
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(requestIDInterceptor, metrics.UnaryServerInterceptor(), authInterceptor(keys), tenantInterceptor),
+	)
 	return &Server{
 		userRepo:   userRepo,
-		grpcServer: grpc.NewServer(),
+		groupRepo:  groupRepo,
+		auditor:    auditor,
+		grpcServer: grpcServer,
 	}
 }
 
@@ -60,6 +84,7 @@ func (s *Server) GetUsers(ctx context.Context, req *pb.GetUsersRequest) (*pb.Get
 			PhoneNumber: user.PhoneNumber.String,
 			CreatedAt:   user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 			UpdatedAt:   user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			Version:     user.Version,
 		}
 	}
 
@@ -70,3 +95,101 @@ func (s *Server) GetUsers(ctx context.Context, req *pb.GetUsersRequest) (*pb.Get
 		PageSize: req.PageSize,
 	}, nil
 }
+
+// UpdateUser applies a field mask update. Users may update their own
+// account; other accounts need the admin role.
+func (s *Server) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	if req.User == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	id, err := uuid.Parse(req.User.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user id")
+	}
+	if err := s.requireSelfOrAdmin(ctx, id); err != nil {
+		return nil, err
+	}
+
+	patch, err := patchFromMask(req.User, req.UpdateMask)
+	if err != nil {
+		return nil, err
+	}
+	if fieldErrors := patch.Validate(); fieldErrors != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid update: %v", fieldErrors)
+	}
+
+	before, user, err := s.userRepo.PatchUser(ctx, id, patch, req.ExpectedVersion)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return nil, status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return nil, status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, repository.ErrEmailInUse):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to update user: %v", err)
+	}
+	s.recordAudit(ctx, &audit.Event{
+		Action:       audit.ActionUserUpdated,
+		TargetUserID: &user.ID,
+		Changes:      audit.Diff(models.NewUserResponse(before), models.NewUserResponse(user)),
+	})
+
+	return &pb.User{
+		Id:          user.ID.String(),
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		PhoneNumber: user.PhoneNumber.String,
+		CreatedAt:   user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:   user.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		Version:     user.Version,
+	}, nil
+}
+
+// patchFromMask converts a field mask update into a merge patch. Without a
+// mask every non-empty field is updated; with a mask an empty value clears
+// the field.
+func patchFromMask(user *pb.User, mask *fieldmaskpb.FieldMask) (*models.UserPatch, error) {
+	fields := map[string]string{
+		"first_name":   user.FirstName,
+		"last_name":    user.LastName,
+		"email":        user.Email,
+		"phone_number": user.PhoneNumber,
+	}
+
+	var paths []string
+	if mask == nil || len(mask.Paths) == 0 {
+		for path, value := range fields {
+			if value != "" {
+				paths = append(paths, path)
+			}
+		}
+	} else {
+		paths = mask.Paths
+	}
+
+	patch := &models.UserPatch{}
+	for _, path := range paths {
+		value, ok := fields[path]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+
+		v := models.SetString(value)
+		if value == "" {
+			v = models.ClearString()
+		}
+		switch path {
+		case "first_name":
+			patch.FirstName = v
+		case "last_name":
+			patch.LastName = v
+		case "email":
+			patch.Email = v
+		case "phone_number":
+			patch.PhoneNumber = v
+		}
+	}
+	return patch, nil
+}
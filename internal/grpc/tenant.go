@@ -0,0 +1,23 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tenantInterceptor puts the organization of the caller's access token in the
+// handler's context, so repository calls are scoped to it. Like
+// middleware.AuthMiddleware it trusts nothing but the verified claims, so it
+// must run after authInterceptor.
+func tenantInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	claims, ok := callerClaims(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+	return handler(tenant.WithOrganization(ctx, claims.OrganizationID), req)
+}
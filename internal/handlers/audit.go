@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"log/slog"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// recordAudit records event on behalf of a user handler
+func (h *UserHandler) recordAudit(c *gin.Context, event *audit.Event) {
+	recordAudit(c, h.auditor, event)
+}
+
+// recordAudit fills in the request details of event and appends it to the
+// audit log. Failures are logged but never fail the request.
+func recordAudit(c *gin.Context, auditor audit.Recorder, event *audit.Event) {
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.RequestID = logging.RequestID(c.Request.Context())
+	if event.ActorID == nil {
+		event.ActorID = actorID(c)
+	}
+	if event.OrganizationID == nil {
+		if organizationID, ok := tenant.Organization(c.Request.Context()); ok {
+			event.OrganizationID = &organizationID
+		}
+	}
+
+	if err := auditor.Record(c.Request.Context(), event); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record audit event", "action", event.Action, "error", err)
+	}
+}
+
+// auditUserChange records a write to user, diffing the before and after state
+func (h *UserHandler) auditUserChange(c *gin.Context, action string, before, after *models.User) {
+	var target *models.User
+	var beforeSnapshot, afterSnapshot interface{}
+	if before != nil {
+		target = before
+		beforeSnapshot = newUserResponse(before)
+	}
+	if after != nil {
+		target = after
+		afterSnapshot = newUserResponse(after)
+	}
+	if target == nil {
+		return
+	}
+
+	h.recordAudit(c, &audit.Event{
+		Action:       action,
+		TargetUserID: &target.ID,
+		Changes:      audit.Diff(beforeSnapshot, afterSnapshot),
+	})
+}
+
+// actorID returns the authenticated user making the request, if any
+func actorID(c *gin.Context) *uuid.UUID {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return nil
+	}
+	id, err := uuid.Parse(userID.(string))
+	if err != nil {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AuditHandler exposes the audit log to admins
+type AuditHandler struct {
+	store audit.Store
+}
+
+func NewAuditHandler(store audit.Store) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// ListEvents returns audit events of the caller's organization newest first.
+// Supported query parameters: actor, target (user IDs), action, request
+// (request ID), since, until (RFC 3339), limit and cursor.
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	var filter audit.Filter
+
+	organizationID, err := tenant.Require(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return
+	}
+	filter.OrganizationID = &organizationID
+
+	for param, dest := range map[string]**uuid.UUID{"actor": &filter.ActorID, "target": &filter.TargetUserID} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid "+param+" ID"))
+				return
+			}
+			*dest = &id
+		}
+	}
+
+	for param, dest := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, param+" must be an RFC 3339 timestamp"))
+				return
+			}
+			*dest = t
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid limit"))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	filter.Action = c.Query("action")
+	filter.RequestID = c.Query("request")
+	filter.Cursor = c.Query("cursor")
+
+	page, err := h.store.Query(c.Request.Context(), filter)
+	if errors.Is(err, audit.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
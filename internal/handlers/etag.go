@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userETag returns the strong entity tag for a user, derived from its version
+func userETag(user *models.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// setUserETag adds the ETag header for user to the response
+func setUserETag(c *gin.Context, user *models.User) {
+	c.Header("ETag", userETag(user))
+}
+
+// parseETags splits an If-Match / If-None-Match header into its entity tags.
+// Weak tags are returned with their W/ prefix intact.
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// notModified handles If-None-Match for a GET. It writes 304 and returns true
+// when the client already has the current representation.
+func notModified(c *gin.Context, user *models.User) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	current := userETag(user)
+	for _, tag := range parseETags(header) {
+		// If-None-Match uses weak comparison
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			setUserETag(c, user)
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion resolves the If-Match header into the version a write must
+// be conditional on. It returns 0 when there is no precondition. When the
+// header cannot match the current user it writes 412 and returns ok=false.
+func (h *UserHandler) expectedVersion(c *gin.Context, current func() (*models.User, error)) (version int64, ok bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	var versions []int64
+	for _, tag := range parseETags(header) {
+		if tag == "*" {
+			// Matches any current representation; existence is checked by the write
+			return 0, true
+		}
+		// If-Match requires strong comparison, so weak tags never match
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if v, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		preconditionFailed(c)
+		return 0, false
+	case 1:
+		return versions[0], true
+	}
+
+	// Several candidate tags: the write is conditional on whichever is current
+	user, err := current()
+	if err != nil {
+		preconditionFailed(c)
+		return 0, false
+	}
+	for _, v := range versions {
+		if v == user.Version {
+			return v, true
+		}
+	}
+	preconditionFailed(c)
+	return 0, false
+}
+
+func preconditionFailed(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, middleware.ErrorBody(c, "precondition failed: user has been modified"))
+}
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/oidc"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNoLinkedAccount is a verified sign-in at a provider that no account
+// is, or may be, linked to
+var errNoLinkedAccount = errors.New("no account is linked to this identity")
+
+// FederationSettings controls sign-in with external identity providers
+type FederationSettings struct {
+	// CallbackURL is the page providers send users back to, registered as
+	// the redirect URI at every provider. It posts the code and state to
+	// the callback endpoint.
+	CallbackURL string
+	// LoginTTL is how long a user may take to sign in at a provider
+	LoginTTL time.Duration
+}
+
+// federation holds what a UserHandler needs for sign-in with identity
+// providers
+type federation struct {
+	identities repository.IdentityRepository
+	rp         *oidc.RelyingParty
+	settings   FederationSettings
+}
+
+// WithFederation lets users sign in with the external OpenID Providers
+// their organization configured, linking or creating accounts on first
+// sign-in as each provider allows
+func WithFederation(identities repository.IdentityRepository, rp *oidc.RelyingParty, settings FederationSettings) Option {
+	return func(h *UserHandler) {
+		h.federation = &federation{identities: identities, rp: rp, settings: settings}
+	}
+}
+
+// ListSignInProviders returns the enabled identity providers of the
+// organization query parameter, for the sign-in page. An unknown
+// organization has none.
+func (h *UserHandler) ListSignInProviders(c *gin.Context) {
+	if !h.requireFederation(c) {
+		return
+	}
+	providers := []models.SignInProvider{}
+	err := h.enterOrganization(c, c.Query("organization"))
+	if errors.Is(err, repository.ErrOrganizationNotFound) {
+		c.JSON(http.StatusOK, gin.H{"providers": providers})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	enabled, err := h.federation.identities.ListProviders(c.Request.Context(), true, 100, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	for _, provider := range enabled {
+		providers = append(providers, models.SignInProvider{Slug: provider.Slug, Name: provider.Name})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+// StartFederatedLogin begins a sign-in at an identity provider and returns
+// where to send the browser. The state, nonce and PKCE verifier are kept
+// until the provider sends the user back.
+func (h *UserHandler) StartFederatedLogin(c *gin.Context) {
+	if !h.requireFederation(c) {
+		return
+	}
+	var req models.FederatedLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	err := h.enterOrganization(c, req.Organization)
+	if errors.Is(err, repository.ErrOrganizationNotFound) {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, repository.ErrIdentityProviderNotFound.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	provider, err := h.federation.identities.GetProviderBySlug(c.Request.Context(), req.Provider)
+	if err == nil && !provider.Enabled {
+		err = repository.ErrIdentityProviderNotFound
+	}
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = middleware.RandomToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to start sign-in"))
+			return
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	redirectTo, err := h.federation.rp.AuthorizationURL(c.Request.Context(), h.oidcClient(provider), state, nonce, oidc.S256Challenge(verifier))
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+	err = h.federation.identities.CreateLogin(c.Request.Context(), &models.FederatedLogin{
+		ProviderID:   provider.ID,
+		StateHash:    middleware.TokenHash(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(h.federation.settings.LoginTTL),
+	})
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.FederatedLoginResponse{RedirectTo: redirectTo, State: state})
+}
+
+// FederatedLogin completes a sign-in at an identity provider with the code
+// and state it sent the user back with, and returns the same response as
+// Login. The first sign-in of an identity links it to the account with the
+// same verified email or creates an account, when the provider allows.
+func (h *UserHandler) FederatedLogin(c *gin.Context) {
+	if !h.requireFederation(c) {
+		return
+	}
+	var req models.FederatedCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.LoginFailed(metrics.LoginReasonInvalidRequest)
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	login, err := h.federation.identities.ConsumeLogin(c.Request.Context(), middleware.TokenHash(req.State))
+	if err != nil {
+		h.federatedLoginFailed(c, nil, "", err)
+		return
+	}
+	// The sign-in decides the organization
+	c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), login.OrganizationID))
+	provider, err := h.federation.identities.GetProvider(c.Request.Context(), login.ProviderID)
+	if err == nil && !provider.Enabled {
+		err = repository.ErrIdentityProviderNotFound
+	}
+	if err != nil {
+		h.federatedLoginFailed(c, nil, "", err)
+		return
+	}
+
+	identity, err := h.federation.rp.Exchange(c.Request.Context(), h.oidcClient(provider), req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		h.federatedLoginFailed(c, provider, "", err)
+		return
+	}
+	user, created, err := h.federatedUser(c, provider, identity)
+	if err != nil {
+		h.federatedLoginFailed(c, provider, identity.Email, err)
+		return
+	}
+
+	token, err := h.issueToken(c.Request.Context(), user)
+	if err != nil {
+		metrics.LoginFailed(metrics.LoginReasonTokenError)
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate token"))
+		return
+	}
+
+	metrics.LoginSucceeded()
+	h.recordAudit(c, &audit.Event{
+		ActorID:      &user.ID,
+		Action:       audit.ActionLogin,
+		TargetUserID: &user.ID,
+		Metadata:     map[string]interface{}{"method": "sso", "provider": provider.Slug},
+	})
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, models.LoginResponse{
+		Token: token,
+		User:  newUserResponse(user),
+	})
+}
+
+// federatedUser finds the user a verified identity signs in, linking the
+// identity or provisioning an account on its first sign-in. created
+// reports whether the account is new.
+func (h *UserHandler) federatedUser(c *gin.Context, provider *models.IdentityProvider, identity *oidc.Identity) (user *models.User, created bool, err error) {
+	ctx := c.Request.Context()
+	linked, err := h.federation.identities.GetIdentity(ctx, provider.ID, identity.Subject)
+	if err == nil {
+		user, err = h.repo.GetUserByID(ctx, linked.UserID)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			// The linked account was deleted
+			return nil, false, errNoLinkedAccount
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return user, false, h.federation.identities.RecordIdentityLogin(ctx, linked.ID, identity.Email)
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, false, err
+	}
+
+	// Only an email the provider vouches for may pick an account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, false, errNoLinkedAccount
+	}
+	link := &models.UserIdentity{ProviderID: provider.ID, Subject: identity.Subject, Email: identity.Email}
+	user, err = h.repo.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !provider.LinkByEmail {
+			return nil, false, errNoLinkedAccount
+		}
+		link.UserID = user.ID
+		if err := h.federation.identities.LinkIdentity(ctx, link); err != nil {
+			return nil, false, err
+		}
+		h.recordAudit(c, &audit.Event{
+			ActorID:      &user.ID,
+			Action:       audit.ActionIdentityLinked,
+			TargetUserID: &user.ID,
+			Metadata:     map[string]interface{}{"provider": provider.Slug, "subject": identity.Subject},
+		})
+		return user, false, nil
+
+	case errors.Is(err, repository.ErrUserNotFound):
+		if !provider.ProvisionUsers {
+			return nil, false, errNoLinkedAccount
+		}
+		// Provisioned users sign in through the provider; a password
+		// reset or magic link gives them a way in without it
+		password, err := middleware.RandomToken()
+		if err != nil {
+			return nil, false, err
+		}
+		firstName, lastName := identityNames(identity)
+		user, err = h.federation.identities.ProvisionUser(ctx, &models.RegisterRequest{
+			Email:     identity.Email,
+			Password:  password,
+			FirstName: firstName,
+			LastName:  lastName,
+		}, link)
+		if err != nil {
+			return nil, false, err
+		}
+		h.recordAudit(c, &audit.Event{
+			ActorID:      &user.ID,
+			Action:       audit.ActionRegister,
+			TargetUserID: &user.ID,
+			Changes:      audit.Diff(nil, newUserResponse(user)),
+			Metadata:     map[string]interface{}{"method": "sso", "provider": provider.Slug, "subject": identity.Subject},
+		})
+		return user, true, nil
+
+	default:
+		return nil, false, err
+	}
+}
+
+// federatedLoginFailed answers a failed sign-in at an identity provider.
+// provider and email are recorded when known.
+func (h *UserHandler) federatedLoginFailed(c *gin.Context, provider *models.IdentityProvider, email string, err error) {
+	reason := metrics.LoginReasonIdentityProvider
+	status, message := http.StatusUnauthorized, "sign-in with the identity provider failed"
+	switch {
+	case errors.Is(err, repository.ErrFederatedLoginInvalid), errors.Is(err, repository.ErrIdentityProviderNotFound):
+		message = repository.ErrFederatedLoginInvalid.Error()
+	case errors.Is(err, oidc.ErrAuthenticationFailed):
+	case errors.Is(err, errNoLinkedAccount), errors.Is(err, repository.ErrIdentityLinked), errors.Is(err, repository.ErrEmailInUse):
+		reason = metrics.LoginReasonNoLinkedAccount
+		status, message = http.StatusForbidden, errNoLinkedAccount.Error()
+	case errors.Is(err, oidc.ErrProviderUnavailable):
+		slog.WarnContext(c.Request.Context(), "Identity provider unavailable", "error", err)
+		c.JSON(http.StatusBadGateway, middleware.ErrorBody(c, oidc.ErrProviderUnavailable.Error()))
+		return
+	default:
+		slog.ErrorContext(c.Request.Context(), "Federated sign-in failed", "error", err)
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to sign in"))
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Login failed", "reason", reason, "error", err)
+	metadata := map[string]interface{}{"method": "sso", "reason": reason}
+	if provider != nil {
+		metadata["provider"] = provider.Slug
+	}
+	if email != "" {
+		metadata["email"] = email
+	}
+	// Without a sign-in there is no organization to record the event in
+	if _, ok := tenant.Organization(c.Request.Context()); ok {
+		h.recordAudit(c, &audit.Event{Action: audit.ActionLoginFailed, Metadata: metadata})
+	}
+	metrics.LoginFailed(reason)
+	c.JSON(status, middleware.ErrorBody(c, message))
+}
+
+// ListIdentities returns the identity provider accounts linked to the
+// current user
+func (h *UserHandler) ListIdentities(c *gin.Context) {
+	if !h.requireFederation(c) {
+		return
+	}
+	id := actorID(c)
+	if id == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return
+	}
+
+	identities, err := h.federation.identities.ListUserIdentities(c.Request.Context(), *id)
+	if err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkIdentity removes a linked identity of the current user. Signing in
+// with it again links it anew only if its provider allows.
+func (h *UserHandler) UnlinkIdentity(c *gin.Context) {
+	if !h.requireFederation(c) {
+		return
+	}
+	userID := actorID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return
+	}
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.federation.identities.DeleteIdentity(c.Request.Context(), *userID, id); err != nil {
+		writeIdentityError(c, err)
+		return
+	}
+	h.recordAudit(c, &audit.Event{
+		Action:       audit.ActionIdentityUnlinked,
+		TargetUserID: userID,
+		Metadata:     map[string]interface{}{"identityId": id},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "identity unlinked successfully"})
+}
+
+// requireFederation writes a 404 unless sign-in with identity providers is
+// enabled
+func (h *UserHandler) requireFederation(c *gin.Context) bool {
+	if h.federation == nil {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "sign-in with identity providers is not enabled"))
+		return false
+	}
+	return true
+}
+
+// oidcClient describes the service's registration at provider
+func (h *UserHandler) oidcClient(provider *models.IdentityProvider) oidc.Client {
+	return oidc.Client{
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURI:  h.federation.settings.CallbackURL,
+		Scopes:       provider.Scopes,
+	}
+}
+
+// identityNames picks the first and last name of a provisioned user,
+// splitting the full name when the provider sends no given and family
+// name, and falling back to the start of the email
+func identityNames(identity *oidc.Identity) (string, string) {
+	if identity.GivenName != "" || identity.FamilyName != "" {
+		return identity.GivenName, identity.FamilyName
+	}
+	if name := strings.TrimSpace(identity.Name); name != "" {
+		first, last, _ := strings.Cut(name, " ")
+		return first, strings.TrimSpace(last)
+	}
+	local, _, _ := strings.Cut(identity.Email, "@")
+	return local, ""
+}
+
+// writeIdentityError maps identity repository and provider errors to HTTP
+// responses
+func writeIdentityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrIdentityProviderNotFound), errors.Is(err, repository.ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrIdentityProviderExists):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, oidc.ErrProviderUnavailable):
+		slog.WarnContext(c.Request.Context(), "Identity provider unavailable", "error", err)
+		c.JSON(http.StatusBadGateway, middleware.ErrorBody(c, oidc.ErrProviderUnavailable.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
+}
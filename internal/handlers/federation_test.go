@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/oidc"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockIdentityRepository is a mock implementation of IdentityRepository
+type MockIdentityRepository struct {
+	mock.Mock
+}
+
+func (m *MockIdentityRepository) CreateProvider(ctx context.Context, provider *models.IdentityProvider) error {
+	args := m.Called(provider)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) GetProvider(ctx context.Context, id uuid.UUID) (*models.IdentityProvider, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdentityProvider), args.Error(1)
+}
+
+func (m *MockIdentityRepository) GetProviderBySlug(ctx context.Context, slug string) (*models.IdentityProvider, error) {
+	args := m.Called(slug)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.IdentityProvider), args.Error(1)
+}
+
+func (m *MockIdentityRepository) ListProviders(ctx context.Context, enabledOnly bool, limit, offset int) ([]*models.IdentityProvider, error) {
+	args := m.Called(enabledOnly, limit, offset)
+	return args.Get(0).([]*models.IdentityProvider), args.Error(1)
+}
+
+func (m *MockIdentityRepository) UpdateProvider(ctx context.Context, provider *models.IdentityProvider) error {
+	args := m.Called(provider)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) DeleteProvider(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) CreateLogin(ctx context.Context, login *models.FederatedLogin) error {
+	args := m.Called(login)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) ConsumeLogin(ctx context.Context, stateHash string) (*models.FederatedLogin, error) {
+	args := m.Called(stateHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.FederatedLogin), args.Error(1)
+}
+
+func (m *MockIdentityRepository) GetIdentity(ctx context.Context, providerID uuid.UUID, subject string) (*models.UserIdentity, error) {
+	args := m.Called(providerID, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserIdentity), args.Error(1)
+}
+
+func (m *MockIdentityRepository) LinkIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	args := m.Called(identity)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) ProvisionUser(ctx context.Context, req *models.RegisterRequest, identity *models.UserIdentity) (*models.User, error) {
+	args := m.Called(req, identity)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockIdentityRepository) RecordIdentityLogin(ctx context.Context, id uuid.UUID, email string) error {
+	args := m.Called(id, email)
+	return args.Error(0)
+}
+
+func (m *MockIdentityRepository) ListUserIdentities(ctx context.Context, userID uuid.UUID) ([]*models.UserIdentity, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]*models.UserIdentity), args.Error(1)
+}
+
+func (m *MockIdentityRepository) DeleteIdentity(ctx context.Context, userID, id uuid.UUID) error {
+	args := m.Called(userID, id)
+	return args.Error(0)
+}
+
+const testSSOCallbackURL = "https://app.example.com/sso/callback"
+
+// mockIdentityProvider is a local OpenID Provider. It redeems the code
+// "valid-code" for the client "service" once it proves the PKCE challenge
+// of the authorization request the service built, issuing an ID token with
+// claims and that request's nonce.
+type mockIdentityProvider struct {
+	*httptest.Server
+	signer        *oidc.Signer
+	authorization url.Values
+	claims        jwt.MapClaims
+}
+
+func newMockIdentityProvider(t *testing.T) *mockIdentityProvider {
+	signer, err := oidc.NewSigner("")
+	require.NoError(t, err)
+	idp := &mockIdentityProvider{signer: signer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.NewDiscovery(idp.URL))
+	})
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(idp.signer.JWKS())
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "service" || secret != "secret" || r.PostFormValue("code") != "valid-code" ||
+			r.PostFormValue("redirect_uri") != testSSOCallbackURL ||
+			!oidc.VerifyPKCE(idp.authorization.Get("code_challenge"), r.PostFormValue("code_verifier")) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   "service",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": idp.authorization.Get("nonce"),
+		}
+		for name, value := range idp.claims {
+			claims[name] = value
+		}
+		idToken, err := idp.signer.Sign(claims)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	idp.claims = jwt.MapClaims{"sub": "00u1abcd", "email": "ada@example.com", "email_verified": true, "name": "Ada Lovelace"}
+	return idp
+}
+
+// federationTest signs users in through a mock identity provider
+type federationTest struct {
+	router     *gin.Engine
+	users      *MockUserRepository
+	identities *MockIdentityRepository
+	idp        *mockIdentityProvider
+	auditor    *recordingAuditor
+	provider   *models.IdentityProvider
+}
+
+func newFederationTest(t *testing.T) *federationTest {
+	ft := &federationTest{
+		users:      new(MockUserRepository),
+		identities: new(MockIdentityRepository),
+		idp:        newMockIdentityProvider(t),
+		auditor:    &recordingAuditor{},
+	}
+	ft.provider = &models.IdentityProvider{
+		ID:             uuid.New(),
+		OrganizationID: tenant.DefaultOrganizationID,
+		Slug:           "okta",
+		Name:           "Okta",
+		Issuer:         ft.idp.URL,
+		ClientID:       "service",
+		ClientSecret:   "secret",
+		Scopes:         defaultProviderScopes,
+		Enabled:        true,
+	}
+	ft.identities.On("GetProviderBySlug", "okta").Return(ft.provider, nil)
+	ft.identities.On("GetProviderBySlug", mock.Anything).Return(nil, repository.ErrIdentityProviderNotFound)
+	ft.identities.On("GetProvider", ft.provider.ID).Return(ft.provider, nil)
+
+	handler := NewUserHandler(ft.users, new(MockTokenGenerator), new(MockPasswordHasher), WithAuditor(ft.auditor),
+		WithFederation(ft.identities, oidc.NewRelyingParty(nil), FederationSettings{
+			CallbackURL: testSSOCallbackURL,
+			LoginTTL:    10 * time.Minute,
+		}))
+	ft.router = gin.New()
+	ft.router.GET("/auth/sso/providers", handler.ListSignInProviders)
+	ft.router.POST("/auth/sso/login", handler.StartFederatedLogin)
+	ft.router.POST("/auth/sso/callback", handler.FederatedLogin)
+	return ft
+}
+
+// start begins a sign-in at the provider and returns its state, as the
+// provider would send it back
+func (ft *federationTest) start(t *testing.T) string {
+	var login *models.FederatedLogin
+	ft.identities.On("CreateLogin", mock.AnythingOfType("*models.FederatedLogin")).
+		Run(func(args mock.Arguments) { login = args.Get(0).(*models.FederatedLogin) }).Return(nil).Once()
+
+	resp := postJSON(ft.router, "/auth/sso/login", `{"provider":"okta"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var started models.FederatedLoginResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &started))
+	redirect, err := url.Parse(started.RedirectTo)
+	require.NoError(t, err)
+	ft.idp.authorization = redirect.Query()
+
+	require.NotNil(t, login)
+	assert.Equal(t, middleware.TokenHash(started.State), login.StateHash)
+	assert.Equal(t, started.State, ft.idp.authorization.Get("state"))
+	assert.Equal(t, login.Nonce, ft.idp.authorization.Get("nonce"))
+	login.OrganizationID = tenant.DefaultOrganizationID
+	ft.identities.On("ConsumeLogin", login.StateHash).Return(login, nil).Once()
+	return started.State
+}
+
+// callback posts what the provider sent the browser back with
+func (ft *federationTest) callback(state, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.FederatedCallbackRequest{State: state, Code: code})
+	return postJSON(ft.router, "/auth/sso/callback", string(body))
+}
+
+func TestStartFederatedLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ft := newFederationTest(t)
+	ft.identities.On("ListProviders", true, 100, 0).Return([]*models.IdentityProvider{ft.provider}, nil)
+
+	resp := httptest.NewRecorder()
+	ft.router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/auth/sso/providers", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"providers":[{"slug":"okta","name":"Okta"}]}`, resp.Body.String())
+
+	ft.start(t)
+	authorization := ft.idp.authorization
+	assert.Equal(t, "code", authorization.Get("response_type"))
+	assert.Equal(t, "service", authorization.Get("client_id"))
+	assert.Equal(t, testSSOCallbackURL, authorization.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", authorization.Get("scope"))
+	assert.Equal(t, "S256", authorization.Get("code_challenge_method"))
+
+	// Every sign-in gets its own state
+	first := authorization.Get("state")
+	ft.start(t)
+	assert.NotEqual(t, first, ft.idp.authorization.Get("state"))
+
+	assert.Equal(t, http.StatusNotFound, postJSON(ft.router, "/auth/sso/login", `{"provider":"google"}`).Code)
+	ft.provider.Enabled = false
+	assert.Equal(t, http.StatusNotFound, postJSON(ft.router, "/auth/sso/login", `{"provider":"okta"}`).Code)
+}
+
+func TestFederatedLoginProvisionsUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ft := newFederationTest(t)
+	ft.provider.ProvisionUsers = true
+	ft.identities.On("GetIdentity", ft.provider.ID, "00u1abcd").Return(nil, repository.ErrIdentityNotFound)
+	ft.users.On("GetUserByEmail", "ada@example.com").Return(nil, repository.ErrUserNotFound)
+	user := &models.User{ID: uuid.New(), OrganizationID: tenant.DefaultOrganizationID, Email: "ada@example.com", FirstName: "Ada", LastName: "Lovelace"}
+	var req *models.RegisterRequest
+	var identity *models.UserIdentity
+	ft.identities.On("ProvisionUser", mock.AnythingOfType("*models.RegisterRequest"), mock.AnythingOfType("*models.UserIdentity")).
+		Run(func(args mock.Arguments) {
+			req, identity = args.Get(0).(*models.RegisterRequest), args.Get(1).(*models.UserIdentity)
+		}).Return(user, nil).Once()
+
+	state := ft.start(t)
+	resp := ft.callback(state, "valid-code")
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var login models.LoginResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &login))
+	assert.Equal(t, "test-jwt-token", login.Token)
+	assert.Equal(t, user.ID, login.User.ID)
+
+	assert.Equal(t, "Ada", req.FirstName)
+	assert.Equal(t, "Lovelace", req.LastName)
+	assert.NotEmpty(t, req.Password)
+	assert.Equal(t, &models.UserIdentity{ProviderID: ft.provider.ID, Subject: "00u1abcd", Email: "ada@example.com"}, identity)
+	require.Len(t, ft.auditor.events, 2)
+	assert.Equal(t, audit.ActionRegister, ft.auditor.events[0].Action)
+	assert.Equal(t, audit.ActionLogin, ft.auditor.events[1].Action)
+
+	// The state works once
+	ft.identities.On("ConsumeLogin", mock.Anything).Return(nil, repository.ErrFederatedLoginInvalid)
+	assert.Equal(t, http.StatusUnauthorized, ft.callback(state, "valid-code").Code)
+	ft.identities.AssertExpectations(t)
+}
+
+func TestFederatedLoginLinksByEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ft := newFederationTest(t)
+	ft.identities.On("GetIdentity", ft.provider.ID, "00u1abcd").Return(nil, repository.ErrIdentityNotFound)
+	user := &models.User{ID: uuid.New(), OrganizationID: tenant.DefaultOrganizationID, Email: "ada@example.com"}
+	ft.users.On("GetUserByEmail", "ada@example.com").Return(user, nil)
+
+	// Linking must be allowed by the provider
+	resp := ft.callback(ft.start(t), "valid-code")
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), "no account is linked")
+
+	ft.provider.LinkByEmail = true
+	var linked *models.UserIdentity
+	ft.identities.On("LinkIdentity", mock.AnythingOfType("*models.UserIdentity")).
+		Run(func(args mock.Arguments) { linked = args.Get(0).(*models.UserIdentity) }).Return(nil).Once()
+	resp = ft.callback(ft.start(t), "valid-code")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, user.ID, linked.UserID)
+	assert.Equal(t, "00u1abcd", linked.Subject)
+	assert.Equal(t, audit.ActionIdentityLinked, ft.auditor.events[len(ft.auditor.events)-2].Action)
+
+	// Only a verified email picks the account
+	ft.idp.claims["email_verified"] = false
+	assert.Equal(t, http.StatusForbidden, ft.callback(ft.start(t), "valid-code").Code)
+	ft.identities.AssertNumberOfCalls(t, "LinkIdentity", 1)
+}
+
+func TestFederatedLoginLinkedIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ft := newFederationTest(t)
+	user := &models.User{ID: uuid.New(), OrganizationID: tenant.DefaultOrganizationID, Email: "ada@example.com"}
+	identity := &models.UserIdentity{ID: uuid.New(), UserID: user.ID, ProviderID: ft.provider.ID, Subject: "00u1abcd"}
+	ft.identities.On("GetIdentity", ft.provider.ID, "00u1abcd").Return(identity, nil)
+	ft.identities.On("RecordIdentityLogin", identity.ID, "ada.lovelace@example.com").Return(nil).Once()
+	ft.users.On("GetUserByID", user.ID).Return(user, nil)
+
+	// The subject decides, whatever the email says now
+	ft.idp.claims["email"] = "ada.lovelace@example.com"
+	ft.idp.claims["email_verified"] = false
+	resp := ft.callback(ft.start(t), "valid-code")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var login models.LoginResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &login))
+	assert.Equal(t, user.ID, login.User.ID)
+
+	// The provider refuses a wrong code, and a token for another sign-in
+	// carries the wrong nonce
+	assert.Equal(t, http.StatusUnauthorized, ft.callback(ft.start(t), "stolen-code").Code)
+	ft.idp.claims["nonce"] = "replayed"
+	assert.Equal(t, http.StatusUnauthorized, ft.callback(ft.start(t), "valid-code").Code)
+
+	// An unreachable provider is not the user's fault
+	ft.idp.Close()
+	assert.Equal(t, http.StatusBadGateway, ft.callback(ft.start(t), "valid-code").Code)
+	ft.identities.AssertExpectations(t)
+}
+
+func TestIdentityProviderHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	identities := new(MockIdentityRepository)
+	auditor := &recordingAuditor{}
+	handler := NewIdentityProviderHandler(identities, auditor)
+	router := gin.New()
+	router.POST("/identity-providers", handler.CreateProvider)
+	router.PUT("/identity-providers/:id", handler.UpdateProvider)
+
+	var created *models.IdentityProvider
+	identities.On("CreateProvider", mock.AnythingOfType("*models.IdentityProvider")).
+		Run(func(args mock.Arguments) {
+			created = args.Get(0).(*models.IdentityProvider)
+			created.ID = uuid.New()
+		}).Return(nil).Once()
+
+	for _, body := range []string{
+		`{"slug":"Okta","name":"Okta","issuer":"https://acme.okta.com","clientId":"service"}`,
+		`{"slug":"okta","name":"Okta","issuer":"ftp://acme.okta.com","clientId":"service"}`,
+		`{"slug":"okta","name":"Okta","issuer":"https://acme.okta.com?tenant=1","clientId":"service"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, postJSON(router, "/identity-providers", body).Code, body)
+	}
+
+	resp := postJSON(router, "/identity-providers",
+		`{"slug":"okta","name":"Okta","issuer":"https://acme.okta.com","clientId":"service","clientSecret":"secret","scopes":["email","groups"],"provisionUsers":true}`)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	assert.NotContains(t, resp.Body.String(), "secret\"")
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+	assert.Equal(t, true, response["hasClientSecret"])
+	assert.Equal(t, true, response["enabled"])
+	assert.Equal(t, []string{"openid", "email", "groups"}, created.Scopes)
+	assert.Equal(t, "secret", created.ClientSecret)
+	assert.Equal(t, audit.ActionIdentityProviderCreated, auditor.events[0].Action)
+
+	// An update without a secret keeps the current one
+	identities.On("GetProvider", created.ID).Return(created, nil)
+	identities.On("UpdateProvider", created).Return(nil).Once()
+	req := httptest.NewRequest(http.MethodPut, "/identity-providers/"+created.ID.String(),
+		strings.NewReader(`{"name":"Acme Okta","issuer":"https://acme.okta.com","clientId":"service-2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "secret", created.ClientSecret)
+	assert.Equal(t, "service-2", created.ClientID)
+	assert.Equal(t, defaultProviderScopes, created.Scopes)
+	assert.False(t, created.Enabled)
+	identities.AssertExpectations(t)
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GroupHandler manages groups, their members and their nesting. Any user
+// may read groups and create one, becoming its owner; changing a group
+// takes one of its owners or an admin.
+type GroupHandler struct {
+	groups  repository.GroupRepository
+	users   repository.UserRepository
+	auditor audit.Recorder
+}
+
+func NewGroupHandler(groups repository.GroupRepository, users repository.UserRepository, auditor audit.Recorder) *GroupHandler {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	return &GroupHandler{groups: groups, users: users, auditor: auditor}
+}
+
+// CreateGroup creates a group owned by the caller
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	caller := actorID(c)
+	if caller == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return
+	}
+
+	var req models.CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	group := &models.Group{Name: req.Name, Description: req.Description}
+	if err := h.groups.CreateGroup(c.Request.Context(), group, *caller); err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionGroupCreated,
+		Changes:  audit.Diff(nil, group),
+		Metadata: map[string]interface{}{"groupId": group.ID},
+	})
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// ListGroups returns a page of the organization's groups ordered by name
+func (h *GroupHandler) ListGroups(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	groups, err := h.groups.ListGroups(c.Request.Context(), limit, offset)
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// GetGroup returns a single group
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	group, err := h.groups.GetGroup(c.Request.Context(), id)
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup renames a group and replaces its description
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	id, ok := h.managedGroup(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	before, err := h.groups.GetGroup(c.Request.Context(), id)
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	group, err := h.groups.UpdateGroup(c.Request.Context(), id, &req)
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionGroupUpdated,
+		Changes:  audit.Diff(before, group),
+		Metadata: map[string]interface{}{"groupId": id},
+	})
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup removes a group together with its memberships and nesting
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	id, ok := h.managedGroup(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groups.DeleteGroup(c.Request.Context(), id); err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionGroupDeleted,
+		Metadata: map[string]interface{}{"groupId": id},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "group deleted successfully"})
+}
+
+// ListMembers returns the direct members of a group, or with expand=true
+// also the members of its nested subgroups
+func (h *GroupHandler) ListMembers(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	members, err := h.groups.ListMembers(c.Request.Context(), id, c.Query("expand") == "true")
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// SetMember adds a user to a group or changes their role. The role defaults
+// to member.
+func (h *GroupHandler) SetMember(c *gin.Context) {
+	id, ok := h.managedGroup(c)
+	if !ok {
+		return
+	}
+	userID, ok := parseID(c, "userId")
+	if !ok {
+		return
+	}
+
+	var req models.SetGroupMemberRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+	}
+	if req.Role == "" {
+		req.Role = models.GroupRoleMember
+	}
+
+	member, err := h.groups.SetMember(c.Request.Context(), id, userID, req.Role)
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:       audit.ActionGroupMemberSet,
+		TargetUserID: &userID,
+		Metadata:     map[string]interface{}{"groupId": id, "role": member.Role},
+	})
+
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember removes a user from a group. Members may always leave a
+// group themselves.
+func (h *GroupHandler) RemoveMember(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseID(c, "userId")
+	if !ok {
+		return
+	}
+	if caller := actorID(c); caller == nil || *caller != userID {
+		if !h.canManage(c, id) {
+			return
+		}
+	}
+
+	if err := h.groups.RemoveMember(c.Request.Context(), id, userID); err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:       audit.ActionGroupMemberRemoved,
+		TargetUserID: &userID,
+		Metadata:     map[string]interface{}{"groupId": id},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "group member removed successfully"})
+}
+
+// ListSubgroups returns the groups nested directly inside a group
+func (h *GroupHandler) ListSubgroups(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	groups, err := h.groups.ListSubgroups(c.Request.Context(), id)
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// AddSubgroup nests a group inside another, whose members then include the
+// subgroup's members
+func (h *GroupHandler) AddSubgroup(c *gin.Context) {
+	id, ok := h.managedGroup(c)
+	if !ok {
+		return
+	}
+	childID, ok := parseID(c, "childId")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.AddSubgroup(c.Request.Context(), id, childID); err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionGroupSubgroupAdded,
+		Metadata: map[string]interface{}{"groupId": id, "subgroupId": childID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "subgroup added successfully"})
+}
+
+// RemoveSubgroup undoes AddSubgroup
+func (h *GroupHandler) RemoveSubgroup(c *gin.Context) {
+	id, ok := h.managedGroup(c)
+	if !ok {
+		return
+	}
+	childID, ok := parseID(c, "childId")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.RemoveSubgroup(c.Request.Context(), id, childID); err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionGroupSubgroupRemoved,
+		Metadata: map[string]interface{}{"groupId": id, "subgroupId": childID},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "subgroup removed successfully"})
+}
+
+// ListUserGroups returns the groups a user is a direct member of, or with
+// expand=true also the groups they belong to through nesting
+func (h *GroupHandler) ListUserGroups(c *gin.Context) {
+	userID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.users.GetUserByID(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
+		return
+	}
+
+	groups, err := h.groups.ListUserGroups(c.Request.Context(), userID, c.Query("expand") == "true")
+	if err != nil {
+		writeGroupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// managedGroup parses the group ID path parameter and checks that the caller
+// may change the group, writing the error response if not
+func (h *GroupHandler) managedGroup(c *gin.Context) (uuid.UUID, bool) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return uuid.Nil, false
+	}
+	if !h.canManage(c, id) {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// canManage reports whether the caller owns the group or is an admin,
+// writing a 403 if not. The group itself may not exist; the repository
+// reports that afterwards.
+func (h *GroupHandler) canManage(c *gin.Context, groupID uuid.UUID) bool {
+	caller := actorID(c)
+	if caller == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return false
+	}
+
+	member, err := h.groups.GetMember(c.Request.Context(), groupID, *caller)
+	if err == nil && member.Role == models.GroupRoleOwner {
+		return true
+	}
+	user, err := h.users.GetUserByID(c.Request.Context(), *caller)
+	if err == nil && user.Role == models.RoleAdmin {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, middleware.ErrorBody(c, "group owner or admin role required"))
+	return false
+}
+
+// writeGroupError maps group repository errors to HTTP responses
+func writeGroupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrGroupNotFound),
+		errors.Is(err, repository.ErrMemberNotFound),
+		errors.Is(err, repository.ErrSubgroupNotFound),
+		errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrGroupNameInUse),
+		errors.Is(err, repository.ErrLastOwner),
+		errors.Is(err, repository.ErrGroupCycle):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
+}
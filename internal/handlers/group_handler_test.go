@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGroupRepository is a mock implementation of GroupRepository
+type MockGroupRepository struct {
+	mock.Mock
+}
+
+func (m *MockGroupRepository) CreateGroup(ctx context.Context, group *models.Group, ownerID uuid.UUID) error {
+	args := m.Called(group, ownerID)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) GetGroup(ctx context.Context, id uuid.UUID) (*models.Group, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Group), args.Error(1)
+}
+
+func (m *MockGroupRepository) ListGroups(ctx context.Context, limit, offset int) ([]*models.Group, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]*models.Group), args.Error(1)
+}
+
+func (m *MockGroupRepository) UpdateGroup(ctx context.Context, id uuid.UUID, updates *models.UpdateGroupRequest) (*models.Group, error) {
+	args := m.Called(id, updates)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Group), args.Error(1)
+}
+
+func (m *MockGroupRepository) DeleteGroup(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) SetMember(ctx context.Context, groupID, userID uuid.UUID, role string) (*models.GroupMember, error) {
+	args := m.Called(groupID, userID, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.GroupMember), args.Error(1)
+}
+
+func (m *MockGroupRepository) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	args := m.Called(groupID, userID)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error) {
+	args := m.Called(groupID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.GroupMember), args.Error(1)
+}
+
+func (m *MockGroupRepository) ListMembers(ctx context.Context, groupID uuid.UUID, expand bool) ([]*models.GroupMember, error) {
+	args := m.Called(groupID, expand)
+	return args.Get(0).([]*models.GroupMember), args.Error(1)
+}
+
+func (m *MockGroupRepository) AddSubgroup(ctx context.Context, parentID, childID uuid.UUID) error {
+	args := m.Called(parentID, childID)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) RemoveSubgroup(ctx context.Context, parentID, childID uuid.UUID) error {
+	args := m.Called(parentID, childID)
+	return args.Error(0)
+}
+
+func (m *MockGroupRepository) ListSubgroups(ctx context.Context, groupID uuid.UUID) ([]*models.Group, error) {
+	args := m.Called(groupID)
+	return args.Get(0).([]*models.Group), args.Error(1)
+}
+
+func (m *MockGroupRepository) ListUserGroups(ctx context.Context, userID uuid.UUID, expand bool) ([]*models.UserGroup, error) {
+	args := m.Called(userID, expand)
+	return args.Get(0).([]*models.UserGroup), args.Error(1)
+}
+
+// groupTokenGenerator records the group claims it was asked to issue
+type groupTokenGenerator struct {
+	groups []string
+}
+
+func (g *groupTokenGenerator) GenerateToken(userID, organizationID string, groups ...string) (string, error) {
+	g.groups = groups
+	return "test-jwt-token", nil
+}
+
+func TestSetGroupMember(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	callerID := uuid.New()
+	groupID := uuid.New()
+	userID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(groups *MockGroupRepository, users *MockUserRepository)
+		expectedStatus int
+	}{
+		{
+			name: "plain member is forbidden",
+			body: `{"role":"member"}`,
+			mockSetup: func(groups *MockGroupRepository, users *MockUserRepository) {
+				groups.On("GetMember", groupID, callerID).Return(&models.GroupMember{Role: models.GroupRoleMember}, nil)
+				users.On("GetUserByID", callerID).Return(&models.User{ID: callerID, Role: models.RoleUser}, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "owner adds a member",
+			mockSetup: func(groups *MockGroupRepository, users *MockUserRepository) {
+				groups.On("GetMember", groupID, callerID).Return(&models.GroupMember{Role: models.GroupRoleOwner}, nil)
+				groups.On("SetMember", groupID, userID, models.GroupRoleMember).
+					Return(&models.GroupMember{GroupID: groupID, UserID: userID, Role: models.GroupRoleMember}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "admin outside the group",
+			body: `{"role":"owner"}`,
+			mockSetup: func(groups *MockGroupRepository, users *MockUserRepository) {
+				groups.On("GetMember", groupID, callerID).Return(nil, repository.ErrMemberNotFound)
+				users.On("GetUserByID", callerID).Return(&models.User{ID: callerID, Role: models.RoleAdmin}, nil)
+				groups.On("SetMember", groupID, userID, models.GroupRoleOwner).
+					Return(&models.GroupMember{GroupID: groupID, UserID: userID, Role: models.GroupRoleOwner}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "demoting the last owner",
+			body: `{"role":"member"}`,
+			mockSetup: func(groups *MockGroupRepository, users *MockUserRepository) {
+				groups.On("GetMember", groupID, callerID).Return(&models.GroupMember{Role: models.GroupRoleOwner}, nil)
+				groups.On("SetMember", groupID, userID, models.GroupRoleMember).Return(nil, repository.ErrLastOwner)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "unknown role",
+			body: `{"role":"admin"}`,
+			mockSetup: func(groups *MockGroupRepository, users *MockUserRepository) {
+				groups.On("GetMember", groupID, callerID).Return(&models.GroupMember{Role: models.GroupRoleOwner}, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := new(MockGroupRepository)
+			users := new(MockUserRepository)
+			tt.mockSetup(groups, users)
+			auditor := &recordingAuditor{}
+			handler := NewGroupHandler(groups, users, auditor)
+
+			router := gin.New()
+			router.PUT("/groups/:id/members/:userId", func(c *gin.Context) {
+				c.Set("userID", callerID.String())
+				handler.SetMember(c)
+			})
+
+			req := httptest.NewRequest(http.MethodPut, "/groups/"+groupID.String()+"/members/"+userID.String(), bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			if tt.expectedStatus == http.StatusOK {
+				require.Len(t, auditor.events, 1)
+				assert.Equal(t, audit.ActionGroupMemberSet, auditor.events[0].Action)
+				assert.Equal(t, &userID, auditor.events[0].TargetUserID)
+			}
+			groups.AssertExpectations(t)
+			users.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLeaveGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	callerID := uuid.New()
+	groupID := uuid.New()
+	groups := new(MockGroupRepository)
+	groups.On("RemoveMember", groupID, callerID).Return(nil)
+	handler := NewGroupHandler(groups, new(MockUserRepository), nil)
+
+	router := gin.New()
+	router.DELETE("/groups/:id/members/:userId", func(c *gin.Context) {
+		c.Set("userID", callerID.String())
+		handler.RemoveMember(c)
+	})
+
+	// Members need no owner rights to leave
+	req := httptest.NewRequest(http.MethodDelete, "/groups/"+groupID.String()+"/members/"+callerID.String(), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	groups.AssertExpectations(t)
+}
+
+func TestIssueTokenWithGroupClaims(t *testing.T) {
+	user := &models.User{ID: uuid.New(), OrganizationID: uuid.New()}
+	direct := &models.UserGroup{Group: models.Group{ID: uuid.New()}, Role: models.GroupRoleMember}
+	inherited := &models.UserGroup{Group: models.Group{ID: uuid.New()}, Inherited: true}
+
+	tokens := &groupTokenGenerator{}
+	handler := NewUserHandler(new(MockUserRepository), tokens, new(MockPasswordHasher))
+	_, err := handler.issueToken(context.Background(), user)
+	require.NoError(t, err)
+	assert.Empty(t, tokens.groups, "group claims are off by default")
+
+	groups := new(MockGroupRepository)
+	groups.On("ListUserGroups", user.ID, true).Return([]*models.UserGroup{direct, inherited}, nil)
+	handler = NewUserHandler(new(MockUserRepository), tokens, new(MockPasswordHasher), WithGroupClaims(groups))
+	_, err = handler.issueToken(context.Background(), user)
+	require.NoError(t, err)
+	assert.Equal(t, []string{direct.ID.String(), inherited.ID.String()}, tokens.groups)
+}
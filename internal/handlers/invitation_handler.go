@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/notify"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// invitationTokenPurpose binds signed tokens to invitations
+const invitationTokenPurpose = "invitation"
+
+// InvitationSettings controls the invitations an InvitationHandler sends
+type InvitationSettings struct {
+	// TTL is how long an invitation can be accepted after it was last sent
+	TTL time.Duration
+	// AcceptURL is the page where invitees accept; the token is added as
+	// its token query parameter
+	AcceptURL string
+}
+
+// InvitationHandler lets admins invite people into their organization and
+// invitees accept by choosing a password
+type InvitationHandler struct {
+	invitations repository.InvitationRepository
+	tokens      *middleware.SignedTokens
+	tokenGen    TokenGenerator
+	notifier    notify.Notifier
+	auditor     audit.Recorder
+	settings    InvitationSettings
+}
+
+func NewInvitationHandler(invitations repository.InvitationRepository, tokens *middleware.SignedTokens, tokenGen TokenGenerator, notifier notify.Notifier, auditor audit.Recorder, settings InvitationSettings) *InvitationHandler {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	return &InvitationHandler{
+		invitations: invitations,
+		tokens:      tokens,
+		tokenGen:    tokenGen,
+		notifier:    notifier,
+		auditor:     auditor,
+		settings:    settings,
+	}
+}
+
+// CreateInvitation invites an email address into the caller's organization
+// and sends the invitation link
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req models.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+
+	invitation := &models.Invitation{
+		Email:     req.Email,
+		Role:      req.Role,
+		Locale:    req.Locale,
+		InviterID: actorID(c),
+		ExpiresAt: time.Now().Add(h.settings.TTL),
+	}
+	token, err := h.issueToken(invitation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate invitation token"))
+		return
+	}
+
+	if err := h.invitations.CreateInvitation(c.Request.Context(), invitation); err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionInvitationCreated,
+		Metadata: map[string]interface{}{"invitationId": invitation.ID, "email": invitation.Email, "role": invitation.Role},
+	})
+
+	if !h.send(c, invitation, token) {
+		return
+	}
+	c.JSON(http.StatusCreated, models.NewInvitationResponse(invitation))
+}
+
+// ListInvitations returns a page of the organization's invitations, newest first
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	invitations, err := h.invitations.ListInvitations(c.Request.Context(), limit, offset)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	response := make([]models.InvitationResponse, len(invitations))
+	for i, invitation := range invitations {
+		response[i] = models.NewInvitationResponse(invitation)
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": response})
+}
+
+// GetInvitation returns a single invitation
+func (h *InvitationHandler) GetInvitation(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	invitation, err := h.invitations.GetInvitation(c.Request.Context(), id)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.NewInvitationResponse(invitation))
+}
+
+// ResendInvitation sends an open invitation again with a new link and a
+// fresh expiry. Earlier links stop working.
+func (h *InvitationHandler) ResendInvitation(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	renewal := &models.Invitation{ID: id, ExpiresAt: time.Now().Add(h.settings.TTL)}
+	token, err := h.issueToken(renewal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate invitation token"))
+		return
+	}
+
+	invitation, err := h.invitations.RenewInvitation(c.Request.Context(), id, renewal.TokenHash, renewal.ExpiresAt)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionInvitationResent,
+		Metadata: map[string]interface{}{"invitationId": id, "email": invitation.Email},
+	})
+
+	if !h.send(c, invitation, token) {
+		return
+	}
+	c.JSON(http.StatusOK, models.NewInvitationResponse(invitation))
+}
+
+// RevokeInvitation closes an open invitation so its link stops working
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	invitation, err := h.invitations.RevokeInvitation(c.Request.Context(), id)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionInvitationRevoked,
+		Metadata: map[string]interface{}{"invitationId": id, "email": invitation.Email},
+	})
+
+	c.JSON(http.StatusOK, models.NewInvitationResponse(invitation))
+}
+
+// AcceptInvitation creates the invited account with the chosen password and
+// logs the new user in
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	var req models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	id, err := h.tokens.Verify(invitationTokenPurpose, req.Token)
+	if err != nil {
+		writeInvitationError(c, repository.ErrInvitationInvalid)
+		return
+	}
+
+	invitation, user, err := h.invitations.AcceptInvitation(c.Request.Context(), id, middleware.TokenHash(req.Token), &models.RegisterRequest{
+		Password:    req.Password,
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		PhoneNumber: req.PhoneNumber,
+	})
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	// From here on the request acts in the organization of the invitation
+	c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), user.OrganizationID))
+	recordAudit(c, h.auditor, &audit.Event{
+		ActorID:      &user.ID,
+		Action:       audit.ActionInvitationAccepted,
+		TargetUserID: &user.ID,
+		Changes:      audit.Diff(nil, newUserResponse(user)),
+		Metadata:     map[string]interface{}{"invitationId": invitation.ID, "inviterId": invitation.InviterID},
+	})
+
+	token, err := h.tokenGen.GenerateToken(user.ID.String(), user.OrganizationID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate token"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.LoginResponse{
+		Token: token,
+		User:  newUserResponse(user),
+	})
+}
+
+// issueToken signs a new token for invitation and stores its hash in it
+func (h *InvitationHandler) issueToken(invitation *models.Invitation) (string, error) {
+	if invitation.ID == uuid.Nil {
+		invitation.ID = uuid.New()
+	}
+	token, err := h.tokens.Issue(invitationTokenPurpose, invitation.ID)
+	if err != nil {
+		return "", err
+	}
+	invitation.TokenHash = middleware.TokenHash(token)
+	return token, nil
+}
+
+// send delivers the invitation link. The invitation is already stored, so a
+// failure is reported as such and the admin can resend it.
+func (h *InvitationHandler) send(c *gin.Context, invitation *models.Invitation, token string) bool {
+	msg, err := h.message(invitation, token)
+	if err == nil {
+		err = h.notifier.Notify(c.Request.Context(), msg)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to send invitation", "invitation_id", invitation.ID, "error", err)
+		c.JSON(http.StatusBadGateway, middleware.ErrorBody(c, "invitation saved but could not be sent; resend it"))
+		return false
+	}
+	return true
+}
+
+// message renders the invitation email in the invitation's locale
+func (h *InvitationHandler) message(invitation *models.Invitation, token string) (notify.Message, error) {
+	link, err := h.acceptLink(token)
+	if err != nil {
+		return notify.Message{}, err
+	}
+	msg, err := notify.Render("invitation", invitation.Locale, struct {
+		Role, Link, ExpiresAt string
+	}{
+		Role:      invitation.Role,
+		Link:      link,
+		ExpiresAt: invitation.ExpiresAt.UTC().Format(time.RFC1123),
+	})
+	msg.Channel = notify.Email
+	msg.To = invitation.Email
+	return msg, err
+}
+
+// acceptLink adds token to the configured accept URL
+func (h *InvitationHandler) acceptLink(token string) (string, error) {
+	return linkWithToken(h.settings.AcceptURL, token)
+}
+
+// linkWithToken adds token to page as its token query parameter
+func linkWithToken(page, token string) (string, error) {
+	link, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// writeInvitationError maps invitation repository errors to HTTP responses
+func writeInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrInvitationInvalid):
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrInvitationPending),
+		errors.Is(err, repository.ErrInvitationClosed),
+		errors.Is(err, repository.ErrEmailInUse):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/notify"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockInvitationRepository is a mock implementation of InvitationRepository
+type MockInvitationRepository struct {
+	mock.Mock
+}
+
+func (m *MockInvitationRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	args := m.Called(invitation)
+	return args.Error(0)
+}
+
+func (m *MockInvitationRepository) GetInvitation(ctx context.Context, id uuid.UUID) (*models.Invitation, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
+func (m *MockInvitationRepository) ListInvitations(ctx context.Context, limit, offset int) ([]*models.Invitation, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]*models.Invitation), args.Error(1)
+}
+
+func (m *MockInvitationRepository) RenewInvitation(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time) (*models.Invitation, error) {
+	args := m.Called(id, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
+func (m *MockInvitationRepository) RevokeInvitation(ctx context.Context, id uuid.UUID) (*models.Invitation, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
+func (m *MockInvitationRepository) AcceptInvitation(ctx context.Context, id uuid.UUID, tokenHash string, req *models.RegisterRequest) (*models.Invitation, *models.User, error) {
+	args := m.Called(id, tokenHash, req)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.Invitation), args.Get(1).(*models.User), args.Error(2)
+}
+
+// recordingNotifier collects notifications in memory
+type recordingNotifier struct {
+	messages []notify.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func newTestInvitationHandler(invitations repository.InvitationRepository, notifier notify.Notifier, auditor audit.Recorder) *InvitationHandler {
+	return NewInvitationHandler(invitations, middleware.NewSignedTokens(middleware.NewJWTKeys("secret")), new(MockTokenGenerator), notifier, auditor,
+		InvitationSettings{TTL: time.Hour, AcceptURL: "https://app.example.com/accept?source=email"})
+}
+
+// invitationToken extracts the token from the link in an invitation message
+func invitationToken(t *testing.T, msg notify.Message) string {
+	start := strings.Index(msg.Text, "https://")
+	require.GreaterOrEqual(t, start, 0, "no link in %q", msg.Text)
+	link, err := url.Parse(strings.Fields(msg.Text[start:])[0])
+	require.NoError(t, err)
+	assert.Equal(t, "email", link.Query().Get("source"))
+	return link.Query().Get("token")
+}
+
+func TestCreateInvitation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	adminID := uuid.New()
+	invitations := new(MockInvitationRepository)
+	notifier := &recordingNotifier{}
+	auditor := &recordingAuditor{}
+	handler := newTestInvitationHandler(invitations, notifier, auditor)
+
+	var stored *models.Invitation
+	invitations.On("CreateInvitation", mock.AnythingOfType("*models.Invitation")).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*models.Invitation) }).
+		Return(nil).Once()
+	invitations.On("CreateInvitation", mock.Anything).Return(repository.ErrInvitationPending).Once()
+
+	router := gin.New()
+	router.POST("/invitations", func(c *gin.Context) {
+		c.Set("userID", adminID.String())
+		handler.CreateInvitation(c)
+	})
+	invite := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/invitations", bytes.NewBufferString(`{"email":"new@example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := invite()
+	require.Equal(t, http.StatusCreated, resp.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, models.InvitationPending, body["status"])
+	assert.Equal(t, models.RoleUser, body["role"])
+	assert.NotContains(t, resp.Body.String(), stored.TokenHash)
+
+	assert.Equal(t, &adminID, stored.InviterID)
+	require.Len(t, notifier.messages, 1)
+	assert.Equal(t, "new@example.com", notifier.messages[0].To)
+
+	// The link carries a token for this invitation, whose hash was stored
+	token := invitationToken(t, notifier.messages[0])
+	id, err := handler.tokens.Verify(invitationTokenPurpose, token)
+	require.NoError(t, err)
+	assert.Equal(t, stored.ID, id)
+	assert.Equal(t, middleware.TokenHash(token), stored.TokenHash)
+	assert.Equal(t, audit.ActionInvitationCreated, auditor.events[0].Action)
+
+	resp = invite()
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Len(t, notifier.messages, 1)
+	invitations.AssertExpectations(t)
+}
+
+func TestResendInvitation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	id := uuid.New()
+	closedID := uuid.New()
+	invitations := new(MockInvitationRepository)
+	notifier := &recordingNotifier{}
+	handler := newTestInvitationHandler(invitations, notifier, nil)
+
+	invitations.On("RenewInvitation", id, mock.Anything).
+		Return(&models.Invitation{ID: id, Email: "new@example.com", Role: models.RoleUser, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	invitations.On("RenewInvitation", closedID, mock.Anything).Return(nil, repository.ErrInvitationClosed)
+
+	router := gin.New()
+	router.POST("/invitations/:id/resend", handler.ResendInvitation)
+	resend := func(id uuid.UUID) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/invitations/"+id.String()+"/resend", nil))
+		return resp
+	}
+
+	resp := resend(id)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Len(t, notifier.messages, 1)
+	token := invitationToken(t, notifier.messages[0])
+	invitations.AssertCalled(t, "RenewInvitation", id, middleware.TokenHash(token))
+
+	resp = resend(closedID)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Len(t, notifier.messages, 1)
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	invitations := new(MockInvitationRepository)
+	auditor := &recordingAuditor{}
+	handler := newTestInvitationHandler(invitations, &recordingNotifier{}, auditor)
+
+	organizationID := uuid.New()
+	invitation := &models.Invitation{ID: uuid.New(), OrganizationID: organizationID, Email: "new@example.com", Role: models.RoleAdmin}
+	token, err := handler.tokens.Issue(invitationTokenPurpose, invitation.ID)
+	require.NoError(t, err)
+	user := &models.User{ID: uuid.New(), OrganizationID: organizationID, Email: invitation.Email, Role: models.RoleAdmin}
+	invitations.On("AcceptInvitation", invitation.ID, middleware.TokenHash(token), mock.MatchedBy(func(req *models.RegisterRequest) bool {
+		return req.Password == "password123" && req.FirstName == "New"
+	})).Return(invitation, user, nil).Once()
+	invitations.On("AcceptInvitation", invitation.ID, middleware.TokenHash(token), mock.Anything).Return(nil, nil, repository.ErrInvitationInvalid)
+
+	router := gin.New()
+	router.POST("/invitations/accept", handler.AcceptInvitation)
+	accept := func(token string) *httptest.ResponseRecorder {
+		body := `{"token":"` + token + `","password":"password123","firstName":"New","lastName":"User"}`
+		req := httptest.NewRequest(http.MethodPost, "/invitations/accept", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// A forged token never reaches the repository
+	forged, err := middleware.NewSignedTokens(middleware.NewJWTKeys("other")).Issue(invitationTokenPurpose, invitation.ID)
+	require.NoError(t, err)
+	resp := accept(forged)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	invitations.AssertNotCalled(t, "AcceptInvitation", mock.Anything, mock.Anything, mock.Anything)
+
+	resp = accept(token)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	var body models.LoginResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "test-jwt-token", body.Token)
+	assert.Equal(t, user.ID, body.User.ID)
+
+	require.Len(t, auditor.events, 1)
+	event := auditor.events[0]
+	assert.Equal(t, audit.ActionInvitationAccepted, event.Action)
+	assert.Equal(t, &organizationID, event.OrganizationID)
+	assert.NotEqual(t, tenant.DefaultOrganizationID, *event.OrganizationID)
+
+	// Tokens are single use
+	resp = accept(token)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/notify"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// magicLinkTokenPurpose binds signed tokens to sign-in links
+	magicLinkTokenPurpose = "magic_link"
+	// loginCodeDigits is the length of emailed sign-in codes
+	loginCodeDigits = 6
+)
+
+// MagicLinkSettings controls passwordless sign-in
+type MagicLinkSettings struct {
+	// TTL is how long a sign-in link or code can be used
+	TTL time.Duration
+	// URL is the page sign-in links point to; the token is added as its
+	// token query parameter
+	URL string
+	// MaxAttempts is how many wrong guesses an emailed code survives
+	MaxAttempts int
+	// ResendInterval is the minimum time between two sign-in emails to a user
+	ResendInterval time.Duration
+}
+
+// passwordless holds what a UserHandler needs for passwordless sign-in
+type passwordless struct {
+	codes    repository.CodeRepository
+	tokens   *middleware.SignedTokens
+	notifier notify.Notifier
+	settings MagicLinkSettings
+}
+
+// WithMagicLinks lets users sign in with a single-use link or code emailed
+// to them instead of their password
+func WithMagicLinks(codes repository.CodeRepository, tokens *middleware.SignedTokens, notifier notify.Notifier, settings MagicLinkSettings) Option {
+	return func(h *UserHandler) {
+		h.passwordless = &passwordless{codes: codes, tokens: tokens, notifier: notifier, settings: settings}
+	}
+}
+
+// RequestMagicLink emails a sign-in link or code. The response is the same
+// whether or not the account exists, so it cannot be used to find accounts.
+func (h *UserHandler) RequestMagicLink(c *gin.Context) {
+	if h.passwordless == nil {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "passwordless sign-in is not enabled"))
+		return
+	}
+	var req models.MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if req.Method == "" {
+		req.Method = models.MagicLinkMethodLink
+	}
+
+	if err := h.sendMagicLink(c, &req); err != nil {
+		if errors.Is(err, repository.ErrCodeTooSoon) {
+			slog.InfoContext(c.Request.Context(), "Sign-in email not sent; one was sent recently")
+		} else {
+			slog.ErrorContext(c.Request.Context(), "Failed to send sign-in email", "error", err)
+		}
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a sign-in email has been sent"})
+}
+
+// sendMagicLink does the work of RequestMagicLink. Unknown organizations and
+// users are not errors, as the caller must not learn about them.
+func (h *UserHandler) sendMagicLink(c *gin.Context, req *models.MagicLinkRequest) error {
+	p := h.passwordless
+	if err := h.enterOrganization(c, req.Organization); err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return nil
+		}
+		return err
+	}
+	user, err := h.repo.GetUserByEmail(c.Request.Context(), req.Email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			slog.InfoContext(c.Request.Context(), "Sign-in email requested for unknown user")
+			return nil
+		}
+		return err
+	}
+
+	code := &models.OneTimeCode{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Purpose:   models.CodePurposeLogin,
+		Target:    user.Email,
+		ExpiresAt: time.Now().Add(p.settings.TTL),
+	}
+	data := struct{ Link, Code, Minutes string }{
+		Minutes: strconv.Itoa(int(math.Ceil(p.settings.TTL.Minutes()))),
+	}
+	if req.Method == models.MagicLinkMethodCode {
+		if data.Code, err = middleware.NumericCode(loginCodeDigits); err != nil {
+			return err
+		}
+		code.CodeHash = codeHash(user.ID, data.Code)
+	} else {
+		// The link carries a signed token naming the stored code
+		token, err := p.tokens.Issue(magicLinkTokenPurpose, code.ID)
+		if err != nil {
+			return err
+		}
+		code.CodeHash = middleware.TokenHash(token)
+		if data.Link, err = linkWithToken(p.settings.URL, token); err != nil {
+			return err
+		}
+	}
+	if err := p.codes.SaveCode(c.Request.Context(), code, p.settings.ResendInterval); err != nil {
+		return err
+	}
+
+	msg, err := notify.Render("magic_link", requestLocale(c), data)
+	if err != nil {
+		return err
+	}
+	msg.Channel = notify.Email
+	msg.To = user.Email
+	if err := p.notifier.Notify(c.Request.Context(), msg); err != nil {
+		return err
+	}
+
+	h.recordAudit(c, &audit.Event{
+		Action:       audit.ActionMagicLinkSent,
+		TargetUserID: &user.ID,
+		Metadata:     map[string]interface{}{"method": req.Method},
+	})
+	return nil
+}
+
+// MagicLinkLogin exchanges a sign-in token or code for the same response as
+// Login. Every kind of failure gets the same answer.
+func (h *UserHandler) MagicLinkLogin(c *gin.Context) {
+	if h.passwordless == nil {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "passwordless sign-in is not enabled"))
+		return
+	}
+	var req models.MagicLinkLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.LoginFailed(metrics.LoginReasonInvalidRequest)
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	var user *models.User
+	var err error
+	if req.Token != "" {
+		user, err = h.consumeMagicLink(c, req.Token)
+	} else {
+		user, err = h.consumeLoginCode(c, &req)
+	}
+	if err != nil {
+		reason := metrics.LoginReasonInvalidCode
+		if !errors.Is(err, repository.ErrCodeInvalid) && !errors.Is(err, repository.ErrCodeExpired) &&
+			!errors.Is(err, repository.ErrCodeAttempts) && !errors.Is(err, repository.ErrUserNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Passwordless sign-in failed", "error", err)
+			c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to sign in"))
+			return
+		}
+		slog.InfoContext(c.Request.Context(), "Login failed", "reason", reason, "error", err)
+		event := &audit.Event{
+			Action:   audit.ActionLoginFailed,
+			Metadata: map[string]interface{}{"email": req.Email, "reason": reason},
+		}
+		if user != nil {
+			event.TargetUserID = &user.ID
+		}
+		h.recordAudit(c, event)
+		metrics.LoginFailed(reason)
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "invalid or expired sign-in link or code"))
+		return
+	}
+
+	token, err := h.issueToken(c.Request.Context(), user)
+	if err != nil {
+		metrics.LoginFailed(metrics.LoginReasonTokenError)
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate token"))
+		return
+	}
+
+	metrics.LoginSucceeded()
+	h.recordAudit(c, &audit.Event{
+		ActorID:      &user.ID,
+		Action:       audit.ActionLogin,
+		TargetUserID: &user.ID,
+		Metadata:     map[string]interface{}{"method": "passwordless"},
+	})
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		Token: token,
+		User:  newUserResponse(user),
+	})
+}
+
+// consumeMagicLink uses up the code named by a sign-in link token and
+// returns its user. The code decides the organization.
+func (h *UserHandler) consumeMagicLink(c *gin.Context, token string) (*models.User, error) {
+	id, err := h.passwordless.tokens.Verify(magicLinkTokenPurpose, token)
+	if err != nil {
+		return nil, repository.ErrCodeInvalid
+	}
+	code, err := h.passwordless.codes.ConsumeCodeByID(c.Request.Context(), id, models.CodePurposeLogin, middleware.TokenHash(token))
+	if err != nil {
+		return nil, err
+	}
+	c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), code.OrganizationID))
+	return h.repo.GetUserByID(c.Request.Context(), code.UserID)
+}
+
+// consumeLoginCode uses up the code emailed to req.Email and returns its
+// user. A wrong code also returns the user, for the audit log.
+func (h *UserHandler) consumeLoginCode(c *gin.Context, req *models.MagicLinkLoginRequest) (*models.User, error) {
+	if err := h.enterOrganization(c, req.Organization); err != nil {
+		if errors.Is(err, repository.ErrOrganizationNotFound) {
+			return nil, repository.ErrUserNotFound
+		}
+		return nil, err
+	}
+	user, err := h.repo.GetUserByEmail(c.Request.Context(), req.Email)
+	if err != nil {
+		return nil, err
+	}
+	_, err = h.passwordless.codes.ConsumeCode(c.Request.Context(), user.ID, models.CodePurposeLogin,
+		codeHash(user.ID, req.Code), h.passwordless.settings.MaxAttempts)
+	return user, err
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMagicLinkRouter(users *MockUserRepository, codes *MockCodeRepository, notifier *recordingNotifier, auditor *recordingAuditor) (*gin.Engine, *middleware.SignedTokens) {
+	tokens := middleware.NewSignedTokens(middleware.NewJWTKeys("secret"))
+	handler := NewUserHandler(users, new(MockTokenGenerator), new(MockPasswordHasher), WithAuditor(auditor),
+		WithMagicLinks(codes, tokens, notifier, MagicLinkSettings{
+			TTL:            15 * time.Minute,
+			URL:            "https://app.example.com/sign-in",
+			MaxAttempts:    5,
+			ResendInterval: time.Minute,
+		}))
+	router := gin.New()
+	router.POST("/auth/magic-link", handler.RequestMagicLink)
+	router.POST("/auth/magic-link/verify", handler.MagicLinkLogin)
+	return router, tokens
+}
+
+func postJSON(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRequestMagicLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), OrganizationID: tenant.DefaultOrganizationID, Email: "user@example.com"}
+	users := new(MockUserRepository)
+	users.On("GetUserByEmail", "user@example.com").Return(user, nil)
+	users.On("GetUserByEmail", "nobody@example.com").Return(nil, repository.ErrUserNotFound)
+	codes := new(MockCodeRepository)
+	var stored []*models.OneTimeCode
+	codes.On("SaveCode", mock.AnythingOfType("*models.OneTimeCode"), time.Minute).
+		Run(func(args mock.Arguments) { stored = append(stored, args.Get(0).(*models.OneTimeCode)) }).
+		Return(nil).Twice()
+	codes.On("SaveCode", mock.Anything, time.Minute).Return(repository.ErrCodeTooSoon)
+	notifier := &recordingNotifier{}
+	auditor := &recordingAuditor{}
+	router, tokens := newTestMagicLinkRouter(users, codes, notifier, auditor)
+
+	// A link whose signed token names the stored code
+	resp := postJSON(router, "/auth/magic-link", `{"email":"user@example.com"}`)
+	require.Equal(t, http.StatusAccepted, resp.Code)
+	accepted := resp.Body.String()
+	require.Len(t, notifier.messages, 1)
+	assert.Equal(t, "user@example.com", notifier.messages[0].To)
+	token := regexp.MustCompile(`token=([^\s&"]+)`).FindStringSubmatch(notifier.messages[0].Text)
+	require.Len(t, token, 2)
+	id, err := tokens.Verify(magicLinkTokenPurpose, token[1])
+	require.NoError(t, err)
+	assert.Equal(t, stored[0].ID, id)
+	assert.Equal(t, models.CodePurposeLogin, stored[0].Purpose)
+	assert.Equal(t, middleware.TokenHash(token[1]), stored[0].CodeHash)
+
+	// A code to type in
+	resp = postJSON(router, "/auth/magic-link", `{"email":"user@example.com","method":"code"}`)
+	require.Equal(t, http.StatusAccepted, resp.Code)
+	require.Len(t, notifier.messages, 2)
+	code := regexp.MustCompile(`[0-9]{6}`).FindString(notifier.messages[1].Text)
+	assert.Equal(t, codeHash(user.ID, code), stored[1].CodeHash)
+	assert.Equal(t, audit.ActionMagicLinkSent, auditor.events[1].Action)
+
+	// Unknown accounts and requests within the resend interval look the same
+	// as a sent email
+	for _, body := range []string{
+		`{"email":"nobody@example.com"}`,
+		`{"email":"user@example.com"}`,
+	} {
+		resp = postJSON(router, "/auth/magic-link", body)
+		assert.Equal(t, http.StatusAccepted, resp.Code)
+		assert.Equal(t, accepted, resp.Body.String())
+	}
+	assert.Len(t, notifier.messages, 2)
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	organizationID := uuid.New()
+	user := &models.User{ID: uuid.New(), OrganizationID: organizationID, Email: "user@example.com"}
+	users := new(MockUserRepository)
+	users.On("GetUserByID", user.ID).Return(user, nil)
+	users.On("GetUserByEmail", "user@example.com").Return(user, nil)
+	users.On("GetUserByEmail", "nobody@example.com").Return(nil, repository.ErrUserNotFound)
+	codes := new(MockCodeRepository)
+	auditor := &recordingAuditor{}
+	router, tokens := newTestMagicLinkRouter(users, codes, &recordingNotifier{}, auditor)
+
+	codeID := uuid.New()
+	token, err := tokens.Issue(magicLinkTokenPurpose, codeID)
+	require.NoError(t, err)
+	codes.On("ConsumeCodeByID", codeID, models.CodePurposeLogin, middleware.TokenHash(token)).
+		Return(&models.OneTimeCode{ID: codeID, OrganizationID: organizationID, UserID: user.ID}, nil).Once()
+	codes.On("ConsumeCodeByID", codeID, models.CodePurposeLogin, mock.Anything).Return(nil, repository.ErrCodeInvalid)
+	codes.On("ConsumeCode", user.ID, models.CodePurposeLogin, codeHash(user.ID, "123456"), 5).
+		Return(&models.OneTimeCode{UserID: user.ID}, nil).Once()
+	codes.On("ConsumeCode", user.ID, models.CodePurposeLogin, mock.Anything, 5).Return(nil, repository.ErrCodeAttempts)
+
+	// Exchanging the link signs in, in the organization of the code
+	resp := postJSON(router, "/auth/magic-link/verify", `{"token":"`+token+`"}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var body models.LoginResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "test-jwt-token", body.Token)
+	assert.Equal(t, user.ID, body.User.ID)
+	assert.Equal(t, audit.ActionLogin, auditor.events[0].Action)
+
+	resp = postJSON(router, "/auth/magic-link/verify", `{"email":"user@example.com","code":"123456"}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// Used links, forged tokens, wrong codes and unknown accounts fail alike
+	forged, err := middleware.NewSignedTokens(middleware.NewJWTKeys("other")).Issue(magicLinkTokenPurpose, codeID)
+	require.NoError(t, err)
+	var failures []string
+	for _, req := range []string{
+		`{"token":"` + token + `"}`,
+		`{"token":"` + forged + `"}`,
+		`{"email":"user@example.com","code":"123456"}`,
+		`{"email":"nobody@example.com","code":"123456"}`,
+	} {
+		resp = postJSON(router, "/auth/magic-link/verify", req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		var failure map[string]interface{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &failure))
+		failures = append(failures, failure["error"].(string))
+	}
+	for _, failure := range failures {
+		assert.Equal(t, failures[0], failure)
+	}
+	assert.Equal(t, audit.ActionLoginFailed, auditor.events[len(auditor.events)-1].Action)
+
+	// A code needs the email it was sent to
+	resp = postJSON(router, "/auth/magic-link/verify", `{"code":"123456"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
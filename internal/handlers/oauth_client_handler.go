@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OAuthClientHandler lets admins register the applications that sign their
+// organization's users in through the OpenID Connect provider
+type OAuthClientHandler struct {
+	clients repository.OAuthRepository
+	auditor audit.Recorder
+}
+
+func NewOAuthClientHandler(clients repository.OAuthRepository, auditor audit.Recorder) *OAuthClientHandler {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	return &OAuthClientHandler{clients: clients, auditor: auditor}
+}
+
+// CreateClient registers a client. The secret of a confidential client is
+// only returned here.
+func (h *OAuthClientHandler) CreateClient(c *gin.Context) {
+	var req models.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if !checkRedirectURIs(c, req.RedirectURIs) {
+		return
+	}
+
+	client := &models.OAuthClient{Name: req.Name, RedirectURIs: req.RedirectURIs}
+	var secret string
+	if req.Confidential {
+		var ok bool
+		if secret, ok = newClientSecret(c, client); !ok {
+			return
+		}
+	}
+	if err := h.clients.CreateClient(c.Request.Context(), client); err != nil {
+		writeOAuthClientError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionOAuthClientCreated,
+		Changes:  audit.Diff(nil, models.NewOAuthClientResponse(client)),
+		Metadata: map[string]interface{}{"clientId": client.ID},
+	})
+
+	response := models.NewOAuthClientResponse(client)
+	response.ClientSecret = secret
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListClients returns a page of the organization's clients, oldest first
+func (h *OAuthClientHandler) ListClients(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	clients, err := h.clients.ListClients(c.Request.Context(), limit, offset)
+	if err != nil {
+		writeOAuthClientError(c, err)
+		return
+	}
+
+	response := make([]models.OAuthClientResponse, len(clients))
+	for i, client := range clients {
+		response[i] = models.NewOAuthClientResponse(client)
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": response})
+}
+
+// GetClient returns a single client
+func (h *OAuthClientHandler) GetClient(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	client, err := h.clients.GetClient(c.Request.Context(), id)
+	if err != nil {
+		writeOAuthClientError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.NewOAuthClientResponse(client))
+}
+
+// UpdateClient replaces the name and redirect URIs of a client and
+// optionally rotates its secret
+func (h *OAuthClientHandler) UpdateClient(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	var req models.UpdateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if !checkRedirectURIs(c, req.RedirectURIs) {
+		return
+	}
+
+	client, err := h.clients.GetClient(c.Request.Context(), id)
+	if err != nil {
+		writeOAuthClientError(c, err)
+		return
+	}
+	before := *client
+	client.Name = req.Name
+	client.RedirectURIs = req.RedirectURIs
+	var secret string
+	if req.RotateSecret {
+		if !client.Confidential() {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "public clients have no secret to rotate"))
+			return
+		}
+		if secret, ok = newClientSecret(c, client); !ok {
+			return
+		}
+	}
+
+	if err := h.clients.UpdateClient(c.Request.Context(), client); err != nil {
+		writeOAuthClientError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionOAuthClientUpdated,
+		Changes:  audit.Diff(models.NewOAuthClientResponse(&before), models.NewOAuthClientResponse(client)),
+		Metadata: map[string]interface{}{"clientId": id, "secretRotated": req.RotateSecret},
+	})
+
+	response := models.NewOAuthClientResponse(client)
+	response.ClientSecret = secret
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteClient removes a client together with its consents and tokens
+func (h *OAuthClientHandler) DeleteClient(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.clients.DeleteClient(c.Request.Context(), id); err != nil {
+		writeOAuthClientError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionOAuthClientDeleted,
+		Metadata: map[string]interface{}{"clientId": id},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "oauth client deleted successfully"})
+}
+
+// checkRedirectURIs rejects redirect URIs that are relative or carry a
+// fragment (RFC 6749 section 3.1.2), writing a 400
+func checkRedirectURIs(c *gin.Context, uris []string) bool {
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "redirect URI "+strconv.Quote(uri)+" must be absolute and have no fragment"))
+			return false
+		}
+	}
+	return true
+}
+
+// newClientSecret generates a secret for client and stores its hash in it,
+// writing a 500 on failure
+func newClientSecret(c *gin.Context, client *models.OAuthClient) (string, bool) {
+	secret, err := middleware.RandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate client secret"))
+		return "", false
+	}
+	client.SecretHash = middleware.TokenHash(secret)
+	return secret, true
+}
+
+// writeOAuthClientError maps OAuth repository errors to HTTP responses
+func writeOAuthClientError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrOAuthClientNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
+}
@@ -0,0 +1,574 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/oidc"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OAuthSettings controls the OpenID Connect provider
+type OAuthSettings struct {
+	// Issuer is the provider's public base URL, without a trailing slash
+	Issuer string
+	// ConsentURL is the page that signs the user in and asks for consent;
+	// the authorization request is passed on as its query
+	ConsentURL string
+	// CodeTTL is how long an authorization code can be exchanged
+	CodeTTL time.Duration
+	// AccessTokenTTL is how long access and ID tokens are valid
+	AccessTokenTTL time.Duration
+}
+
+// OAuthHandler serves the OpenID Connect provider: the authorization code
+// flow with PKCE, the userinfo, introspection and revocation endpoints and
+// discovery. Protocol errors use the RFC 6749 error format rather than the
+// API's.
+type OAuthHandler struct {
+	oauth    repository.OAuthRepository
+	users    repository.UserRepository
+	signer   *oidc.Signer
+	auditor  audit.Recorder
+	settings OAuthSettings
+}
+
+func NewOAuthHandler(oauth repository.OAuthRepository, users repository.UserRepository, signer *oidc.Signer, auditor audit.Recorder, settings OAuthSettings) *OAuthHandler {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	return &OAuthHandler{
+		oauth:    oauth,
+		users:    users,
+		signer:   signer,
+		auditor:  auditor,
+		settings: settings,
+	}
+}
+
+// oauthError is an OAuth 2.0 error (RFC 6749 sections 4.1.2.1 and 5.2)
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	// redirect is set for authorization errors that may be sent to the
+	// client's redirect URI; the others mean the redirect URI cannot be
+	// trusted
+	redirect bool
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// Discovery serves the OpenID Provider Metadata
+func (h *OAuthHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, oidc.NewDiscovery(h.settings.Issuer))
+}
+
+// JWKS serves the public keys ID tokens are signed with
+func (h *OAuthHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.signer.JWKS())
+}
+
+// Authorize is the authorization endpoint. A valid request is sent on to
+// the consent page; errors are returned to the client when its redirect URI
+// can be trusted and shown to the user otherwise.
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var req models.AuthorizeRequest
+	_ = c.ShouldBindQuery(&req) // every field is a string
+
+	if _, _, err := h.checkRequest(c, &req); err != nil {
+		h.writeAuthorizeError(c, &req, err)
+		return
+	}
+
+	consent, err := url.Parse(h.settings.ConsentURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	consent.RawQuery = c.Request.URL.RawQuery
+	c.Redirect(http.StatusFound, consent.String())
+}
+
+// AuthorizationPrompt describes an authorization request to the consent
+// page of the signed-in user
+func (h *OAuthHandler) AuthorizationPrompt(c *gin.Context) {
+	var req models.AuthorizeRequest
+	_ = c.ShouldBindQuery(&req)
+
+	client, scopes, err := h.checkRequest(c, &req)
+	if err != nil {
+		h.writeAuthorizeAPIError(c, &req, err)
+		return
+	}
+	userID := actorID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "invalid user"))
+		return
+	}
+
+	required, err := h.consentRequired(c, *userID, client.ID, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	prompt := models.AuthorizationPrompt{Scopes: scopes, ConsentRequired: required}
+	prompt.Client.ClientID = client.ID
+	prompt.Client.Name = client.Name
+	c.JSON(http.StatusOK, prompt)
+}
+
+// Decide records the signed-in user's answer to an authorization request
+// and returns where to send the browser: back to the client with an
+// authorization code, or with access_denied
+func (h *OAuthHandler) Decide(c *gin.Context) {
+	var req models.AuthorizeDecision
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	client, scopes, err := h.checkRequest(c, &req.AuthorizeRequest)
+	if err != nil {
+		h.writeAuthorizeAPIError(c, &req.AuthorizeRequest, err)
+		return
+	}
+	userID := actorID(c)
+	if userID == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "invalid user"))
+		return
+	}
+
+	if !req.Approve {
+		recordAudit(c, h.auditor, &audit.Event{
+			Action:       audit.ActionOAuthDenied,
+			TargetUserID: userID,
+			Metadata:     map[string]interface{}{"clientId": client.ID, "scope": req.Scope},
+		})
+		c.JSON(http.StatusOK, models.AuthorizeResponse{
+			RedirectTo: h.redirectURL(&req.AuthorizeRequest, url.Values{"error": {"access_denied"}}),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	granted := scopes
+	if consent, err := h.oauth.GetConsent(ctx, *userID, client.ID); err == nil {
+		granted = mergeScopes(strings.Fields(consent.Scope), scopes)
+	} else if !errors.Is(err, repository.ErrOAuthConsentNotFound) {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	err = h.oauth.SaveConsent(ctx, &models.OAuthConsent{UserID: *userID, ClientID: client.ID, Scope: strings.Join(granted, " ")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	code, err := middleware.RandomToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate authorization code"))
+		return
+	}
+	err = h.oauth.CreateAuthorizationCode(ctx, &models.OAuthAuthorizationCode{
+		ClientID:      client.ID,
+		UserID:        *userID,
+		CodeHash:      middleware.TokenHash(code),
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(h.settings.CodeTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:       audit.ActionOAuthAuthorized,
+		TargetUserID: userID,
+		Metadata:     map[string]interface{}{"clientId": client.ID, "scope": strings.Join(scopes, " ")},
+	})
+
+	c.JSON(http.StatusOK, models.AuthorizeResponse{
+		RedirectTo: h.redirectURL(&req.AuthorizeRequest, url.Values{"code": {code}}),
+	})
+}
+
+// Token is the token endpoint. It exchanges an authorization code for an
+// access token and, with the openid scope, an ID token.
+func (h *OAuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req models.TokenRequest
+	if err := c.ShouldBindWith(&req, binding.Form); err != nil {
+		c.JSON(http.StatusBadRequest, oauthError{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	client, ok := h.authenticateClient(c, req.ClientID, req.ClientSecret)
+	if !ok {
+		return
+	}
+	if req.GrantType != "authorization_code" {
+		c.JSON(http.StatusBadRequest, oauthError{Code: "unsupported_grant_type"})
+		return
+	}
+	if req.Code == "" || req.CodeVerifier == "" {
+		c.JSON(http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "code and code_verifier are required"})
+		return
+	}
+
+	ctx := tenant.WithOrganization(c.Request.Context(), client.OrganizationID)
+	c.Request = c.Request.WithContext(ctx)
+	code, err := h.oauth.ConsumeAuthorizationCode(ctx, middleware.TokenHash(req.Code))
+	if err == nil && (code.ClientID != client.ID || code.RedirectURI != req.RedirectURI ||
+		!oidc.VerifyPKCE(code.CodeChallenge, req.CodeVerifier)) {
+		err = repository.ErrOAuthCodeInvalid
+	}
+	var user *models.User
+	if err == nil {
+		user, err = h.users.GetUserByID(ctx, code.UserID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthCodeInvalid) || errors.Is(err, repository.ErrUserNotFound) {
+			slog.InfoContext(ctx, "Authorization code exchange failed", "client_id", client.ID, "error", err)
+			c.JSON(http.StatusBadRequest, oauthError{Code: "invalid_grant", Description: repository.ErrOAuthCodeInvalid.Error()})
+			return
+		}
+		slog.ErrorContext(ctx, "Authorization code exchange failed", "client_id", client.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+
+	response, err := h.issueTokens(c, client, code, user)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to issue tokens", "client_id", client.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// issueTokens stores a new access token for an exchanged code and signs
+// the ID token
+func (h *OAuthHandler) issueTokens(c *gin.Context, client *models.OAuthClient, code *models.OAuthAuthorizationCode, user *models.User) (*models.TokenResponse, error) {
+	accessToken, err := middleware.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = h.oauth.CreateAccessToken(c.Request.Context(), &models.OAuthAccessToken{
+		ClientID:            client.ID,
+		UserID:              user.ID,
+		AuthorizationCodeID: &code.ID,
+		TokenHash:           middleware.TokenHash(accessToken),
+		Scope:               code.Scope,
+		ExpiresAt:           now.Add(h.settings.AccessTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.TokenIssued("oauth_access")
+
+	response := &models.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.settings.AccessTokenTTL.Seconds()),
+		Scope:       code.Scope,
+	}
+	scopes := strings.Fields(code.Scope)
+	if !oidc.HasScope(scopes, oidc.ScopeOpenID) {
+		return response, nil
+	}
+
+	claims := jwt.MapClaims(oidc.UserClaims(user, scopes))
+	claims["iss"] = h.settings.Issuer
+	claims["aud"] = client.ID.String()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(h.settings.AccessTokenTTL).Unix()
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+	if response.IDToken, err = h.signer.Sign(claims); err != nil {
+		return nil, err
+	}
+	metrics.TokenIssued("id")
+	return response, nil
+}
+
+// UserInfo returns the claims about the user an access token was issued for
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	scheme, accessToken, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || accessToken == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="userinfo"`)
+		c.JSON(http.StatusUnauthorized, oauthError{Code: "invalid_request", Description: "a bearer access token is required"})
+		return
+	}
+
+	token, err := h.oauth.GetAccessToken(c.Request.Context(), middleware.TokenHash(accessToken))
+	if err != nil && !errors.Is(err, repository.ErrOAuthTokenNotFound) {
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	var user *models.User
+	if err == nil && token.Active(time.Now()) {
+		if !token.HasScope(oidc.ScopeOpenID) {
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			c.JSON(http.StatusForbidden, oauthError{Code: "insufficient_scope"})
+			return
+		}
+		ctx := tenant.WithOrganization(c.Request.Context(), token.OrganizationID)
+		c.Request = c.Request.WithContext(ctx)
+		user, err = h.users.GetUserByID(ctx, token.UserID)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+			return
+		}
+	}
+	if user == nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, oauthError{Code: "invalid_token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, oidc.UserClaims(user, strings.Fields(token.Scope)))
+}
+
+// Introspect tells a confidential client of the same organization whether
+// an access token is active (RFC 7662)
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	client, ok := h.authenticateClient(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+	if !ok {
+		return
+	}
+	if !client.Confidential() {
+		c.JSON(http.StatusUnauthorized, oauthError{Code: "invalid_client", Description: "only confidential clients may introspect tokens"})
+		return
+	}
+	value := c.PostForm("token")
+	if value == "" {
+		c.JSON(http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "token is required"})
+		return
+	}
+
+	token, err := h.oauth.GetAccessToken(c.Request.Context(), middleware.TokenHash(value))
+	if err != nil && !errors.Is(err, repository.ErrOAuthTokenNotFound) {
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	if err != nil || token.OrganizationID != client.OrganizationID || !token.Active(time.Now()) {
+		c.JSON(http.StatusOK, models.IntrospectionResponse{Active: false})
+		return
+	}
+	c.JSON(http.StatusOK, models.IntrospectionResponse{
+		Active:    true,
+		Scope:     token.Scope,
+		ClientID:  token.ClientID.String(),
+		Subject:   token.UserID.String(),
+		TokenType: "Bearer",
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+		Issuer:    h.settings.Issuer,
+	})
+}
+
+// Revoke revokes an access token issued to the calling client (RFC 7009).
+// Unknown tokens and tokens of other clients are ignored, so the answer is
+// always 200.
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	client, ok := h.authenticateClient(c, c.PostForm("client_id"), c.PostForm("client_secret"))
+	if !ok {
+		return
+	}
+	value := c.PostForm("token")
+	if value == "" {
+		c.JSON(http.StatusBadRequest, oauthError{Code: "invalid_request", Description: "token is required"})
+		return
+	}
+
+	token, err := h.oauth.GetAccessToken(c.Request.Context(), middleware.TokenHash(value))
+	if err == nil && token.ClientID == client.ID {
+		ctx := tenant.WithOrganization(c.Request.Context(), token.OrganizationID)
+		err = h.oauth.RevokeAccessToken(ctx, token.ID)
+	}
+	if err != nil && !errors.Is(err, repository.ErrOAuthTokenNotFound) {
+		c.JSON(http.StatusServiceUnavailable, oauthError{Code: "temporarily_unavailable"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// checkRequest validates an authorization request and returns its client
+// and scopes. Validation failures are *oauthError. Requests made by a
+// signed-in user must name a client of the user's organization.
+func (h *OAuthHandler) checkRequest(c *gin.Context, req *models.AuthorizeRequest) (*models.OAuthClient, []string, error) {
+	unknownClient := &oauthError{Code: "invalid_request", Description: "unknown client_id"}
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return nil, nil, unknownClient
+	}
+	client, err := h.oauth.FindClient(c.Request.Context(), clientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, nil, unknownClient
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if organizationID, ok := tenant.Organization(c.Request.Context()); ok && organizationID != client.OrganizationID {
+		return nil, nil, unknownClient
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return nil, nil, &oauthError{Code: "invalid_request", Description: "redirect_uri is not registered for the client"}
+	}
+
+	if req.ResponseType != "code" {
+		return nil, nil, &oauthError{Code: "unsupported_response_type", Description: "only the code response type is supported", redirect: true}
+	}
+	scopes, err := oidc.ParseScope(req.Scope)
+	if err != nil {
+		return nil, nil, &oauthError{Code: "invalid_scope", Description: err.Error(), redirect: true}
+	}
+	if req.CodeChallengeMethod != oidc.CodeChallengeS256 || !oidc.ValidCodeChallenge(req.CodeChallenge) {
+		return nil, nil, &oauthError{Code: "invalid_request", Description: "PKCE with code_challenge_method S256 is required", redirect: true}
+	}
+	return client, scopes, nil
+}
+
+// consentRequired reports whether the user has yet to grant the client any
+// of scopes
+func (h *OAuthHandler) consentRequired(c *gin.Context, userID, clientID uuid.UUID, scopes []string) (bool, error) {
+	consent, err := h.oauth.GetConsent(c.Request.Context(), userID, clientID)
+	if errors.Is(err, repository.ErrOAuthConsentNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	granted := strings.Fields(consent.Scope)
+	for _, scope := range scopes {
+		if !oidc.HasScope(granted, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeAuthorizeError answers the authorization endpoint with err, sending
+// the browser back to the client when the redirect URI can be trusted
+func (h *OAuthHandler) writeAuthorizeError(c *gin.Context, req *models.AuthorizeRequest, err error) {
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		slog.ErrorContext(c.Request.Context(), "Authorization request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	if !oerr.redirect {
+		c.JSON(http.StatusBadRequest, oerr)
+		return
+	}
+	c.Redirect(http.StatusFound, h.redirectURL(req, url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}}))
+}
+
+// writeAuthorizeAPIError answers the consent page's API with err. When the
+// client should hear about the error, redirectTo says where to send the
+// browser.
+func (h *OAuthHandler) writeAuthorizeAPIError(c *gin.Context, req *models.AuthorizeRequest, err error) {
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	body := middleware.ErrorBody(c, oerr.Description)
+	if oerr.redirect {
+		body["redirectTo"] = h.redirectURL(req, url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}})
+	}
+	c.JSON(http.StatusBadRequest, body)
+}
+
+// redirectURL adds params, the request's state and the issuer (RFC 9207)
+// to the already validated redirect URI of req
+func (h *OAuthHandler) redirectURL(req *models.AuthorizeRequest, params url.Values) string {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		// checkRequest only accepts registered redirect URIs, which parse
+		return req.RedirectURI
+	}
+	query := redirect.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", h.settings.Issuer)
+	redirect.RawQuery = query.Encode()
+	return redirect.String()
+}
+
+// authenticateClient identifies the calling client from HTTP Basic
+// credentials or the client_id and client_secret form fields. Confidential
+// clients must present their secret. On failure it writes a 401.
+func (h *OAuthHandler) authenticateClient(c *gin.Context, clientID, secret string) (*models.OAuthClient, bool) {
+	if id, password, ok := c.Request.BasicAuth(); ok {
+		// Basic credentials are form-encoded first (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(password)
+	}
+
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return nil, rejectClient(c, clientID, repository.ErrOAuthClientNotFound)
+	}
+	client, err := h.oauth.FindClient(c.Request.Context(), id)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, rejectClient(c, clientID, err)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "OAuth client lookup failed", "client_id", clientID, "error", err)
+		c.JSON(http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return nil, false
+	}
+	if client.Confidential() &&
+		subtle.ConstantTimeCompare([]byte(middleware.TokenHash(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, rejectClient(c, clientID, errors.New("wrong client secret"))
+	}
+	return client, true
+}
+
+// rejectClient writes the 401 for a failed client authentication and
+// returns false
+func rejectClient(c *gin.Context, clientID string, err error) bool {
+	slog.InfoContext(c.Request.Context(), "OAuth client authentication failed", "client_id", clientID, "error", err)
+	c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	c.JSON(http.StatusUnauthorized, oauthError{Code: "invalid_client"})
+	return false
+}
+
+// mergeScopes returns granted followed by the requested scopes not yet in it
+func mergeScopes(granted, requested []string) []string {
+	merged := append([]string{}, granted...)
+	for _, scope := range requested {
+		if !oidc.HasScope(merged, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/oidc"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockOAuthRepository is a mock implementation of OAuthRepository
+type MockOAuthRepository struct {
+	mock.Mock
+}
+
+func (m *MockOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	args := m.Called(client)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepository) GetClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthRepository) ListClients(ctx context.Context, limit, offset int) ([]*models.OAuthClient, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]*models.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthRepository) UpdateClient(ctx context.Context, client *models.OAuthClient) error {
+	args := m.Called(client)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepository) DeleteClient(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepository) FindClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthRepository) GetConsent(ctx context.Context, userID, clientID uuid.UUID) (*models.OAuthConsent, error) {
+	args := m.Called(userID, clientID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OAuthConsent), args.Error(1)
+}
+
+func (m *MockOAuthRepository) SaveConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	args := m.Called(consent)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error {
+	args := m.Called(code)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error) {
+	args := m.Called(codeHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OAuthAuthorizationCode), args.Error(1)
+}
+
+func (m *MockOAuthRepository) CreateAccessToken(ctx context.Context, token *models.OAuthAccessToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockOAuthRepository) GetAccessToken(ctx context.Context, tokenHash string) (*models.OAuthAccessToken, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OAuthAccessToken), args.Error(1)
+}
+
+func (m *MockOAuthRepository) RevokeAccessToken(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+const (
+	testIssuer       = "https://id.example.com/api/v1"
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// newTestOAuthRouter serves the provider's endpoints, with the consent API
+// signed in as user
+func newTestOAuthRouter(t *testing.T, oauth *MockOAuthRepository, users *MockUserRepository, auditor audit.Recorder, user *models.User) (*gin.Engine, *oidc.Signer) {
+	signer, err := oidc.NewSigner("")
+	require.NoError(t, err)
+	handler := NewOAuthHandler(oauth, users, signer, auditor, OAuthSettings{
+		Issuer:         testIssuer,
+		ConsentURL:     "https://app.example.com/authorize",
+		CodeTTL:        time.Minute,
+		AccessTokenTTL: time.Hour,
+	})
+
+	router := gin.New()
+	router.GET("/oauth/authorize", handler.Authorize)
+	router.POST("/oauth/token", handler.Token)
+	router.GET("/oauth/userinfo", handler.UserInfo)
+	router.POST("/oauth/introspect", handler.Introspect)
+	router.POST("/oauth/revoke", handler.Revoke)
+	signedIn := router.Group("/", func(c *gin.Context) {
+		c.Set("userID", user.ID.String())
+		c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), user.OrganizationID))
+	})
+	signedIn.GET("/oauth/consent", handler.AuthorizationPrompt)
+	signedIn.POST("/oauth/consent", handler.Decide)
+	return router, signer
+}
+
+// authorizeQuery returns a valid authorization request for client
+func authorizeQuery(client *models.OAuthClient) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {oidc.S256Challenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func postForm(router *gin.Engine, path string, form url.Values, clientID, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestOAuthAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	client := &models.OAuthClient{ID: uuid.New(), OrganizationID: uuid.New(), RedirectURIs: []string{testRedirectURI}}
+	oauth := new(MockOAuthRepository)
+	oauth.On("FindClient", client.ID).Return(client, nil)
+	oauth.On("FindClient", mock.Anything).Return(nil, repository.ErrOAuthClientNotFound)
+	router, _ := newTestOAuthRouter(t, oauth, new(MockUserRepository), nil, &models.User{ID: uuid.New()})
+
+	authorize := func(query url.Values) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil))
+		return resp
+	}
+
+	// A valid request goes on to the consent page unchanged
+	query := authorizeQuery(client)
+	resp := authorize(query)
+	require.Equal(t, http.StatusFound, resp.Code)
+	assert.Equal(t, "https://app.example.com/authorize?"+query.Encode(), resp.Header().Get("Location"))
+
+	// Errors are only sent to a registered redirect URI
+	for name, change := range map[string]func(url.Values){
+		"unknown client":      func(q url.Values) { q.Set("client_id", uuid.NewString()) },
+		"malformed client":    func(q url.Values) { q.Set("client_id", "app") },
+		"unregistered uri":    func(q url.Values) { q.Set("redirect_uri", "https://evil.example.com/callback") },
+		"missing redirect ur": func(q url.Values) { q.Del("redirect_uri") },
+	} {
+		query := authorizeQuery(client)
+		change(query)
+		resp := authorize(query)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, name)
+		assert.Empty(t, resp.Header().Get("Location"), name)
+	}
+
+	for want, change := range map[string]func(url.Values){
+		"invalid_request":           func(q url.Values) { q.Set("code_challenge_method", "plain") },
+		"invalid_scope":             func(q url.Values) { q.Set("scope", "openid admin") },
+		"unsupported_response_type": func(q url.Values) { q.Set("response_type", "token") },
+	} {
+		query := authorizeQuery(client)
+		change(query)
+		resp := authorize(query)
+		require.Equal(t, http.StatusFound, resp.Code, want)
+		location, err := url.Parse(resp.Header().Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "app.example.com", location.Host)
+		assert.Equal(t, want, location.Query().Get("error"))
+		assert.Equal(t, "xyz", location.Query().Get("state"))
+		assert.Equal(t, testIssuer, location.Query().Get("iss"))
+	}
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	organizationID := uuid.New()
+	user := &models.User{ID: uuid.New(), OrganizationID: organizationID, Email: "ada@example.com", FirstName: "Ada"}
+	client := &models.OAuthClient{
+		ID:             uuid.New(),
+		OrganizationID: organizationID,
+		Name:           "Example App",
+		SecretHash:     middleware.TokenHash("s3cret"),
+		RedirectURIs:   []string{testRedirectURI},
+	}
+	users := new(MockUserRepository)
+	users.On("GetUserByID", user.ID).Return(user, nil)
+	oauth := new(MockOAuthRepository)
+	oauth.On("FindClient", client.ID).Return(client, nil)
+	oauth.On("GetConsent", user.ID, client.ID).Return(&models.OAuthConsent{Scope: "openid"}, nil)
+	var consent *models.OAuthConsent
+	oauth.On("SaveConsent", mock.AnythingOfType("*models.OAuthConsent")).
+		Run(func(args mock.Arguments) { consent = args.Get(0).(*models.OAuthConsent) }).Return(nil)
+	var code *models.OAuthAuthorizationCode
+	oauth.On("CreateAuthorizationCode", mock.AnythingOfType("*models.OAuthAuthorizationCode")).
+		Run(func(args mock.Arguments) { code = args.Get(0).(*models.OAuthAuthorizationCode) }).Return(nil)
+	var accessToken *models.OAuthAccessToken
+	oauth.On("CreateAccessToken", mock.AnythingOfType("*models.OAuthAccessToken")).
+		Run(func(args mock.Arguments) {
+			accessToken = args.Get(0).(*models.OAuthAccessToken)
+			accessToken.ID, accessToken.OrganizationID, accessToken.CreatedAt = uuid.New(), organizationID, time.Now()
+		}).Return(nil)
+	auditor := &recordingAuditor{}
+	router, signer := newTestOAuthRouter(t, oauth, users, auditor, user)
+
+	// The consent page learns email is new
+	query := authorizeQuery(client)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/oauth/consent?"+query.Encode(), nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var prompt models.AuthorizationPrompt
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &prompt))
+	assert.Equal(t, "Example App", prompt.Client.Name)
+	assert.Equal(t, []string{"openid", "email"}, prompt.Scopes)
+	assert.True(t, prompt.ConsentRequired)
+
+	// Approving adds to the consent and returns a code to the client
+	decision := map[string]interface{}{"approve": true}
+	for key := range query {
+		decision[key] = query.Get(key)
+	}
+	body, err := json.Marshal(decision)
+	require.NoError(t, err)
+	resp = postJSON(router, "/oauth/consent", string(body))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var approved models.AuthorizeResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &approved))
+	redirect, err := url.Parse(approved.RedirectTo)
+	require.NoError(t, err)
+	assert.Equal(t, testRedirectURI, redirect.Scheme+"://"+redirect.Host+redirect.Path)
+	assert.Equal(t, "xyz", redirect.Query().Get("state"))
+	assert.Equal(t, testIssuer, redirect.Query().Get("iss"))
+	assert.Equal(t, "openid email", consent.Scope)
+	require.NotNil(t, code)
+	assert.Equal(t, middleware.TokenHash(redirect.Query().Get("code")), code.CodeHash)
+	assert.Equal(t, audit.ActionOAuthAuthorized, auditor.events[0].Action)
+
+	// Only the client holding the verifier can exchange the code
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {redirect.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	}
+	oauth.On("ConsumeAuthorizationCode", code.CodeHash).Return(code, nil).Once()
+	oauth.On("ConsumeAuthorizationCode", mock.Anything).Return(nil, repository.ErrOAuthCodeInvalid)
+	assert.Equal(t, http.StatusUnauthorized, postForm(router, "/oauth/token", exchange, client.ID.String(), "wrong").Code)
+	resp = postForm(router, "/oauth/token", exchange, client.ID.String(), "s3cret")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+	var tokens models.TokenResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tokens))
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, "openid email", tokens.Scope)
+	assert.Equal(t, middleware.TokenHash(tokens.AccessToken), accessToken.TokenHash)
+	assert.Equal(t, &code.ID, accessToken.AuthorizationCodeID)
+
+	// The ID token verifies with the published key
+	idToken, err := jwt.Parse(tokens.IDToken, func(token *jwt.Token) (interface{}, error) {
+		return signer.JWKS().Keys[0].PublicKey()
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(testIssuer), jwt.WithAudience(client.ID.String()))
+	require.NoError(t, err)
+	claims := idToken.Claims.(jwt.MapClaims)
+	assert.Equal(t, user.ID.String(), claims["sub"])
+	assert.Equal(t, "ada@example.com", claims["email"])
+	assert.Equal(t, "n-0S6", claims["nonce"])
+	assert.NotContains(t, claims, "given_name")
+
+	// The code works once
+	resp = postForm(router, "/oauth/token", exchange, client.ID.String(), "s3cret")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "invalid_grant")
+
+	// The access token reads userinfo and introspects as active
+	oauth.On("GetAccessToken", accessToken.TokenHash).Return(accessToken, nil)
+	oauth.On("GetAccessToken", mock.Anything).Return(nil, repository.ErrOAuthTokenNotFound)
+	req := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var userinfo map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &userinfo))
+	assert.Equal(t, map[string]interface{}{"sub": user.ID.String(), "email": "ada@example.com"}, userinfo)
+
+	req = httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer forged")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "invalid_token")
+
+	resp = postForm(router, "/oauth/introspect", url.Values{"token": {tokens.AccessToken}}, client.ID.String(), "s3cret")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var introspection models.IntrospectionResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &introspection))
+	assert.True(t, introspection.Active)
+	assert.Equal(t, user.ID.String(), introspection.Subject)
+
+	// Revocation answers 200 whether or not the token is known
+	oauth.On("RevokeAccessToken", accessToken.ID).Return(nil).Once()
+	assert.Equal(t, http.StatusOK, postForm(router, "/oauth/revoke", url.Values{"token": {tokens.AccessToken}}, client.ID.String(), "s3cret").Code)
+	assert.Equal(t, http.StatusOK, postForm(router, "/oauth/revoke", url.Values{"token": {"unknown"}}, client.ID.String(), "s3cret").Code)
+	oauth.AssertExpectations(t)
+}
+
+func TestOAuthDenyConsent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), OrganizationID: uuid.New()}
+	client := &models.OAuthClient{ID: uuid.New(), OrganizationID: user.OrganizationID, RedirectURIs: []string{testRedirectURI}}
+	foreign := &models.OAuthClient{ID: uuid.New(), OrganizationID: uuid.New(), RedirectURIs: []string{testRedirectURI}}
+	oauth := new(MockOAuthRepository)
+	oauth.On("FindClient", client.ID).Return(client, nil)
+	oauth.On("FindClient", foreign.ID).Return(foreign, nil)
+	auditor := &recordingAuditor{}
+	router, _ := newTestOAuthRouter(t, oauth, new(MockUserRepository), auditor, user)
+
+	decide := func(client *models.OAuthClient) *httptest.ResponseRecorder {
+		decision := map[string]interface{}{"approve": false}
+		query := authorizeQuery(client)
+		for key := range query {
+			decision[key] = query.Get(key)
+		}
+		body, err := json.Marshal(decision)
+		require.NoError(t, err)
+		return postJSON(router, "/oauth/consent", string(body))
+	}
+
+	resp := decide(client)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var denied models.AuthorizeResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &denied))
+	redirect, err := url.Parse(denied.RedirectTo)
+	require.NoError(t, err)
+	assert.Equal(t, "access_denied", redirect.Query().Get("error"))
+	assert.Equal(t, audit.ActionOAuthDenied, auditor.events[0].Action)
+
+	// Clients of other organizations are unknown to the user
+	assert.Equal(t, http.StatusBadRequest, decide(foreign).Code)
+	oauth.AssertNotCalled(t, "CreateAuthorizationCode", mock.Anything)
+}
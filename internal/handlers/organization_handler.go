@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationHandler shows users their organization and lets platform
+// admins manage every organization
+type OrganizationHandler struct {
+	orgs    repository.OrganizationRepository
+	auditor audit.Recorder
+}
+
+func NewOrganizationHandler(orgs repository.OrganizationRepository, auditor audit.Recorder) *OrganizationHandler {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	return &OrganizationHandler{orgs: orgs, auditor: auditor}
+}
+
+// organizationCreatedResponse is the new organization and, if one was
+// requested, its first admin
+type organizationCreatedResponse struct {
+	Organization *models.Organization `json:"organization"`
+	Admin        *models.UserResponse `json:"admin,omitempty"`
+}
+
+// GetCurrent returns the organization of the authenticated user
+func (h *OrganizationHandler) GetCurrent(c *gin.Context) {
+	organizationID, err := tenant.Require(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return
+	}
+
+	org, err := h.orgs.GetOrganizationByID(c.Request.Context(), organizationID)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// CreateOrganization creates an organization, optionally with its first
+// admin, who can then log in with the organization's slug
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	if !models.ValidSlug(req.Slug) {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "slug must be lower-case letters, digits and hyphens"))
+		return
+	}
+
+	org := &models.Organization{Slug: req.Slug, Name: req.Name}
+	admin, err := h.orgs.CreateOrganization(c.Request.Context(), org, req.Admin)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+
+	metadata := map[string]interface{}{"organizationId": org.ID, "slug": org.Slug}
+	response := organizationCreatedResponse{Organization: org}
+	if admin != nil {
+		metadata["adminUserId"] = admin.ID
+		adminResponse := newUserResponse(admin)
+		response.Admin = &adminResponse
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionOrganizationCreated,
+		Metadata: metadata,
+	})
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListOrganizations returns a page of organizations, oldest first
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	orgs, err := h.orgs.ListOrganizations(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// GetOrganization returns a single organization
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	org, err := h.orgs.GetOrganizationByID(c.Request.Context(), id)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// UpdateOrganization renames an organization
+func (h *OrganizationHandler) UpdateOrganization(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	before, err := h.orgs.GetOrganizationByID(c.Request.Context(), id)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+
+	org, err := h.orgs.UpdateOrganization(c.Request.Context(), id, &req)
+	if err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+	recordAudit(c, h.auditor, &audit.Event{
+		Action:   audit.ActionOrganizationUpdated,
+		Changes:  audit.Diff(before, org),
+		Metadata: map[string]interface{}{"organizationId": org.ID},
+	})
+
+	c.JSON(http.StatusOK, org)
+}
+
+// writeOrganizationError maps organization lookup and write errors to HTTP
+// responses
+func writeOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrOrganizationNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrSlugInUse):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
+}
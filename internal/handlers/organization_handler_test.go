@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockOrganizationRepository is a mock implementation of OrganizationRepository
+type MockOrganizationRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrganizationRepository) CreateOrganization(ctx context.Context, org *models.Organization, admin *models.RegisterRequest) (*models.User, error) {
+	args := m.Called(org, admin)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) GetOrganizationByID(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	args := m.Called(slug)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) ListOrganizations(ctx context.Context, limit, offset int) ([]*models.Organization, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]*models.Organization), args.Error(1)
+}
+
+func (m *MockOrganizationRepository) UpdateOrganization(ctx context.Context, id uuid.UUID, updates *models.UpdateOrganizationRequest) (*models.Organization, error) {
+	args := m.Called(id, updates)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Organization), args.Error(1)
+}
+
+func TestRegisterInOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockUserRepository)
+	mockOrgs := new(MockOrganizationRepository)
+	auditor := &recordingAuditor{}
+	handler := NewUserHandler(mockRepo, new(MockTokenGenerator), new(MockPasswordHasher),
+		WithAuditor(auditor), WithOrganizations(mockOrgs))
+
+	router := gin.New()
+	router.POST("/register", handler.Register)
+
+	acme := &models.Organization{ID: uuid.New(), Slug: "acme", Name: "Acme"}
+	mockOrgs.On("GetOrganizationBySlug", "acme").Return(acme, nil)
+	mockOrgs.On("GetOrganizationBySlug", "nope").Return(nil, repository.ErrOrganizationNotFound)
+	mockRepo.On("CreateUser", mock.Anything).Return(&models.User{ID: uuid.New(), OrganizationID: acme.ID, Email: "test@example.com"}, nil).Once()
+
+	register := func(organization string) *httptest.ResponseRecorder {
+		body := `{"organization":"` + organization + `","email":"test@example.com","password":"password123","firstName":"John","lastName":"Doe"}`
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := register("nope")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = register("acme")
+	require.Equal(t, http.StatusCreated, resp.Code)
+	event := auditor.events[len(auditor.events)-1]
+	assert.Equal(t, audit.ActionRegister, event.Action)
+	assert.Equal(t, &acme.ID, event.OrganizationID)
+
+	mockRepo.AssertExpectations(t)
+	mockOrgs.AssertExpectations(t)
+}
+
+func TestCreateOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	adminID := uuid.New()
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(m *MockOrganizationRepository)
+		expectedStatus int
+	}{
+		{
+			name:           "invalid slug",
+			body:           `{"slug":"Acme Corp","name":"Acme"}`,
+			mockSetup:      func(m *MockOrganizationRepository) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "slug taken",
+			body: `{"slug":"acme","name":"Acme"}`,
+			mockSetup: func(m *MockOrganizationRepository) {
+				m.On("CreateOrganization", mock.Anything, (*models.RegisterRequest)(nil)).Return(nil, repository.ErrSlugInUse)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "with first admin",
+			body: `{"slug":"acme","name":"Acme","admin":{"email":"admin@acme.test","password":"password123","firstName":"Ada","lastName":"Admin"}}`,
+			mockSetup: func(m *MockOrganizationRepository) {
+				m.On("CreateOrganization", mock.MatchedBy(func(org *models.Organization) bool { return org.Slug == "acme" }), mock.Anything).
+					Return(&models.User{ID: adminID, Email: "admin@acme.test", Role: models.RoleAdmin}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockOrgs := new(MockOrganizationRepository)
+			tt.mockSetup(mockOrgs)
+			handler := NewOrganizationHandler(mockOrgs, nil)
+
+			router := gin.New()
+			router.POST("/organizations", handler.CreateOrganization)
+
+			req := httptest.NewRequest(http.MethodPost, "/organizations", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			if tt.expectedStatus == http.StatusCreated {
+				var response organizationCreatedResponse
+				require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &response))
+				assert.Equal(t, "acme", response.Organization.Slug)
+				require.NotNil(t, response.Admin)
+				assert.Equal(t, adminID, response.Admin.ID)
+				assert.Equal(t, models.RoleAdmin, response.Admin.Role)
+			}
+			mockOrgs.AssertExpectations(t)
+		})
+	}
+}
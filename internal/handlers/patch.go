@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// MergePatchContentType is the media type of RFC 7396 JSON merge patches
+const MergePatchContentType = "application/merge-patch+json"
+
+// PatchProfile applies a JSON merge patch to the authenticated user
+func (h *UserHandler) PatchProfile(c *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return
+	}
+
+	// Parse UUID
+	id, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
+		return
+	}
+
+	h.patchUser(c, id, audit.ActionProfileUpdated)
+}
+
+// PatchUser applies a JSON merge patch to the user identified in the URL
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	// Parse ID from URL
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
+		return
+	}
+
+	h.patchUser(c, id, audit.ActionUserUpdated)
+}
+
+func (h *UserHandler) patchUser(c *gin.Context, id uuid.UUID, action string) {
+	patch, ok := bindMergePatch(c)
+	if !ok {
+		return
+	}
+
+	expected, ok := h.expectedVersion(c, func() (*models.User, error) { return h.repo.GetUserByID(c.Request.Context(), id) })
+	if !ok {
+		return
+	}
+
+	var user *models.User
+	var err error
+	if patch.IsEmpty() {
+		// An empty patch is a no-op; still report the current state
+		user, err = h.repo.GetUserByID(c.Request.Context(), id)
+		if err == nil && expected != 0 && user.Version != expected {
+			preconditionFailed(c)
+			return
+		}
+	} else {
+		var before *models.User
+		before, user, err = h.repo.PatchUser(c.Request.Context(), id, patch, expected)
+		if err == nil {
+			h.auditUserChange(c, action, before, user)
+		}
+	}
+	if err != nil {
+		h.writeUpdateError(c, err)
+		return
+	}
+
+	setUserETag(c, user)
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// bindMergePatch decodes and validates a merge patch body. It writes the
+// error response and returns ok=false when the body is unacceptable.
+func bindMergePatch(c *gin.Context) (*models.UserPatch, bool) {
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || (mediaType != MergePatchContentType && mediaType != "application/json") {
+		c.JSON(http.StatusUnsupportedMediaType, middleware.ErrorBody(c, "content type must be "+MergePatchContentType))
+		return nil, false
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "failed to read request body"))
+		return nil, false
+	}
+	// A non-object patch would replace the whole user, which is not supported
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '{' {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "merge patch must be a JSON object"))
+		return nil, false
+	}
+
+	var patch models.UserPatch
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid merge patch: "+err.Error()))
+		return nil, false
+	}
+
+	if fieldErrors := patch.Validate(); fieldErrors != nil {
+		body := middleware.ErrorBody(c, "invalid merge patch")
+		body["fields"] = fieldErrors
+		c.JSON(http.StatusUnprocessableEntity, body)
+		return nil, false
+	}
+
+	return &patch, true
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/notify"
+	"github.com/atulsm/user-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// phoneCodeDigits is the length of phone verification codes
+const phoneCodeDigits = 6
+
+// PhoneSettings controls phone number verification
+type PhoneSettings struct {
+	// CodeTTL is how long a verification code can be used
+	CodeTTL time.Duration
+	// MaxAttempts is how many wrong guesses a code survives
+	MaxAttempts int
+	// ResendInterval is the minimum time between two codes for a user
+	ResendInterval time.Duration
+}
+
+// PhoneHandler lets users prove they own their phone number by typing in a
+// code sent to it by SMS
+type PhoneHandler struct {
+	users    repository.UserRepository
+	codes    repository.CodeRepository
+	notifier notify.Notifier
+	auditor  audit.Recorder
+	settings PhoneSettings
+}
+
+func NewPhoneHandler(users repository.UserRepository, codes repository.CodeRepository, notifier notify.Notifier, auditor audit.Recorder, settings PhoneSettings) *PhoneHandler {
+	if auditor == nil {
+		auditor = audit.Nop{}
+	}
+	return &PhoneHandler{
+		users:    users,
+		codes:    codes,
+		notifier: notifier,
+		auditor:  auditor,
+		settings: settings,
+	}
+}
+
+// SendVerification texts a new verification code to the caller's phone
+// number. A new code replaces the previous one.
+func (h *PhoneHandler) SendVerification(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.PhoneVerifiedAt.Valid {
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, "phone number is already verified"))
+		return
+	}
+
+	code, err := middleware.NumericCode(phoneCodeDigits)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate verification code"))
+		return
+	}
+	stored := &models.OneTimeCode{
+		UserID:    user.ID,
+		Purpose:   models.CodePurposePhoneVerification,
+		Target:    user.PhoneNumber.String,
+		CodeHash:  codeHash(user.ID, code),
+		ExpiresAt: time.Now().Add(h.settings.CodeTTL),
+	}
+	if err := h.codes.SaveCode(c.Request.Context(), stored, h.settings.ResendInterval); err != nil {
+		if errors.Is(err, repository.ErrCodeTooSoon) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(h.settings.ResendInterval.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, middleware.ErrorBody(c, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to save verification code"))
+		return
+	}
+
+	msg, err := notify.Render("phone_verification", requestLocale(c), struct{ Code, Minutes string }{
+		Code:    code,
+		Minutes: strconv.Itoa(int(math.Ceil(h.settings.CodeTTL.Minutes()))),
+	})
+	if err == nil {
+		msg.Channel = notify.SMS
+		msg.To = stored.Target
+		err = h.notifier.Notify(c.Request.Context(), msg)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to send phone verification code", "user_id", user.ID, "error", err)
+		c.JSON(http.StatusBadGateway, middleware.ErrorBody(c, "verification code could not be sent"))
+		return
+	}
+
+	recordAudit(c, h.auditor, &audit.Event{Action: audit.ActionPhoneVerificationSent, TargetUserID: &user.ID})
+	c.JSON(http.StatusAccepted, models.PhoneVerificationResponse{PhoneNumber: stored.Target, ExpiresAt: stored.ExpiresAt})
+}
+
+// ConfirmVerification marks the caller's phone number verified when the
+// code matches the one last sent to it
+func (h *PhoneHandler) ConfirmVerification(c *gin.Context) {
+	var req models.ConfirmPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	code, err := h.codes.ConsumeCode(c.Request.Context(), user.ID, models.CodePurposePhoneVerification,
+		codeHash(user.ID, req.Code), h.settings.MaxAttempts)
+	if err == nil {
+		user, err = h.users.MarkPhoneVerified(c.Request.Context(), user.ID, code.Target)
+	}
+	if err != nil {
+		writePhoneError(c, err)
+		return
+	}
+
+	recordAudit(c, h.auditor, &audit.Event{Action: audit.ActionPhoneVerified, TargetUserID: &user.ID})
+	setUserETag(c, user)
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// currentUser loads the caller, who must have a phone number
+func (h *PhoneHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	id := actorID(c)
+	if id == nil {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
+		return nil, false
+	}
+	user, err := h.users.GetUserByID(c.Request.Context(), *id)
+	if err != nil {
+		writePhoneError(c, err)
+		return nil, false
+	}
+	if !user.PhoneNumber.Valid || user.PhoneNumber.String == "" {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "no phone number to verify; set phoneNumber on your profile first"))
+		return nil, false
+	}
+	return user, true
+}
+
+// writePhoneError maps code and user repository errors to HTTP responses
+func writePhoneError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
+	case errors.Is(err, repository.ErrCodeInvalid), errors.Is(err, repository.ErrCodeExpired):
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrCodeAttempts):
+		c.JSON(http.StatusTooManyRequests, middleware.ErrorBody(c, err.Error()))
+	case errors.Is(err, repository.ErrPhoneChanged):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, err.Error()))
+	default:
+		slog.ErrorContext(c.Request.Context(), "Phone verification failed", "error", err)
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to verify phone number"))
+	}
+}
+
+// codeHash is what is stored for a one-time code. The user ID is mixed in
+// so equal codes of different users hash differently.
+func codeHash(userID uuid.UUID, code string) string {
+	return middleware.TokenHash(userID.String() + ":" + code)
+}
+
+// requestLocale returns the caller's preferred language from the
+// Accept-Language header, or "" for the default
+func requestLocale(c *gin.Context) string {
+	first, _, _ := strings.Cut(c.GetHeader("Accept-Language"), ",")
+	tag, _, _ := strings.Cut(first, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/notify"
+	"github.com/atulsm/user-service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockCodeRepository is a mock implementation of CodeRepository
+type MockCodeRepository struct {
+	mock.Mock
+}
+
+func (m *MockCodeRepository) SaveCode(ctx context.Context, code *models.OneTimeCode, resendInterval time.Duration) error {
+	args := m.Called(code, resendInterval)
+	return args.Error(0)
+}
+
+func (m *MockCodeRepository) ConsumeCode(ctx context.Context, userID uuid.UUID, purpose, codeHash string, maxAttempts int) (*models.OneTimeCode, error) {
+	args := m.Called(userID, purpose, codeHash, maxAttempts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OneTimeCode), args.Error(1)
+}
+
+func (m *MockCodeRepository) ConsumeCodeByID(ctx context.Context, id uuid.UUID, purpose, codeHash string) (*models.OneTimeCode, error) {
+	args := m.Called(id, purpose, codeHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OneTimeCode), args.Error(1)
+}
+
+func newTestPhoneRouter(handler *PhoneHandler, userID uuid.UUID) *gin.Engine {
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("userID", userID.String()) })
+	router.POST("/phone/verification", handler.SendVerification)
+	router.POST("/phone/verification/confirm", handler.ConfirmVerification)
+	return router
+}
+
+func TestSendPhoneVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), PhoneNumber: sql.NullString{String: "+15551234567", Valid: true}}
+	users := new(MockUserRepository)
+	users.On("GetUserByID", user.ID).Return(user, nil)
+	codes := new(MockCodeRepository)
+	var stored *models.OneTimeCode
+	codes.On("SaveCode", mock.AnythingOfType("*models.OneTimeCode"), time.Minute).
+		Run(func(args mock.Arguments) { stored = args.Get(0).(*models.OneTimeCode) }).
+		Return(nil).Once()
+	codes.On("SaveCode", mock.Anything, time.Minute).Return(repository.ErrCodeTooSoon)
+	notifier := &recordingNotifier{}
+	auditor := &recordingAuditor{}
+	handler := NewPhoneHandler(users, codes, notifier, auditor, PhoneSettings{CodeTTL: 10 * time.Minute, MaxAttempts: 5, ResendInterval: time.Minute})
+	router := newTestPhoneRouter(handler, user.ID)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/phone/verification", nil)
+		req.Header.Set("Accept-Language", "es-ES,es;q=0.9,en;q=0.8")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send()
+	require.Equal(t, http.StatusAccepted, resp.Code)
+	var body models.PhoneVerificationResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "+15551234567", body.PhoneNumber)
+
+	// The code is texted in the caller's language and only its hash is stored
+	require.Len(t, notifier.messages, 1)
+	msg := notifier.messages[0]
+	assert.Equal(t, notify.SMS, msg.Channel)
+	assert.Equal(t, "+15551234567", msg.To)
+	assert.Contains(t, msg.Text, "Caduca en 10 minutos")
+	code := regexp.MustCompile(`[0-9]{6}`).FindString(msg.Text)
+	require.NotEmpty(t, code)
+	assert.Equal(t, models.CodePurposePhoneVerification, stored.Purpose)
+	assert.Equal(t, codeHash(user.ID, code), stored.CodeHash)
+	assert.NotContains(t, stored.CodeHash, code)
+	assert.Equal(t, audit.ActionPhoneVerificationSent, auditor.events[0].Action)
+
+	resp = send()
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "60", resp.Header().Get("Retry-After"))
+	assert.Len(t, notifier.messages, 1)
+}
+
+func TestSendPhoneVerificationRequiresUnverifiedPhone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	withoutPhone := &models.User{ID: uuid.New()}
+	verified := &models.User{
+		ID:              uuid.New(),
+		PhoneNumber:     sql.NullString{String: "+15551234567", Valid: true},
+		PhoneVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+	users := new(MockUserRepository)
+	users.On("GetUserByID", withoutPhone.ID).Return(withoutPhone, nil)
+	users.On("GetUserByID", verified.ID).Return(verified, nil)
+	codes := new(MockCodeRepository)
+	handler := NewPhoneHandler(users, codes, &recordingNotifier{}, nil, PhoneSettings{CodeTTL: time.Minute, MaxAttempts: 5})
+
+	for _, tc := range []struct {
+		user *models.User
+		want int
+	}{
+		{withoutPhone, http.StatusBadRequest},
+		{verified, http.StatusConflict},
+	} {
+		resp := httptest.NewRecorder()
+		newTestPhoneRouter(handler, tc.user.ID).ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/phone/verification", nil))
+		assert.Equal(t, tc.want, resp.Code)
+	}
+	codes.AssertNotCalled(t, "SaveCode", mock.Anything, mock.Anything)
+}
+
+func TestConfirmPhoneVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), PhoneNumber: sql.NullString{String: "+15551234567", Valid: true}}
+	verified := *user
+	verified.PhoneVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	users := new(MockUserRepository)
+	users.On("GetUserByID", user.ID).Return(user, nil)
+	users.On("MarkPhoneVerified", user.ID, "+15551234567").Return(&verified, nil).Once()
+
+	purpose := models.CodePurposePhoneVerification
+	codes := new(MockCodeRepository)
+	codes.On("ConsumeCode", user.ID, purpose, codeHash(user.ID, "111111"), 3).Return(nil, repository.ErrCodeInvalid)
+	codes.On("ConsumeCode", user.ID, purpose, codeHash(user.ID, "222222"), 3).Return(nil, repository.ErrCodeAttempts)
+	codes.On("ConsumeCode", user.ID, purpose, codeHash(user.ID, "123456"), 3).
+		Return(&models.OneTimeCode{UserID: user.ID, Purpose: purpose, Target: "+15551234567"}, nil)
+	auditor := &recordingAuditor{}
+	handler := NewPhoneHandler(users, codes, &recordingNotifier{}, auditor, PhoneSettings{CodeTTL: time.Minute, MaxAttempts: 3})
+	router := newTestPhoneRouter(handler, user.ID)
+
+	confirm := func(code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/phone/verification/confirm", bytes.NewBufferString(`{"code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusBadRequest, confirm("12ab56").Code)
+	assert.Equal(t, http.StatusBadRequest, confirm("111111").Code)
+	assert.Equal(t, http.StatusTooManyRequests, confirm("222222").Code)
+	users.AssertNotCalled(t, "MarkPhoneVerified", mock.Anything, mock.Anything)
+
+	resp := confirm("123456")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var body models.UserResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.NotNil(t, body.PhoneVerifiedAt)
+	require.Len(t, auditor.events, 1)
+	assert.Equal(t, audit.ActionPhoneVerified, auditor.events[0].Action)
+}
@@ -1,20 +1,27 @@
 package handlers
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/middleware"
 	"github.com/atulsm/user-service/internal/models"
 	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type TokenGenerator interface {
-	GenerateToken(userID string) (string, error)
+	GenerateToken(userID, organizationID string, groups ...string) (string, error)
 }
 
 type PasswordHasher interface {
@@ -26,91 +33,205 @@ type UserHandler struct {
 	repo     repository.UserRepository
 	tokenGen TokenGenerator
 	pwHasher PasswordHasher
+	auditor  audit.Recorder
+	orgs     repository.OrganizationRepository
+	// groups is set when issued tokens carry group claims
+	groups repository.GroupRepository
+	// passwordless is set when users may sign in without their password
+	passwordless *passwordless
+	// federation is set when users may sign in with identity providers
+	federation *federation
 }
 
-func NewUserHandler(repo repository.UserRepository, tokenGen TokenGenerator, pwHasher PasswordHasher) *UserHandler {
-	return &UserHandler{
+// Option configures optional UserHandler dependencies
+type Option func(*UserHandler)
+
+// WithAuditor records account and admin actions in the audit log
+func WithAuditor(auditor audit.Recorder) Option {
+	return func(h *UserHandler) {
+		h.auditor = auditor
+	}
+}
+
+// WithOrganizations lets public requests name an organization other than the
+// default one by its slug
+func WithOrganizations(orgs repository.OrganizationRepository) Option {
+	return func(h *UserHandler) {
+		h.orgs = orgs
+	}
+}
+
+// WithGroupClaims lists the IDs of the user's groups, including those
+// inherited through nesting, in the tokens issued on login and registration
+func WithGroupClaims(groups repository.GroupRepository) Option {
+	return func(h *UserHandler) {
+		h.groups = groups
+	}
+}
+
+func NewUserHandler(repo repository.UserRepository, tokenGen TokenGenerator, pwHasher PasswordHasher, opts ...Option) *UserHandler {
+	h := &UserHandler{
 		repo:     repo,
 		tokenGen: tokenGen,
 		pwHasher: pwHasher,
+		auditor:  audit.Nop{},
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
+}
+
+// newUserResponse converts a user into its public representation
+func newUserResponse(user *models.User) models.UserResponse {
+	return models.NewUserResponse(user)
+}
+
+// enterOrganization resolves the organization slug of an unauthenticated
+// request and makes the request act in that organization. An empty slug
+// means the default organization.
+func (h *UserHandler) enterOrganization(c *gin.Context, slug string) error {
+	organizationID := tenant.DefaultOrganizationID
+	if slug != "" && slug != tenant.DefaultOrganizationSlug {
+		if h.orgs == nil {
+			return repository.ErrOrganizationNotFound
+		}
+		org, err := h.orgs.GetOrganizationBySlug(c.Request.Context(), slug)
+		if err != nil {
+			return err
+		}
+		organizationID = org.ID
+	}
+	c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), organizationID))
+	return nil
+}
+
+// issueToken generates an access token for user, with group claims if enabled
+func (h *UserHandler) issueToken(ctx context.Context, user *models.User) (string, error) {
+	var groupIDs []string
+	if h.groups != nil {
+		groups, err := h.groups.ListUserGroups(ctx, user.ID, true)
+		if err != nil {
+			return "", err
+		}
+		for _, group := range groups {
+			groupIDs = append(groupIDs, group.ID.String())
+		}
+	}
+	return h.tokenGen.GenerateToken(user.ID.String(), user.OrganizationID.String(), groupIDs...)
+}
+
+// checkPassword runs the bcrypt comparison in its own span, as it dominates
+// login latency
+func (h *UserHandler) checkPassword(ctx context.Context, password, hash string) bool {
+	_, span := tracing.Tracer().Start(ctx, "bcrypt.compare")
+	defer span.End()
+	return h.pwHasher.CheckPasswordHash(password, hash)
+}
+
+// hashPassword runs bcrypt in its own span
+func (h *UserHandler) hashPassword(ctx context.Context, password string) (hash string, err error) {
+	_, span := tracing.Tracer().Start(ctx, "bcrypt.hash")
+	defer func() { tracing.End(span, err) }()
+	return h.pwHasher.HashPassword(password)
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
-	user, err := h.repo.CreateUser(&req)
+	if err := h.enterOrganization(c, req.Organization); err != nil {
+		writeOrganizationError(c, err)
+		return
+	}
+
+	user, err := h.repo.CreateUser(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
+	h.recordAudit(c, &audit.Event{
+		ActorID:      &user.ID,
+		Action:       audit.ActionRegister,
+		TargetUserID: &user.ID,
+		Changes:      audit.Diff(nil, newUserResponse(user)),
+	})
+
 	// Generate token
-	token, err := h.tokenGen.GenerateToken(user.ID.String())
+	token, err := h.issueToken(c.Request.Context(), user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate token"))
 		return
 	}
 
 	c.JSON(http.StatusCreated, models.LoginResponse{
 		Token: token,
-		User: models.UserResponse{
-			ID:          user.ID,
-			Email:       user.Email,
-			FirstName:   user.FirstName,
-			LastName:    user.LastName,
-			PhoneNumber: user.PhoneNumber.String,
-			CreatedAt:   user.CreatedAt,
-		},
+		User:  newUserResponse(user),
 	})
 }
 
 func (h *UserHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		metrics.LoginFailed(metrics.LoginReasonInvalidRequest)
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
-	// Debug log: Log the email being checked
-	log.Printf("Attempting login for email: %s", req.Email)
+	// An unknown organization fails like an unknown user, so logins cannot
+	// be used to discover which organizations exist
+	if err := h.enterOrganization(c, req.Organization); err != nil && !errors.Is(err, repository.ErrOrganizationNotFound) {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
 
-	user, err := h.repo.GetUserByEmail(req.Email)
+	user, err := h.repo.GetUserByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		// Debug log: Log if user not found
-		log.Printf("User not found for email: %s, error: %v", req.Email, err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		slog.InfoContext(c.Request.Context(), "Login failed", "reason", metrics.LoginReasonUnknownUser)
+		h.recordAudit(c, &audit.Event{
+			Action:   audit.ActionLoginFailed,
+			Metadata: map[string]interface{}{"email": req.Email, "reason": "unknown_user"},
+		})
+		metrics.LoginFailed(metrics.LoginReasonUnknownUser)
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "invalid credentials"))
 		return
 	}
 
-	// Debug log: Log if password check fails
-	if !h.pwHasher.CheckPasswordHash(req.Password, user.Password) {
-		log.Printf("Invalid password for user: %s", req.Email)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	if !h.checkPassword(c.Request.Context(), req.Password, user.Password) {
+		slog.InfoContext(c.Request.Context(), "Login failed",
+			"reason", metrics.LoginReasonInvalidPassword, "target_user_id", user.ID)
+		h.recordAudit(c, &audit.Event{
+			Action:       audit.ActionLoginFailed,
+			TargetUserID: &user.ID,
+			Metadata:     map[string]interface{}{"email": req.Email, "reason": "invalid_password"},
+		})
+		metrics.LoginFailed(metrics.LoginReasonInvalidPassword)
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "invalid credentials"))
 		return
 	}
 
 	// Generate token
-	token, err := h.tokenGen.GenerateToken(user.ID.String())
+	token, err := h.issueToken(c.Request.Context(), user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
+		metrics.LoginFailed(metrics.LoginReasonTokenError)
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate token"))
 		return
 	}
 
+	metrics.LoginSucceeded()
+	h.recordAudit(c, &audit.Event{
+		ActorID:      &user.ID,
+		Action:       audit.ActionLogin,
+		TargetUserID: &user.ID,
+	})
+
 	c.JSON(http.StatusOK, models.LoginResponse{
 		Token: token,
-		User: models.UserResponse{
-			ID:          user.ID,
-			Email:       user.Email,
-			FirstName:   user.FirstName,
-			LastName:    user.LastName,
-			PhoneNumber: user.PhoneNumber.String,
-			CreatedAt:   user.CreatedAt,
-		},
+		User:  newUserResponse(user),
 	})
 }
 
@@ -118,70 +239,71 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
 		return
 	}
 
 	// Parse UUID
 	id, err := uuid.Parse(userID.(string))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
 		return
 	}
 
 	// Get user
-	user, err := h.repo.GetUserByID(id)
+	user, err := h.repo.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		PhoneNumber: user.PhoneNumber.String,
-		CreatedAt:   user.CreatedAt,
-	})
+	if notModified(c, user) {
+		return
+	}
+	setUserETag(c, user)
+
+	c.JSON(http.StatusOK, newUserResponse(user))
 }
 
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("userID")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		c.JSON(http.StatusUnauthorized, middleware.ErrorBody(c, "unauthorized"))
 		return
 	}
 
 	// Parse UUID
 	id, err := uuid.Parse(userID.(string))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
 		return
 	}
 
 	// Parse request
 	var req models.UpdateProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
-	// Update user
-	user, err := h.repo.UpdateUser(id, &req)
+	// Honour If-Match so concurrent edits are not silently overwritten
+	expected, ok := h.expectedVersion(c, func() (*models.User, error) { return h.repo.GetUserByID(c.Request.Context(), id) })
+	if !ok {
+		return
+	}
+
+	// Update user; the repository reports the state it replaced for the
+	// audit diff
+	before, user, err := h.repo.UpdateUser(c.Request.Context(), id, &req, expected)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.writeUpdateError(c, err)
 		return
 	}
+	h.auditUserChange(c, audit.ActionProfileUpdated, before, user)
 
-	c.JSON(http.StatusOK, models.UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		CreatedAt: user.CreatedAt,
-	})
+	setUserETag(c, user)
+	c.JSON(http.StatusOK, newUserResponse(user))
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
@@ -189,25 +311,23 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
 		return
 	}
 
 	// Get user
-	user, err := h.repo.GetUserByID(id)
+	user, err := h.repo.GetUserByID(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
 		return
 	}
 
-	c.JSON(http.StatusOK, models.UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		PhoneNumber: user.PhoneNumber.String,
-		CreatedAt:   user.CreatedAt,
-	})
+	if notModified(c, user) {
+		return
+	}
+	setUserETag(c, user)
+
+	c.JSON(http.StatusOK, newUserResponse(user))
 }
 
 func (h *UserHandler) ListUsers(c *gin.Context) {
@@ -217,39 +337,26 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
-		log.Printf("Invalid limit parameter: %s", limitStr)
 		limit = 10
 	}
 
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil {
-		log.Printf("Invalid offset parameter: %s", offsetStr)
 		offset = 0
 	}
 
-	log.Printf("Fetching users with limit: %d, offset: %d", limit, offset)
-
 	// Get users
-	users, err := h.repo.ListUsers(limit, offset)
+	users, err := h.repo.ListUsers(c.Request.Context(), limit, offset)
 	if err != nil {
-		log.Printf("Error fetching users: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.ErrorContext(c.Request.Context(), "Failed to list users", "error", err)
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
-	log.Printf("Successfully fetched %d users", len(users))
-
 	// Convert to response objects
 	response := make([]models.UserResponse, len(users))
 	for i, user := range users {
-		response[i] = models.UserResponse{
-			ID:          user.ID,
-			Email:       user.Email,
-			FirstName:   user.FirstName,
-			LastName:    user.LastName,
-			PhoneNumber: user.PhoneNumber.String,
-			CreatedAt:   user.CreatedAt,
-		}
+		response[i] = newUserResponse(user)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -260,47 +367,130 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
+		return
+	}
+
+	expected, ok := h.expectedVersion(c, func() (*models.User, error) { return h.repo.GetUserByID(c.Request.Context(), id) })
+	if !ok {
 		return
 	}
 
-	// Delete user
-	err = h.repo.DeleteUser(id)
+	// Soft delete user; the account can be restored until it is purged
+	err = h.repo.DeleteUser(c.Request.Context(), id, expected)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
+		return
+	}
+	if errors.Is(err, repository.ErrVersionMismatch) {
+		preconditionFailed(c)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
+	h.recordAudit(c, &audit.Event{Action: audit.ActionUserDeleted, TargetUserID: &id})
+
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
 }
 
+// RestoreUser undoes a soft delete (admin only)
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	// Parse ID from URL
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
+		return
+	}
+
+	user, err := h.repo.RestoreUser(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "deleted user not found"))
+		return
+	case errors.Is(err, repository.ErrEmailInUse):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, "email is now used by another account"))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	h.recordAudit(c, &audit.Event{Action: audit.ActionUserRestored, TargetUserID: &user.ID})
+
+	setUserETag(c, user)
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// ListDeletedUsers lists soft-deleted users that can still be restored (admin only)
+func (h *UserHandler) ListDeletedUsers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		limit = 10
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	users, err := h.repo.ListDeletedUsers(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	response := make([]models.DeletedUserResponse, len(users))
+	for i, user := range users {
+		response[i] = models.DeletedUserResponse{
+			UserResponse: newUserResponse(user),
+			DeletedAt:    user.DeletedAt.Time,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 func (h *UserHandler) ResetPassword(c *gin.Context) {
 	var req models.ResetPasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	if err := h.enterOrganization(c, req.Organization); err != nil {
+		writeOrganizationError(c, err)
 		return
 	}
 
 	// Get user by email
-	user, err := h.repo.GetUserByEmail(req.Email)
+	user, err := h.repo.GetUserByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
 		return
 	}
 
 	// Hash the new password
-	passwordHash, err := h.pwHasher.HashPassword(req.NewPassword)
+	passwordHash, err := h.hashPassword(c.Request.Context(), req.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to hash password"))
 		return
 	}
 
 	// Update the user's password
-	if err := h.repo.UpdatePassword(user.ID, passwordHash); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update password"})
+	if err := h.repo.UpdatePassword(c.Request.Context(), user.ID, passwordHash); err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to update password"))
 		return
 	}
 
+	h.recordAudit(c, &audit.Event{
+		Action:       audit.ActionPasswordReset,
+		TargetUserID: &user.ID,
+		Changes:      map[string]audit.Change{"password": audit.RedactedChange()},
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "password reset successfully"})
 }
 
@@ -309,46 +499,62 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid user ID"))
 		return
 	}
 
 	// Parse request
 	var req models.UpdateProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	// Honour If-Match so concurrent edits are not silently overwritten
+	expected, ok := h.expectedVersion(c, func() (*models.User, error) { return h.repo.GetUserByID(c.Request.Context(), id) })
+	if !ok {
 		return
 	}
 
-	// Update user
-	user, err := h.repo.UpdateUser(id, &req)
+	// Update user; the repository reports the state it replaced for the
+	// audit diff
+	before, user, err := h.repo.UpdateUser(c.Request.Context(), id, &req, expected)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.writeUpdateError(c, err)
 		return
 	}
+	h.auditUserChange(c, audit.ActionUserUpdated, before, user)
 
-	c.JSON(http.StatusOK, models.UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		PhoneNumber: user.PhoneNumber.String,
-		CreatedAt:   user.CreatedAt,
-	})
+	setUserETag(c, user)
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// writeUpdateError maps repository errors from UpdateUser to HTTP responses
+func (h *UserHandler) writeUpdateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, "user not found"))
+	case errors.Is(err, repository.ErrVersionMismatch):
+		preconditionFailed(c)
+	case errors.Is(err, repository.ErrEmailInUse):
+		c.JSON(http.StatusConflict, middleware.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
 }
 
 func (h *UserHandler) Logout(c *gin.Context) {
 	// Get the token from the Authorization header
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "authorization header is required"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "authorization header is required"))
 		return
 	}
 
 	// Extract the token
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid authorization header format"})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid authorization header format"))
 		return
 	}
 
@@ -357,6 +563,7 @@ func (h *UserHandler) Logout(c *gin.Context) {
 	// 2. Clear any server-side sessions
 	// 3. Update the user's last logout timestamp
 	// For now, we'll just return success as the client will remove the token
+	h.recordAudit(c, &audit.Event{Action: audit.ActionLogout, TargetUserID: actorID(c)})
 
 	c.JSON(http.StatusOK, gin.H{"message": "successfully logged out"})
 }
@@ -364,14 +571,14 @@ func (h *UserHandler) Logout(c *gin.Context) {
 func (h *UserHandler) CreateUser(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
 	// Hash the password
-	passwordHash, err := h.pwHasher.HashPassword(req.Password)
+	passwordHash, err := h.hashPassword(c.Request.Context(), req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to hash password"))
 		return
 	}
 
@@ -379,18 +586,13 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	req.Password = passwordHash
 
 	// Create user
-	user, err := h.repo.CreateUser(&req)
+	user, err := h.repo.CreateUser(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusCreated, models.UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		PhoneNumber: user.PhoneNumber.String,
-		CreatedAt:   user.CreatedAt,
-	})
+	h.auditUserChange(c, audit.ActionUserCreated, nil, user)
+
+	c.JSON(http.StatusCreated, newUserResponse(user))
 }
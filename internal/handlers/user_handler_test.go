@@ -11,7 +11,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/middleware"
 	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -28,7 +32,7 @@ type MockTokenGenerator struct {
 	mock.Mock
 }
 
-func (m *MockTokenGenerator) GenerateToken(userID string) (string, error) {
+func (m *MockTokenGenerator) GenerateToken(userID, organizationID string, groups ...string) (string, error) {
 	return "test-jwt-token", nil
 }
 
@@ -57,7 +61,7 @@ func (m *MockUserRepository) Close() error {
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) CreateUser(req *models.RegisterRequest) (*models.User, error) {
+func (m *MockUserRepository) CreateUser(ctx context.Context, req *models.RegisterRequest) (*models.User, error) {
 	args := m.Called(req)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -65,7 +69,7 @@ func (m *MockUserRepository) CreateUser(req *models.RegisterRequest) (*models.Us
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockUserRepository) GetUserByEmail(email string) (*models.User, error) {
+func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	args := m.Called(email)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -73,7 +77,7 @@ func (m *MockUserRepository) GetUserByEmail(email string) (*models.User, error)
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockUserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
+func (m *MockUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -81,15 +85,39 @@ func (m *MockUserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockUserRepository) UpdateUser(id uuid.UUID, req *models.UpdateProfileRequest) (*models.User, error) {
-	args := m.Called(id, req)
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id uuid.UUID, req *models.UpdateProfileRequest, expectedVersion int64) (*models.User, *models.User, error) {
+	args := m.Called(id, req, expectedVersion)
+	before, _ := args.Get(0).(*models.User)
+	after, _ := args.Get(1).(*models.User)
+	return before, after, args.Error(2)
+}
+
+func (m *MockUserRepository) PatchUser(ctx context.Context, id uuid.UUID, patch *models.UserPatch, expectedVersion int64) (*models.User, *models.User, error) {
+	args := m.Called(id, patch, expectedVersion)
+	before, _ := args.Get(0).(*models.User)
+	after, _ := args.Get(1).(*models.User)
+	return before, after, args.Error(2)
+}
+
+func (m *MockUserRepository) ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	args := m.Called(limit, offset)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(*models.User), args.Error(1)
+	return args.Get(0).([]*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) DeleteUser(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	args := m.Called(id, expectedVersion)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, newPassword string) error {
+	args := m.Called(id, newPassword)
+	return args.Error(0)
 }
 
-func (m *MockUserRepository) ListUsers(limit, offset int) ([]*models.User, error) {
+func (m *MockUserRepository) ListDeletedUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
 	args := m.Called(limit, offset)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -97,14 +125,25 @@ func (m *MockUserRepository) ListUsers(limit, offset int) ([]*models.User, error
 	return args.Get(0).([]*models.User), args.Error(1)
 }
 
-func (m *MockUserRepository) DeleteUser(id uuid.UUID) error {
+func (m *MockUserRepository) RestoreUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	args := m.Called(id)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockUserRepository) UpdatePassword(id uuid.UUID, newPassword string) error {
-	args := m.Called(id, newPassword)
-	return args.Error(0)
+func (m *MockUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, phoneNumber string) (*models.User, error) {
+	args := m.Called(id, phoneNumber)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	args := m.Called(deletedBefore)
+	return args.Get(0).(int64), args.Error(1)
 }
 
 func (m *MockUserRepository) GetUsers(ctx context.Context, page, pageSize int) ([]*models.User, int, error) {
@@ -444,6 +483,7 @@ func TestDeleteUser(t *testing.T) {
 	handler := NewUserHandler(mockRepo, mockTokenGen, mockPwHasher)
 
 	userID := uuid.New()
+	missingID := uuid.New()
 
 	tests := []struct {
 		name           string
@@ -455,7 +495,7 @@ func TestDeleteUser(t *testing.T) {
 			name:   "successful deletion",
 			userID: userID.String(),
 			mockSetup: func() {
-				mockRepo.On("DeleteUser", userID).Return(nil)
+				mockRepo.On("DeleteUser", userID, int64(0)).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -465,6 +505,14 @@ func TestDeleteUser(t *testing.T) {
 			mockSetup:      func() {},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:   "already deleted",
+			userID: missingID.String(),
+			mockSetup: func() {
+				mockRepo.On("DeleteUser", missingID, int64(0)).Return(repository.ErrUserNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
 	}
 
 	for _, tt := range tests {
@@ -485,6 +533,389 @@ func TestDeleteUser(t *testing.T) {
 	}
 }
 
+func TestRestoreUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockUserRepository)
+	mockTokenGen := new(MockTokenGenerator)
+	mockPwHasher := new(MockPasswordHasher)
+	handler := NewUserHandler(mockRepo, mockTokenGen, mockPwHasher)
+
+	restoredID := uuid.New()
+	missingID := uuid.New()
+	conflictID := uuid.New()
+	restoredUser := &models.User{
+		ID:        restoredID,
+		Email:     "restored@example.com",
+		FirstName: "Re",
+		LastName:  "Stored",
+		Role:      models.RoleUser,
+		CreatedAt: time.Now(),
+	}
+
+	tests := []struct {
+		name           string
+		userID         string
+		mockSetup      func()
+		expectedStatus int
+	}{
+		{
+			name:   "successful restore",
+			userID: restoredID.String(),
+			mockSetup: func() {
+				mockRepo.On("RestoreUser", restoredID).Return(restoredUser, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "user is not deleted",
+			userID: missingID.String(),
+			mockSetup: func() {
+				mockRepo.On("RestoreUser", missingID).Return(nil, repository.ErrUserNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "email taken by another account",
+			userID: conflictID.String(),
+			mockSetup: func() {
+				mockRepo.On("RestoreUser", conflictID).Return(nil, repository.ErrEmailInUse)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "invalid UUID",
+			userID:         "invalid-uuid",
+			mockSetup:      func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			router := gin.New()
+			router.POST("/users/:id/restore", handler.RestoreUser)
+
+			req := httptest.NewRequest("POST", "/users/"+tt.userID+"/restore", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockUserRepository)
+	mockTokenGen := new(MockTokenGenerator)
+	mockPwHasher := new(MockPasswordHasher)
+	handler := NewUserHandler(mockRepo, mockTokenGen, mockPwHasher)
+
+	userID := uuid.New()
+	testUser := &models.User{
+		ID:        userID,
+		Email:     "test@example.com",
+		FirstName: "John",
+		LastName:  "Doe",
+		CreatedAt: time.Now(),
+		Version:   3,
+	}
+	updatedUser := *testUser
+	updatedUser.FirstName = "Jane"
+	updatedUser.Version = 4
+
+	mockRepo.On("GetUserByID", userID).Return(testUser, nil)
+
+	tests := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		body           string
+		mockSetup      func()
+		expectedStatus int
+		expectedETag   string
+	}{
+		{
+			name:           "GET returns the version as ETag",
+			method:         "GET",
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"3"`,
+		},
+		{
+			name:           "GET with matching If-None-Match is not modified",
+			method:         "GET",
+			headers:        map[string]string{"If-None-Match": `W/"2", "3"`},
+			expectedStatus: http.StatusNotModified,
+			expectedETag:   `"3"`,
+		},
+		{
+			name:           "GET with stale If-None-Match returns the user",
+			method:         "GET",
+			headers:        map[string]string{"If-None-Match": `"2"`},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"3"`,
+		},
+		{
+			name:    "PUT with current If-Match updates",
+			method:  "PUT",
+			headers: map[string]string{"If-Match": `"3"`},
+			body:    `{"firstName":"Jane"}`,
+			mockSetup: func() {
+				mockRepo.On("UpdateUser", userID, mock.AnythingOfType("*models.UpdateProfileRequest"), int64(3)).Return(testUser, &updatedUser, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"4"`,
+		},
+		{
+			name:    "PUT with stale If-Match fails the precondition",
+			method:  "PUT",
+			headers: map[string]string{"If-Match": `"2"`},
+			body:    `{"firstName":"Jane"}`,
+			mockSetup: func() {
+				mockRepo.On("UpdateUser", userID, mock.AnythingOfType("*models.UpdateProfileRequest"), int64(2)).Return(nil, nil, repository.ErrVersionMismatch).Once()
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "PUT with weak If-Match never matches",
+			method:         "PUT",
+			headers:        map[string]string{"If-Match": `W/"3"`},
+			body:           `{"firstName":"Jane"}`,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:    "DELETE with If-Match is conditional on that version",
+			method:  "DELETE",
+			headers: map[string]string{"If-Match": `"3"`},
+			mockSetup: func() {
+				mockRepo.On("DeleteUser", userID, int64(3)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:    "DELETE with If-Match: * is unconditional",
+			method:  "DELETE",
+			headers: map[string]string{"If-Match": "*"},
+			mockSetup: func() {
+				mockRepo.On("DeleteUser", userID, int64(0)).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router := gin.New()
+			router.GET("/users/:id", handler.GetUser)
+			router.PUT("/users/:id", handler.UpdateUser)
+			router.DELETE("/users/:id", handler.DeleteUser)
+
+			req := httptest.NewRequest(tt.method, "/users/"+userID.String(), bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			if tt.expectedETag != "" {
+				assert.Equal(t, tt.expectedETag, resp.Header().Get("ETag"))
+			}
+		})
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPatchProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockUserRepository)
+	mockTokenGen := new(MockTokenGenerator)
+	mockPwHasher := new(MockPasswordHasher)
+	handler := NewUserHandler(mockRepo, mockTokenGen, mockPwHasher)
+
+	userID := uuid.New()
+	patchedUser := &models.User{
+		ID:        userID,
+		Email:     "test@example.com",
+		FirstName: "John",
+		LastName:  "Doe",
+		CreatedAt: time.Now(),
+		Version:   2,
+	}
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		mockSetup      func()
+		expectedStatus int
+		expectedBody   map[string]interface{}
+	}{
+		{
+			name:        "null clears the phone number",
+			contentType: MergePatchContentType,
+			body:        `{"phoneNumber":null}`,
+			mockSetup: func() {
+				expected := &models.UserPatch{PhoneNumber: models.ClearString()}
+				mockRepo.On("GetUserByID", userID).Return(patchedUser, nil).Maybe()
+				mockRepo.On("PatchUser", userID, expected, int64(0)).Return(patchedUser, patchedUser, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid fields are reported individually",
+			contentType:    MergePatchContentType,
+			body:           `{"firstName":null,"phoneNumber":"12"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody: map[string]interface{}{
+				"error": "invalid merge patch",
+				"fields": map[string]interface{}{
+					"firstName":   "cannot be empty",
+					"phoneNumber": "must be in E.164 format or null to clear",
+				},
+			},
+		},
+		{
+			name:           "unknown members are rejected",
+			contentType:    MergePatchContentType,
+			body:           `{"role":"admin"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "non-object patches are rejected",
+			contentType:    MergePatchContentType,
+			body:           `null`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unsupported content type",
+			contentType:    "text/plain",
+			body:           `{"firstName":"Jane"}`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockSetup != nil {
+				tt.mockSetup()
+			}
+
+			router := gin.New()
+			router.PATCH("/profile", func(c *gin.Context) {
+				c.Set("userID", userID.String())
+				handler.PatchProfile(c)
+			})
+
+			req := httptest.NewRequest("PATCH", "/profile", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.expectedStatus, resp.Code)
+			if tt.expectedBody != nil {
+				var response map[string]interface{}
+				json.Unmarshal(resp.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedBody, response)
+			}
+		})
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserWriteAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockUserRepository)
+	handler := NewUserHandler(mockRepo, new(MockTokenGenerator), new(MockPasswordHasher))
+
+	admin := &models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.RoleAdmin}
+	member := &models.User{ID: uuid.New(), Email: "member@example.com", Role: models.RoleUser}
+	target := &models.User{ID: uuid.New(), Email: "target@example.com", Role: models.RoleUser, Version: 1}
+	mockRepo.On("GetUserByID", admin.ID).Return(admin, nil)
+	mockRepo.On("GetUserByID", member.ID).Return(member, nil)
+	mockRepo.On("GetUserByID", target.ID).Return(target, nil)
+	mockRepo.On("UpdateUser", target.ID, mock.AnythingOfType("*models.UpdateProfileRequest"), int64(0)).Return(target, target, nil)
+	mockRepo.On("PatchUser", target.ID, mock.AnythingOfType("*models.UserPatch"), int64(0)).Return(target, target, nil)
+	mockRepo.On("DeleteUser", target.ID, int64(0)).Return(nil)
+
+	// The middleware mirrors the route table in internal/server
+	newRouter := func(caller uuid.UUID) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("userID", caller.String()) })
+		requireSelfOrAdmin := middleware.RequireSelfOrAdmin(mockRepo, "id")
+		router.POST("/users", middleware.RequireAdmin(mockRepo), handler.CreateUser)
+		router.PUT("/users/:id", requireSelfOrAdmin, handler.UpdateUser)
+		router.PATCH("/users/:id", requireSelfOrAdmin, handler.PatchUser)
+		router.DELETE("/users/:id", requireSelfOrAdmin, handler.DeleteUser)
+		return router
+	}
+
+	requests := []struct {
+		method      string
+		body        string
+		contentType string
+	}{
+		{method: "PUT", body: `{"email":"taken@example.com"}`, contentType: "application/json"},
+		{method: "PATCH", body: `{"email":"taken@example.com"}`, contentType: MergePatchContentType},
+		{method: "DELETE"},
+	}
+	callers := []struct {
+		name           string
+		caller         uuid.UUID
+		expectedStatus int
+	}{
+		{name: "another member is forbidden", caller: member.ID, expectedStatus: http.StatusForbidden},
+		{name: "the user may change themselves", caller: target.ID, expectedStatus: http.StatusOK},
+		{name: "an admin may change anyone", caller: admin.ID, expectedStatus: http.StatusOK},
+	}
+
+	for _, r := range requests {
+		for _, tt := range callers {
+			t.Run(r.method+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(r.method, "/users/"+target.ID.String(), bytes.NewBufferString(r.body))
+				if r.contentType != "" {
+					req.Header.Set("Content-Type", r.contentType)
+				}
+				resp := httptest.NewRecorder()
+
+				newRouter(tt.caller).ServeHTTP(resp, req)
+
+				assert.Equal(t, tt.expectedStatus, resp.Code)
+			})
+		}
+	}
+
+	t.Run("POST by a member is forbidden", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(`{"email":"new@example.com","password":"password123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+
+		newRouter(member.ID).ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	})
+
+	mockRepo.AssertNumberOfCalls(t, "UpdateUser", 2)
+	mockRepo.AssertNumberOfCalls(t, "PatchUser", 2)
+	mockRepo.AssertNumberOfCalls(t, "DeleteUser", 2)
+	mockRepo.AssertNotCalled(t, "CreateUser", mock.Anything)
+}
+
 func TestLogout(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -547,3 +978,69 @@ func TestLogout(t *testing.T) {
 		})
 	}
 }
+
+// recordingAuditor collects audit events in memory
+type recordingAuditor struct {
+	events []*audit.Event
+}
+
+func (r *recordingAuditor) Record(ctx context.Context, event *audit.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestAuditTrail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := new(MockUserRepository)
+	mockTokenGen := new(MockTokenGenerator)
+	mockPwHasher := new(MockPasswordHasher)
+	auditor := &recordingAuditor{}
+	handler := NewUserHandler(mockRepo, mockTokenGen, mockPwHasher, WithAuditor(auditor))
+
+	adminID := uuid.New()
+	userID := uuid.New()
+
+	router := gin.New()
+	router.POST("/login", handler.Login)
+	router.DELETE("/users/:id", func(c *gin.Context) {
+		c.Set("userID", adminID.String())
+		handler.DeleteUser(c)
+	})
+
+	t.Run("failed login records reason without password", func(t *testing.T) {
+		mockRepo.On("GetUserByEmail", "nobody@example.com").Return(nil, sql.ErrNoRows).Once()
+
+		body := `{"email":"nobody@example.com","password":"secret123"}`
+		req := httptest.NewRequest("POST", "/login", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "audit-test")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		event := auditor.events[len(auditor.events)-1]
+		assert.Equal(t, audit.ActionLoginFailed, event.Action)
+		assert.Equal(t, "unknown_user", event.Metadata["reason"])
+		assert.Equal(t, "audit-test", event.UserAgent)
+		assert.Nil(t, event.ActorID)
+		assert.Equal(t, &tenant.DefaultOrganizationID, event.OrganizationID)
+		assert.NotContains(t, event.Metadata, "password")
+	})
+
+	t.Run("delete records actor and target", func(t *testing.T) {
+		mockRepo.On("DeleteUser", userID, int64(0)).Return(nil).Once()
+
+		req := httptest.NewRequest("DELETE", "/users/"+userID.String(), nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		event := auditor.events[len(auditor.events)-1]
+		assert.Equal(t, audit.ActionUserDeleted, event.Action)
+		assert.Equal(t, &adminID, event.ActorID)
+		assert.Equal(t, &userID, event.TargetUserID)
+	})
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/atulsm/user-service/internal/events"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WebhookHandler lets admins manage webhook subscriptions and inspect
+// deliveries
+type WebhookHandler struct {
+	store webhook.Store
+}
+
+func NewWebhookHandler(store webhook.Store) *WebhookHandler {
+	return &WebhookHandler{store: store}
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required,min=1"`
+	// Secret is generated when omitted on create and kept when omitted on update
+	Secret string `json:"secret"`
+	Active *bool  `json:"active"`
+}
+
+// webhookCreatedResponse is the only response that includes the secret
+type webhookCreatedResponse struct {
+	*webhook.Subscription
+	Secret string `json:"secret"`
+}
+
+// bind decodes and validates the request body, writing a 400 on failure
+func (r *webhookRequest) bind(c *gin.Context) bool {
+	if err := c.ShouldBindJSON(r); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return false
+	}
+	if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "url must be an http or https URL"))
+		return false
+	}
+	if err := webhook.CheckURL(r.URL); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, err.Error()))
+		return false
+	}
+	for _, eventType := range r.Events {
+		if !events.IsValidType(eventType) {
+			body := middleware.ErrorBody(c, "unknown event type "+strconv.Quote(eventType))
+			body["eventTypes"] = events.Types
+			c.JSON(http.StatusBadRequest, body)
+			return false
+		}
+	}
+	return true
+}
+
+// CreateSubscription registers a new webhook endpoint
+func (h *WebhookHandler) CreateSubscription(c *gin.Context) {
+	var req webhookRequest
+	if !req.bind(c) {
+		return
+	}
+
+	sub := &webhook.Subscription{URL: req.URL, Events: req.Events, Secret: req.Secret, Active: true}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if sub.Secret == "" {
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, "failed to generate secret"))
+			return
+		}
+		sub.Secret = secret
+	}
+
+	if err := h.store.CreateSubscription(c.Request.Context(), sub); err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhookCreatedResponse{Subscription: sub, Secret: sub.Secret})
+}
+
+// ListSubscriptions returns every webhook subscription
+func (h *WebhookHandler) ListSubscriptions(c *gin.Context) {
+	subs, err := h.store.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
+
+// GetSubscription returns a single webhook subscription
+func (h *WebhookHandler) GetSubscription(c *gin.Context) {
+	sub, ok := h.subscription(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// UpdateSubscription replaces the URL, event types and state of a
+// subscription. Sending a secret rotates it.
+func (h *WebhookHandler) UpdateSubscription(c *gin.Context) {
+	sub, ok := h.subscription(c)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if !req.bind(c) {
+		return
+	}
+
+	sub.URL = req.URL
+	sub.Events = req.Events
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+
+	if err := h.store.UpdateSubscription(c.Request.Context(), sub); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+// DeleteSubscription removes a subscription together with its deliveries
+func (h *WebhookHandler) DeleteSubscription(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteSubscription(c.Request.Context(), id); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "webhook subscription deleted successfully"})
+}
+
+// ListDeliveries returns recent deliveries for a subscription, optionally
+// filtered by status (pending, succeeded or dead)
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	sub, ok := h.subscription(c)
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusSucceeded, webhook.StatusDead:
+	default:
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid status"))
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "limit must be between 1 and 200"))
+		return
+	}
+
+	deliveries, err := h.store.ListDeliveries(c.Request.Context(), sub.ID, status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// ListAttempts returns the delivery log of a single delivery
+func (h *WebhookHandler) ListAttempts(c *gin.Context) {
+	sub, ok := h.subscription(c)
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseID(c, "deliveryId")
+	if !ok {
+		return
+	}
+
+	attempts, err := h.store.ListAttempts(c.Request.Context(), sub.ID, deliveryID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// Redeliver queues a dead (or already delivered) delivery again
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	sub, ok := h.subscription(c)
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseID(c, "deliveryId")
+	if !ok {
+		return
+	}
+
+	delivery, err := h.store.Redeliver(c.Request.Context(), sub.ID, deliveryID)
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+func (h *WebhookHandler) subscription(c *gin.Context) (*webhook.Subscription, bool) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return nil, false
+	}
+	sub, err := h.store.GetSubscription(c.Request.Context(), id)
+	if err != nil {
+		writeWebhookError(c, err)
+		return nil, false
+	}
+	return sub, true
+}
+
+func writeWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrSubscriptionNotFound), errors.Is(err, webhook.ErrDeliveryNotFound):
+		c.JSON(http.StatusNotFound, middleware.ErrorBody(c, err.Error()))
+	default:
+		c.JSON(http.StatusInternalServerError, middleware.ErrorBody(c, err.Error()))
+	}
+}
+
+// parseID parses the UUID path parameter param, writing a 400 if it is invalid
+func parseID(c *gin.Context, param string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorBody(c, "invalid "+param))
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,165 @@
+// Package health serves the liveness and readiness endpoints. Liveness only
+// says the process is up. Readiness runs every registered dependency check
+// in parallel, each bounded by a timeout, and fails while the service is
+// draining for shutdown so load balancers stop sending it traffic.
+// Informational checks are reported alongside but never fail readiness.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// Statuses reported for the service and for each check
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+	// StatusWarn is reported by failing informational checks
+	StatusWarn = "warn"
+)
+
+// CheckFunc reports whether a dependency is usable. The detail, if any, is
+// included in the readiness report for operators.
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+type check struct {
+	name          string
+	fn            CheckFunc
+	informational bool
+}
+
+// Registry holds the dependency checks behind readiness
+type Registry struct {
+	mu       sync.RWMutex
+	checks   []check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the readiness of the service
+type Report struct {
+	Status   string                 `json:"status"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+// NewRegistry creates a registry whose checks each get timeout to finish
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a named check to readiness
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, fn: fn})
+}
+
+// RegisterInformational adds a named check that is reported by readiness but
+// does not gate it. Use it for conditions every replica shares, such as a
+// backlog in a common table, where failing readiness would take the whole
+// service out of rotation without helping.
+func (r *Registry) RegisterInformational(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, fn: fn, informational: true})
+}
+
+// SetDraining makes readiness fail regardless of the checks, for the
+// duration of a graceful shutdown
+func (r *Registry) SetDraining(draining bool) {
+	r.draining.Store(draining)
+}
+
+// Ready runs every check and reports whether the service can take traffic
+func (r *Registry) Ready(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:   StatusOK,
+		Draining: r.draining.Load(),
+		Checks:   make(map[string]CheckResult, len(checks)),
+	}
+	if report.Draining {
+		report.Status = StatusFail
+	}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status == StatusFail {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := c.fn(ctx)
+	result := CheckResult{
+		Status:   StatusOK,
+		Detail:   detail,
+		Duration: time.Since(start).Round(time.Microsecond).String(),
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Health check failed", "check", c.name, "informational", c.informational, "error", err)
+		result.Status = StatusFail
+		if c.informational {
+			result.Status = StatusWarn
+		}
+		// The report is served unauthenticated; keep credentials out of it
+		result.Error = logging.Scrub(err.Error())
+	}
+	return result
+}
+
+// LiveHandler serves /livez, which succeeds as long as the process can
+// handle requests
+func (r *Registry) LiveHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": StatusOK})
+	}
+}
+
+// ReadyHandler serves /readyz with the full report, and 503 unless every
+// check passes and the service is not draining
+func (r *Registry) ReadyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := r.Ready(c.Request.Context())
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	r := NewRegistry(50 * time.Millisecond)
+	r.Register("database", func(ctx context.Context) (string, error) {
+		return "2 open connections", nil
+	})
+	r.Register("cache", func(ctx context.Context) (string, error) {
+		return "", errors.New("dial tcp: connection refused")
+	})
+	r.Register("slow", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	report := r.Ready(context.Background())
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, "2 open connections", report.Checks["database"].Detail)
+	assert.Equal(t, StatusFail, report.Checks["cache"].Status)
+	assert.Equal(t, "dial tcp: connection refused", report.Checks["cache"].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestReadyIgnoresInformationalChecks(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("database", func(ctx context.Context) (string, error) {
+		return "", nil
+	})
+	r.RegisterInformational("outbox", func(ctx context.Context) (string, error) {
+		return "", errors.New("oldest unpublished event is 1h0m0s old")
+	})
+
+	report := r.Ready(context.Background())
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusWarn, report.Checks["outbox"].Status)
+	assert.Equal(t, "oldest unpublished event is 1h0m0s old", report.Checks["outbox"].Error)
+}
+
+func TestReadyScrubsCredentials(t *testing.T) {
+	r := NewRegistry(time.Second)
+	r.Register("database", func(ctx context.Context) (string, error) {
+		return "", errors.New(`connect postgres://app:hunter2@db:5432/users failed`)
+	})
+
+	report := r.Ready(context.Background())
+	assert.NotContains(t, report.Checks["database"].Error, "hunter2")
+}
+
+func TestReadyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := NewRegistry(time.Second)
+	r.Register("database", func(ctx context.Context) (string, error) { return "", nil })
+
+	router := gin.New()
+	router.GET("/readyz", r.ReadyHandler())
+	serve := func() (int, Report) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, report := serve()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+
+	r.SetDraining(true)
+	code, report = serve()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.True(t, report.Draining)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+}
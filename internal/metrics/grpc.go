@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor records call counts and latency by method
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		started := time.Now()
+		resp, err := handler(ctx, req)
+
+		grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(started).Seconds())
+		return resp, err
+	}
+}
@@ -0,0 +1,181 @@
+// Package metrics defines the service's Prometheus metrics and the
+// middleware that records them. Everything is registered on Registry, which
+// is served on the admin port rather than the public API.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "userservice"
+
+// Login failure reasons
+const (
+	LoginReasonInvalidRequest  = "invalid_request"
+	LoginReasonUnknownUser     = "unknown_user"
+	LoginReasonInvalidPassword = "invalid_password"
+	LoginReasonTokenError      = "token_error"
+	LoginReasonInvalidCode     = "invalid_code"
+	// LoginReasonIdentityProvider covers sign-ins an identity provider
+	// rejected or that could not be verified
+	LoginReasonIdentityProvider = "identity_provider"
+	// LoginReasonNoLinkedAccount is a verified sign-in at an identity
+	// provider that no account may be linked to
+	LoginReasonNoLinkedAccount = "no_linked_account"
+)
+
+// Notification results
+const (
+	NotificationDelivered = "delivered"
+	NotificationFailed    = "failed"
+	NotificationDropped   = "dropped"
+)
+
+// Registry holds every metric exposed by the service
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_handled_total",
+		Help:      "gRPC calls by full method name and status code.",
+	}, []string{"method", "code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_handling_seconds",
+		Help:      "gRPC call latency by full method name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	passwordHashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "password_hash_duration_seconds",
+		Help:      "Time spent in bcrypt, by operation (hash or compare).",
+		// bcrypt at cost 14 takes around a second; default buckets stop too early
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8},
+	}, []string{"operation"})
+
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Login attempts by result (success or failure) and failure reason.",
+	}, []string{"result", "reason"})
+
+	tokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Tokens issued by type.",
+	}, []string{"type"})
+
+	rateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_rate_limited_total",
+		Help:      "HTTP requests rejected by the rate limiter.",
+	})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Configuration reloads by result (success or failure).",
+	}, []string{"result"})
+
+	notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Notifications by channel and result (delivered, failed or dropped).",
+	}, []string{"channel", "result"})
+
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload succeeded (1) or was rolled back (0).",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		grpcRequests, grpcDuration,
+		passwordHashDuration,
+		loginAttempts,
+		tokensIssued,
+		rateLimited,
+		configReloads, configLastReloadSuccessful,
+		notifications,
+	)
+	configLastReloadSuccessful.Set(1)
+}
+
+// Handler serves the metrics in Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports connection pool statistics (sql.DBStats) for db
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObservePasswordHash records how long a bcrypt operation took
+func ObservePasswordHash(operation string, started time.Time) {
+	passwordHashDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+}
+
+// LoginSucceeded counts a successful login
+func LoginSucceeded() {
+	loginAttempts.WithLabelValues("success", "").Inc()
+}
+
+// LoginFailed counts a failed login; reason is one of the LoginReason constants
+func LoginFailed(reason string) {
+	loginAttempts.WithLabelValues("failure", reason).Inc()
+}
+
+// TokenIssued counts an issued token of the given type (e.g. "access")
+func TokenIssued(tokenType string) {
+	tokensIssued.WithLabelValues(tokenType).Inc()
+}
+
+// RequestRateLimited counts a request rejected by the rate limiter
+func RequestRateLimited() {
+	rateLimited.Inc()
+}
+
+// ConfigReloaded records the outcome of a configuration reload
+func ConfigReloaded(success bool) {
+	if success {
+		configReloads.WithLabelValues("success").Inc()
+		configLastReloadSuccessful.Set(1)
+		return
+	}
+	configReloads.WithLabelValues("failure").Inc()
+	configLastReloadSuccessful.Set(0)
+}
+
+// NotificationSent records the outcome of a notification; result is one of
+// the Notification constants
+func NotificationSent(channel, result string) {
+	notifications.WithLabelValues(channel, result).Inc()
+}
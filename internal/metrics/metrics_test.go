@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGinMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(GinMiddleware())
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/users/1", "/users/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/users/:id", "204")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("GET", unmatchedRoute, "404")))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUsers"}
+
+	interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "missing")
+	})
+	interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcRequests.WithLabelValues(info.FullMethod, "OK")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcRequests.WithLabelValues(info.FullMethod, "NotFound")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(grpcRequests.WithLabelValues(info.FullMethod, "Unknown")))
+}
+
+func TestAuthCounters(t *testing.T) {
+	success := loginAttempts.WithLabelValues("success", "")
+	invalidPassword := loginAttempts.WithLabelValues("failure", LoginReasonInvalidPassword)
+	access := tokensIssued.WithLabelValues("access")
+	before := []float64{testutil.ToFloat64(success), testutil.ToFloat64(invalidPassword), testutil.ToFloat64(access)}
+
+	LoginSucceeded()
+	LoginFailed(LoginReasonInvalidPassword)
+	LoginFailed(LoginReasonInvalidPassword)
+	TokenIssued("access")
+
+	assert.Equal(t, before[0]+1, testutil.ToFloat64(success))
+	assert.Equal(t, before[1]+2, testutil.ToFloat64(invalidPassword))
+	assert.Equal(t, before[2]+1, testutil.ToFloat64(access))
+}
+
+func TestHandlerExposesRegistry(t *testing.T) {
+	TokenIssued("access")
+
+	resp := httptest.NewRecorder()
+	Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "userservice_tokens_issued_total")
+	assert.Contains(t, resp.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequireAdmin only lets through requests from users with the admin role.
+// It must run after AuthMiddleware. The role is looked up on every request so
+// that demoting an admin takes effect immediately.
+func RequireAdmin(repo repository.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller, ok := callerID(c)
+		if !ok {
+			return
+		}
+		if !requireAdminRole(c, repo, caller) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelfOrAdmin lets users act on their own account, named by the param
+// path parameter, and admins on any account. It must run after
+// AuthMiddleware.
+func RequireSelfOrAdmin(repo repository.UserRepository, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller, ok := callerID(c)
+		if !ok {
+			return
+		}
+		if target, err := uuid.Parse(c.Param(param)); err == nil && target == caller {
+			c.Next()
+			return
+		}
+		if !requireAdminRole(c, repo, caller) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// callerID returns the authenticated user's ID, aborting with a 401 if there
+// is none
+func callerID(c *gin.Context) (uuid.UUID, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorBody(c, "unauthorized"))
+		c.Abort()
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorBody(c, "unauthorized"))
+		c.Abort()
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// requireAdminRole checks that the user has the admin role, aborting with a
+// 403 if not
+func requireAdminRole(c *gin.Context, repo repository.UserRepository, userID uuid.UUID) bool {
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, ErrorBody(c, "admin role required"))
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// RequirePlatformAdmin only lets through admins of the default organization,
+// who manage the other organizations. It must run after RequireAdmin.
+func RequirePlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		organizationID, ok := tenant.Organization(c.Request.Context())
+		if !ok || organizationID != tenant.DefaultOrganizationID {
+			c.JSON(http.StatusForbidden, ErrorBody(c, "platform admin role required"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
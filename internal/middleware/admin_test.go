@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthSetsOrganizationAndPlatformAdminRequiresDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := NewJWTKeys("secret")
+	generator := NewTokenGenerator(keys, time.Hour)
+
+	var seen uuid.UUID
+	router := gin.New()
+	router.Use(AuthMiddleware(keys), RequirePlatformAdmin())
+	router.GET("/organizations", func(c *gin.Context) {
+		seen, _ = tenant.Organization(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		organizationID uuid.UUID
+		expectedStatus int
+	}{
+		{"default organization", tenant.DefaultOrganizationID, http.StatusOK},
+		{"other organization", uuid.New(), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := generator.GenerateToken(uuid.NewString(), tt.organizationID.String())
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/organizations", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.organizationID, seen)
+			}
+		})
+	}
+}
@@ -3,22 +3,38 @@ package middleware
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/tenant"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// Claims is what a valid access token says about its bearer
+type Claims struct {
+	UserID         string
+	OrganizationID uuid.UUID
+	// Groups are the IDs of the bearer's groups when the token was issued,
+	// if group claims are enabled
+	Groups []string
+}
+
+// AuthMiddleware rejects requests without a valid bearer token signed with
+// one of keys and sets "userID", "organizationID" and "groups" for the
+// handlers that follow. The organization is also put in the request context (see package
+// tenant), which scopes every repository call the request makes.
+func AuthMiddleware(keys *JWTKeys) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			log.Printf("No Authorization header found")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
+			slog.DebugContext(c.Request.Context(), "Rejected request without Authorization header")
+			c.JSON(http.StatusUnauthorized, ErrorBody(c, "authorization header is required"))
 			c.Abort()
 			return
 		}
@@ -26,86 +42,102 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Check if the header format is correct
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			log.Printf("Invalid Authorization header format: %s", authHeader)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header format must be Bearer {token}"})
+			slog.InfoContext(c.Request.Context(), "Rejected malformed Authorization header")
+			c.JSON(http.StatusUnauthorized, ErrorBody(c, "authorization header format must be Bearer {token}"))
 			c.Abort()
 			return
 		}
 
-		// Debug log: Log the token being validated
-		log.Printf("Validating token: %s", parts[1])
-
 		// Validate token
-		userID, err := ValidateToken(parts[1])
+		claims, err := ValidateToken(parts[1], keys.Verification()...)
 		if err != nil {
-			log.Printf("Token validation failed: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			slog.InfoContext(c.Request.Context(), "Token validation failed", "error", err)
+			c.JSON(http.StatusUnauthorized, ErrorBody(c, "invalid or expired token"))
 			c.Abort()
 			return
 		}
 
-		// Debug log: Log successful token validation
-		log.Printf("Token validated successfully for user: %s", userID)
-
-		// Set user ID in context
-		c.Set("userID", userID)
+		// Set user ID in context, and in the request context so it is logged
+		c.Set("userID", claims.UserID)
+		c.Set("organizationID", claims.OrganizationID)
+		c.Set("groups", claims.Groups)
+		ctx := logging.WithUserID(c.Request.Context(), claims.UserID)
+		c.Request = c.Request.WithContext(tenant.WithOrganization(ctx, claims.OrganizationID))
 		c.Next()
 	}
 }
 
 // TokenGenerator generates JWT tokens
 type TokenGenerator struct {
-	secret string
+	keys *JWTKeys
+	ttl  time.Duration
 }
 
-// NewTokenGenerator creates a new TokenGenerator with the given secret
-func NewTokenGenerator(secret string) *TokenGenerator {
-	return &TokenGenerator{secret: secret}
+// NewTokenGenerator creates a new TokenGenerator signing with the current
+// secret of keys whose tokens expire after ttl
+func NewTokenGenerator(keys *JWTKeys, ttl time.Duration) *TokenGenerator {
+	return &TokenGenerator{keys: keys, ttl: ttl}
 }
 
-// GenerateToken generates a new JWT token for the given user ID
-func (t *TokenGenerator) GenerateToken(userID string) (string, error) {
-	if t.secret == "" {
+// GenerateToken generates a new JWT token for the given user ID in the given
+// organization. Any groups are listed in a "groups" claim.
+func (t *TokenGenerator) GenerateToken(userID, organizationID string, groups ...string) (string, error) {
+	secret := t.keys.Signing()
+	if secret == "" {
 		return "", errors.New("JWT secret is not set")
 	}
 
 	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"sub": userID,
-		"exp": time.Now().Add(time.Hour * 24 * 7).Unix(), // 1 week
+		"org": organizationID,
+		"exp": time.Now().Add(t.ttl).Unix(),
 		"iat": time.Now().Unix(),
-	})
+	}
+	if len(groups) > 0 {
+		claims["groups"] = groups
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign token
-	tokenString, err := token.SignedString([]byte(t.secret))
+	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
 		return "", err
 	}
 
+	metrics.TokenIssued("access")
 	return tokenString, nil
 }
 
-func ValidateToken(tokenString string) (string, error) {
-	// Get JWT secret from environment
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Printf("JWT_SECRET environment variable is not set")
-		return "", errors.New("JWT_SECRET environment variable is not set")
+// ValidateToken checks tokenString against each of secrets in turn and
+// returns its claims. Only a signature mismatch moves on to the next secret.
+func ValidateToken(tokenString string, secrets ...string) (*Claims, error) {
+	err := errors.New("JWT secret is not set")
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		var claims *Claims
+		claims, err = validateToken(tokenString, secret)
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			return claims, err
+		}
 	}
-	log.Printf("Using JWT secret: %s", secret)
+	return nil, err
+}
 
+// validateToken checks tokenString against a single secret
+func validateToken(tokenString, secret string) (*Claims, error) {
 	// Parse token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Validate signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			log.Printf("Unexpected signing method: %v", token.Header["alg"])
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(secret), nil
 	})
 	if err != nil {
-		log.Printf("Token parsing failed: %v", err)
-		return "", err
+		return nil, err
 	}
 
 	// Validate token claims
@@ -113,22 +145,34 @@ func ValidateToken(tokenString string) (string, error) {
 		// Check expiration
 		if exp, ok := claims["exp"].(float64); ok {
 			if time.Now().Unix() > int64(exp) {
-				log.Printf("Token expired at %v, current time: %v", exp, time.Now().Unix())
-				return "", errors.New("token expired")
+				return nil, errors.New("token expired")
 			}
 		} else {
-			log.Printf("Invalid expiration claim in token")
-			return "", errors.New("invalid token claims")
+			return nil, errors.New("invalid token claims")
 		}
 
 		// Get user ID
-		if sub, ok := claims["sub"].(string); ok {
-			log.Printf("Token validated successfully for user: %s", sub)
-			return sub, nil
+		sub, ok := claims["sub"].(string)
+		if !ok {
+			return nil, errors.New("invalid user ID in token")
+		}
+
+		// Tokens issued before organizations existed carry no tenant and
+		// must be renewed by logging in again
+		org, _ := claims["org"].(string)
+		organizationID, err := uuid.Parse(org)
+		if err != nil || organizationID == uuid.Nil {
+			return nil, errors.New("invalid organization in token")
+		}
+		var groups []string
+		if list, ok := claims["groups"].([]interface{}); ok {
+			for _, group := range list {
+				if id, ok := group.(string); ok {
+					groups = append(groups, id)
+				}
+			}
 		}
-		log.Printf("Invalid user ID claim in token")
-		return "", errors.New("invalid user ID in token")
+		return &Claims{UserID: sub, OrganizationID: organizationID, Groups: groups}, nil
 	}
-	log.Printf("Token validation failed: invalid token")
-	return "", errors.New("invalid token")
+	return nil, errors.New("invalid token")
 }
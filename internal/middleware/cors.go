@@ -1,19 +1,156 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-func CORSMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+	"github.com/gin-gonic/gin"
+)
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+// CORSPolicy describes which browser origins may call the API and what they
+// may send and read
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins such as https://app.example.com or
+	// wildcard subdomain patterns such as https://*.example.com
+	AllowedOrigins []string
+	// AllowedHeaders and AllowedMethods are answered to preflight requests
+	AllowedHeaders []string
+	AllowedMethods []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// CORS applies a CORSPolicy. Allowed origins are echoed back one at a time
+// with credentials allowed; other origins get no CORS headers at all, and
+// their preflight requests are refused. The policy can be replaced with
+// Update while requests are being served.
+type CORS struct {
+	policy atomic.Pointer[compiledCORS]
+}
+
+// compiledCORS is a CORSPolicy prepared for matching and writing headers
+type compiledCORS struct {
+	origins   map[string]bool
+	wildcards []originPattern
+	headers   string
+	methods   string
+	exposed   string
+	maxAge    string
+}
+
+// originPattern matches scheme://*.suffix, where the wildcard stands for one
+// or more subdomain labels
+type originPattern struct {
+	prefix string
+	suffix string
+}
+
+func (p originPattern) match(origin string) bool {
+	if len(origin) <= len(p.prefix)+len(p.suffix) ||
+		!strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	labels := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	if strings.HasPrefix(labels, ".") || strings.HasSuffix(labels, ".") {
+		return false
+	}
+	for _, r := range labels {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCORS returns middleware state applying policy
+func NewCORS(policy CORSPolicy) *CORS {
+	c := &CORS{}
+	c.Update(policy)
+	return c
+}
+
+// Update atomically replaces the policy
+func (c *CORS) Update(policy CORSPolicy) {
+	compiled := &compiledCORS{
+		origins: make(map[string]bool, len(policy.AllowedOrigins)),
+		headers: strings.Join(policy.AllowedHeaders, ", "),
+		methods: strings.Join(policy.AllowedMethods, ", "),
+		exposed: strings.Join(policy.ExposedHeaders, ", "),
+		maxAge:  strconv.Itoa(int(policy.MaxAge.Seconds())),
+	}
+	for _, origin := range policy.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if scheme, host, ok := strings.Cut(origin, "://*."); ok {
+			compiled.wildcards = append(compiled.wildcards, originPattern{prefix: scheme + "://", suffix: "." + host})
+			continue
+		}
+		compiled.origins[origin] = true
+	}
+	c.policy.Store(compiled)
+}
+
+func (p *compiledCORS) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.wildcards {
+		if pattern.match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler returns the middleware applying the policy
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy := c.policy.Load()
+		origin := ctx.GetHeader("Origin")
+		preflight := ctx.Request.Method == http.MethodOptions && origin != "" &&
+			ctx.GetHeader("Access-Control-Request-Method") != ""
+
+		// The response depends on the origin, so caches must not share it
+		header := ctx.Writer.Header()
+		header.Add("Vary", "Origin")
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			// Not a cross-origin browser request
+			ctx.Next()
+			return
+		}
+		if !policy.allowed(origin) {
+			if preflight {
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Serve it without CORS headers; the browser keeps the response
+			// from the calling script
+			ctx.Next()
 			return
 		}
 
-		c.Next()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", policy.methods)
+			header.Set("Access-Control-Allow-Headers", policy.headers)
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if policy.exposed != "" {
+			header.Set("Access-Control-Expose-Headers", policy.exposed)
+		}
+		ctx.Next()
 	}
 }
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cors := NewCORS(CORSPolicy{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.staging.example.com"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		AllowedMethods: []string{"GET", "POST"},
+		ExposedHeaders: []string{"ETag", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	})
+	router := gin.New()
+	router.Use(cors.Handler())
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/users", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("allowed origin is reflected", func(t *testing.T) {
+		w := serve(http.MethodGet, "https://app.example.com", false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "ETag, X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	})
+
+	t.Run("wildcard subdomain", func(t *testing.T) {
+		for origin, allowed := range map[string]bool{
+			"https://pr-42.staging.example.com":          true,
+			"https://a.b.staging.example.com":            true,
+			"https://staging.example.com":                false,
+			"http://pr-42.staging.example.com":           false,
+			"https://evil.com/.staging.example.com":      false,
+			"https://pr-42.staging.example.com.evil.com": false,
+		} {
+			w := serve(http.MethodGet, origin, false)
+			if allowed {
+				assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			}
+		}
+	})
+
+	t.Run("unknown origin gets no CORS headers", func(t *testing.T) {
+		w := serve(http.MethodGet, "https://evil.example.org", false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	})
+
+	t.Run("preflight from allowed origin", func(t *testing.T) {
+		w := serve(http.MethodOptions, "https://app.example.com", true)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+		assert.Contains(t, w.Header().Values("Vary"), "Access-Control-Request-Headers")
+	})
+
+	t.Run("preflight from unknown origin is refused", func(t *testing.T) {
+		w := serve(http.MethodOptions, "https://evil.example.org", true)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("update replaces the policy", func(t *testing.T) {
+		cors.Update(CORSPolicy{AllowedOrigins: []string{"https://new.example.com"}})
+		defer cors.Update(CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}})
+
+		assert.Empty(t, serve(http.MethodGet, "https://app.example.com", false).Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "https://new.example.com",
+			serve(http.MethodGet, "https://new.example.com", false).Header().Get("Access-Control-Allow-Origin"))
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import "sync/atomic"
+
+// JWTKeys holds the secret new tokens are signed with and the previous
+// secrets that are still accepted while clients pick up rotated tokens. The
+// keys can be replaced with Set while requests are being served.
+type JWTKeys struct {
+	keys atomic.Pointer[[]string]
+}
+
+// NewJWTKeys returns keys that sign with signing and also verify tokens
+// signed with any of previous
+func NewJWTKeys(signing string, previous ...string) *JWTKeys {
+	k := &JWTKeys{}
+	k.Set(signing, previous...)
+	return k
+}
+
+// Set atomically replaces the signing and previous secrets
+func (k *JWTKeys) Set(signing string, previous ...string) {
+	keys := make([]string, 0, len(previous)+1)
+	keys = append(keys, signing)
+	for _, secret := range previous {
+		if secret != "" && secret != signing {
+			keys = append(keys, secret)
+		}
+	}
+	k.keys.Store(&keys)
+}
+
+// Signing returns the secret new tokens are signed with
+func (k *JWTKeys) Signing() string {
+	return (*k.keys.Load())[0]
+}
+
+// Verification returns every secret a token may be signed with, the signing
+// secret first
+func (k *JWTKeys) Verification() []string {
+	return *k.keys.Load()
+}
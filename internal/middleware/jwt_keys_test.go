@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTKeyRotation(t *testing.T) {
+	keys := NewJWTKeys("old-secret")
+	generator := NewTokenGenerator(keys, time.Hour)
+
+	oldToken, err := generator.GenerateToken("user-1", tenant.DefaultOrganizationID.String())
+	require.NoError(t, err)
+
+	// Rotate: new tokens use the new secret, old ones are still accepted
+	keys.Set("new-secret", "old-secret")
+	newToken, err := generator.GenerateToken("user-2", tenant.DefaultOrganizationID.String())
+	require.NoError(t, err)
+
+	claims, err := ValidateToken(oldToken, keys.Verification()...)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+
+	claims, err = ValidateToken(newToken, keys.Verification()...)
+	require.NoError(t, err)
+	assert.Equal(t, "user-2", claims.UserID)
+
+	_, err = ValidateToken(newToken, "old-secret")
+	assert.Error(t, err)
+
+	// Once the old secret is retired its tokens are rejected
+	keys.Set("new-secret")
+	_, err = ValidateToken(oldToken, keys.Verification()...)
+	assert.Error(t, err)
+}
+
+func TestValidateTokenWithoutSecrets(t *testing.T) {
+	_, err := ValidateToken("anything")
+	assert.EqualError(t, err, "JWT secret is not set")
+}
+
+func TestTokenCarriesOrganization(t *testing.T) {
+	organizationID := uuid.New()
+	token, err := NewTokenGenerator(NewJWTKeys("secret"), time.Hour).GenerateToken("user-1", organizationID.String())
+	require.NoError(t, err)
+
+	claims, err := ValidateToken(token, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, organizationID, claims.OrganizationID)
+	assert.Empty(t, claims.Groups)
+
+	token, err = NewTokenGenerator(NewJWTKeys("secret"), time.Hour).GenerateToken("user-1", organizationID.String(), "group-a", "group-b")
+	require.NoError(t, err)
+	claims, err = ValidateToken(token, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"group-a", "group-b"}, claims.Groups)
+
+	// Tokens without an organization predate tenancy and are rejected
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = ValidateToken(legacy, "secret")
+	assert.EqualError(t, err, "invalid organization in token")
+}
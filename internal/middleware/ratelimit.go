@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTTL is how long a client's bucket is kept after its last request
+const limiterIdleTTL = 10 * time.Minute
+
+// RateLimiter limits requests per client IP with a token bucket of rps
+// requests per second and burst. A rate of zero disables limiting. The limits
+// can be changed with Update while requests are being served.
+type RateLimiter struct {
+	mu        sync.Mutex
+	rps       rate.Limit
+	burst     int
+	clients   map[string]*client
+	lastPrune time.Time
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rps requests per second per
+// client with bursts of up to burst
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rps:       rate.Limit(rps),
+		burst:     burst,
+		clients:   map[string]*client{},
+		lastPrune: time.Now(),
+	}
+}
+
+// Update atomically changes the limits, applying them to existing clients too
+func (l *RateLimiter) Update(rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rps, l.burst = rate.Limit(rps), burst
+	for _, c := range l.clients {
+		c.limiter.SetLimit(l.rps)
+		c.limiter.SetBurst(l.burst)
+	}
+}
+
+// allow reports whether key may make a request now
+func (l *RateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rps == 0 {
+		return true
+	}
+
+	// Drop clients that have gone quiet so the map does not grow unbounded
+	if now.Sub(l.lastPrune) > limiterIdleTTL {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > limiterIdleTTL {
+				delete(l.clients, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// Handler returns the middleware rejecting requests over the limit with 429
+func (l *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l.allow(c.ClientIP(), time.Now()) {
+			c.Next()
+			return
+		}
+
+		metrics.RequestRateLimited()
+		slog.InfoContext(c.Request.Context(), "Rate limited request", "client_ip", c.ClientIP())
+		c.Header("Retry-After", strconv.Itoa(1))
+		c.JSON(http.StatusTooManyRequests, ErrorBody(c, "too many requests"))
+		c.Abort()
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := NewRateLimiter(1, 2)
+	router := gin.New()
+	router.Use(limiter.Handler())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The burst is allowed, then the client is limited
+	assert.Equal(t, http.StatusOK, get("10.0.0.1"))
+	assert.Equal(t, http.StatusOK, get("10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, get("10.0.0.1"))
+
+	// Other clients have their own bucket
+	assert.Equal(t, http.StatusOK, get("10.0.0.2"))
+
+	// Disabling the limiter takes effect immediately
+	limiter.Update(0, 0)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1"))
+}
+
+func TestRateLimiterPrunesIdleClients(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	now := time.Now()
+
+	assert.True(t, limiter.allow("10.0.0.1", now))
+	assert.Len(t, limiter.clients, 1)
+
+	later := now.Add(2 * limiterIdleTTL)
+	assert.True(t, limiter.allow("10.0.0.2", later))
+	assert.Len(t, limiter.clients, 1)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestID adopts the caller's X-Request-ID, or generates one when it is
+// missing or malformed, and makes it available to the rest of the request:
+// in the request context (and so every log line), as "requestID" on the Gin
+// context, and echoed back in the response header.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := requestid.Resolve(c.GetHeader(requestid.Header))
+
+		c.Set("requestID", id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+
+		c.Next()
+	}
+}
+
+// ErrorBody builds the JSON body of an error response. The request ID is
+// included when there is one so clients can quote it when reporting problems.
+func ErrorBody(c *gin.Context, message string) gin.H {
+	body := gin.H{"error": message}
+	if id := logging.RequestID(c.Request.Context()); id != "" {
+		body["requestId"] = id
+	}
+	return body
+}
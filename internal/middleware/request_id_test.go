@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{"adopts caller ID", "client-req-42", true},
+		{"generates missing ID", "", false},
+		{"replaces malformed ID", "not a valid\tid", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			router := gin.New()
+			router.Use(RequestID())
+			router.GET("/fail", func(c *gin.Context) {
+				fromContext = logging.RequestID(c.Request.Context())
+				c.JSON(http.StatusNotFound, ErrorBody(c, "user not found"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestid.Header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestid.Header)
+			require.NotEmpty(t, id)
+			assert.True(t, requestid.Valid(id))
+			if tt.wantSame {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.NotEqual(t, tt.incoming, id)
+			}
+			assert.Equal(t, id, fromContext)
+
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "user not found", body["error"])
+			assert.Equal(t, id, body["requestId"])
+		})
+	}
+}
+
+func TestErrorBodyWithoutRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	assert.Equal(t, gin.H{"error": "boom"}, ErrorBody(c, "boom"))
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSignedToken is returned for malformed, forged or mismatched
+// signed tokens
+var ErrInvalidSignedToken = errors.New("invalid token")
+
+// SignedTokens issues opaque tokens for links sent to users, such as
+// invitations. A token carries the ID of the record it belongs to and a
+// random nonce, signed with the JWT keys for one purpose so it cannot be
+// replayed elsewhere. Tokens do not expire by themselves: the record stores
+// TokenHash of the current token together with its expiry, and reissuing a
+// token invalidates the previous one.
+type SignedTokens struct {
+	keys *JWTKeys
+}
+
+// NewSignedTokens creates signed tokens that follow rotations of keys
+func NewSignedTokens(keys *JWTKeys) *SignedTokens {
+	return &SignedTokens{keys: keys}
+}
+
+// Issue returns a new token for the record id
+func (t *SignedTokens) Issue(purpose string, id uuid.UUID) (string, error) {
+	secret := t.keys.Signing()
+	if secret == "" {
+		return "", errors.New("JWT secret is not set")
+	}
+
+	payload := make([]byte, 32)
+	copy(payload, id[:])
+	if _, err := rand.Read(payload[16:]); err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(secret, purpose, encoded)), nil
+}
+
+// Verify checks the signature of token against every verification key and
+// returns the record ID it was issued for
+func (t *SignedTokens) Verify(purpose, token string) (uuid.UUID, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, ErrInvalidSignedToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return uuid.Nil, ErrInvalidSignedToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) != 32 {
+		return uuid.Nil, ErrInvalidSignedToken
+	}
+
+	for _, secret := range t.keys.Verification() {
+		if secret != "" && hmac.Equal(mac, sign(secret, purpose, encoded)) {
+			id, err := uuid.FromBytes(payload[:16])
+			if err != nil {
+				return uuid.Nil, ErrInvalidSignedToken
+			}
+			return id, nil
+		}
+	}
+	return uuid.Nil, ErrInvalidSignedToken
+}
+
+// TokenHash is what records store to recognise their current token
+func TokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NumericCode returns a random code of the given number of decimal digits,
+// for users to type in
+func NumericCode(digits int) (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < digits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// RandomToken returns a random URL-safe token with 256 bits of entropy, for
+// secrets that are only ever stored as their TokenHash
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func sign(secret, purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose + "." + payload))
+	return mac.Sum(nil)
+}
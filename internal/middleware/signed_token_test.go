@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedTokens(t *testing.T) {
+	keys := NewJWTKeys("old-secret")
+	tokens := NewSignedTokens(keys)
+	id := uuid.New()
+
+	token, err := tokens.Issue("invitation", id)
+	require.NoError(t, err)
+
+	got, err := tokens.Verify("invitation", token)
+	require.NoError(t, err)
+	assert.Equal(t, id, got)
+
+	// Tokens are bound to their purpose
+	_, err = tokens.Verify("magic-link", token)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	// Every token is different, so a record can tell its current one apart
+	again, err := tokens.Issue("invitation", id)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, again)
+	assert.NotEqual(t, TokenHash(token), TokenHash(again))
+
+	// Tampering with the record ID breaks the signature
+	other, err := tokens.Issue("invitation", uuid.New())
+	require.NoError(t, err)
+	_, err = tokens.Verify("invitation", other[:22]+token[22:])
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	// Rotated keys keep verifying until they are retired
+	keys.Set("new-secret", "old-secret")
+	_, err = tokens.Verify("invitation", token)
+	assert.NoError(t, err)
+	keys.Set("new-secret")
+	_, err = tokens.Verify("invitation", token)
+	assert.ErrorIs(t, err, ErrInvalidSignedToken)
+
+	for _, malformed := range []string{"", "abc", "abc.def", token + "x"} {
+		_, err = tokens.Verify("invitation", malformed)
+		assert.ErrorIs(t, err, ErrInvalidSignedToken, malformed)
+	}
+}
+
+func TestNumericCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		code, err := NumericCode(6)
+		require.NoError(t, err)
+		assert.Regexp(t, `^[0-9]{6}$`, code)
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestRandomToken(t *testing.T) {
+	a, err := RandomToken()
+	require.NoError(t, err)
+	b, err := RandomToken()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[A-Za-z0-9_-]{43}$`, a)
+	assert.NotEqual(t, a, b)
+}
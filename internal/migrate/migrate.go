@@ -0,0 +1,397 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockKey is the pg_advisory_lock key held while migrations run so that
+// several replicas starting at once never apply the same migration twice.
+const lockKey int64 = 0x75736572737663 // "usersvc"
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrSchemaOutdated is returned by Check when the database is missing
+// migrations that this binary requires.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Context string // empty when the migration always runs
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations to a PostgreSQL database.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	contexts   map[string]bool
+}
+
+// New loads the migrations in fsys. Migrations tagged with a context only run
+// when that context is passed in contexts.
+func New(db *sqlx.DB, fsys fs.FS, contexts ...string) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migrator{db: db, migrations: migrations, contexts: map[string]bool{}}
+	for _, c := range contexts {
+		if c = strings.TrimSpace(c); c != "" {
+			m.contexts[c] = true
+		}
+	}
+	return m, nil
+}
+
+// Load parses every <version>_<name>.<up|down>.sql file in fsys and returns
+// the migrations sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		parts := fileNamePattern.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %v", entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration version %d used by both %q and %q", version, m.Name, parts[2])
+		}
+
+		tag := parseContext(string(body))
+		if parts[3] == "up" {
+			m.Up = string(body)
+			m.Context = tag
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseContext returns the value of a "-- context: <name>" directive found in
+// the leading comment block of a migration script.
+func parseContext(body string) string {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		directive := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		if value, ok := strings.CutPrefix(directive, "context:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// Migrations returns the loaded migrations in version order.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// enabled reports whether a migration should run for the configured contexts.
+func (m *Migrator) enabled(mig Migration) bool {
+	return mig.Context == "" || m.contexts[mig.Context]
+}
+
+// Up applies all pending migrations and returns the ones that were applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok || !m.enabled(mig) {
+				continue
+			}
+			slog.InfoContext(ctx, "Applying migration", "version", mig.Version, "name", mig.Name)
+			if err := m.apply(ctx, conn, mig.Up, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, NOW())",
+					mig.Version, mig.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		done, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", mig.Version, mig.Name)
+			}
+			slog.InfoContext(ctx, "Reverting migration", "version", mig.Version, "name", mig.Name)
+			if err := m.apply(ctx, conn, mig.Down, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	done, err := m.readApplied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = Status{Migration: mig}
+		if appliedAt, ok := done[mig.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Check returns ErrSchemaOutdated if any migration required by this binary
+// has not been applied. Context-specific migrations are never required.
+func (m *Migrator) Check(ctx context.Context) error {
+	done, err := m.readApplied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, mig := range m.migrations {
+		if mig.Context != "" {
+			continue
+		}
+		if _, ok := done[mig.Version]; !ok {
+			missing = append(missing, fmt.Sprintf("%d_%s", mig.Version, mig.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: pending migrations %s", ErrSchemaOutdated, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled.
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			slog.ErrorContext(ctx, "Failed to release migration lock", "error", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+// apply runs a migration script and its bookkeeping statement in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, script string, record func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appliedVersions creates the schema_migrations table if needed and returns
+// the applied versions. A database previously managed by Liquibase is adopted
+// by recording its changesets as applied migrations.
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int64]*time.Time, error) {
+	exists, err := tableExists(ctx, conn, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		liquibase, err := liquibaseVersions(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := conn.ExecContext(ctx, `
+			CREATE TABLE schema_migrations (
+				version    BIGINT      PRIMARY KEY,
+				name       TEXT        NOT NULL,
+				applied_at TIMESTAMPTZ NOT NULL
+			)
+		`); err != nil {
+			return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+		}
+
+		for _, mig := range m.migrations {
+			if appliedAt, ok := liquibase[mig.Version]; ok {
+				slog.InfoContext(ctx, "Adopting Liquibase changeset", "version", mig.Version, "name", mig.Name)
+				if _, err := conn.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+					mig.Version, mig.Name, appliedAt); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return m.readApplied(ctx, conn)
+}
+
+// readApplied returns the applied versions without modifying the database.
+func (m *Migrator) readApplied(ctx context.Context, q sqlx.QueryerContext) (map[int64]*time.Time, error) {
+	exists, err := tableExists(ctx, q, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return liquibaseVersions(ctx, q)
+	}
+
+	rows := []struct {
+		Version   int64     `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}{}
+	if err := sqlx.SelectContext(ctx, q, &rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]*time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt := row.AppliedAt
+		done[row.Version] = &appliedAt
+	}
+	return done, nil
+}
+
+// liquibaseVersions maps the numeric changeset IDs recorded by Liquibase to
+// migration versions. It returns an empty map when Liquibase was never used.
+func liquibaseVersions(ctx context.Context, q sqlx.QueryerContext) (map[int64]*time.Time, error) {
+	done := map[int64]*time.Time{}
+
+	exists, err := tableExists(ctx, q, "databasechangelog")
+	if err != nil || !exists {
+		return done, err
+	}
+
+	rows := []struct {
+		ID           string    `db:"id"`
+		DateExecuted time.Time `db:"dateexecuted"`
+	}{}
+	if err := sqlx.SelectContext(ctx, q, &rows, "SELECT id, dateexecuted FROM databasechangelog"); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		version, err := strconv.ParseInt(row.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		executed := row.DateExecuted
+		done[version] = &executed
+	}
+	return done, nil
+}
+
+func tableExists(ctx context.Context, q sqlx.QueryerContext, table string) (bool, error) {
+	var name sql.NullString
+	if err := sqlx.GetContext(ctx, q, &name, "SELECT to_regclass($1)::text", table); err != nil {
+		return false, err
+	}
+	return name.Valid, nil
+}
@@ -0,0 +1,116 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/atulsm/user-service/db/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       fstest.MapFS
+		wantVersion []int64
+		wantErr     bool
+	}{
+		{
+			name: "sorts migrations by version and pairs up/down scripts",
+			files: fstest.MapFS{
+				"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+				"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+				"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+				"0010_tenth.up.sql":    {Data: []byte("CREATE TABLE c ();")},
+				"README.md":            {Data: []byte("ignored")},
+			},
+			wantVersion: []int64{1, 2, 10},
+		},
+		{
+			name: "rejects badly named files",
+			files: fstest.MapFS{
+				"first.sql": {Data: []byte("SELECT 1;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "rejects migrations without an up script",
+			files: fstest.MapFS{
+				"0001_first.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "rejects duplicate versions",
+			files: fstest.MapFS{
+				"0001_first.up.sql":  {Data: []byte("SELECT 1;")},
+				"0001_second.up.sql": {Data: []byte("SELECT 2;")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.files)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Load() expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() unexpected error: %v", err)
+			}
+			if len(got) != len(tt.wantVersion) {
+				t.Fatalf("Load() returned %d migrations, want %d", len(got), len(tt.wantVersion))
+			}
+			for i, v := range tt.wantVersion {
+				if got[i].Version != v {
+					t.Errorf("Load()[%d].Version = %d, want %d", i, got[i].Version, v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "no directive", body: "CREATE TABLE a ();", want: ""},
+		{name: "directive on first line", body: "-- context: test\nINSERT INTO a VALUES (1);", want: "test"},
+		{name: "directive after other comments", body: "-- Seed data\n\n-- context: demo\nSELECT 1;", want: "demo"},
+		{name: "directive after SQL is ignored", body: "SELECT 1;\n-- context: test", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseContext(tt.body); got != tt.want {
+				t.Errorf("parseContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if len(got) < 3 {
+		t.Fatalf("expected at least the three ported changesets, got %d", len(got))
+	}
+	for i, m := range got {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want contiguous version %d", m.Name, m.Version, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+	if got[2].Context != "test" {
+		t.Errorf("seed data migration context = %q, want %q", got[2].Context, "test")
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Purposes of one-time codes
+const (
+	CodePurposePhoneVerification = "phone_verification"
+	CodePurposeLogin             = "login"
+)
+
+// OneTimeCode is a short-lived code sent to a user to prove they control a
+// phone number or email address. Only its hash is stored.
+type OneTimeCode struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	Purpose        string    `json:"purpose" db:"purpose"`
+	Target         string    `json:"target" db:"target"` // Where the code was sent
+	CodeHash       string    `json:"-" db:"code_hash"`
+	ExpiresAt      time.Time `json:"expiresAt" db:"expires_at"`
+	Attempts       int       `json:"attempts" db:"attempts"` // Wrong guesses so far
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
+
+// PhoneVerificationResponse is returned when a verification code was sent
+type PhoneVerificationResponse struct {
+	PhoneNumber string    `json:"phoneNumber"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type ConfirmPhoneRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// Ways of delivering a passwordless sign-in
+const (
+	MagicLinkMethodLink = "link"
+	MagicLinkMethodCode = "code"
+)
+
+type MagicLinkRequest struct {
+	// Organization is the slug of the account's organization; empty means
+	// the default organization
+	Organization string `json:"organization" binding:"omitempty,max=63"`
+	Email        string `json:"email" binding:"required,email"`
+	// Method is link (the default) to email a sign-in link, or code to
+	// email a numeric code to type in
+	Method string `json:"method" binding:"omitempty,oneof=link code"`
+}
+
+// MagicLinkLoginRequest signs in with either the token from a sign-in link,
+// or an emailed code together with the account's email
+type MagicLinkLoginRequest struct {
+	Token        string `json:"token" binding:"required_without=Code"`
+	Organization string `json:"organization" binding:"omitempty,max=63"`
+	Email        string `json:"email" binding:"required_with=Code,omitempty,email"`
+	Code         string `json:"code" binding:"required_without=Token,omitempty,len=6,numeric"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Group roles
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleMember = "member"
+)
+
+// Group is a named set of users within an organization. Groups can be
+// nested: the members of a subgroup are also members of its parents.
+type Group struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// GroupMember is a user's direct membership of a group. In an expanded
+// member listing GroupID is the (sub)group the user belongs to directly.
+type GroupMember struct {
+	GroupID   uuid.UUID `json:"groupId" db:"group_id"`
+	UserID    uuid.UUID `json:"userId" db:"user_id"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// UserGroup is a group a user belongs to. Inherited groups are reached
+// through a subgroup and carry no role.
+type UserGroup struct {
+	Group
+	Role      string `json:"role,omitempty" db:"role"`
+	Inherited bool   `json:"inherited" db:"inherited"`
+}
+
+type CreateGroupRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description"`
+}
+
+type UpdateGroupRequest struct {
+	Name        string `json:"name" binding:"required,max=255"`
+	Description string `json:"description"`
+}
+
+type SetGroupMemberRequest struct {
+	Role string `json:"role" binding:"omitempty,oneof=owner member"`
+}
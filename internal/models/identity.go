@@ -0,0 +1,125 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdentityProvider is an external OpenID Provider, such as Google, Azure AD
+// or Okta, that the users of an organization can sign in with
+type IdentityProvider struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Slug           string    `json:"slug" db:"slug"`
+	Name           string    `json:"name" db:"name"`
+	Issuer         string    `json:"issuer" db:"issuer"`
+	ClientID       string    `json:"clientId" db:"client_id"`
+	ClientSecret   string    `json:"-" db:"client_secret"` // Empty for public clients
+	Scopes         []string  `json:"scopes" db:"-"`
+	// ProvisionUsers creates an account on the first sign-in of someone
+	// whose verified email has none
+	ProvisionUsers bool `json:"provisionUsers" db:"provision_users"`
+	// LinkByEmail links the first sign-in of an identity to the account
+	// with its verified email
+	LinkByEmail bool      `json:"linkByEmail" db:"link_by_email"`
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// IdentityProviderResponse is a provider as shown to admins; the client
+// secret is never returned
+type IdentityProviderResponse struct {
+	*IdentityProvider
+	HasClientSecret bool `json:"hasClientSecret"`
+}
+
+// NewIdentityProviderResponse converts a provider into its admin representation
+func NewIdentityProviderResponse(provider *IdentityProvider) IdentityProviderResponse {
+	return IdentityProviderResponse{IdentityProvider: provider, HasClientSecret: provider.ClientSecret != ""}
+}
+
+// SignInProvider is a provider as offered on the sign-in page
+type SignInProvider struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type CreateIdentityProviderRequest struct {
+	Slug         string `json:"slug" binding:"required,max=63"`
+	Name         string `json:"name" binding:"required,max=255"`
+	Issuer       string `json:"issuer" binding:"required,url"`
+	ClientID     string `json:"clientId" binding:"required"`
+	ClientSecret string `json:"clientSecret"`
+	// Scopes default to openid, email and profile; openid is always added
+	Scopes         []string `json:"scopes"`
+	ProvisionUsers bool     `json:"provisionUsers"`
+	LinkByEmail    bool     `json:"linkByEmail"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// UpdateIdentityProviderRequest replaces the settings of a provider. Its
+// slug is permanent, and an empty client secret keeps the current one.
+type UpdateIdentityProviderRequest struct {
+	Name           string   `json:"name" binding:"required,max=255"`
+	Issuer         string   `json:"issuer" binding:"required,url"`
+	ClientID       string   `json:"clientId" binding:"required"`
+	ClientSecret   string   `json:"clientSecret"`
+	Scopes         []string `json:"scopes"`
+	ProvisionUsers bool     `json:"provisionUsers"`
+	LinkByEmail    bool     `json:"linkByEmail"`
+	Enabled        bool     `json:"enabled"`
+}
+
+// UserIdentity links a user to their account at an identity provider,
+// identified by the provider's subject
+type UserIdentity struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	OrganizationID uuid.UUID  `json:"organizationId" db:"organization_id"`
+	UserID         uuid.UUID  `json:"userId" db:"user_id"`
+	ProviderID     uuid.UUID  `json:"providerId" db:"provider_id"`
+	Subject        string     `json:"subject" db:"subject"`
+	Email          string     `json:"email" db:"email"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	LastLoginAt    *time.Time `json:"lastLoginAt,omitempty" db:"last_login_at"`
+	// ProviderSlug and ProviderName are filled in when listing a user's
+	// identities
+	ProviderSlug string `json:"providerSlug,omitempty" db:"provider_slug"`
+	ProviderName string `json:"providerName,omitempty" db:"provider_name"`
+}
+
+// FederatedLogin is a sign-in in progress at an identity provider. It is
+// found again by the hash of the state parameter when the provider sends
+// the user back, and holds what is needed to redeem the code.
+type FederatedLogin struct {
+	ID             uuid.UUID `db:"id"`
+	OrganizationID uuid.UUID `db:"organization_id"`
+	ProviderID     uuid.UUID `db:"provider_id"`
+	StateHash      string    `db:"state_hash"`
+	Nonce          string    `db:"nonce"`
+	CodeVerifier   string    `db:"code_verifier"`
+	ExpiresAt      time.Time `db:"expires_at"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+type FederatedLoginRequest struct {
+	Organization string `json:"organization"`
+	Provider     string `json:"provider" binding:"required"`
+}
+
+// FederatedLoginResponse says where to send the browser to sign in. The
+// page should keep state and only post back a callback carrying the same
+// state.
+type FederatedLoginResponse struct {
+	RedirectTo string `json:"redirectTo"`
+	State      string `json:"state"`
+}
+
+// FederatedCallbackRequest carries the parameters the provider sent the
+// browser back with
+type FederatedCallbackRequest struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
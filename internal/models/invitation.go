@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invitation statuses, derived from the invitation's timestamps
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation invites someone to join an organization with a role. The
+// invitee accepts it with the token from the invitation link, choosing
+// their password.
+type Invitation struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	OrganizationID uuid.UUID  `json:"organizationId" db:"organization_id"`
+	Email          string     `json:"email" db:"email"`
+	Role           string     `json:"role" db:"role"`
+	Locale         string     `json:"locale,omitempty" db:"locale"` // Language of the invitation message
+	InviterID      *uuid.UUID `json:"inviterId,omitempty" db:"inviter_id"`
+	TokenHash      string     `json:"-" db:"token_hash"`
+	ExpiresAt      time.Time  `json:"expiresAt" db:"expires_at"`
+	SentAt         time.Time  `json:"sentAt" db:"sent_at"`
+	SendCount      int        `json:"sendCount" db:"send_count"`
+	AcceptedAt     *time.Time `json:"acceptedAt,omitempty" db:"accepted_at"`
+	UserID         *uuid.UUID `json:"userId,omitempty" db:"user_id"` // Set once accepted
+	RevokedAt      *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+// Status reports whether the invitation is pending, accepted, revoked or
+// expired at now
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// InvitationResponse is an invitation as shown to admins
+type InvitationResponse struct {
+	*Invitation
+	Status string `json:"status"`
+}
+
+// NewInvitationResponse converts an invitation into its public representation
+func NewInvitationResponse(invitation *Invitation) InvitationResponse {
+	return InvitationResponse{Invitation: invitation, Status: invitation.Status(time.Now())}
+}
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	// Role defaults to user
+	Role string `json:"role" binding:"omitempty,oneof=user admin"`
+	// Locale is the language of the invitation message, e.g. es or pt-BR
+	Locale string `json:"locale" binding:"omitempty,bcp47_language_tag"`
+}
+
+type AcceptInvitationRequest struct {
+	Token       string `json:"token" binding:"required"`
+	Password    string `json:"password" binding:"required,min=8"`
+	FirstName   string `json:"firstName" binding:"required"`
+	LastName    string `json:"lastName" binding:"required"`
+	PhoneNumber string `json:"phoneNumber" binding:"omitempty,e164"`
+}
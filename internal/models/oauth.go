@@ -0,0 +1,193 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is an application that signs users in through the OpenID
+// Connect provider. Confidential clients authenticate with a secret; public
+// clients, such as single-page and mobile apps, rely on PKCE alone.
+type OAuthClient struct {
+	ID             uuid.UUID `json:"clientId" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	SecretHash     string    `json:"-" db:"secret_hash"` // Empty for public clients
+	RedirectURIs   []string  `json:"redirectUris" db:"-"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Confidential reports whether the client authenticates with a secret
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// AllowsRedirect reports whether uri is one of the client's registered
+// redirect URIs. URIs are compared exactly, as RFC 6749 section 3.1.2.3
+// recommends.
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if uri == registered {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthClientResponse is a client as shown to admins
+type OAuthClientResponse struct {
+	*OAuthClient
+	Confidential bool `json:"confidential"`
+	// ClientSecret is only returned when the client is created or its
+	// secret is rotated
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+// NewOAuthClientResponse converts a client into its public representation
+func NewOAuthClientResponse(client *OAuthClient) OAuthClientResponse {
+	return OAuthClientResponse{OAuthClient: client, Confidential: client.Confidential()}
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	RedirectURIs []string `json:"redirectUris" binding:"required,min=1,dive,url"`
+	// Confidential clients get a secret; public clients only use PKCE
+	Confidential bool `json:"confidential"`
+}
+
+type UpdateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=255"`
+	RedirectURIs []string `json:"redirectUris" binding:"required,min=1,dive,url"`
+	// RotateSecret replaces the secret of a confidential client; the new
+	// secret is returned once
+	RotateSecret bool `json:"rotateSecret"`
+}
+
+// OAuthConsent records the scopes a user has granted a client
+type OAuthConsent struct {
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	ClientID       uuid.UUID `json:"clientId" db:"client_id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	Scope          string    `json:"scope" db:"scope"` // Space-separated
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// OAuthAuthorizationCode is issued when a user approves an authorization
+// request and exchanged once by the client for tokens. Only its hash is
+// stored.
+type OAuthAuthorizationCode struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	OrganizationID uuid.UUID  `json:"organizationId" db:"organization_id"`
+	ClientID       uuid.UUID  `json:"clientId" db:"client_id"`
+	UserID         uuid.UUID  `json:"userId" db:"user_id"`
+	CodeHash       string     `json:"-" db:"code_hash"`
+	RedirectURI    string     `json:"redirectUri" db:"redirect_uri"`
+	Scope          string     `json:"scope" db:"scope"`
+	Nonce          string     `json:"-" db:"nonce"`
+	CodeChallenge  string     `json:"-" db:"code_challenge"`
+	ExpiresAt      time.Time  `json:"expiresAt" db:"expires_at"`
+	UsedAt         *time.Time `json:"usedAt,omitempty" db:"used_at"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// OAuthAccessToken is an opaque access token issued to a client. Only its
+// hash is stored.
+type OAuthAccessToken struct {
+	ID                  uuid.UUID  `json:"id" db:"id"`
+	OrganizationID      uuid.UUID  `json:"organizationId" db:"organization_id"`
+	ClientID            uuid.UUID  `json:"clientId" db:"client_id"`
+	UserID              uuid.UUID  `json:"userId" db:"user_id"`
+	AuthorizationCodeID *uuid.UUID `json:"authorizationCodeId,omitempty" db:"authorization_code_id"`
+	TokenHash           string     `json:"-" db:"token_hash"`
+	Scope               string     `json:"scope" db:"scope"`
+	ExpiresAt           time.Time  `json:"expiresAt" db:"expires_at"`
+	RevokedAt           *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt           time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Active reports whether the token can be used at now
+func (t *OAuthAccessToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// HasScope reports whether the token was granted scope
+func (t *OAuthAccessToken) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(t.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizeRequest holds the parameters of an OAuth 2.0 authorization
+// request. They arrive as the query of /oauth/authorize and are passed on
+// unchanged by the consent page, so they keep their protocol names.
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// AuthorizeDecision is the signed-in user's answer to an authorization request
+type AuthorizeDecision struct {
+	AuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// AuthorizationPrompt describes an authorization request to the consent page
+type AuthorizationPrompt struct {
+	Client struct {
+		ClientID uuid.UUID `json:"clientId"`
+		Name     string    `json:"name"`
+	} `json:"client"`
+	Scopes []string `json:"scopes"`
+	// ConsentRequired is false when the user has already granted every
+	// requested scope, so the page can approve without asking
+	ConsentRequired bool `json:"consentRequired"`
+}
+
+// AuthorizeResponse tells the consent page where to send the browser
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirectTo"`
+}
+
+// TokenRequest is the form posted to the token endpoint
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// TokenResponse is a successful token endpoint response (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// IntrospectionResponse describes a token to a resource server (RFC 7662)
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization is a tenant. Every user belongs to exactly one, and emails
+// are unique within it.
+type Organization struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	Slug      string    `json:"slug" db:"slug"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// CreateOrganizationRequest creates an organization, optionally together
+// with its first admin
+type CreateOrganizationRequest struct {
+	Slug  string           `json:"slug" binding:"required,max=63"`
+	Name  string           `json:"name" binding:"required,max=255"`
+	Admin *RegisterRequest `json:"admin"`
+}
+
+// UpdateOrganizationRequest renames an organization; the slug is permanent
+type UpdateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// ValidSlug reports whether slug is lower-case letters, digits and inner
+// hyphens, as organization slugs must be
+func ValidSlug(slug string) bool {
+	return len(slug) <= 63 && slugPattern.MatchString(slug)
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = validator.New()
+
+// NullableString is a JSON merge patch (RFC 7396) member: it records whether
+// the member was present in the patch and, if so, whether it was null.
+type NullableString struct {
+	Set   bool // member present in the patch
+	Null  bool // member present with a null value, meaning "clear"
+	Value string
+}
+
+// UnmarshalJSON is only called for members present in the document
+func (n *NullableString) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		n.Null = true
+		n.Value = ""
+		return nil
+	}
+	n.Null = false
+	return json.Unmarshal(data, &n.Value)
+}
+
+// SetString returns a NullableString holding value
+func SetString(value string) NullableString {
+	return NullableString{Set: true, Value: value}
+}
+
+// ClearString returns a NullableString that clears the field
+func ClearString() NullableString {
+	return NullableString{Set: true, Null: true}
+}
+
+// UserPatch is a partial update of a user. Members that are not Set are left
+// unchanged; a null member clears the field.
+type UserPatch struct {
+	FirstName   NullableString `json:"firstName"`
+	LastName    NullableString `json:"lastName"`
+	Email       NullableString `json:"email"`
+	PhoneNumber NullableString `json:"phoneNumber"`
+}
+
+// IsEmpty reports whether the patch changes nothing
+func (p *UserPatch) IsEmpty() bool {
+	return !p.FirstName.Set && !p.LastName.Set && !p.Email.Set && !p.PhoneNumber.Set
+}
+
+// Validate checks each present member and returns a message per invalid
+// field, keyed by its JSON name. It returns nil when the patch is valid.
+func (p *UserPatch) Validate() map[string]string {
+	errs := map[string]string{}
+
+	requiredName := func(field string, v NullableString) {
+		if !v.Set {
+			return
+		}
+		switch {
+		case v.Null || strings.TrimSpace(v.Value) == "":
+			errs[field] = "cannot be empty"
+		case len(v.Value) > 100:
+			errs[field] = "must be at most 100 characters"
+		}
+	}
+	requiredName("firstName", p.FirstName)
+	requiredName("lastName", p.LastName)
+
+	if p.Email.Set {
+		switch {
+		case p.Email.Null || p.Email.Value == "":
+			errs["email"] = "cannot be empty"
+		case len(p.Email.Value) > 255 || validate.Var(p.Email.Value, "email") != nil:
+			errs["email"] = "must be a valid email address"
+		}
+	}
+
+	if p.PhoneNumber.Set && !p.PhoneNumber.Null {
+		if validate.Var(p.PhoneNumber.Value, "e164") != nil {
+			errs["phoneNumber"] = "must be in E.164 format or null to clear"
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ToPatch converts the legacy PUT body, where empty strings mean "unchanged",
+// into a UserPatch
+func (r *UpdateProfileRequest) ToPatch() *UserPatch {
+	patch := &UserPatch{}
+	if r.FirstName != "" {
+		patch.FirstName = SetString(r.FirstName)
+	}
+	if r.LastName != "" {
+		patch.LastName = SetString(r.LastName)
+	}
+	if r.Email != "" {
+		patch.Email = SetString(r.Email)
+	}
+	if r.PhoneNumber != "" {
+		patch.PhoneNumber = SetString(r.PhoneNumber)
+	}
+	return patch
+}
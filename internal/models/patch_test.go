@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUserPatchUnmarshal(t *testing.T) {
+	var patch UserPatch
+	body := `{"firstName":"Jane","phoneNumber":null}`
+	if err := json.Unmarshal([]byte(body), &patch); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+
+	if !patch.FirstName.Set || patch.FirstName.Null || patch.FirstName.Value != "Jane" {
+		t.Errorf("FirstName = %+v, want set to Jane", patch.FirstName)
+	}
+	if !patch.PhoneNumber.Set || !patch.PhoneNumber.Null {
+		t.Errorf("PhoneNumber = %+v, want explicit null", patch.PhoneNumber)
+	}
+	if patch.LastName.Set || patch.Email.Set {
+		t.Errorf("absent members should not be set: lastName=%+v email=%+v", patch.LastName, patch.Email)
+	}
+	if patch.IsEmpty() {
+		t.Error("IsEmpty() = true, want false")
+	}
+}
+
+func TestUserPatchValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		patch      UserPatch
+		wantFields []string
+	}{
+		{
+			name:  "empty patch is valid",
+			patch: UserPatch{},
+		},
+		{
+			name:  "clearing the phone number is allowed",
+			patch: UserPatch{PhoneNumber: ClearString()},
+		},
+		{
+			name:  "valid values",
+			patch: UserPatch{FirstName: SetString("Jane"), Email: SetString("jane@example.com"), PhoneNumber: SetString("+14155552671")},
+		},
+		{
+			name:       "required fields cannot be cleared",
+			patch:      UserPatch{FirstName: ClearString(), LastName: SetString("  "), Email: ClearString()},
+			wantFields: []string{"firstName", "lastName", "email"},
+		},
+		{
+			name:       "malformed values",
+			patch:      UserPatch{Email: SetString("not-an-email"), PhoneNumber: SetString("555-1234")},
+			wantFields: []string{"email", "phoneNumber"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.patch.Validate()
+			if len(got) != len(tt.wantFields) {
+				t.Fatalf("Validate() = %v, want errors for %v", got, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if _, ok := got[field]; !ok {
+					t.Errorf("Validate() missing error for %s: %v", field, got)
+				}
+			}
+		})
+	}
+}
@@ -7,37 +7,84 @@ import (
 	"github.com/google/uuid"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID          uuid.UUID      `json:"id" db:"id"`
-	Email       string         `json:"email" db:"email"`
-	Password    string         `json:"-" db:"password_hash"` // Never returned in responses
-	FirstName   string         `json:"first_name" db:"first_name"`
-	LastName    string         `json:"last_name" db:"last_name"`
-	PhoneNumber sql.NullString `json:"phone_number,omitempty" db:"phone_number"`
-	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at" db:"updated_at"`
+	ID             uuid.UUID      `json:"id" db:"id"`
+	OrganizationID uuid.UUID      `json:"organization_id" db:"organization_id"`
+	Email          string         `json:"email" db:"email"`
+	Password       string         `json:"-" db:"password_hash"` // Never returned in responses
+	FirstName      string         `json:"first_name" db:"first_name"`
+	LastName       string         `json:"last_name" db:"last_name"`
+	PhoneNumber    sql.NullString `json:"phone_number,omitempty" db:"phone_number"`
+	// PhoneVerifiedAt is set once the user proves they own PhoneNumber
+	PhoneVerifiedAt sql.NullTime `json:"phone_verified_at,omitempty" db:"phone_verified_at"`
+	Role            string       `json:"role" db:"role"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at" db:"updated_at"`
+	DeletedAt       sql.NullTime `json:"deleted_at,omitempty" db:"deleted_at"` // Set when soft deleted
+	Version         int64        `json:"version" db:"version"`                 // Incremented on every write
 }
 
 type UserResponse struct {
-	ID          uuid.UUID `json:"id"`
-	Email       string    `json:"email"`
-	FirstName   string    `json:"firstName"`
-	LastName    string    `json:"lastName"`
-	PhoneNumber string    `json:"phoneNumber,omitempty"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID             uuid.UUID `json:"id"`
+	OrganizationID uuid.UUID `json:"organizationId"`
+	Email          string    `json:"email"`
+	FirstName      string    `json:"firstName"`
+	LastName       string    `json:"lastName"`
+	PhoneNumber    string    `json:"phoneNumber,omitempty"`
+	// PhoneVerifiedAt is absent until the phone number has been verified
+	PhoneVerifiedAt *time.Time `json:"phoneVerifiedAt,omitempty"`
+	Role            string     `json:"role,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// NewUserResponse converts a user into its public representation
+func NewUserResponse(user *User) UserResponse {
+	response := UserResponse{
+		ID:             user.ID,
+		OrganizationID: user.OrganizationID,
+		Email:          user.Email,
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		PhoneNumber:    user.PhoneNumber.String,
+		Role:           user.Role,
+		CreatedAt:      user.CreatedAt,
+	}
+	if user.PhoneVerifiedAt.Valid {
+		response.PhoneVerifiedAt = &user.PhoneVerifiedAt.Time
+	}
+	return response
+}
+
+// DeletedUserResponse is returned to admins browsing soft-deleted accounts
+type DeletedUserResponse struct {
+	UserResponse
+	DeletedAt time.Time `json:"deletedAt"`
 }
 
 type RegisterRequest struct {
-	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=8"`
-	FirstName   string `json:"firstName" binding:"required"`
-	LastName    string `json:"lastName" binding:"required"`
-	PhoneNumber string `json:"phoneNumber" binding:"omitempty,e164"`
+	// Organization is the slug of the organization to join; empty means the
+	// default organization. Accounts created by an authenticated user always
+	// join that user's organization.
+	Organization string `json:"organization" binding:"omitempty,max=63"`
+	Email        string `json:"email" binding:"required,email"`
+	Password     string `json:"password" binding:"required,min=8"`
+	FirstName    string `json:"firstName" binding:"required"`
+	LastName     string `json:"lastName" binding:"required"`
+	PhoneNumber  string `json:"phoneNumber" binding:"omitempty,e164"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	// Organization is the slug of the account's organization; empty means
+	// the default organization
+	Organization string `json:"organization" binding:"omitempty,max=63"`
+	Email        string `json:"email" binding:"required,email"`
+	Password     string `json:"password" binding:"required"`
 }
 
 type LoginResponse struct {
@@ -53,6 +100,9 @@ type UpdateProfileRequest struct {
 }
 
 type ResetPasswordRequest struct {
-	Email       string `json:"email" binding:"required,email"`
-	NewPassword string `json:"newPassword" binding:"required,min=8"`
+	// Organization is the slug of the account's organization; empty means
+	// the default organization
+	Organization string `json:"organization" binding:"omitempty,max=63"`
+	Email        string `json:"email" binding:"required,email"`
+	NewPassword  string `json:"newPassword" binding:"required,min=8"`
 }
@@ -0,0 +1,60 @@
+// Package notify sends messages to users, such as invitation links, by email
+// or SMS. Messages are rendered from localized templates (see Render) and
+// handed to a Notifier: SMTP for real delivery, File, Memory or Log for
+// development and tests. Queue wraps any of them so callers never wait on
+// delivery.
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// Channel is how a message reaches its recipient
+type Channel string
+
+const (
+	Email Channel = "email"
+	SMS   Channel = "sms"
+)
+
+// ErrUnsupportedChannel is returned by notifiers that cannot deliver on a
+// message's channel
+var ErrUnsupportedChannel = errors.New("notification channel not supported")
+
+// Message is a single message to one recipient
+type Message struct {
+	// Channel defaults to Email
+	Channel Channel `json:"channel,omitempty"`
+	// To is an email address or, for SMS, an E.164 phone number
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Text    string `json:"text"`
+	// HTML is an optional alternative to Text for email
+	HTML string `json:"html,omitempty"`
+}
+
+// channel returns the channel of msg, applying the default
+func (msg Message) channel() Channel {
+	if msg.Channel == "" {
+		return Email
+	}
+	return msg.Channel
+}
+
+// Notifier delivers messages to users
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Log is a Notifier for development that writes messages to the log instead
+// of delivering them. Message bodies can hold secrets such as invitation
+// links, so they are only logged at debug level.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "Notification not delivered; no notifier is configured", "channel", msg.channel(), "to", msg.To, "subject", msg.Subject)
+	slog.DebugContext(ctx, "Notification body", "to", msg.To, "text", msg.Text)
+	return nil
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invitationData struct {
+	Role, Link, ExpiresAt string
+}
+
+func TestRender(t *testing.T) {
+	data := invitationData{Role: "admin", Link: "https://app.example.com/accept?token=a&b", ExpiresAt: "Mon, 02 Jan 2006"}
+
+	msg, err := Render("invitation", "es-MX", data)
+	require.NoError(t, err)
+	assert.Equal(t, "Has recibido una invitación", msg.Subject)
+	assert.Contains(t, msg.Text, "como admin")
+
+	// Unknown locales fall back to English
+	for _, locale := range []string{"", "fr", "EN_gb"} {
+		msg, err = Render("invitation", locale, data)
+		require.NoError(t, err, locale)
+		assert.Equal(t, "You have been invited", msg.Subject, locale)
+	}
+
+	// Text is left alone, HTML is escaped
+	assert.Contains(t, msg.Text, data.Link)
+	assert.Contains(t, msg.HTML, `href="https://app.example.com/accept?token=a&amp;b"`)
+
+	_, err = Render("no-such-template", "en", data)
+	assert.Error(t, err)
+}
+
+// flakyNotifier fails the first failures deliveries
+type flakyNotifier struct {
+	mu        sync.Mutex
+	failures  int
+	attempts  int
+	delivered chan Message
+}
+
+func (n *flakyNotifier) Notify(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.attempts++
+	if n.attempts <= n.failures {
+		return errors.New("connection refused")
+	}
+	n.delivered <- msg
+	return nil
+}
+
+func TestQueueRetries(t *testing.T) {
+	notifier := &flakyNotifier{failures: 2, delivered: make(chan Message, 1)}
+	queue := NewQueue(notifier, 10, 3)
+	queue.baseBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	require.NoError(t, queue.Notify(context.Background(), Message{To: "user@example.com", Text: "hello"}))
+	select {
+	case msg := <-notifier.delivered:
+		assert.Equal(t, "user@example.com", msg.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered")
+	}
+	assert.Equal(t, 3, notifier.attempts)
+}
+
+func TestQueueFull(t *testing.T) {
+	queue := NewQueue(&Memory{}, 1, 1)
+	require.NoError(t, queue.Notify(context.Background(), Message{To: "a@example.com"}))
+	assert.ErrorIs(t, queue.Notify(context.Background(), Message{To: "b@example.com"}), ErrQueueFull)
+}
+
+func TestSMTP(t *testing.T) {
+	notifier := NewSMTP(SMTPConfig{Host: "mail.example.com", Port: 587, From: "Example <no-reply@example.com>"})
+
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var body string
+	notifier.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo, body = addr, from, to, string(msg)
+		return nil
+	}
+
+	err := notifier.Notify(context.Background(), Message{To: "user@example.com", Subject: "Grüße", Text: "plain", HTML: "<p>rich</p>"})
+	require.NoError(t, err)
+	assert.Equal(t, "mail.example.com:587", gotAddr)
+	assert.Equal(t, "no-reply@example.com", gotFrom)
+	assert.Equal(t, []string{"user@example.com"}, gotTo)
+	assert.Contains(t, body, "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n")
+	assert.Contains(t, body, "Content-Type: multipart/alternative; boundary=")
+	assert.Contains(t, body, "plain")
+	assert.Contains(t, body, "<p>rich</p>")
+
+	err = notifier.Notify(context.Background(), Message{To: "user@example.com", Subject: "a\r\nBcc: victim@example.com"})
+	assert.Error(t, err)
+	err = notifier.Notify(context.Background(), Message{Channel: SMS, To: "+15555550100"})
+	assert.ErrorIs(t, err, ErrUnsupportedChannel)
+	assert.False(t, strings.Contains(body, "victim"))
+}
+
+func TestSMSGateway(t *testing.T) {
+	var received map[string]string
+	var auth string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		if received["to"] == "+15550000000" {
+			http.Error(w, "unknown number", http.StatusBadRequest)
+		}
+	}))
+	defer gateway.Close()
+
+	sms := NewSMSGateway(SMSGatewayConfig{URL: gateway.URL, Token: "secret", From: "Example"}, gateway.Client())
+	email := &Memory{}
+	notifier := Channels{Email: email, SMS: sms}
+
+	require.NoError(t, notifier.Notify(context.Background(), Message{Channel: SMS, To: "+15551234567", Text: "Your code is 123456"}))
+	assert.Equal(t, "Bearer secret", auth)
+	assert.Equal(t, map[string]string{"from": "Example", "to": "+15551234567", "text": "Your code is 123456"}, received)
+
+	err := notifier.Notify(context.Background(), Message{Channel: SMS, To: "+15550000000", Text: "Hi"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown number")
+
+	// Email goes to its own notifier; the gateway does not take it
+	require.NoError(t, notifier.Notify(context.Background(), Message{To: "user@example.com", Text: "Hi"}))
+	assert.Len(t, email.Messages(), 1)
+	assert.ErrorIs(t, sms.Notify(context.Background(), Message{To: "user@example.com"}), ErrUnsupportedChannel)
+	assert.ErrorIs(t, Channels{}.Notify(context.Background(), Message{}), ErrUnsupportedChannel)
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/metrics"
+)
+
+const (
+	defaultQueueWorkers = 4
+	defaultBaseBackoff  = time.Second
+	defaultMaxBackoff   = time.Minute
+)
+
+// ErrQueueFull is returned when a message cannot be queued without waiting
+var ErrQueueFull = errors.New("notification queue is full")
+
+// Queue is a Notifier that hands messages to another one in the background,
+// so requests never wait on a mail server. Failed deliveries are retried with
+// exponential backoff. Messages are only kept in memory: any still queued
+// when the service stops are lost.
+type Queue struct {
+	notifier    Notifier
+	messages    chan queued
+	workers     int
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// queued is a message waiting for delivery together with the request that
+// sent it, for logging
+type queued struct {
+	msg       Message
+	requestID string
+}
+
+// NewQueue creates a Queue holding up to size messages, each tried up to
+// maxAttempts times
+func NewQueue(notifier Notifier, size, maxAttempts int) *Queue {
+	return &Queue{
+		notifier:    notifier,
+		messages:    make(chan queued, size),
+		workers:     defaultQueueWorkers,
+		maxAttempts: maxAttempts,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+}
+
+// Notify queues msg and returns straight away
+func (q *Queue) Notify(ctx context.Context, msg Message) error {
+	select {
+	case q.messages <- queued{msg: msg, requestID: logging.RequestID(ctx)}:
+		return nil
+	default:
+		metrics.NotificationSent(string(msg.channel()), metrics.NotificationDropped)
+		return ErrQueueFull
+	}
+}
+
+// Run delivers queued messages until ctx is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Delivering notifications", "workers", q.workers, "max_attempts", q.maxAttempts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case item := <-q.messages:
+					q.deliver(logging.WithRequestID(ctx, item.requestID), item.msg)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(q.messages); n > 0 {
+		slog.WarnContext(ctx, "Notifications still queued at shutdown were not delivered", "count", n)
+	}
+}
+
+// deliver tries msg until it is delivered, its attempts run out or ctx is
+// cancelled
+func (q *Queue) deliver(ctx context.Context, msg Message) {
+	channel := string(msg.channel())
+	for attempt := 1; ; attempt++ {
+		err := q.notifier.Notify(ctx, msg)
+		if err == nil {
+			metrics.NotificationSent(channel, metrics.NotificationDelivered)
+			return
+		}
+		if attempt >= q.maxAttempts || errors.Is(err, ErrUnsupportedChannel) {
+			slog.ErrorContext(ctx, "Failed to deliver notification", "channel", channel, "to", msg.To,
+				"attempts", attempt, "error", err)
+			metrics.NotificationSent(channel, metrics.NotificationFailed)
+			return
+		}
+
+		slog.WarnContext(ctx, "Notification delivery failed; retrying", "channel", channel, "to", msg.To,
+			"attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.backoff(attempt)):
+		}
+	}
+}
+
+// backoff returns the delay after the nth failed attempt
+func (q *Queue) backoff(n int) time.Duration {
+	delay := q.baseBackoff
+	for i := 1; i < n && delay < q.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.maxBackoff {
+		delay = q.maxBackoff
+	}
+	return delay
+}
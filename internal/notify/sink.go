@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// File is a Notifier for development that appends every message to a file
+// as a JSON line instead of delivering it
+type File struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFile creates a File sink writing to path
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// fileRecord is one line of a File sink
+type fileRecord struct {
+	Time time.Time `json:"time"`
+	Message
+}
+
+func (f *File) Notify(ctx context.Context, msg Message) error {
+	msg.Channel = msg.channel()
+	line, err := json.Marshal(fileRecord{Time: time.Now().UTC(), Message: msg})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Memory is a Notifier for tests that keeps every message
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Memory) Notify(ctx context.Context, msg Message) error {
+	msg.Channel = msg.channel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages received so far, oldest first
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
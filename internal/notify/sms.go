@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SMSGatewayConfig says how to reach an HTTP SMS gateway
+type SMSGatewayConfig struct {
+	// URL receives a POST per message
+	URL string
+	// Token is sent as a bearer token, if set
+	Token string
+	// From is the sender ID or number, if the gateway needs one
+	From string
+}
+
+// SMSGateway sends text messages through an HTTP gateway. Each message is
+// POSTed as JSON, {"from": ..., "to": "+15551234567", "text": ...}, and any
+// 2xx response counts as accepted. Most SMS providers can be reached this
+// way directly or through a small adapter.
+type SMSGateway struct {
+	cfg    SMSGatewayConfig
+	client *http.Client
+}
+
+// NewSMSGateway creates an SMS notifier that uses client for its requests
+func NewSMSGateway(cfg SMSGatewayConfig, client *http.Client) *SMSGateway {
+	return &SMSGateway{cfg: cfg, client: client}
+}
+
+func (g *SMSGateway) Notify(ctx context.Context, msg Message) error {
+	if msg.channel() != SMS {
+		return ErrUnsupportedChannel
+	}
+	body, err := json.Marshal(struct {
+		From string `json:"from,omitempty"`
+		To   string `json:"to"`
+		Text string `json:"text"`
+	}{g.cfg.From, msg.To, msg.Text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.cfg.Token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS gateway responded %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// Channels is a Notifier that hands each message to the notifier for its
+// channel, e.g. email to SMTP and SMS to an SMSGateway
+type Channels map[Channel]Notifier
+
+func (c Channels) Notify(ctx context.Context, msg Message) error {
+	notifier, ok := c[msg.channel()]
+	if !ok {
+		return ErrUnsupportedChannel
+	}
+	return notifier.Notify(ctx, msg)
+}
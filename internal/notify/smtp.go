@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig says how to reach the mail server
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password enable PLAIN authentication, which net/smtp
+	// only performs over TLS or to localhost
+	Username string
+	Password string
+	// From is the sender, e.g. "Example <no-reply@example.com>"
+	From string
+}
+
+// SMTP delivers email through a mail server. The connection is upgraded
+// with STARTTLS whenever the server offers it.
+type SMTP struct {
+	cfg  SMTPConfig
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+	now  func() time.Time
+}
+
+// NewSMTP creates an SMTP notifier
+func NewSMTP(cfg SMTPConfig) *SMTP {
+	return &SMTP{cfg: cfg, send: smtp.SendMail, now: time.Now}
+}
+
+func (s *SMTP) Notify(ctx context.Context, msg Message) error {
+	if msg.channel() != Email {
+		return ErrUnsupportedChannel
+	}
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+	body, err := s.compose(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	return s.send(addr, auth, from.Address, []string{to.Address}, body)
+}
+
+// compose builds the MIME message: plain text, or multipart/alternative
+// when there is an HTML version
+func (s *SMTP) compose(from, to *mail.Address, msg Message) ([]byte, error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("subject must be a single line")
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", s.now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is used when a message has no translation in the requested
+// locale
+const DefaultLocale = "en"
+
+// Templates are named <name>.<locale>.tmpl and define "subject" and "text",
+// plus "html" for email. The text parts are rendered with text/template and
+// the HTML part with html/template, which escapes the data.
+//
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var textTemplates, htmlTemplates = mustLoadTemplates()
+
+func mustLoadTemplates() (map[string]*texttemplate.Template, map[string]*htmltemplate.Template) {
+	text := map[string]*texttemplate.Template{}
+	html := map[string]*htmltemplate.Template{}
+
+	files, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		key := strings.TrimSuffix(path.Base(file), ".tmpl")
+		text[key] = texttemplate.Must(texttemplate.ParseFS(templateFS, file))
+		html[key] = htmltemplate.Must(htmltemplate.ParseFS(templateFS, file))
+	}
+	return text, html
+}
+
+// Render builds the message called name in locale from data. A locale such
+// as pt-BR falls back to pt and then to DefaultLocale. The caller fills in
+// the recipient and channel.
+func Render(name, locale string, data interface{}) (Message, error) {
+	key, ok := resolve(name, locale)
+	if !ok {
+		return Message{}, fmt.Errorf("no template named %q", name)
+	}
+
+	var msg Message
+	var err error
+	if msg.Subject, err = executeText(key, "subject", data); err != nil {
+		return Message{}, err
+	}
+	msg.Subject = strings.TrimSpace(msg.Subject)
+	if msg.Text, err = executeText(key, "text", data); err != nil {
+		return Message{}, err
+	}
+	if tmpl := htmlTemplates[key].Lookup("html"); tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return Message{}, fmt.Errorf("render %s html: %w", key, err)
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+// resolve finds the template key for name in the closest available locale
+func resolve(name, locale string) (string, bool) {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, candidate := range candidates {
+		key := name + "." + candidate
+		if _, ok := textTemplates[key]; ok && candidate != "" {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// executeText renders one of the text parts of a template; parts that are
+// not defined render empty
+func executeText(key, part string, data interface{}) (string, error) {
+	tmpl := textTemplates[key].Lookup(part)
+	if tmpl == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render %s %s: %w", key, part, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,141 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// generatedKeyBits is the size of keys generated when none is configured
+const generatedKeyBits = 2048
+
+// ErrInvalidKey is returned for keys that are not PEM-encoded RSA private keys
+var ErrInvalidKey = errors.New("signing key must be a PEM-encoded RSA private key")
+
+// ParsePrivateKey decodes a PEM-encoded PKCS #1 or PKCS #8 RSA private key
+func ParsePrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Signer signs ID tokens with RS256. Its key ID is the RFC 7638 thumbprint
+// of the public key, so it changes whenever the key does.
+type Signer struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewSigner creates a signer from a PEM-encoded RSA private key. An empty
+// key generates a new one, which only lasts as long as the process.
+func NewSigner(pemKey string) (*Signer, error) {
+	var key *rsa.PrivateKey
+	var err error
+	if pemKey == "" {
+		key, err = rsa.GenerateKey(rand.Reader, generatedKeyBits)
+	} else {
+		key, err = ParsePrivateKey(pemKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	jwk := NewJWK(&key.PublicKey, "")
+	return &Signer{key: key, keyID: jwk.Thumbprint()}, nil
+}
+
+// KeyID returns the kid of the signing key
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign returns claims as a signed JWT
+func (s *Signer) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyID
+	return token.SignedString(s.key)
+}
+
+// JWKS returns the public key set relying parties verify ID tokens with
+func (s *Signer) JWKS() JWKSet {
+	return JWKSet{Keys: []JWK{NewJWK(&s.key.PublicKey, s.keyID)}}
+}
+
+// JWK is an RSA public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// JWKSet is a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes key as a signing JWK with the given key ID
+func NewJWK(key *rsa.PublicKey, keyID string) JWK {
+	return JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     keyID,
+		Modulus:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key
+func (k JWK) Thumbprint() string {
+	// The required members in lexicographic order, without whitespace
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{k.Exponent, k.KeyType, k.Modulus})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKey decodes the RSA public key
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.KeyType != "RSA" {
+		return nil, errors.New("not an RSA key")
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
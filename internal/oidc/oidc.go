@@ -0,0 +1,157 @@
+// Package oidc holds the protocol pieces of the OpenID Connect provider:
+// scopes and the standard claims they release, PKCE, discovery metadata,
+// and the RSA key that signs ID tokens and is published as a JWK set. It
+// also holds the relying party that signs users in with external
+// providers.
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/atulsm/user-service/internal/models"
+)
+
+// Scopes understood by the provider
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+// Scopes lists every supported scope
+var Scopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePhone}
+
+// Claims lists the claims the provider can release
+var Claims = []string{
+	"iss", "sub", "aud", "exp", "iat", "nonce",
+	"name", "given_name", "family_name", "updated_at",
+	"email", "phone_number", "phone_number_verified",
+}
+
+// ParseScope splits a space-separated scope parameter, dropping duplicates.
+// Unsupported scopes are an error.
+func ParseScope(scope string) ([]string, error) {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !HasScope(Scopes, s) {
+			return nil, fmt.Errorf("unsupported scope %q", s)
+		}
+		if !HasScope(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// HasScope reports whether scopes contains scope
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// UserClaims returns the standard claims about user that scopes release
+// (OpenID Connect Core section 5.4). sub is always included.
+func UserClaims(user *models.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID.String()}
+	if HasScope(scopes, ScopeProfile) {
+		claims["name"] = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		claims["given_name"] = user.FirstName
+		claims["family_name"] = user.LastName
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if HasScope(scopes, ScopeEmail) {
+		// email_verified is left out: the service does not verify emails
+		claims["email"] = user.Email
+	}
+	if HasScope(scopes, ScopePhone) && user.PhoneNumber.Valid {
+		claims["phone_number"] = user.PhoneNumber.String
+		claims["phone_number_verified"] = user.PhoneVerifiedAt.Valid
+	}
+	return claims
+}
+
+// PKCE code challenge methods (RFC 7636). Only S256 is accepted; plain
+// offers no protection once the challenge leaks.
+const CodeChallengeS256 = "S256"
+
+var pkceValue = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// ValidCodeChallenge reports whether challenge is shaped like an S256
+// challenge
+func ValidCodeChallenge(challenge string) bool {
+	return len(challenge) == 43 && pkceValue.MatchString(challenge)
+}
+
+// S256Challenge returns the S256 code challenge of verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE reports whether verifier is a well-formed code verifier whose
+// S256 challenge is challenge
+func VerifyPKCE(challenge, verifier string) bool {
+	if !pkceValue.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
+
+// Discovery is the OpenID Provider Metadata served at
+// /.well-known/openid-configuration (OpenID Connect Discovery section 3)
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+	IntrospectionEndpointAuthMethods  []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethods     []string `json:"revocation_endpoint_auth_methods_supported"`
+}
+
+// NewDiscovery returns the metadata of the provider at issuer, which must
+// not end in a slash
+func NewDiscovery(issuer string) Discovery {
+	clientAuth := []string{"client_secret_basic", "client_secret_post"}
+	return Discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   Scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: append(clientAuth, "none"),
+		CodeChallengeMethodsSupported:     []string{CodeChallengeS256},
+		ClaimsSupported:                   Claims,
+		AuthorizationResponseIssParameter: true,
+		IntrospectionEndpointAuthMethods:  clientAuth,
+		RevocationEndpointAuthMethods:     append(clientAuth, "none"),
+	}
+}
@@ -0,0 +1,94 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// The example of RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.Equal(t, challenge, S256Challenge(verifier))
+	assert.True(t, ValidCodeChallenge(challenge))
+	assert.True(t, VerifyPKCE(challenge, verifier))
+
+	assert.False(t, VerifyPKCE(challenge, verifier[:42]+"x"))
+	assert.False(t, VerifyPKCE(challenge, challenge))
+	// Too short to be a verifier, even with the right challenge
+	assert.False(t, VerifyPKCE(S256Challenge("short"), "short"))
+	assert.False(t, ValidCodeChallenge("plain-challenge"))
+}
+
+func TestParseScope(t *testing.T) {
+	scopes, err := ParseScope(" openid  email openid ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, scopes)
+
+	_, err = ParseScope("openid offline_access")
+	assert.ErrorContains(t, err, "offline_access")
+}
+
+func TestUserClaims(t *testing.T) {
+	user := &models.User{
+		ID:          uuid.New(),
+		Email:       "ada@example.com",
+		FirstName:   "Ada",
+		LastName:    "Lovelace",
+		PhoneNumber: sql.NullString{String: "+15551234567", Valid: true},
+		UpdatedAt:   time.Unix(1700000000, 0),
+	}
+
+	assert.Equal(t, map[string]interface{}{"sub": user.ID.String()}, UserClaims(user, []string{ScopeOpenID}))
+
+	claims := UserClaims(user, Scopes)
+	assert.Equal(t, "Ada Lovelace", claims["name"])
+	assert.Equal(t, "Lovelace", claims["family_name"])
+	assert.Equal(t, int64(1700000000), claims["updated_at"])
+	assert.Equal(t, "ada@example.com", claims["email"])
+	assert.Equal(t, "+15551234567", claims["phone_number"])
+	assert.Equal(t, false, claims["phone_number_verified"])
+}
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	signer, err := NewSigner(pemKey)
+	require.NoError(t, err)
+
+	// The key ID only depends on the key
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	again, err := NewSigner(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})))
+	require.NoError(t, err)
+	assert.Equal(t, signer.KeyID(), again.KeyID())
+
+	token, err := signer.Sign(jwt.MapClaims{"sub": "someone"})
+	require.NoError(t, err)
+
+	// Relying parties verify with the published key
+	jwks := signer.JWKS()
+	require.Len(t, jwks.Keys, 1)
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal(t, jwks.Keys[0].KeyID, token.Header["kid"])
+		return jwks.Keys[0].PublicKey()
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	require.NoError(t, err)
+	assert.Equal(t, "someone", parsed.Claims.(jwt.MapClaims)["sub"])
+
+	_, err = NewSigner("not a key")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
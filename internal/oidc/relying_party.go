@@ -0,0 +1,333 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrProviderUnavailable is returned when an identity provider cannot be
+	// reached or does not answer like an OpenID Provider
+	ErrProviderUnavailable = errors.New("identity provider unavailable")
+	// ErrAuthenticationFailed is returned when an identity provider rejects
+	// an authorization code or its ID token does not verify
+	ErrAuthenticationFailed = errors.New("authentication with the identity provider failed")
+)
+
+const (
+	// metadataTTL is how long discovered metadata and keys are reused
+	metadataTTL = time.Hour
+	// maxResponseSize bounds what is read from an identity provider
+	maxResponseSize = 1 << 20
+	// clockSkew is the leeway allowed on ID token timestamps
+	clockSkew = time.Minute
+)
+
+// Client is the registration of the service as a client of an external
+// OpenID Provider
+type Client struct {
+	Issuer   string
+	ClientID string
+	// ClientSecret is empty for public clients, which rely on PKCE alone
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+}
+
+// Identity is what a verified ID token says about the signed-in user
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+}
+
+// RelyingParty signs users in with external OpenID Providers using the
+// authorization code flow with PKCE. Provider metadata and keys are
+// discovered from the issuer and cached.
+type RelyingParty struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	providers map[string]*provider
+}
+
+// provider is the cached metadata and signing keys of an issuer
+type provider struct {
+	metadata  Discovery
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewRelyingParty creates a relying party that talks to providers with
+// client, or a client with a 10 second timeout when nil
+func NewRelyingParty(client *http.Client) *RelyingParty {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RelyingParty{client: client, providers: make(map[string]*provider)}
+}
+
+// AuthorizationURL returns where to send the browser to sign in at the
+// provider. state, nonce and the S256 codeChallenge must be fresh for each
+// sign-in.
+func (rp *RelyingParty) AuthorizationURL(ctx context.Context, client Client, state, nonce, codeChallenge string) (string, error) {
+	p, err := rp.provider(ctx, client.Issuer, false)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(p.metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint", ErrProviderUnavailable)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", client.ClientID)
+	query.Set("redirect_uri", client.RedirectURI)
+	query.Set("scope", strings.Join(client.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", CodeChallengeS256)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider and returns the
+// identity in its ID token, which must carry nonce
+func (rp *RelyingParty) Exchange(ctx context.Context, client Client, code, codeVerifier, nonce string) (*Identity, error) {
+	p, err := rp.provider(ctx, client.Issuer, false)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {client.RedirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	if client.ClientSecret == "" {
+		form.Set("client_id", client.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid token endpoint", ErrProviderUnavailable)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if client.ClientSecret != "" {
+		// client_secret_basic form-encodes both parts (RFC 6749 section 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(client.ClientID), url.QueryEscape(client.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := rp.do(req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: token endpoint answered %d %s %s", ErrAuthenticationFailed, status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token issued", ErrAuthenticationFailed)
+	}
+	return rp.verify(ctx, client, p, tokens.IDToken, nonce)
+}
+
+// idTokenClaims are the ID token claims the relying party reads
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	Email           string   `json:"email"`
+	EmailVerified   jsonBool `json:"email_verified"`
+	Name            string   `json:"name"`
+	GivenName       string   `json:"given_name"`
+	FamilyName      string   `json:"family_name"`
+}
+
+// verify checks an ID token as OpenID Connect Core section 3.1.3.7 asks of
+// tokens received directly from the token endpoint
+func (rp *RelyingParty) verify(ctx context.Context, client Client, p *provider, idToken, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return rp.key(ctx, client.Issuer, p, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(client.ClientID),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if errors.Is(err, ErrProviderUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthenticationFailed, err)
+	}
+	switch {
+	case claims.ExpiresAt == nil:
+		return nil, fmt.Errorf("%w: ID token has no expiry", ErrAuthenticationFailed)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: ID token has no subject", ErrAuthenticationFailed)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != client.ClientID:
+		return nil, fmt.Errorf("%w: ID token was issued to %q", ErrAuthenticationFailed, claims.AuthorizedParty)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: ID token nonce does not match", ErrAuthenticationFailed)
+	}
+
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
+
+// provider returns the metadata and keys of issuer, discovering them when
+// they are not cached, have expired or refresh is set
+func (rp *RelyingParty) provider(ctx context.Context, issuer string, refresh bool) (*provider, error) {
+	rp.mu.Lock()
+	p, ok := rp.providers[issuer]
+	rp.mu.Unlock()
+	if ok && !refresh && time.Since(p.fetchedAt) < metadataTTL {
+		return p, nil
+	}
+
+	p = &provider{fetchedAt: time.Now()}
+	if err := rp.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &p.metadata); err != nil {
+		return nil, err
+	}
+	if p.metadata.Issuer != issuer {
+		return nil, fmt.Errorf("%w: metadata names issuer %q", ErrProviderUnavailable, p.metadata.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: metadata lacks required endpoints", ErrProviderUnavailable)
+	}
+
+	var keys JWKSet
+	if err := rp.getJSON(ctx, p.metadata.JWKSURI, &keys); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]*rsa.PublicKey)
+	for _, jwk := range keys.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of other types are not usable for RS256 and are skipped
+		if key, err := jwk.PublicKey(); err == nil {
+			p.keys[jwk.KeyID] = key
+		}
+	}
+
+	rp.mu.Lock()
+	rp.providers[issuer] = p
+	rp.mu.Unlock()
+	return p, nil
+}
+
+// key returns the signing key kid of the provider. An unknown key ID
+// rediscovers the keys once, as the provider may have rotated them.
+func (rp *RelyingParty) key(ctx context.Context, issuer string, p *provider, kid string) (*rsa.PublicKey, error) {
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	p, err := rp.provider(ctx, issuer, true)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := p.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds the key kid; without a kid, the provider must have exactly
+// one key
+func (p *provider) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// getJSON fetches a JSON document from the provider
+func (rp *RelyingParty) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	status, err := rp.do(req, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: %s answered %d", ErrProviderUnavailable, target, status)
+	}
+	return nil
+}
+
+// do sends req and decodes the JSON response into v. Transport failures,
+// server errors and undecodable successful responses are
+// ErrProviderUnavailable.
+func (rp *RelyingParty) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return 0, fmt.Errorf("%w: %s answered %d", ErrProviderUnavailable, req.URL, resp.StatusCode)
+	}
+	// Error responses are not always JSON; their status is enough
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+	if err != nil && resp.StatusCode < http.StatusBadRequest {
+		return 0, fmt.Errorf("%w: invalid response from %s: %v", ErrProviderUnavailable, req.URL, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// jsonBool is a boolean claim that some providers send as a string
+type jsonBool bool
+
+func (b *jsonBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = jsonBool(v)
+	case string:
+		*b = jsonBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
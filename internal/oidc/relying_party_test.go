@@ -0,0 +1,151 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider is a minimal OpenID Provider that issues an ID token with
+// claims for the code "good-code", checking the client's PKCE verifier
+type mockProvider struct {
+	*httptest.Server
+	signer    *Signer
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	signer, err := NewSigner("")
+	require.NoError(t, err)
+	p := &mockProvider{signer: signer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize?tenant=acme",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(p.signer.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "rp" || secret != "s3cret%2F" || r.PostFormValue("code") != "good-code" ||
+			!VerifyPKCE(p.challenge, r.PostFormValue("code_verifier")) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, err := p.signer.Sign(p.claims)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	p.challenge = S256Challenge(testVerifier)
+	p.claims = jwt.MapClaims{
+		"iss":            p.URL,
+		"sub":            "248289761001",
+		"aud":            "rp",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "n-0S6",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+	}
+	return p
+}
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func TestRelyingParty(t *testing.T) {
+	provider := newMockProvider(t)
+	rp := NewRelyingParty(nil)
+	client := Client{
+		Issuer:       provider.URL,
+		ClientID:     "rp",
+		ClientSecret: "s3cret/",
+		RedirectURI:  "https://app.example.com/sso/callback",
+		Scopes:       []string{ScopeOpenID, ScopeEmail},
+	}
+	ctx := context.Background()
+
+	authorizationURL, err := rp.AuthorizationURL(ctx, client, "af0ifjsldkj", "n-0S6", provider.challenge)
+	require.NoError(t, err)
+	u, err := url.Parse(authorizationURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/authorize", u.Path)
+	assert.Equal(t, url.Values{
+		"tenant":                {"acme"},
+		"response_type":         {"code"},
+		"client_id":             {"rp"},
+		"redirect_uri":          {"https://app.example.com/sso/callback"},
+		"scope":                 {"openid email"},
+		"state":                 {"af0ifjsldkj"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {provider.challenge},
+		"code_challenge_method": {"S256"},
+	}, u.Query())
+
+	identity, err := rp.Exchange(ctx, client, "good-code", testVerifier, "n-0S6")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "248289761001", Email: "ada@example.com", EmailVerified: true, GivenName: "Ada"}, identity)
+
+	_, err = rp.Exchange(ctx, client, "good-code", testVerifier, "another-nonce")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+	_, err = rp.Exchange(ctx, client, "bad-code", testVerifier, "n-0S6")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+	_, err = rp.Exchange(ctx, client, "good-code", testVerifier[1:]+"x", "n-0S6")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+
+	// Tokens meant for another client are rejected
+	provider.claims["aud"] = []string{"rp", "other"}
+	_, err = rp.Exchange(ctx, client, "good-code", testVerifier, "n-0S6")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+	provider.claims["azp"] = "rp"
+	_, err = rp.Exchange(ctx, client, "good-code", testVerifier, "n-0S6")
+	assert.NoError(t, err)
+	provider.claims["aud"] = "other"
+	_, err = rp.Exchange(ctx, client, "good-code", testVerifier, "n-0S6")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+	provider.claims["aud"] = "rp"
+
+	// Rotated keys are picked up despite the cache
+	provider.signer, err = NewSigner("")
+	require.NoError(t, err)
+	provider.claims["email_verified"] = "false"
+	identity, err = rp.Exchange(ctx, client, "good-code", testVerifier, "n-0S6")
+	require.NoError(t, err)
+	assert.False(t, identity.EmailVerified)
+
+	provider.claims["iss"] = "https://evil.example.com"
+	_, err = rp.Exchange(ctx, client, "good-code", testVerifier, "n-0S6")
+	assert.ErrorIs(t, err, ErrAuthenticationFailed)
+}
+
+func TestRelyingPartyDiscovery(t *testing.T) {
+	provider := newMockProvider(t)
+	rp := NewRelyingParty(nil)
+
+	// The metadata must be about the configured issuer
+	_, err := rp.AuthorizationURL(context.Background(), Client{Issuer: provider.URL + "/"}, "state", "nonce", "challenge")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+
+	provider.Close()
+	_, err = rp.AuthorizationURL(context.Background(), Client{Issuer: provider.URL}, "state", "nonce", "challenge")
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+}
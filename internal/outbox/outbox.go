@@ -0,0 +1,53 @@
+// Package outbox implements the transactional outbox pattern.
+//
+// Repositories call Write inside the transaction that changes a user, so an
+// event is stored if and only if the change commits. The Relay later leases
+// unpublished events, hands them to an EventPublisher and marks them
+// published. Delivery is at least once: an event whose lease expires before
+// it is marked published is published again, so consumers must use the event
+// ID as an idempotency key.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// EventPublisher hands events to whatever consumes them. Publish must be
+// safe to call more than once for the same event.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *events.Event) error
+}
+
+// Message is an outbox row that has been leased for publishing
+type Message struct {
+	Event    events.Event
+	Attempts int
+}
+
+// Store persists outbox messages
+type Store interface {
+	// Claim leases up to limit unpublished messages available at now, making
+	// them invisible to other relays until now+lease
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Message, error)
+	MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error
+	// MarkFailed records err and makes the message available again at retryAt
+	MarkFailed(ctx context.Context, id uuid.UUID, err error, retryAt time.Time) error
+	// DeletePublished removes messages published before the given time
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Write stores event in the outbox as part of tx. aggregateID is the user
+// the event is about.
+func Write(ctx context.Context, tx sqlx.ExecerContext, aggregateID uuid.UUID, event *events.Event) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox (id, event_type, organization_id, aggregate_id, payload, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, event.ID, event.Type, event.OrganizationID, aggregateID, []byte(event.Data), event.OccurredAt)
+	return err
+}
@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresStore keeps the outbox in the outbox table
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresStore creates an outbox store on top of an existing connection pool
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+type messageRow struct {
+	ID             uuid.UUID `db:"id"`
+	EventType      string    `db:"event_type"`
+	OrganizationID uuid.UUID `db:"organization_id"`
+	Payload        []byte    `db:"payload"`
+	OccurredAt     time.Time `db:"occurred_at"`
+	Attempts       int       `db:"attempts"`
+}
+
+// Claim locks due rows with FOR UPDATE SKIP LOCKED, so concurrent relays
+// never claim the same row, and pushes their availability past the lease.
+func (s *PostgresStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Message, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows := []messageRow{}
+	err = tx.SelectContext(ctx, &rows, `
+		SELECT id, event_type, organization_id, payload, occurred_at, attempts
+		FROM outbox
+		WHERE published_at IS NULL AND available_at <= $1
+		ORDER BY occurred_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, now, limit)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID.String()
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE outbox SET available_at = $1, attempts = attempts + 1 WHERE id = ANY ($2::uuid[])
+	`, now.Add(lease), pq.StringArray(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, len(rows))
+	for i, row := range rows {
+		messages[i] = &Message{
+			Event: events.Event{
+				ID:             row.ID,
+				Type:           row.EventType,
+				OrganizationID: row.OrganizationID,
+				OccurredAt:     row.OccurredAt,
+				Data:           row.Payload,
+			},
+			Attempts: row.Attempts + 1,
+		}
+	}
+	return messages, nil
+}
+
+// Lag returns how long the oldest unpublished event has been waiting, or 0
+// when everything has been published
+func (s *PostgresStore) Lag(ctx context.Context, now time.Time) (time.Duration, error) {
+	var oldest sql.NullTime
+	err := s.db.GetContext(ctx, &oldest, `SELECT min(occurred_at) FROM outbox WHERE published_at IS NULL`)
+	if err != nil || !oldest.Valid {
+		return 0, err
+	}
+	return now.Sub(oldest.Time), nil
+}
+
+func (s *PostgresStore) MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox SET published_at = $2, last_error = '' WHERE id = $1`, id, at)
+	return err
+}
+
+func (s *PostgresStore) MarkFailed(ctx context.Context, id uuid.UUID, publishErr error, retryAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE outbox SET available_at = $2, last_error = $3 WHERE id = $1 AND published_at IS NULL
+	`, id, retryAt, publishErr.Error())
+	return err
+}
+
+func (s *PostgresStore) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultBatchSize = 50
+	// lease must comfortably exceed the time it takes to publish a batch
+	defaultLease       = time.Minute
+	defaultBaseBackoff = 5 * time.Second
+	defaultMaxBackoff  = 10 * time.Minute
+	// publishedRetention is how long published events are kept for debugging
+	publishedRetention = 7 * 24 * time.Hour
+)
+
+// Relay moves events from the outbox to an EventPublisher
+type Relay struct {
+	store        Store
+	publisher    EventPublisher
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	now          func() time.Time
+}
+
+// NewRelay creates a Relay that checks the outbox every pollInterval
+func NewRelay(store Store, publisher EventPublisher, pollInterval time.Duration) *Relay {
+	return &Relay{
+		store:        store,
+		publisher:    publisher,
+		pollInterval: pollInterval,
+		batchSize:    defaultBatchSize,
+		lease:        defaultLease,
+		baseBackoff:  defaultBaseBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		now:          time.Now,
+	}
+}
+
+// Run relays events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Relaying outbox events", "interval", r.pollInterval)
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back so a backlog drains quickly
+		for {
+			n, err := r.RelayOnce(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to relay outbox events", "error", err)
+			}
+			if err != nil || n < r.batchSize {
+				break
+			}
+		}
+
+		if _, err := r.store.DeletePublished(ctx, r.now().Add(-publishedRetention)); err != nil {
+			slog.ErrorContext(ctx, "Failed to clean up published outbox events", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of due events and returns how many were
+// claimed. A publish failure is recorded on the event, which is retried with
+// exponential backoff; it does not stop the rest of the batch.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := r.store.Claim(ctx, r.now(), r.lease, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		event := msg.Event
+		if err := r.publisher.Publish(ctx, &event); err != nil {
+			retryAt := r.now().Add(r.backoff(msg.Attempts))
+			slog.WarnContext(ctx, "Failed to publish outbox event", "event_type", event.Type, "event_id", event.ID,
+				"attempt", msg.Attempts, "error", err)
+			if err := r.store.MarkFailed(ctx, event.ID, err, retryAt); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		// If this fails the lease expires and the event is published again,
+		// which consumers tolerate thanks to the event ID
+		if err := r.store.MarkPublished(ctx, event.ID, r.now()); err != nil {
+			return 0, err
+		}
+	}
+	return len(messages), nil
+}
+
+// backoff returns the delay after the nth failed attempt
+func (r *Relay) backoff(n int) time.Duration {
+	delay := r.baseBackoff
+	for i := 1; i < n && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	return delay
+}
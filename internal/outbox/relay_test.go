@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryRow struct {
+	message     Message
+	availableAt time.Time
+	publishedAt *time.Time
+	lastError   string
+}
+
+// memoryStore is an in-memory Store for tests
+type memoryStore struct {
+	mu   sync.Mutex
+	rows map[uuid.UUID]*memoryRow
+}
+
+func newMemoryStore(evts ...*events.Event) *memoryStore {
+	m := &memoryStore{rows: map[uuid.UUID]*memoryRow{}}
+	for _, e := range evts {
+		m.rows[e.ID] = &memoryRow{message: Message{Event: *e}}
+	}
+	return m
+}
+
+func (m *memoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	due := []*memoryRow{}
+	for _, row := range m.rows {
+		if row.publishedAt == nil && !row.availableAt.After(now) {
+			due = append(due, row)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].message.Event.OccurredAt.Before(due[j].message.Event.OccurredAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	messages := make([]*Message, len(due))
+	for i, row := range due {
+		row.availableAt = now.Add(lease)
+		row.message.Attempts++
+		copied := row.message
+		messages[i] = &copied
+	}
+	return messages, nil
+}
+
+func (m *memoryStore) MarkPublished(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[id].publishedAt = &at
+	return nil
+}
+
+func (m *memoryStore) MarkFailed(ctx context.Context, id uuid.UUID, err error, retryAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[id].availableAt = retryAt
+	m.rows[id].lastError = err.Error()
+	return nil
+}
+
+func (m *memoryStore) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, row := range m.rows {
+		if row.publishedAt != nil && row.publishedAt.Before(before) {
+			delete(m.rows, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// flakyPublisher fails for events listed in failing and records the rest
+type flakyPublisher struct {
+	failing   map[uuid.UUID]int
+	published []uuid.UUID
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event *events.Event) error {
+	if p.failing[event.ID] > 0 {
+		p.failing[event.ID]--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func newEvent(t *testing.T, eventType string, occurredAt time.Time) *events.Event {
+	event, err := events.New(eventType, map[string]string{"id": uuid.NewString()})
+	require.NoError(t, err)
+	event.OccurredAt = occurredAt
+	return event
+}
+
+func TestRelayPublishesInOrderAndRetriesFailures(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	first := newEvent(t, events.UserRegistered, clock.Add(-2*time.Minute))
+	second := newEvent(t, events.UserProfileUpdated, clock.Add(-time.Minute))
+	store := newMemoryStore(first, second)
+	publisher := &flakyPublisher{failing: map[uuid.UUID]int{second.ID: 2}}
+
+	relay := NewRelay(store, publisher, time.Second)
+	relay.now = func() time.Time { return clock }
+
+	n, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []uuid.UUID{first.ID}, publisher.published)
+	assert.Equal(t, "broker unavailable", store.rows[second.ID].lastError)
+
+	// The failed event is not retried before its backoff elapses
+	n, _ = relay.RelayOnce(ctx)
+	assert.Equal(t, 0, n)
+
+	clock = clock.Add(relay.backoff(1))
+	relay.RelayOnce(ctx)
+	clock = clock.Add(relay.backoff(2))
+	relay.RelayOnce(ctx)
+
+	assert.Equal(t, []uuid.UUID{first.ID, second.ID}, publisher.published)
+	assert.Equal(t, 3, store.rows[second.ID].message.Attempts)
+	assert.NotNil(t, store.rows[second.ID].publishedAt)
+}
+
+func TestRelayRepublishesAfterLeaseExpires(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	event := newEvent(t, events.UserDeleted, clock)
+	store := newMemoryStore(event)
+
+	// A relay that claimed the event and crashed before publishing it
+	claimed, err := store.Claim(ctx, clock, defaultLease, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	publisher := &flakyPublisher{}
+	relay := NewRelay(store, publisher, time.Second)
+	relay.now = func() time.Time { return clock }
+
+	n, _ := relay.RelayOnce(ctx)
+	assert.Equal(t, 0, n, "leased events are invisible to other relays")
+
+	clock = clock.Add(defaultLease)
+	n, _ = relay.RelayOnce(ctx)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []uuid.UUID{event.ID}, publisher.published)
+}
@@ -0,0 +1,63 @@
+package purger
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/atulsm/user-service/internal/repository"
+)
+
+// Purger periodically hard deletes users whose soft delete is older than the
+// retention window.
+type Purger struct {
+	repo      repository.UserRepository
+	retention time.Duration
+	interval  time.Duration
+	now       func() time.Time
+}
+
+// New creates a Purger that runs every interval and removes users deleted
+// more than retention ago.
+func New(repo repository.UserRepository, retention, interval time.Duration) *Purger {
+	return &Purger{
+		repo:      repo,
+		retention: retention,
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// Run purges once immediately and then on every tick until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Purging soft-deleted users", "interval", p.interval, "retention", p.retention)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.PurgeOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to purge deleted users", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce removes every user deleted before the retention cutoff and
+// returns how many were removed.
+func (p *Purger) PurgeOnce(ctx context.Context) (int64, error) {
+	cutoff := p.now().Add(-p.retention)
+	purged, err := p.repo.PurgeDeletedUsers(ctx, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		slog.InfoContext(ctx, "Purged deleted users", "count", purged, "deleted_before", cutoff)
+	}
+	return purged, nil
+}
@@ -0,0 +1,170 @@
+// Package reload applies configuration changes to a running service. Only
+// the dynamic subset of config.Config (see config.IsDynamic) is applied; a
+// new configuration is validated in full before anything changes, and if a
+// target fails to apply it, the targets already updated are rolled back.
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atulsm/user-service/internal/config"
+	"github.com/atulsm/user-service/internal/metrics"
+)
+
+// ApplyFunc makes a component use cfg
+type ApplyFunc func(cfg *config.Config) error
+
+type target struct {
+	name  string
+	apply ApplyFunc
+}
+
+// Reloader holds the configuration in effect and the components it is
+// applied to
+type Reloader struct {
+	mu      sync.Mutex
+	current *config.Config
+	load    func() (*config.Config, error)
+	targets []target
+}
+
+// New returns a Reloader whose configuration starts as current and is
+// re-read with load
+func New(current *config.Config, load func() (*config.Config, error)) *Reloader {
+	return &Reloader{current: current, load: load}
+}
+
+// Register adds a component that is given the configuration on every
+// reload. Targets are applied in the order they were registered.
+func (r *Reloader) Register(name string, apply ApplyFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.targets = append(r.targets, target{name: name, apply: apply})
+}
+
+// Current returns the configuration in effect
+func (r *Reloader) Current() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload reads the configuration again and applies its dynamic settings.
+// Nothing changes if the new configuration is invalid or a target rejects it.
+func (r *Reloader) Reload(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.reload(ctx)
+	metrics.ConfigReloaded(err == nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Configuration reload failed; keeping the current configuration", "error", err)
+	}
+	return err
+}
+
+func (r *Reloader) reload(ctx context.Context) error {
+	loaded, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	var dynamic, static []string
+	for _, key := range r.current.Changed(loaded) {
+		if config.IsDynamic(key) {
+			dynamic = append(dynamic, key)
+		} else {
+			static = append(static, key)
+		}
+	}
+	if len(static) > 0 {
+		slog.WarnContext(ctx, "Ignoring configuration changes that need a restart", "keys", static)
+	}
+	if len(dynamic) == 0 {
+		slog.InfoContext(ctx, "Configuration reloaded with no changes")
+		return nil
+	}
+
+	next := r.current.WithDynamic(loaded)
+	for i, t := range r.targets {
+		if err := t.apply(next); err != nil {
+			applyErr := fmt.Errorf("%s: %w", t.name, err)
+			return errors.Join(applyErr, r.rollback(r.targets[:i]))
+		}
+	}
+
+	r.current = next
+	// Only keys are logged; several dynamic settings are secrets
+	slog.InfoContext(ctx, "Configuration reloaded", "changed", dynamic)
+	return nil
+}
+
+// rollback gives targets the configuration in effect before the reload
+func (r *Reloader) rollback(targets []target) error {
+	var errs []error
+	for _, t := range targets {
+		if err := t.apply(r.current); err != nil {
+			errs = append(errs, fmt.Errorf("rolling back %s: %w", t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch reloads on SIGHUP and, when path is set and interval is positive,
+// whenever the contents of the file at path change. It returns when ctx is
+// cancelled.
+func (r *Reloader) Watch(ctx context.Context, path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	var last [sha256.Size]byte
+	if path != "" && interval > 0 {
+		last, _ = fingerprint(path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+		slog.InfoContext(ctx, "Watching configuration file", "path", path, "interval", interval)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.InfoContext(ctx, "Received SIGHUP; reloading configuration")
+			r.Reload(ctx)
+		case <-poll:
+			sum, err := fingerprint(path)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to read configuration file", "path", path, "error", err)
+				continue
+			}
+			if sum == last {
+				continue
+			}
+			last = sum
+			slog.InfoContext(ctx, "Configuration file changed; reloading", "path", path)
+			r.Reload(ctx)
+		}
+	}
+}
+
+// fingerprint hashes the file at path
+func fingerprint(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
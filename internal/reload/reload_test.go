@@ -0,0 +1,89 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/atulsm/user-service/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func baseConfig() *config.Config {
+	return &config.Config{
+		Port:               "8080",
+		JWTSecret:          "secret",
+		CORSAllowedOrigins: []string{"http://localhost:3000"},
+		RateLimitRPS:       20,
+		RateLimitBurst:     40,
+		LogLevel:           slog.LevelInfo,
+	}
+}
+
+func TestReloadAppliesDynamicSettings(t *testing.T) {
+	loaded := baseConfig()
+	loaded.RateLimitRPS = 5
+	loaded.JWTSecret = "rotated"
+	loaded.Port = "9999"
+
+	r := New(baseConfig(), func() (*config.Config, error) { return loaded, nil })
+	var applied *config.Config
+	r.Register("test", func(cfg *config.Config) error {
+		applied = cfg
+		return nil
+	})
+
+	require.NoError(t, r.Reload(context.Background()))
+	require.NotNil(t, applied)
+	assert.Equal(t, 5.0, applied.RateLimitRPS)
+	assert.Equal(t, "rotated", applied.JWTSecret)
+	// Static settings need a restart and are left alone
+	assert.Equal(t, "8080", applied.Port)
+	assert.Same(t, applied, r.Current())
+}
+
+func TestReloadKeepsConfigWhenInvalid(t *testing.T) {
+	current := baseConfig()
+	r := New(current, func() (*config.Config, error) { return nil, errors.New("RATE_LIMIT_RPS must not be negative") })
+	called := false
+	r.Register("test", func(*config.Config) error {
+		called = true
+		return nil
+	})
+
+	assert.ErrorContains(t, r.Reload(context.Background()), "RATE_LIMIT_RPS")
+	assert.False(t, called)
+	assert.Same(t, current, r.Current())
+}
+
+func TestReloadRollsBackOnFailure(t *testing.T) {
+	current := baseConfig()
+	loaded := baseConfig()
+	loaded.CORSAllowedOrigins = []string{"https://app.example.com"}
+
+	r := New(current, func() (*config.Config, error) { return loaded, nil })
+
+	var origins []string
+	r.Register("cors", func(cfg *config.Config) error {
+		origins = cfg.CORSAllowedOrigins
+		return nil
+	})
+	r.Register("broken", func(*config.Config) error { return errors.New("boom") })
+
+	err := r.Reload(context.Background())
+	assert.ErrorContains(t, err, "broken: boom")
+	assert.Equal(t, []string{"http://localhost:3000"}, origins)
+	assert.Same(t, current, r.Current())
+}
+
+func TestReloadWithoutChanges(t *testing.T) {
+	r := New(baseConfig(), func() (*config.Config, error) { return baseConfig(), nil })
+	r.Register("test", func(*config.Config) error {
+		t.Fatal("nothing changed, so nothing should be applied")
+		return nil
+	})
+	assert.NoError(t, r.Reload(context.Background()))
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrCodeTooSoon is returned when a new code is requested before the
+	// resend interval of the previous one has passed
+	ErrCodeTooSoon = errors.New("a code was sent recently; wait before requesting another")
+	// ErrCodeInvalid is returned when a code does not match, or there is no
+	// outstanding code to check it against
+	ErrCodeInvalid = errors.New("invalid code")
+	// ErrCodeExpired is returned when the outstanding code has expired
+	ErrCodeExpired = errors.New("code has expired; request a new one")
+	// ErrCodeAttempts is returned once a code has been guessed wrong too
+	// often; it cannot be used any more
+	ErrCodeAttempts = errors.New("too many wrong attempts; request a new code")
+)
+
+// CodeRepository stores the one-time codes of the organization carried by
+// the context (see package tenant). A user has at most one outstanding code
+// per purpose. ConsumeCodeByID is the exception: the code itself decides
+// the organization.
+type CodeRepository interface {
+	// SaveCode stores code, replacing the user's outstanding code for the
+	// same purpose unless that one is younger than resendInterval. The ID is
+	// generated unless already set.
+	SaveCode(ctx context.Context, code *models.OneTimeCode, resendInterval time.Duration) error
+	// ConsumeCode checks codeHash against the user's outstanding code for
+	// purpose and deletes the code when it matches. A wrong guess counts
+	// as an attempt; after maxAttempts the code stops working.
+	ConsumeCode(ctx context.Context, userID uuid.UUID, purpose, codeHash string, maxAttempts int) (*models.OneTimeCode, error)
+	// ConsumeCodeByID deletes and returns the code id if it has purpose,
+	// matches codeHash and has not expired. Every failure is ErrCodeInvalid.
+	// It is meant for codes sent inside signed links, which cannot be
+	// guessed, so failures are not counted as attempts.
+	ConsumeCodeByID(ctx context.Context, id uuid.UUID, purpose, codeHash string) (*models.OneTimeCode, error)
+}
+
+type PostgresCodeRepository struct {
+	db *sqlx.DB
+}
+
+// NewPostgresCodeRepository creates a repository on top of an existing connection pool
+func NewPostgresCodeRepository(db *sqlx.DB) *PostgresCodeRepository {
+	return &PostgresCodeRepository{db: db}
+}
+
+func (r *PostgresCodeRepository) SaveCode(ctx context.Context, code *models.OneTimeCode, resendInterval time.Duration) (err error) {
+	ctx, span := startCodeSpan(ctx, "SaveCode")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if code.ID == uuid.Nil {
+		code.ID = uuid.New()
+	}
+	code.OrganizationID = organizationID
+	code.Attempts = 0
+	code.CreatedAt = now
+
+	var result sql.Result
+	err = retry(ctx, "SaveCode", func() error {
+		var err error
+		result, err = r.db.ExecContext(ctx, `
+			INSERT INTO one_time_codes (id, organization_id, user_id, purpose, target, code_hash, expires_at, attempts, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8)
+			ON CONFLICT (user_id, purpose) DO UPDATE
+			SET id = EXCLUDED.id, target = EXCLUDED.target, code_hash = EXCLUDED.code_hash,
+				expires_at = EXCLUDED.expires_at, attempts = 0, created_at = EXCLUDED.created_at
+			WHERE one_time_codes.created_at <= $9
+		`, code.ID, organizationID, code.UserID, code.Purpose, code.Target, code.CodeHash, code.ExpiresAt, now, now.Add(-resendInterval))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrCodeTooSoon
+	}
+	return nil
+}
+
+func (r *PostgresCodeRepository) ConsumeCode(ctx context.Context, userID uuid.UUID, purpose, codeHash string, maxAttempts int) (code *models.OneTimeCode, err error) {
+	ctx, span := startCodeSpan(ctx, "ConsumeCode")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A wrong guess is counted and committed; the error is only returned
+	// once the transaction is done
+	var failure error
+	code = &models.OneTimeCode{}
+	err = inTx(ctx, r.db, "ConsumeCode", func(tx *sqlx.Tx) error {
+		failure = nil
+		err := tx.GetContext(ctx, code, `
+			SELECT * FROM one_time_codes WHERE user_id = $1 AND purpose = $2 AND organization_id = $3 FOR UPDATE
+		`, userID, purpose, organizationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			failure = ErrCodeInvalid
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case code.Attempts >= maxAttempts:
+			failure = ErrCodeAttempts
+			return nil
+		case !time.Now().Before(code.ExpiresAt):
+			failure = ErrCodeExpired
+			return nil
+		case subtle.ConstantTimeCompare([]byte(code.CodeHash), []byte(codeHash)) != 1:
+			failure = ErrCodeInvalid
+			if code.Attempts+1 >= maxAttempts {
+				failure = ErrCodeAttempts
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE one_time_codes SET attempts = attempts + 1 WHERE id = $1", code.ID)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM one_time_codes WHERE id = $1", code.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return code, nil
+}
+
+func (r *PostgresCodeRepository) ConsumeCodeByID(ctx context.Context, id uuid.UUID, purpose, codeHash string) (code *models.OneTimeCode, err error) {
+	ctx, span := startCodeSpan(ctx, "ConsumeCodeByID")
+	defer func() { tracing.End(span, err) }()
+
+	code = &models.OneTimeCode{}
+	err = inTx(ctx, r.db, "ConsumeCodeByID", func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, code, "SELECT * FROM one_time_codes WHERE id = $1 FOR UPDATE", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCodeInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if code.Purpose != purpose || !time.Now().Before(code.ExpiresAt) ||
+			subtle.ConstantTimeCompare([]byte(code.CodeHash), []byte(codeHash)) != 1 {
+			return ErrCodeInvalid
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM one_time_codes WHERE id = $1", id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// startCodeSpan starts a client span for one code repository operation
+func startCodeSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "CodeRepository", operation)
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PoolConfig sizes the connection pool
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig is used when no pool size is configured
+var DefaultPoolConfig = PoolConfig{MaxOpenConns: 25, MaxIdleConns: 5, ConnMaxLifetime: 5 * time.Minute}
+
+// ConnectRetry controls how long WaitForDB keeps trying to reach the database
+type ConnectRetry struct {
+	// Timeout gives up after this long; 0 keeps trying until the context
+	// is cancelled
+	Timeout time.Duration
+	// InitialBackoff is the delay after the first failure. It doubles after
+	// every further failure, up to MaxBackoff, and is jittered so restarting
+	// replicas do not retry in lockstep.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultConnectRetry gives the database a minute to come up
+var DefaultConnectRetry = ConnectRetry{Timeout: time.Minute, InitialBackoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// NewUserRepository connects to dbURL and returns a repository on top of it
+func NewUserRepository(dbURL string) (UserRepository, error) {
+	db, err := Connect(context.Background(), dbURL, DefaultPoolConfig, DefaultConnectRetry)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostgresUserRepository(db), nil
+}
+
+// Connect opens a PostgreSQL connection pool for the given database URL and
+// waits until the database answers
+func Connect(ctx context.Context, dbURL string, pool PoolConfig, retry ConnectRetry) (*sqlx.DB, error) {
+	db, err := Open(dbURL, pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := WaitForDB(ctx, db, retry); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Open creates a PostgreSQL connection pool without connecting; connections
+// are made when they are first needed
+func Open(dbURL string, pool PoolConfig) (*sqlx.DB, error) {
+	// Parse the database URL to extract database name
+	parsedURL, err := url.Parse(dbURL)
+	if err != nil {
+		slog.Warn("Could not parse database URL", "error", err)
+	} else {
+		dbName := strings.TrimPrefix(parsedURL.Path, "/")
+		slog.Info("Opening database pool", "database", dbName, "host", parsedURL.Host)
+	}
+
+	db, err := sqlx.Open("postgres", dbURL)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	return db, nil
+}
+
+// WaitForDB pings db until it answers, backing off between attempts
+func WaitForDB(ctx context.Context, db *sqlx.DB, retry ConnectRetry) error {
+	if retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, retry.Timeout)
+		defer cancel()
+	}
+	backoff := retry.InitialBackoff
+	if backoff <= 0 {
+		backoff = DefaultConnectRetry.InitialBackoff
+	}
+	maxBackoff := retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultConnectRetry.MaxBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			slog.InfoContext(ctx, "Connected to PostgreSQL database", "attempts", attempt)
+			return nil
+		}
+
+		delay := jitter(backoff)
+		slog.WarnContext(ctx, "Database is not available yet", "attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not available after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// jitter returns a random delay between half of d and d
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
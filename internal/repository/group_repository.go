@@ -0,0 +1,531 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrGroupNotFound is returned when no matching group exists in the organization
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupNameInUse is returned when another group of the organization has the name
+	ErrGroupNameInUse = errors.New("group name already in use")
+	// ErrMemberNotFound is returned when the user is not a direct member of the group
+	ErrMemberNotFound = errors.New("group member not found")
+	// ErrSubgroupNotFound is returned when the group is not a direct subgroup
+	ErrSubgroupNotFound = errors.New("subgroup not found")
+	// ErrLastOwner is returned when a change would leave a group without owners
+	ErrLastOwner = errors.New("a group must keep at least one owner")
+	// ErrGroupCycle is returned when nesting a group would make it its own ancestor
+	ErrGroupCycle = errors.New("group cannot be nested inside itself")
+)
+
+// descendantsCTE expands $1 into the group itself and every group nested
+// below it. UNION (not UNION ALL) stops the recursion at groups already seen.
+const descendantsCTE = `
+	WITH RECURSIVE descendants (id) AS (
+		SELECT $1::uuid
+		UNION
+		SELECT s.child_id FROM group_subgroups s JOIN descendants d ON s.parent_id = d.id
+	)`
+
+// GroupRepository manages the groups of the organization carried by the
+// context (see package tenant). Every method fails with tenant.ErrMissing
+// when there is none.
+type GroupRepository interface {
+	// CreateGroup stores group with ownerID as its first owner
+	CreateGroup(ctx context.Context, group *models.Group, ownerID uuid.UUID) error
+	GetGroup(ctx context.Context, id uuid.UUID) (*models.Group, error)
+	ListGroups(ctx context.Context, limit, offset int) ([]*models.Group, error)
+	UpdateGroup(ctx context.Context, id uuid.UUID, updates *models.UpdateGroupRequest) (*models.Group, error)
+	DeleteGroup(ctx context.Context, id uuid.UUID) error
+
+	// SetMember adds userID to the group or changes their role
+	SetMember(ctx context.Context, groupID, userID uuid.UUID, role string) (*models.GroupMember, error)
+	RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error
+	// GetMember returns userID's direct membership of the group
+	GetMember(ctx context.Context, groupID, userID uuid.UUID) (*models.GroupMember, error)
+	// ListMembers returns the direct members of the group and, when expand is
+	// set, the members of every nested subgroup as well
+	ListMembers(ctx context.Context, groupID uuid.UUID, expand bool) ([]*models.GroupMember, error)
+
+	// AddSubgroup nests childID inside parentID
+	AddSubgroup(ctx context.Context, parentID, childID uuid.UUID) error
+	RemoveSubgroup(ctx context.Context, parentID, childID uuid.UUID) error
+	ListSubgroups(ctx context.Context, groupID uuid.UUID) ([]*models.Group, error)
+
+	// ListUserGroups returns the groups userID is a direct member of and,
+	// when expand is set, every group that contains one of those
+	ListUserGroups(ctx context.Context, userID uuid.UUID, expand bool) ([]*models.UserGroup, error)
+}
+
+// PostgresGroupRepository keeps groups in the groups, group_members and
+// group_subgroups tables
+type PostgresGroupRepository struct {
+	db *sqlx.DB
+}
+
+// NewPostgresGroupRepository creates a group repository on top of an existing connection pool
+func NewPostgresGroupRepository(db *sqlx.DB) *PostgresGroupRepository {
+	return &PostgresGroupRepository{db: db}
+}
+
+func (r *PostgresGroupRepository) CreateGroup(ctx context.Context, group *models.Group, ownerID uuid.UUID) (err error) {
+	ctx, span := startGroupSpan(ctx, "CreateGroup")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if group.ID == uuid.Nil {
+		group.ID = uuid.New()
+	}
+	group.OrganizationID = organizationID
+	now := time.Now()
+	group.CreatedAt, group.UpdatedAt = now, now
+
+	err = inTx(ctx, r.db, "CreateGroup", func(tx *sqlx.Tx) error {
+		if err := requireUser(ctx, tx, organizationID, ownerID); err != nil {
+			return err
+		}
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO groups (id, organization_id, name, description, created_at, updated_at)
+			VALUES (:id, :organization_id, :name, :description, :created_at, :updated_at)
+		`, group)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO group_members (group_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)
+		`, group.ID, ownerID, models.GroupRoleOwner, now)
+		return err
+	})
+	return groupNameError(err)
+}
+
+func (r *PostgresGroupRepository) GetGroup(ctx context.Context, id uuid.UUID) (group *models.Group, err error) {
+	ctx, span := startGroupSpan(ctx, "GetGroup")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group = &models.Group{}
+	err = retry(ctx, "GetGroup", func() error {
+		return r.db.GetContext(ctx, group, "SELECT * FROM groups WHERE id = $1 AND organization_id = $2", id, organizationID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (r *PostgresGroupRepository) ListGroups(ctx context.Context, limit, offset int) (groups []*models.Group, err error) {
+	ctx, span := startGroupSpan(ctx, "ListGroups")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	groups = []*models.Group{}
+	err = retry(ctx, "ListGroups", func() error {
+		return r.db.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE organization_id = $1 ORDER BY name LIMIT $2 OFFSET $3", organizationID, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *PostgresGroupRepository) UpdateGroup(ctx context.Context, id uuid.UUID, updates *models.UpdateGroupRequest) (group *models.Group, err error) {
+	ctx, span := startGroupSpan(ctx, "UpdateGroup")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group = &models.Group{}
+	err = retry(ctx, "UpdateGroup", func() error {
+		return r.db.GetContext(ctx, group, `
+			UPDATE groups
+			SET name = $3, description = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND organization_id = $2
+			RETURNING *
+		`, id, organizationID, updates.Name, updates.Description)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, groupNameError(err)
+	}
+	return group, nil
+}
+
+func (r *PostgresGroupRepository) DeleteGroup(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := startGroupSpan(ctx, "DeleteGroup")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "DeleteGroup", func() error {
+		result, err = r.db.ExecContext(ctx, "DELETE FROM groups WHERE id = $1 AND organization_id = $2", id, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrGroupNotFound)
+}
+
+func (r *PostgresGroupRepository) SetMember(ctx context.Context, groupID, userID uuid.UUID, role string) (member *models.GroupMember, err error) {
+	ctx, span := startGroupSpan(ctx, "SetMember")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	member = &models.GroupMember{}
+	err = inTx(ctx, r.db, "SetMember", func(tx *sqlx.Tx) error {
+		if err := lockGroup(ctx, tx, organizationID, groupID); err != nil {
+			return err
+		}
+		if err := requireUser(ctx, tx, organizationID, userID); err != nil {
+			return err
+		}
+		err := tx.GetContext(ctx, member, `
+			INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, $3)
+			ON CONFLICT (group_id, user_id) DO UPDATE SET role = EXCLUDED.role
+			RETURNING *
+		`, groupID, userID, role)
+		if err != nil {
+			return err
+		}
+		return requireOwner(ctx, tx, groupID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (r *PostgresGroupRepository) RemoveMember(ctx context.Context, groupID, userID uuid.UUID) (err error) {
+	ctx, span := startGroupSpan(ctx, "RemoveMember")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, r.db, "RemoveMember", func(tx *sqlx.Tx) error {
+		if err := lockGroup(ctx, tx, organizationID, groupID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM group_members WHERE group_id = $1 AND user_id = $2", groupID, userID)
+		if err != nil {
+			return err
+		}
+		if err := requireAffected(result, ErrMemberNotFound); err != nil {
+			return err
+		}
+		return requireOwner(ctx, tx, groupID)
+	})
+}
+
+func (r *PostgresGroupRepository) GetMember(ctx context.Context, groupID, userID uuid.UUID) (member *models.GroupMember, err error) {
+	ctx, span := startGroupSpan(ctx, "GetMember")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	member = &models.GroupMember{}
+	err = retry(ctx, "GetMember", func() error {
+		return r.db.GetContext(ctx, member, `
+			SELECT m.* FROM group_members m
+			JOIN groups g ON g.id = m.group_id
+			WHERE m.group_id = $1 AND m.user_id = $2 AND g.organization_id = $3
+		`, groupID, userID, organizationID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (r *PostgresGroupRepository) ListMembers(ctx context.Context, groupID uuid.UUID, expand bool) (members []*models.GroupMember, err error) {
+	ctx, span := startGroupSpan(ctx, "ListMembers")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := r.GetGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	// Soft deleted users keep their memberships so that restoring them
+	// restores their groups, but they are not listed
+	query := `
+		SELECT m.* FROM group_members m
+		JOIN users u ON u.id = m.user_id AND u.deleted_at IS NULL
+		WHERE m.group_id = $1
+		ORDER BY m.created_at, m.user_id`
+	if expand {
+		// A user reached through several groups is listed once, preferring
+		// their direct membership of this group
+		query = descendantsCTE + `
+		SELECT DISTINCT ON (m.user_id) m.* FROM group_members m
+		JOIN descendants d ON d.id = m.group_id
+		JOIN users u ON u.id = m.user_id AND u.deleted_at IS NULL
+		ORDER BY m.user_id, m.group_id = $1 DESC, m.role = 'owner' DESC`
+	}
+
+	members = []*models.GroupMember{}
+	err = retry(ctx, "ListMembers", func() error {
+		return r.db.SelectContext(ctx, &members, query, groupID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *PostgresGroupRepository) AddSubgroup(ctx context.Context, parentID, childID uuid.UUID) (err error) {
+	ctx, span := startGroupSpan(ctx, "AddSubgroup")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	if parentID == childID {
+		return ErrGroupCycle
+	}
+
+	return inTx(ctx, r.db, "AddSubgroup", func(tx *sqlx.Tx) error {
+		// Nesting changes of one organization are serialized, so that two
+		// concurrent changes cannot close a cycle between them
+		if _, err := tx.ExecContext(ctx, "SELECT 1 FROM organizations WHERE id = $1 FOR UPDATE", organizationID); err != nil {
+			return err
+		}
+
+		var found int
+		err := tx.GetContext(ctx, &found, "SELECT COUNT(*) FROM groups WHERE id IN ($1, $2) AND organization_id = $3", parentID, childID, organizationID)
+		if err != nil {
+			return err
+		}
+		if found != 2 {
+			return ErrGroupNotFound
+		}
+
+		var cycle bool
+		err = tx.GetContext(ctx, &cycle, descendantsCTE+`
+			SELECT EXISTS (SELECT 1 FROM descendants WHERE id = $2)
+		`, childID, parentID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrGroupCycle
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO group_subgroups (parent_id, child_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, parentID, childID)
+		return err
+	})
+}
+
+func (r *PostgresGroupRepository) RemoveSubgroup(ctx context.Context, parentID, childID uuid.UUID) (err error) {
+	ctx, span := startGroupSpan(ctx, "RemoveSubgroup")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "RemoveSubgroup", func() error {
+		result, err = r.db.ExecContext(ctx, `
+			DELETE FROM group_subgroups s USING groups g
+			WHERE s.parent_id = $1 AND s.child_id = $2 AND g.id = s.parent_id AND g.organization_id = $3
+		`, parentID, childID, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrSubgroupNotFound)
+}
+
+func (r *PostgresGroupRepository) ListSubgroups(ctx context.Context, groupID uuid.UUID) (groups []*models.Group, err error) {
+	ctx, span := startGroupSpan(ctx, "ListSubgroups")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := r.GetGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	groups = []*models.Group{}
+	err = retry(ctx, "ListSubgroups", func() error {
+		return r.db.SelectContext(ctx, &groups, `
+			SELECT g.* FROM groups g
+			JOIN group_subgroups s ON s.child_id = g.id
+			WHERE s.parent_id = $1
+			ORDER BY g.name
+		`, groupID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *PostgresGroupRepository) ListUserGroups(ctx context.Context, userID uuid.UUID, expand bool) (groups []*models.UserGroup, err error) {
+	ctx, span := startGroupSpan(ctx, "ListUserGroups")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT g.*, m.role, false AS inherited FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1 AND g.organization_id = $2
+		ORDER BY g.name`
+	if expand {
+		query = `
+		WITH RECURSIVE ancestors (id) AS (
+			SELECT group_id FROM group_members WHERE user_id = $1
+			UNION
+			SELECT s.parent_id FROM group_subgroups s JOIN ancestors a ON s.child_id = a.id
+		)
+		SELECT g.*, COALESCE(m.role, '') AS role, m.user_id IS NULL AS inherited FROM groups g
+		JOIN ancestors a ON a.id = g.id
+		LEFT JOIN group_members m ON m.group_id = g.id AND m.user_id = $1
+		WHERE g.organization_id = $2
+		ORDER BY g.name`
+	}
+
+	groups = []*models.UserGroup{}
+	err = retry(ctx, "ListUserGroups", func() error {
+		return r.db.SelectContext(ctx, &groups, query, userID, organizationID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// startGroupSpan starts a client span for one group repository operation
+func startGroupSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "GroupRepository", operation)
+}
+
+// lockGroup locks a group of the organization for the rest of tx, so that
+// membership changes to it are serialized
+func lockGroup(ctx context.Context, tx *sqlx.Tx, organizationID, groupID uuid.UUID) error {
+	var id uuid.UUID
+	err := tx.GetContext(ctx, &id, "SELECT id FROM groups WHERE id = $1 AND organization_id = $2 FOR UPDATE", groupID, organizationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrGroupNotFound
+	}
+	return err
+}
+
+// requireUser fails with ErrUserNotFound unless userID is an active user of
+// the organization
+func requireUser(ctx context.Context, tx *sqlx.Tx, organizationID, userID uuid.UUID) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL)
+	`, userID, organizationID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// requireOwner fails with ErrLastOwner if the group has no owner left
+func requireOwner(ctx context.Context, tx *sqlx.Tx, groupID uuid.UUID) error {
+	var owners int
+	err := tx.GetContext(ctx, &owners, "SELECT COUNT(*) FROM group_members WHERE group_id = $1 AND role = 'owner'", groupID)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// requireAffected turns "no rows affected" into notFound
+func requireAffected(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// groupNameError maps a violation of the per-organization unique name to
+// ErrGroupNameInUse
+func groupNameError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "groups_organization_name_key" {
+		return ErrGroupNameInUse
+	}
+	return err
+}
@@ -0,0 +1,463 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrIdentityProviderNotFound is returned when no matching identity provider exists in the organization
+	ErrIdentityProviderNotFound = errors.New("identity provider not found")
+	// ErrIdentityProviderExists is returned when the organization already has a provider with the slug
+	ErrIdentityProviderExists = errors.New("an identity provider with this slug already exists")
+	// ErrIdentityNotFound is returned when no matching linked identity exists
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrIdentityLinked is returned when the user already has an identity at the provider
+	ErrIdentityLinked = errors.New("account is already linked to an identity at this provider")
+	// ErrFederatedLoginInvalid is returned for a callback whose state is
+	// unknown, expired or already used. The cases are not told apart.
+	ErrFederatedLoginInvalid = errors.New("invalid or expired sign-in")
+)
+
+// IdentityRepository stores the identity providers of the organization
+// carried by the context (see package tenant), the sign-ins in progress at
+// them and the identities linked to users. ConsumeLogin is the exception:
+// the sign-in itself decides the organization.
+type IdentityRepository interface {
+	CreateProvider(ctx context.Context, provider *models.IdentityProvider) error
+	GetProvider(ctx context.Context, id uuid.UUID) (*models.IdentityProvider, error)
+	GetProviderBySlug(ctx context.Context, slug string) (*models.IdentityProvider, error)
+	// ListProviders returns a page of providers, oldest first; with
+	// enabledOnly, disabled providers are left out
+	ListProviders(ctx context.Context, enabledOnly bool, limit, offset int) ([]*models.IdentityProvider, error)
+	// UpdateProvider replaces everything but the slug of provider
+	UpdateProvider(ctx context.Context, provider *models.IdentityProvider) error
+	// DeleteProvider removes a provider together with its linked identities
+	DeleteProvider(ctx context.Context, id uuid.UUID) error
+
+	// CreateLogin stores a sign-in in progress. Expired sign-ins are
+	// discarded on the way.
+	CreateLogin(ctx context.Context, login *models.FederatedLogin) error
+	// ConsumeLogin removes the unexpired sign-in matching stateHash in any
+	// organization and returns it
+	ConsumeLogin(ctx context.Context, stateHash string) (*models.FederatedLogin, error)
+
+	GetIdentity(ctx context.Context, providerID uuid.UUID, subject string) (*models.UserIdentity, error)
+	// LinkIdentity links identity to its existing user
+	LinkIdentity(ctx context.Context, identity *models.UserIdentity) error
+	// ProvisionUser creates a user from req together with identity
+	ProvisionUser(ctx context.Context, req *models.RegisterRequest, identity *models.UserIdentity) (*models.User, error)
+	// RecordIdentityLogin notes a sign-in with an identity and the email
+	// the provider asserted
+	RecordIdentityLogin(ctx context.Context, id uuid.UUID, email string) error
+	// ListUserIdentities returns the identities of a user with their
+	// provider's slug and name
+	ListUserIdentities(ctx context.Context, userID uuid.UUID) ([]*models.UserIdentity, error)
+	// DeleteIdentity unlinks an identity of the user
+	DeleteIdentity(ctx context.Context, userID, id uuid.UUID) error
+}
+
+// PostgresIdentityRepository keeps providers, sign-ins and identities in
+// the identity_providers, federated_logins and user_identities tables. Like
+// the invitation repository it builds on the user repository, which
+// creates provisioned accounts.
+type PostgresIdentityRepository struct {
+	users *PostgresUserRepository
+}
+
+// NewPostgresIdentityRepository creates an identity repository on top of users
+func NewPostgresIdentityRepository(users *PostgresUserRepository) *PostgresIdentityRepository {
+	return &PostgresIdentityRepository{users: users}
+}
+
+type identityProviderRow struct {
+	models.IdentityProvider
+	Scopes pq.StringArray `db:"scopes"`
+}
+
+func (r *identityProviderRow) toProvider() *models.IdentityProvider {
+	provider := r.IdentityProvider
+	provider.Scopes = []string(r.Scopes)
+	return &provider
+}
+
+func (r *PostgresIdentityRepository) CreateProvider(ctx context.Context, provider *models.IdentityProvider) (err error) {
+	ctx, span := startIdentitySpan(ctx, "CreateProvider")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if provider.ID == uuid.Nil {
+		provider.ID = uuid.New()
+	}
+	provider.OrganizationID = organizationID
+	now := time.Now()
+	provider.CreatedAt, provider.UpdatedAt = now, now
+
+	err = retry(ctx, "CreateProvider", func() error {
+		_, err := r.users.db.ExecContext(ctx, `
+			INSERT INTO identity_providers
+				(id, organization_id, slug, name, issuer, client_id, client_secret, scopes, provision_users, link_by_email, enabled, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $12)
+		`, provider.ID, organizationID, provider.Slug, provider.Name, provider.Issuer, provider.ClientID, provider.ClientSecret,
+			pq.StringArray(provider.Scopes), provider.ProvisionUsers, provider.LinkByEmail, provider.Enabled, now)
+		return err
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "identity_providers_organization_slug_key" {
+		return ErrIdentityProviderExists
+	}
+	return err
+}
+
+func (r *PostgresIdentityRepository) GetProvider(ctx context.Context, id uuid.UUID) (provider *models.IdentityProvider, err error) {
+	ctx, span := startIdentitySpan(ctx, "GetProvider")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.getProvider(ctx, "GetProvider", "SELECT * FROM identity_providers WHERE id = $1 AND organization_id = $2", id, organizationID)
+}
+
+func (r *PostgresIdentityRepository) GetProviderBySlug(ctx context.Context, slug string) (provider *models.IdentityProvider, err error) {
+	ctx, span := startIdentitySpan(ctx, "GetProviderBySlug")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.getProvider(ctx, "GetProviderBySlug", "SELECT * FROM identity_providers WHERE slug = $1 AND organization_id = $2", slug, organizationID)
+}
+
+func (r *PostgresIdentityRepository) getProvider(ctx context.Context, operation, query string, args ...interface{}) (*models.IdentityProvider, error) {
+	var row identityProviderRow
+	err := retry(ctx, operation, func() error {
+		return r.users.db.GetContext(ctx, &row, query, args...)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityProviderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toProvider(), nil
+}
+
+func (r *PostgresIdentityRepository) ListProviders(ctx context.Context, enabledOnly bool, limit, offset int) (providers []*models.IdentityProvider, err error) {
+	ctx, span := startIdentitySpan(ctx, "ListProviders")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows := []identityProviderRow{}
+	err = retry(ctx, "ListProviders", func() error {
+		return r.users.db.SelectContext(ctx, &rows, `
+			SELECT * FROM identity_providers WHERE organization_id = $1 AND (enabled OR NOT $2)
+			ORDER BY created_at, id LIMIT $3 OFFSET $4
+		`, organizationID, enabledOnly, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	providers = make([]*models.IdentityProvider, len(rows))
+	for i := range rows {
+		providers[i] = rows[i].toProvider()
+	}
+	return providers, nil
+}
+
+func (r *PostgresIdentityRepository) UpdateProvider(ctx context.Context, provider *models.IdentityProvider) (err error) {
+	ctx, span := startIdentitySpan(ctx, "UpdateProvider")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	provider.UpdatedAt = time.Now()
+	var result sql.Result
+	err = retry(ctx, "UpdateProvider", func() error {
+		result, err = r.users.db.ExecContext(ctx, `
+			UPDATE identity_providers
+			SET name = $3, issuer = $4, client_id = $5, client_secret = $6, scopes = $7,
+				provision_users = $8, link_by_email = $9, enabled = $10, updated_at = $11
+			WHERE id = $1 AND organization_id = $2
+		`, provider.ID, organizationID, provider.Name, provider.Issuer, provider.ClientID, provider.ClientSecret,
+			pq.StringArray(provider.Scopes), provider.ProvisionUsers, provider.LinkByEmail, provider.Enabled, provider.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrIdentityProviderNotFound)
+}
+
+func (r *PostgresIdentityRepository) DeleteProvider(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := startIdentitySpan(ctx, "DeleteProvider")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "DeleteProvider", func() error {
+		result, err = r.users.db.ExecContext(ctx, "DELETE FROM identity_providers WHERE id = $1 AND organization_id = $2", id, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrIdentityProviderNotFound)
+}
+
+func (r *PostgresIdentityRepository) CreateLogin(ctx context.Context, login *models.FederatedLogin) (err error) {
+	ctx, span := startIdentitySpan(ctx, "CreateLogin")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if login.ID == uuid.Nil {
+		login.ID = uuid.New()
+	}
+	login.OrganizationID = organizationID
+	login.CreatedAt = time.Now()
+	return inTx(ctx, r.users.db, "CreateLogin", func(tx *sqlx.Tx) error {
+		// Abandoned sign-ins are never consumed; clear them here
+		_, err := tx.ExecContext(ctx, "DELETE FROM federated_logins WHERE expires_at <= $1", login.CreatedAt)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NamedExecContext(ctx, `
+			INSERT INTO federated_logins (id, organization_id, provider_id, state_hash, nonce, code_verifier, expires_at, created_at)
+			VALUES (:id, :organization_id, :provider_id, :state_hash, :nonce, :code_verifier, :expires_at, :created_at)
+		`, login)
+		return err
+	})
+}
+
+func (r *PostgresIdentityRepository) ConsumeLogin(ctx context.Context, stateHash string) (login *models.FederatedLogin, err error) {
+	ctx, span := startIdentitySpan(ctx, "ConsumeLogin")
+	defer func() { tracing.End(span, err) }()
+
+	login = &models.FederatedLogin{}
+	err = retry(ctx, "ConsumeLogin", func() error {
+		return r.users.db.GetContext(ctx, login, `
+			DELETE FROM federated_logins WHERE state_hash = $1 AND expires_at > $2
+			RETURNING *
+		`, stateHash, time.Now())
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFederatedLoginInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+func (r *PostgresIdentityRepository) GetIdentity(ctx context.Context, providerID uuid.UUID, subject string) (identity *models.UserIdentity, err error) {
+	ctx, span := startIdentitySpan(ctx, "GetIdentity")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity = &models.UserIdentity{}
+	err = retry(ctx, "GetIdentity", func() error {
+		return r.users.db.GetContext(ctx, identity, `
+			SELECT * FROM user_identities WHERE provider_id = $1 AND subject = $2 AND organization_id = $3
+		`, providerID, subject, organizationID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *PostgresIdentityRepository) LinkIdentity(ctx context.Context, identity *models.UserIdentity) (err error) {
+	ctx, span := startIdentitySpan(ctx, "LinkIdentity")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := tenant.Require(ctx); err != nil {
+		return err
+	}
+
+	return inTx(ctx, r.users.db, "LinkIdentity", func(tx *sqlx.Tx) error {
+		return insertIdentity(ctx, tx, identity)
+	})
+}
+
+func (r *PostgresIdentityRepository) ProvisionUser(ctx context.Context, req *models.RegisterRequest, identity *models.UserIdentity) (user *models.User, err error) {
+	ctx, span := startIdentitySpan(ctx, "ProvisionUser")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash outside the transaction
+	user, err = r.users.newUser(ctx, organizationID, req, models.RoleUser)
+	if err != nil {
+		return nil, err
+	}
+	err = inTx(ctx, r.users.db, "ProvisionUser", func(tx *sqlx.Tx) error {
+		if err := insertUser(ctx, tx, user); err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return insertIdentity(ctx, tx, identity)
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_organization_email_active_key" {
+		return nil, ErrEmailInUse
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// insertIdentity stores a new identity in the organization of ctx as part
+// of tx. The user must belong to the same organization.
+func insertIdentity(ctx context.Context, tx *sqlx.Tx, identity *models.UserIdentity) error {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	if identity.ID == uuid.Nil {
+		identity.ID = uuid.New()
+	}
+	identity.OrganizationID = organizationID
+	now := time.Now()
+	identity.CreatedAt, identity.LastLoginAt = now, &now
+
+	result, err := tx.NamedExecContext(ctx, `
+		INSERT INTO user_identities (id, organization_id, user_id, provider_id, subject, email, created_at, last_login_at)
+		SELECT :id, :organization_id, :user_id, :provider_id, :subject, :email, :created_at, :last_login_at
+		WHERE EXISTS (SELECT 1 FROM users WHERE id = :user_id AND organization_id = :organization_id AND deleted_at IS NULL)
+	`, identity)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "user_identities_user_provider_key" {
+		return ErrIdentityLinked
+	}
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrUserNotFound)
+}
+
+func (r *PostgresIdentityRepository) RecordIdentityLogin(ctx context.Context, id uuid.UUID, email string) (err error) {
+	ctx, span := startIdentitySpan(ctx, "RecordIdentityLogin")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "RecordIdentityLogin", func() error {
+		result, err = r.users.db.ExecContext(ctx, `
+			UPDATE user_identities SET email = $3, last_login_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND organization_id = $2
+		`, id, organizationID, email)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrIdentityNotFound)
+}
+
+func (r *PostgresIdentityRepository) ListUserIdentities(ctx context.Context, userID uuid.UUID) (identities []*models.UserIdentity, err error) {
+	ctx, span := startIdentitySpan(ctx, "ListUserIdentities")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identities = []*models.UserIdentity{}
+	err = retry(ctx, "ListUserIdentities", func() error {
+		return r.users.db.SelectContext(ctx, &identities, `
+			SELECT i.*, p.slug AS provider_slug, p.name AS provider_name
+			FROM user_identities i JOIN identity_providers p ON p.id = i.provider_id
+			WHERE i.user_id = $1 AND i.organization_id = $2
+			ORDER BY i.created_at, i.id
+		`, userID, organizationID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *PostgresIdentityRepository) DeleteIdentity(ctx context.Context, userID, id uuid.UUID) (err error) {
+	ctx, span := startIdentitySpan(ctx, "DeleteIdentity")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "DeleteIdentity", func() error {
+		result, err = r.users.db.ExecContext(ctx, `
+			DELETE FROM user_identities WHERE id = $1 AND user_id = $2 AND organization_id = $3
+		`, id, userID, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrIdentityNotFound)
+}
+
+// startIdentitySpan starts a client span for one identity repository operation
+func startIdentitySpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "IdentityRepository", operation)
+}
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrInvitationNotFound is returned when no matching invitation exists in the organization
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationPending is returned when the email already has an open invitation
+	ErrInvitationPending = errors.New("an invitation for this email is already pending")
+	// ErrInvitationClosed is returned when changing an accepted or revoked invitation
+	ErrInvitationClosed = errors.New("invitation has already been accepted or revoked")
+	// ErrInvitationInvalid is returned when accepting with a token that is
+	// unknown, superseded, expired or already used. The cases are not told
+	// apart so tokens cannot be probed.
+	ErrInvitationInvalid = errors.New("invalid or expired invitation")
+)
+
+// InvitationRepository manages the invitations of the organization carried
+// by the context (see package tenant). AcceptInvitation is the exception:
+// the invitation itself decides the organization.
+type InvitationRepository interface {
+	// CreateInvitation stores a new invitation. Expired invitations for the
+	// same email are revoked first.
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+	GetInvitation(ctx context.Context, id uuid.UUID) (*models.Invitation, error)
+	ListInvitations(ctx context.Context, limit, offset int) ([]*models.Invitation, error)
+	// RenewInvitation replaces the token of an open invitation and extends
+	// its expiry, for resending it
+	RenewInvitation(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time) (*models.Invitation, error)
+	RevokeInvitation(ctx context.Context, id uuid.UUID) (*models.Invitation, error)
+	// AcceptInvitation creates the invited user from req, whose email is
+	// ignored in favour of the invitation's, and closes the invitation
+	AcceptInvitation(ctx context.Context, id uuid.UUID, tokenHash string, req *models.RegisterRequest) (*models.Invitation, *models.User, error)
+}
+
+// PostgresInvitationRepository keeps invitations in the invitations table.
+// Like the organization repository it builds on the user repository, which
+// creates the accounts of accepted invitations.
+type PostgresInvitationRepository struct {
+	users *PostgresUserRepository
+}
+
+// NewPostgresInvitationRepository creates an invitation repository on top of users
+func NewPostgresInvitationRepository(users *PostgresUserRepository) *PostgresInvitationRepository {
+	return &PostgresInvitationRepository{users: users}
+}
+
+func (r *PostgresInvitationRepository) CreateInvitation(ctx context.Context, invitation *models.Invitation) (err error) {
+	ctx, span := startInvitationSpan(ctx, "CreateInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if invitation.ID == uuid.Nil {
+		invitation.ID = uuid.New()
+	}
+	invitation.OrganizationID = organizationID
+	now := time.Now()
+	invitation.SentAt, invitation.CreatedAt, invitation.UpdatedAt = now, now, now
+	invitation.SendCount = 1
+
+	err = inTx(ctx, r.users.db, "CreateInvitation", func(tx *sqlx.Tx) error {
+		var exists bool
+		err := tx.GetContext(ctx, &exists, `
+			SELECT EXISTS (SELECT 1 FROM users WHERE organization_id = $1 AND email = $2 AND deleted_at IS NULL)
+		`, organizationID, invitation.Email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrEmailInUse
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE invitations SET revoked_at = $3, updated_at = $3
+			WHERE organization_id = $1 AND email = $2
+				AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= $3
+		`, organizationID, invitation.Email, now)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NamedExecContext(ctx, `
+			INSERT INTO invitations (id, organization_id, email, role, locale, inviter_id, token_hash, expires_at, sent_at, send_count, created_at, updated_at)
+			VALUES (:id, :organization_id, :email, :role, :locale, :inviter_id, :token_hash, :expires_at, :sent_at, :send_count, :created_at, :updated_at)
+		`, invitation)
+		return err
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "invitations_organization_email_open_key" {
+		return ErrInvitationPending
+	}
+	return err
+}
+
+func (r *PostgresInvitationRepository) GetInvitation(ctx context.Context, id uuid.UUID) (invitation *models.Invitation, err error) {
+	ctx, span := startInvitationSpan(ctx, "GetInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation = &models.Invitation{}
+	err = retry(ctx, "GetInvitation", func() error {
+		return r.users.db.GetContext(ctx, invitation, "SELECT * FROM invitations WHERE id = $1 AND organization_id = $2", id, organizationID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (r *PostgresInvitationRepository) ListInvitations(ctx context.Context, limit, offset int) (invitations []*models.Invitation, err error) {
+	ctx, span := startInvitationSpan(ctx, "ListInvitations")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	invitations = []*models.Invitation{}
+	err = retry(ctx, "ListInvitations", func() error {
+		return r.users.db.SelectContext(ctx, &invitations, `
+			SELECT * FROM invitations WHERE organization_id = $1
+			ORDER BY created_at DESC, id LIMIT $2 OFFSET $3
+		`, organizationID, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *PostgresInvitationRepository) RenewInvitation(ctx context.Context, id uuid.UUID, tokenHash string, expiresAt time.Time) (invitation *models.Invitation, err error) {
+	ctx, span := startInvitationSpan(ctx, "RenewInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	return r.updateOpen(ctx, "RenewInvitation", id, `
+		UPDATE invitations
+		SET token_hash = $3, expires_at = $4, sent_at = CURRENT_TIMESTAMP, send_count = send_count + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND organization_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+		RETURNING *
+	`, tokenHash, expiresAt)
+}
+
+func (r *PostgresInvitationRepository) RevokeInvitation(ctx context.Context, id uuid.UUID) (invitation *models.Invitation, err error) {
+	ctx, span := startInvitationSpan(ctx, "RevokeInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	return r.updateOpen(ctx, "RevokeInvitation", id, `
+		UPDATE invitations
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND organization_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+		RETURNING *
+	`)
+}
+
+// updateOpen runs an update of an open invitation of the organization. When no
+// row matches it tells a missing invitation (ErrInvitationNotFound) from a
+// closed one (ErrInvitationClosed).
+func (r *PostgresInvitationRepository) updateOpen(ctx context.Context, operation string, id uuid.UUID, query string, args ...interface{}) (*models.Invitation, error) {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{}
+	err = retry(ctx, operation, func() error {
+		return r.users.db.GetContext(ctx, invitation, query, append([]interface{}{id, organizationID}, args...)...)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.GetInvitation(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvitationClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (r *PostgresInvitationRepository) AcceptInvitation(ctx context.Context, id uuid.UUID, tokenHash string, req *models.RegisterRequest) (invitation *models.Invitation, user *models.User, err error) {
+	ctx, span := startInvitationSpan(ctx, "AcceptInvitation")
+	defer func() { tracing.End(span, err) }()
+
+	// Hash outside the transaction; the organization, email and role are
+	// filled in from the invitation
+	user, err = r.users.newUser(ctx, uuid.Nil, req, models.RoleUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	invitation = &models.Invitation{}
+	err = inTx(ctx, r.users.db, "AcceptInvitation", func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, invitation, "SELECT * FROM invitations WHERE id = $1 FOR UPDATE", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvitationInvalid
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if subtle.ConstantTimeCompare([]byte(invitation.TokenHash), []byte(tokenHash)) != 1 ||
+			invitation.Status(now) != models.InvitationPending {
+			return ErrInvitationInvalid
+		}
+
+		user.OrganizationID = invitation.OrganizationID
+		user.Email = invitation.Email
+		user.Role = invitation.Role
+		if err := insertUser(ctx, tx, user); err != nil {
+			return err
+		}
+
+		return tx.GetContext(ctx, invitation, `
+			UPDATE invitations SET accepted_at = $2, user_id = $3, updated_at = $2
+			WHERE id = $1
+			RETURNING *
+		`, id, now, user.ID)
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_organization_email_active_key" {
+		return nil, nil, ErrEmailInUse
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return invitation, user, nil
+}
+
+// startInvitationSpan starts a client span for one invitation repository operation
+func startInvitationSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "InvitationRepository", operation)
+}
@@ -0,0 +1,409 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrOAuthClientNotFound is returned when no matching OAuth client exists
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	// ErrOAuthConsentNotFound is returned when the user has not consented to the client
+	ErrOAuthConsentNotFound = errors.New("oauth consent not found")
+	// ErrOAuthCodeInvalid is returned when exchanging an authorization code
+	// that is unknown, expired or already used. The cases are not told apart.
+	ErrOAuthCodeInvalid = errors.New("invalid or expired authorization code")
+	// ErrOAuthTokenNotFound is returned when no access token matches
+	ErrOAuthTokenNotFound = errors.New("oauth access token not found")
+)
+
+// OAuthRepository stores the clients, consents, authorization codes and
+// access tokens of the OpenID Connect provider for the organization carried
+// by the context (see package tenant). FindClient and GetAccessToken are the
+// exceptions: protocol endpoints learn the organization from the client or
+// token they look up.
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client *models.OAuthClient) error
+	GetClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error)
+	ListClients(ctx context.Context, limit, offset int) ([]*models.OAuthClient, error)
+	// UpdateClient replaces the name, redirect URIs and secret hash of client
+	UpdateClient(ctx context.Context, client *models.OAuthClient) error
+	DeleteClient(ctx context.Context, id uuid.UUID) error
+	// FindClient returns the client id of any organization
+	FindClient(ctx context.Context, id uuid.UUID) (*models.OAuthClient, error)
+
+	GetConsent(ctx context.Context, userID, clientID uuid.UUID) (*models.OAuthConsent, error)
+	// SaveConsent creates or replaces the user's consent to the client
+	SaveConsent(ctx context.Context, consent *models.OAuthConsent) error
+
+	CreateAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) error
+	// ConsumeAuthorizationCode marks the code matching codeHash as used and
+	// returns it. Presenting a used code again revokes the tokens issued
+	// for it, as RFC 6749 section 4.1.2 asks.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.OAuthAuthorizationCode, error)
+
+	CreateAccessToken(ctx context.Context, token *models.OAuthAccessToken) error
+	// GetAccessToken returns the token matching tokenHash in any
+	// organization, whether or not it is still active
+	GetAccessToken(ctx context.Context, tokenHash string) (*models.OAuthAccessToken, error)
+	RevokeAccessToken(ctx context.Context, id uuid.UUID) error
+}
+
+// PostgresOAuthRepository keeps the provider's state in the oauth_* tables
+type PostgresOAuthRepository struct {
+	db *sqlx.DB
+}
+
+// NewPostgresOAuthRepository creates an OAuth repository on top of an existing connection pool
+func NewPostgresOAuthRepository(db *sqlx.DB) *PostgresOAuthRepository {
+	return &PostgresOAuthRepository{db: db}
+}
+
+type oauthClientRow struct {
+	models.OAuthClient
+	RedirectURIs pq.StringArray `db:"redirect_uris"`
+}
+
+func (r *oauthClientRow) toClient() *models.OAuthClient {
+	client := r.OAuthClient
+	client.RedirectURIs = []string(r.RedirectURIs)
+	return &client
+}
+
+func (r *PostgresOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) (err error) {
+	ctx, span := startOAuthSpan(ctx, "CreateClient")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if client.ID == uuid.Nil {
+		client.ID = uuid.New()
+	}
+	client.OrganizationID = organizationID
+	now := time.Now()
+	client.CreatedAt, client.UpdatedAt = now, now
+
+	return retry(ctx, "CreateClient", func() error {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO oauth_clients (id, organization_id, name, secret_hash, redirect_uris, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, client.ID, organizationID, client.Name, client.SecretHash, pq.StringArray(client.RedirectURIs), now, now)
+		return err
+	})
+}
+
+func (r *PostgresOAuthRepository) GetClient(ctx context.Context, id uuid.UUID) (client *models.OAuthClient, err error) {
+	ctx, span := startOAuthSpan(ctx, "GetClient")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.getClient(ctx, "GetClient", "SELECT * FROM oauth_clients WHERE id = $1 AND organization_id = $2", id, organizationID)
+}
+
+func (r *PostgresOAuthRepository) FindClient(ctx context.Context, id uuid.UUID) (client *models.OAuthClient, err error) {
+	ctx, span := startOAuthSpan(ctx, "FindClient")
+	defer func() { tracing.End(span, err) }()
+
+	return r.getClient(ctx, "FindClient", "SELECT * FROM oauth_clients WHERE id = $1", id)
+}
+
+func (r *PostgresOAuthRepository) getClient(ctx context.Context, operation, query string, args ...interface{}) (*models.OAuthClient, error) {
+	var row oauthClientRow
+	err := retry(ctx, operation, func() error {
+		return r.db.GetContext(ctx, &row, query, args...)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toClient(), nil
+}
+
+func (r *PostgresOAuthRepository) ListClients(ctx context.Context, limit, offset int) (clients []*models.OAuthClient, err error) {
+	ctx, span := startOAuthSpan(ctx, "ListClients")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows := []oauthClientRow{}
+	err = retry(ctx, "ListClients", func() error {
+		return r.db.SelectContext(ctx, &rows, `
+			SELECT * FROM oauth_clients WHERE organization_id = $1
+			ORDER BY created_at, id LIMIT $2 OFFSET $3
+		`, organizationID, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	clients = make([]*models.OAuthClient, len(rows))
+	for i := range rows {
+		clients[i] = rows[i].toClient()
+	}
+	return clients, nil
+}
+
+func (r *PostgresOAuthRepository) UpdateClient(ctx context.Context, client *models.OAuthClient) (err error) {
+	ctx, span := startOAuthSpan(ctx, "UpdateClient")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	client.UpdatedAt = time.Now()
+	var result sql.Result
+	err = retry(ctx, "UpdateClient", func() error {
+		result, err = r.db.ExecContext(ctx, `
+			UPDATE oauth_clients SET name = $3, secret_hash = $4, redirect_uris = $5, updated_at = $6
+			WHERE id = $1 AND organization_id = $2
+		`, client.ID, organizationID, client.Name, client.SecretHash, pq.StringArray(client.RedirectURIs), client.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrOAuthClientNotFound)
+}
+
+func (r *PostgresOAuthRepository) DeleteClient(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := startOAuthSpan(ctx, "DeleteClient")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "DeleteClient", func() error {
+		result, err = r.db.ExecContext(ctx, "DELETE FROM oauth_clients WHERE id = $1 AND organization_id = $2", id, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrOAuthClientNotFound)
+}
+
+func (r *PostgresOAuthRepository) GetConsent(ctx context.Context, userID, clientID uuid.UUID) (consent *models.OAuthConsent, err error) {
+	ctx, span := startOAuthSpan(ctx, "GetConsent")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consent = &models.OAuthConsent{}
+	err = retry(ctx, "GetConsent", func() error {
+		return r.db.GetContext(ctx, consent, `
+			SELECT * FROM oauth_consents WHERE user_id = $1 AND client_id = $2 AND organization_id = $3
+		`, userID, clientID, organizationID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOAuthConsentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
+
+func (r *PostgresOAuthRepository) SaveConsent(ctx context.Context, consent *models.OAuthConsent) (err error) {
+	ctx, span := startOAuthSpan(ctx, "SaveConsent")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	consent.OrganizationID = organizationID
+	now := time.Now()
+	consent.CreatedAt, consent.UpdatedAt = now, now
+	return retry(ctx, "SaveConsent", func() error {
+		return r.db.GetContext(ctx, &consent.CreatedAt, `
+			INSERT INTO oauth_consents (user_id, client_id, organization_id, scope, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $5)
+			ON CONFLICT (user_id, client_id) DO UPDATE SET scope = EXCLUDED.scope, updated_at = EXCLUDED.updated_at
+			RETURNING created_at
+		`, consent.UserID, consent.ClientID, organizationID, consent.Scope, now)
+	})
+}
+
+func (r *PostgresOAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.OAuthAuthorizationCode) (err error) {
+	ctx, span := startOAuthSpan(ctx, "CreateAuthorizationCode")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if code.ID == uuid.Nil {
+		code.ID = uuid.New()
+	}
+	code.OrganizationID = organizationID
+	code.CreatedAt = time.Now()
+	return retry(ctx, "CreateAuthorizationCode", func() error {
+		_, err := r.db.NamedExecContext(ctx, `
+			INSERT INTO oauth_authorization_codes
+				(id, organization_id, client_id, user_id, code_hash, redirect_uri, scope, nonce, code_challenge, expires_at, created_at)
+			VALUES (:id, :organization_id, :client_id, :user_id, :code_hash, :redirect_uri, :scope, :nonce, :code_challenge, :expires_at, :created_at)
+		`, code)
+		return err
+	})
+}
+
+func (r *PostgresOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code *models.OAuthAuthorizationCode, err error) {
+	ctx, span := startOAuthSpan(ctx, "ConsumeAuthorizationCode")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Revoking the tokens of a replayed code must commit; the error is only
+	// returned once the transaction is done
+	var failure error
+	code = &models.OAuthAuthorizationCode{}
+	err = inTx(ctx, r.db, "ConsumeAuthorizationCode", func(tx *sqlx.Tx) error {
+		failure = nil
+		err := tx.GetContext(ctx, code, `
+			SELECT * FROM oauth_authorization_codes WHERE code_hash = $1 AND organization_id = $2 FOR UPDATE
+		`, codeHash, organizationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			failure = ErrOAuthCodeInvalid
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		switch {
+		case code.UsedAt != nil:
+			failure = ErrOAuthCodeInvalid
+			_, err := tx.ExecContext(ctx, `
+				UPDATE oauth_access_tokens SET revoked_at = $2 WHERE authorization_code_id = $1 AND revoked_at IS NULL
+			`, code.ID, now)
+			return err
+		case !now.Before(code.ExpiresAt):
+			failure = ErrOAuthCodeInvalid
+			return nil
+		}
+		code.UsedAt = &now
+		_, err = tx.ExecContext(ctx, "UPDATE oauth_authorization_codes SET used_at = $2 WHERE id = $1", code.ID, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return code, nil
+}
+
+func (r *PostgresOAuthRepository) CreateAccessToken(ctx context.Context, token *models.OAuthAccessToken) (err error) {
+	ctx, span := startOAuthSpan(ctx, "CreateAccessToken")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	if token.ID == uuid.Nil {
+		token.ID = uuid.New()
+	}
+	token.OrganizationID = organizationID
+	token.CreatedAt = time.Now()
+	return retry(ctx, "CreateAccessToken", func() error {
+		_, err := r.db.NamedExecContext(ctx, `
+			INSERT INTO oauth_access_tokens
+				(id, organization_id, client_id, user_id, authorization_code_id, token_hash, scope, expires_at, created_at)
+			VALUES (:id, :organization_id, :client_id, :user_id, :authorization_code_id, :token_hash, :scope, :expires_at, :created_at)
+		`, token)
+		return err
+	})
+}
+
+func (r *PostgresOAuthRepository) GetAccessToken(ctx context.Context, tokenHash string) (token *models.OAuthAccessToken, err error) {
+	ctx, span := startOAuthSpan(ctx, "GetAccessToken")
+	defer func() { tracing.End(span, err) }()
+
+	token = &models.OAuthAccessToken{}
+	err = retry(ctx, "GetAccessToken", func() error {
+		return r.db.GetContext(ctx, token, "SELECT * FROM oauth_access_tokens WHERE token_hash = $1", tokenHash)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOAuthTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *PostgresOAuthRepository) RevokeAccessToken(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := startOAuthSpan(ctx, "RevokeAccessToken")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	err = retry(ctx, "RevokeAccessToken", func() error {
+		result, err = r.db.ExecContext(ctx, `
+			UPDATE oauth_access_tokens SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+			WHERE id = $1 AND organization_id = $2
+		`, id, organizationID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrOAuthTokenNotFound)
+}
+
+// startOAuthSpan starts a client span for one OAuth repository operation
+func startOAuthSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "OAuthRepository", operation)
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrOrganizationNotFound is returned when no matching organization exists
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrSlugInUse is returned when another organization already has the slug
+	ErrSlugInUse = errors.New("organization slug already in use")
+)
+
+// OrganizationRepository manages organizations. Unlike UserRepository it is
+// not scoped to the tenant in the context; callers decide who may see which
+// organization.
+type OrganizationRepository interface {
+	// CreateOrganization stores org and, when admin is not nil, creates its
+	// first user with the admin role in the same transaction
+	CreateOrganization(ctx context.Context, org *models.Organization, admin *models.RegisterRequest) (*models.User, error)
+	GetOrganizationByID(ctx context.Context, id uuid.UUID) (*models.Organization, error)
+	GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	ListOrganizations(ctx context.Context, limit, offset int) ([]*models.Organization, error)
+	UpdateOrganization(ctx context.Context, id uuid.UUID, updates *models.UpdateOrganizationRequest) (*models.Organization, error)
+}
+
+// PostgresOrganizationRepository keeps organizations in the organizations
+// table. It shares the connection pool and password hasher of the user
+// repository, which it uses to create an organization's first admin.
+type PostgresOrganizationRepository struct {
+	users *PostgresUserRepository
+}
+
+// NewPostgresOrganizationRepository creates an organization repository on
+// top of users
+func NewPostgresOrganizationRepository(users *PostgresUserRepository) *PostgresOrganizationRepository {
+	return &PostgresOrganizationRepository{users: users}
+}
+
+func (r *PostgresOrganizationRepository) CreateOrganization(ctx context.Context, org *models.Organization, admin *models.RegisterRequest) (user *models.User, err error) {
+	ctx, span := startOrganizationSpan(ctx, "CreateOrganization")
+	defer func() { tracing.End(span, err) }()
+
+	if org.ID == uuid.Nil {
+		org.ID = uuid.New()
+	}
+	now := time.Now()
+	org.CreatedAt, org.UpdatedAt = now, now
+
+	if admin != nil {
+		user, err = r.users.newUser(ctx, org.ID, admin, models.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = inTx(ctx, r.users.db, "CreateOrganization", func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO organizations (id, slug, name, created_at, updated_at)
+			VALUES (:id, :slug, :name, :created_at, :updated_at)
+		`, org)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return nil
+		}
+		return insertUser(ctx, tx, user)
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "organizations_slug_key" {
+		return nil, ErrSlugInUse
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *PostgresOrganizationRepository) GetOrganizationByID(ctx context.Context, id uuid.UUID) (org *models.Organization, err error) {
+	ctx, span := startOrganizationSpan(ctx, "GetOrganizationByID")
+	defer func() { tracing.End(span, err) }()
+
+	return r.get(ctx, "GetOrganizationByID", "SELECT * FROM organizations WHERE id = $1", id)
+}
+
+func (r *PostgresOrganizationRepository) GetOrganizationBySlug(ctx context.Context, slug string) (org *models.Organization, err error) {
+	ctx, span := startOrganizationSpan(ctx, "GetOrganizationBySlug")
+	defer func() { tracing.End(span, err) }()
+
+	return r.get(ctx, "GetOrganizationBySlug", "SELECT * FROM organizations WHERE slug = $1", slug)
+}
+
+// startOrganizationSpan starts a client span for one organization repository
+// operation
+func startOrganizationSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "OrganizationRepository", operation)
+}
+
+// get loads a single organization, mapping no rows to ErrOrganizationNotFound
+func (r *PostgresOrganizationRepository) get(ctx context.Context, operation, query string, arg interface{}) (*models.Organization, error) {
+	org := &models.Organization{}
+	err := retry(ctx, operation, func() error {
+		return r.users.db.GetContext(ctx, org, query, arg)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (r *PostgresOrganizationRepository) ListOrganizations(ctx context.Context, limit, offset int) (orgs []*models.Organization, err error) {
+	ctx, span := startOrganizationSpan(ctx, "ListOrganizations")
+	defer func() { tracing.End(span, err) }()
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	orgs = []*models.Organization{}
+	err = retry(ctx, "ListOrganizations", func() error {
+		return r.users.db.SelectContext(ctx, &orgs, "SELECT * FROM organizations ORDER BY created_at, id LIMIT $1 OFFSET $2", limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+func (r *PostgresOrganizationRepository) UpdateOrganization(ctx context.Context, id uuid.UUID, updates *models.UpdateOrganizationRequest) (org *models.Organization, err error) {
+	ctx, span := startOrganizationSpan(ctx, "UpdateOrganization")
+	defer func() { tracing.End(span, err) }()
+
+	org = &models.Organization{}
+	err = retry(ctx, "UpdateOrganization", func() error {
+		return r.users.db.GetContext(ctx, org, `
+			UPDATE organizations
+			SET name = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING *
+		`, id, updates.Name)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
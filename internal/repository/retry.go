@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"syscall"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// maxTransientAttempts bounds how often an operation is tried when the
+// database fails it with a transient error
+const maxTransientAttempts = 3
+
+// transientBackoff is the delay before the first retry; it doubles after that
+const transientBackoff = 50 * time.Millisecond
+
+// errUncertainCommit wraps a commit that failed with the connection lost, so
+// the transaction may or may not have been applied and must not be retried
+type errUncertainCommit struct{ err error }
+
+func (e errUncertainCommit) Error() string { return e.err.Error() }
+func (e errUncertainCommit) Unwrap() error { return e.err }
+
+// isTransient reports whether err is a failure that may succeed when tried
+// again: a lost connection, the server restarting, or a transaction aborted
+// by a serialization failure or deadlock
+func isTransient(err error) bool {
+	var uncertain errUncertainCommit
+	if err == nil || errors.As(err, &uncertain) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08": // connection_exception
+			return true
+		case "40": // transaction_rollback: serialization_failure, deadlock_detected
+			return pqErr.Code == "40001" || pqErr.Code == "40P01"
+		case "57": // operator_intervention: admin_shutdown, crash_shutdown, cannot_connect_now
+			return pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+		}
+		return false
+	}
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retry runs fn until it succeeds, fails with an error that is not
+// transient, or has been tried maxTransientAttempts times
+func retry(ctx context.Context, operation string, fn func() error) error {
+	backoff := transientBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !isTransient(err) || attempt == maxTransientAttempts {
+			return err
+		}
+
+		slog.WarnContext(ctx, "Retrying after transient database error",
+			"operation", operation, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(jitter(backoff)):
+		}
+		backoff *= 2
+	}
+}
+
+// inTx runs fn in a transaction and commits it, retrying the whole
+// transaction on transient errors. A commit lost with its connection is not
+// retried, since it may have been applied.
+func inTx(ctx context.Context, db *sqlx.DB, operation string, fn func(tx *sqlx.Tx) error) error {
+	return retry(ctx, operation, func() error {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			var pqErr *pq.Error
+			if !errors.As(err, &pqErr) {
+				return errUncertainCommit{err}
+			}
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"not found", ErrUserNotFound, false},
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"deadlock", &pq.Error{Code: "40P01"}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"server starting up", &pq.Error{Code: "57P03"}, true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"query canceled", &pq.Error{Code: "57014"}, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"connection reset", fmt.Errorf("read tcp: %w", syscall.ECONNRESET), true},
+		{"uncertain commit", errUncertainCommit{syscall.ECONNRESET}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTransient(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("retries transient errors until success", func(t *testing.T) {
+		calls := 0
+		err := retry(context.Background(), "test", func() error {
+			calls++
+			if calls < maxTransientAttempts {
+				return &pq.Error{Code: "40001"}
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, maxTransientAttempts, calls)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		calls := 0
+		err := retry(context.Background(), "test", func() error {
+			calls++
+			return driver.ErrBadConn
+		})
+		assert.ErrorIs(t, err, driver.ErrBadConn)
+		assert.Equal(t, maxTransientAttempts, calls)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		err := retry(context.Background(), "test", func() error {
+			calls++
+			return ErrEmailInUse
+		})
+		assert.True(t, errors.Is(err, ErrEmailInUse))
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -4,62 +4,105 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
-	"net/url"
 	"time"
 
+	"github.com/atulsm/user-service/internal/events"
 	"github.com/atulsm/user-service/internal/models"
+	"github.com/atulsm/user-service/internal/outbox"
+	"github.com/atulsm/user-service/internal/tenant"
+	"github.com/atulsm/user-service/internal/tracing"
 	"github.com/atulsm/user-service/pkg/utils"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	// ErrUserNotFound is returned when no matching (non-deleted) user exists
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailInUse is returned when an active user already owns the email
+	ErrEmailInUse = errors.New("email already in use")
+	// ErrVersionMismatch is returned when a write is conditional on a version
+	// that is no longer current
+	ErrVersionMismatch = errors.New("user has been modified by another request")
+	// ErrPhoneChanged is returned when verifying a phone number that is no
+	// longer the user's
+	ErrPhoneChanged = errors.New("phone number has changed since the code was sent")
+)
+
+// maxUpdateAttempts bounds how often an unconditional update is retried when
+// it races with a concurrent write
+const maxUpdateAttempts = 3
+
+// UserRepository reads and writes the users of the organization carried by
+// the context (see package tenant). Every method except PurgeDeletedUsers
+// fails with tenant.ErrMissing when there is none.
 type UserRepository interface {
-	CreateUser(user *models.RegisterRequest) (*models.User, error)
-	GetUserByID(id uuid.UUID) (*models.User, error)
-	GetUserByEmail(email string) (*models.User, error)
-	UpdateUser(id uuid.UUID, updates *models.UpdateProfileRequest) (*models.User, error)
-	ListUsers(limit, offset int) ([]*models.User, error)
-	DeleteUser(id uuid.UUID) error
+	CreateUser(ctx context.Context, user *models.RegisterRequest) (*models.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	// UpdateUser applies updates if the stored version equals expectedVersion;
+	// an expectedVersion of 0 applies them to whatever version is current. It
+	// returns the user as the write found it and as it left it.
+	UpdateUser(ctx context.Context, id uuid.UUID, updates *models.UpdateProfileRequest, expectedVersion int64) (before, after *models.User, err error)
+	// PatchUser applies a merge patch with the same expectedVersion semantics
+	// and results as UpdateUser. The patch must already be validated.
+	PatchUser(ctx context.Context, id uuid.UUID, patch *models.UserPatch, expectedVersion int64) (before, after *models.User, err error)
+	ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
+	// DeleteUser soft deletes a user, with the same expectedVersion semantics as UpdateUser
+	DeleteUser(ctx context.Context, id uuid.UUID, expectedVersion int64) error
 	Close() error
-	UpdatePassword(id uuid.UUID, passwordHash string) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
 	GetUsers(ctx context.Context, page, pageSize int) ([]*models.User, int, error)
+	ListDeletedUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
+	RestoreUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// MarkPhoneVerified records that the user owns phoneNumber, which must
+	// still be their phone number
+	MarkPhoneVerified(ctx context.Context, id uuid.UUID, phoneNumber string) (*models.User, error)
 }
 
 type PostgresUserRepository struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	hasher *utils.PasswordHasher
 }
 
-func NewUserRepository(dbURL string) UserRepository {
-	// Parse the database URL to extract database name
-	parsedURL, err := url.Parse(dbURL)
-	if err != nil {
-		log.Printf("Warning: Could not parse database URL: %v", err)
-	} else {
-		dbName := parsedURL.Path[1:] // Remove leading '/'
-		log.Printf("Connecting to database: %s on host: %s", dbName, parsedURL.Host)
+// Option configures a PostgresUserRepository
+type Option func(*PostgresUserRepository)
+
+// WithPasswordHasher sets the hasher used for new users' passwords
+func WithPasswordHasher(hasher *utils.PasswordHasher) Option {
+	return func(r *PostgresUserRepository) {
+		r.hasher = hasher
 	}
+}
 
-	db, err := sqlx.Connect("postgres", dbURL)
-	if err != nil {
-		panic(err)
+// NewPostgresUserRepository creates a repository on top of an existing connection pool
+func NewPostgresUserRepository(db *sqlx.DB, opts ...Option) *PostgresUserRepository {
+	r := &PostgresUserRepository{db: db, hasher: utils.NewPasswordHasher()}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
+}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+func (r *PostgresUserRepository) CreateUser(ctx context.Context, req *models.RegisterRequest) (user *models.User, err error) {
+	ctx, span := startSpan(ctx, "CreateUser")
+	defer func() { tracing.End(span, err) }()
 
-	log.Printf("Successfully connected to PostgreSQL database")
-	return &PostgresUserRepository{db: db}
-}
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-func (r *PostgresUserRepository) CreateUser(req *models.RegisterRequest) (*models.User, error) {
 	// Check if user with this email already exists
 	var count int
-	err := r.db.Get(&count, "SELECT COUNT(*) FROM users WHERE email = $1", req.Email)
+	err = retry(ctx, "CreateUser", func() error {
+		return r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE email = $1 AND organization_id = $2 AND deleted_at IS NULL", req.Email, organizationID)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -67,112 +110,295 @@ func (r *PostgresUserRepository) CreateUser(req *models.RegisterRequest) (*model
 		return nil, errors.New("user with this email already exists")
 	}
 
-	// Hash password
-	passwordHash, err := utils.HashPassword(req.Password)
+	user, err = r.newUser(ctx, organizationID, req, models.RoleUser)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create new user
-	user := &models.User{
-		ID:          uuid.New(),
-		Email:       req.Email,
-		Password:    passwordHash,
-		FirstName:   req.FirstName,
-		LastName:    req.LastName,
-		PhoneNumber: sql.NullString{String: req.PhoneNumber, Valid: req.PhoneNumber != ""},
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	err = inTx(ctx, r.db, "CreateUser", func(tx *sqlx.Tx) error {
+		return insertUser(ctx, tx, user)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return user, nil
+}
 
-	// Insert user into database
-	_, err = r.db.NamedExec(`
-		INSERT INTO users (id, email, password_hash, first_name, last_name, phone_number, created_at, updated_at)
-		VALUES (:id, :email, :password_hash, :first_name, :last_name, :phone_number, :created_at, :updated_at)
-	`, user)
-
+// newUser builds a user with the given role in an organization from req,
+// hashing its password
+func (r *PostgresUserRepository) newUser(ctx context.Context, organizationID uuid.UUID, req *models.RegisterRequest, role string) (*models.User, error) {
+	passwordHash, err := r.hashPassword(ctx, req.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	now := time.Now()
+	return &models.User{
+		ID:             uuid.New(),
+		OrganizationID: organizationID,
+		Email:          req.Email,
+		Password:       passwordHash,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		PhoneNumber:    sql.NullString{String: req.PhoneNumber, Valid: req.PhoneNumber != ""},
+		Role:           role,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Version:        1,
+	}, nil
 }
 
-func (r *PostgresUserRepository) GetUserByID(id uuid.UUID) (*models.User, error) {
-	user := &models.User{}
-	err := r.db.Get(user, "SELECT * FROM users WHERE id = $1", id)
+// insertUser stores a new user and its registration event as part of tx
+func insertUser(ctx context.Context, tx *sqlx.Tx, user *models.User) error {
+	_, err := tx.NamedExecContext(ctx, `
+		INSERT INTO users (id, organization_id, email, password_hash, first_name, last_name, phone_number, role, created_at, updated_at, version)
+		VALUES (:id, :organization_id, :email, :password_hash, :first_name, :last_name, :phone_number, :role, :created_at, :updated_at, :version)
+	`, user)
+	if err != nil {
+		return err
+	}
+	return writeEvent(ctx, tx, user, events.UserRegistered, models.NewUserResponse(user))
+}
+
+func (r *PostgresUserRepository) GetUserByID(ctx context.Context, id uuid.UUID) (user *models.User, err error) {
+	ctx, span := startSpan(ctx, "GetUserByID")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &models.User{}
+	err = retry(ctx, "GetUserByID", func() error {
+		return r.db.GetContext(ctx, user, "SELECT * FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL", id, organizationID)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 	return user, nil
 }
 
-func (r *PostgresUserRepository) GetUserByEmail(email string) (*models.User, error) {
-	user := &models.User{}
-	err := r.db.Get(user, "SELECT * FROM users WHERE email = $1", email)
+func (r *PostgresUserRepository) GetUserByEmail(ctx context.Context, email string) (user *models.User, err error) {
+	ctx, span := startSpan(ctx, "GetUserByEmail")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user = &models.User{}
+	err = retry(ctx, "GetUserByEmail", func() error {
+		return r.db.GetContext(ctx, user, "SELECT * FROM users WHERE email = $1 AND organization_id = $2 AND deleted_at IS NULL", email, organizationID)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 	return user, nil
 }
 
-func (r *PostgresUserRepository) UpdateUser(id uuid.UUID, updates *models.UpdateProfileRequest) (*models.User, error) {
+func (r *PostgresUserRepository) UpdateUser(ctx context.Context, id uuid.UUID, updates *models.UpdateProfileRequest, expectedVersion int64) (before, after *models.User, err error) {
+	return r.PatchUser(ctx, id, updates.ToPatch(), expectedVersion)
+}
+
+func (r *PostgresUserRepository) PatchUser(ctx context.Context, id uuid.UUID, patch *models.UserPatch, expectedVersion int64) (before, after *models.User, err error) {
+	ctx, span := startSpan(ctx, "PatchUser")
+	defer func() { tracing.End(span, err) }()
+
+	for attempt := 1; ; attempt++ {
+		before, after, err = r.patchUserOnce(ctx, id, patch, expectedVersion)
+		if errors.Is(err, ErrVersionMismatch) && expectedVersion == 0 && attempt < maxUpdateAttempts {
+			// Someone else wrote in between our read and write; re-apply the
+			// patch on top of their changes instead of overwriting them.
+			continue
+		}
+		span.SetAttributes(attribute.Int("db.attempts", attempt))
+		return before, after, err
+	}
+}
+
+// patchUserOnce performs one read-modify-write cycle guarded by the version
+// that was read. Because the write only succeeds if that version is still
+// current, the user as read is exactly the state the write replaced.
+func (r *PostgresUserRepository) patchUserOnce(ctx context.Context, id uuid.UUID, patch *models.UserPatch, expectedVersion int64) (*models.User, *models.User, error) {
 	// Get current user
-	user, err := r.GetUserByID(id)
+	user, err := r.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if expectedVersion != 0 && user.Version != expectedVersion {
+		return nil, nil, ErrVersionMismatch
 	}
+	before := *user
 
-	// Apply updates
-	if updates.FirstName != "" {
-		user.FirstName = updates.FirstName
+	// Apply patch
+	if patch.FirstName.Set {
+		user.FirstName = patch.FirstName.Value
 	}
-	if updates.LastName != "" {
-		user.LastName = updates.LastName
+	if patch.LastName.Set {
+		user.LastName = patch.LastName.Value
 	}
-	if updates.PhoneNumber != "" {
-		user.PhoneNumber = sql.NullString{String: updates.PhoneNumber, Valid: true}
+	phoneChanged := false
+	if patch.PhoneNumber.Set {
+		phone := sql.NullString{String: patch.PhoneNumber.Value, Valid: !patch.PhoneNumber.Null}
+		if phone != user.PhoneNumber {
+			// A new number has to be verified again
+			phoneChanged = true
+			user.PhoneVerifiedAt = sql.NullTime{}
+		}
+		user.PhoneNumber = phone
 	}
-	if updates.Email != "" && updates.Email != user.Email {
+	if patch.Email.Set && patch.Email.Value != user.Email {
 		// Check if email is already taken
 		var count int
-		err := r.db.Get(&count, "SELECT COUNT(*) FROM users WHERE email = $1 AND id != $2", updates.Email, id)
+		err := retry(ctx, "PatchUser", func() error {
+			return r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE email = $1 AND id != $2 AND organization_id = $3 AND deleted_at IS NULL", patch.Email.Value, id, user.OrganizationID)
+		})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if count > 0 {
-			return nil, errors.New("email already in use")
+			return nil, nil, ErrEmailInUse
 		}
-		user.Email = updates.Email
+		user.Email = patch.Email.Value
 	}
 
 	user.UpdatedAt = time.Now()
 
-	// Save updates
-	_, err = r.db.NamedExec(`
-		UPDATE users 
-		SET first_name = :first_name, 
-			last_name = :last_name, 
-			email = :email, 
-			phone_number = :phone_number,
-			updated_at = :updated_at
-		WHERE id = :id
-	`, user)
+	read := user.Version
+	err = inTx(ctx, r.db, "PatchUser", func(tx *sqlx.Tx) error {
+		// Save updates only if nobody else has written since we read the
+		// row; a retried attempt starts again from the version read
+		user.Version = read
+		result, err := tx.NamedExecContext(ctx, `
+			UPDATE users 
+			SET first_name = :first_name, 
+				last_name = :last_name, 
+				email = :email, 
+				phone_number = :phone_number,
+				phone_verified_at = :phone_verified_at,
+				updated_at = :updated_at,
+				version = version + 1
+			WHERE id = :id AND organization_id = :organization_id AND version = :version AND deleted_at IS NULL
+		`, user)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+
+		if phoneChanged {
+			// Codes sent to the old number must not verify the new one
+			_, err := tx.ExecContext(ctx, "DELETE FROM one_time_codes WHERE user_id = $1 AND purpose = $2",
+				user.ID, models.CodePurposePhoneVerification)
+			if err != nil {
+				return err
+			}
+		}
+
+		user.Version++
+		return writeEvent(ctx, tx, user, events.UserProfileUpdated, models.NewUserResponse(user))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &before, user, nil
+}
+
+func (r *PostgresUserRepository) ListUsers(ctx context.Context, limit, offset int) (users []*models.User, err error) {
+	ctx, span := startSpan(ctx, "ListUsers")
+	defer func() { tracing.End(span, err) }()
 
+	organizationID, err := tenant.Require(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	users = []*models.User{}
+	err = retry(ctx, "ListUsers", func() error {
+		return r.db.SelectContext(ctx, &users, "SELECT * FROM users WHERE organization_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC LIMIT $2 OFFSET $3", organizationID, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
 }
 
-func (r *PostgresUserRepository) ListUsers(limit, offset int) ([]*models.User, error) {
+// DeleteUser soft deletes a user. The row is kept until PurgeDeletedUsers
+// removes it, so the account can be restored in the meantime.
+func (r *PostgresUserRepository) DeleteUser(ctx context.Context, id uuid.UUID, expectedVersion int64) (err error) {
+	ctx, span := startSpan(ctx, "DeleteUser")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, r.db, "DeleteUser", func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE users
+			SET deleted_at = NOW(),
+				updated_at = NOW(),
+				version = version + 1
+			WHERE id = $1 AND organization_id = $3 AND deleted_at IS NULL AND ($2::bigint = 0 OR version = $2::bigint)
+		`, id, expectedVersion, organizationID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			if expectedVersion != 0 {
+				// Tell a stale precondition apart from a missing user
+				if _, err := r.GetUserByID(ctx, id); err == nil {
+					return ErrVersionMismatch
+				}
+			}
+			return ErrUserNotFound
+		}
+
+		deleted := &models.User{ID: id, OrganizationID: organizationID}
+		return writeEvent(ctx, tx, deleted, events.UserDeleted, map[string]uuid.UUID{"id": id})
+	})
+}
+
+func (r *PostgresUserRepository) ListDeletedUsers(ctx context.Context, limit, offset int) (users []*models.User, err error) {
+	ctx, span := startSpan(ctx, "ListDeletedUsers")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	if limit <= 0 {
 		limit = 10
 	}
@@ -183,60 +409,196 @@ func (r *PostgresUserRepository) ListUsers(limit, offset int) ([]*models.User, e
 		offset = 0
 	}
 
-	log.Printf("Executing ListUsers query with limit: %d, offset: %d", limit, offset)
+	users = []*models.User{}
+	err = retry(ctx, "ListDeletedUsers", func() error {
+		return r.db.SelectContext(ctx, &users, "SELECT * FROM users WHERE organization_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC LIMIT $2 OFFSET $3", organizationID, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// RestoreUser undoes a soft delete. It fails with ErrEmailInUse when the email
+// has been taken by another account since the user was deleted.
+func (r *PostgresUserRepository) RestoreUser(ctx context.Context, id uuid.UUID) (user *models.User, err error) {
+	ctx, span := startSpan(ctx, "RestoreUser")
+	defer func() { tracing.End(span, err) }()
 
-	users := []*models.User{}
-	err := r.db.Select(&users, "SELECT * FROM users ORDER BY created_at DESC LIMIT $1 OFFSET $2", limit, offset)
+	organizationID, err := tenant.Require(ctx)
 	if err != nil {
-		log.Printf("Database error in ListUsers: %v", err)
 		return nil, err
 	}
 
-	log.Printf("Successfully retrieved %d users from database", len(users))
-	return users, nil
+	err = inTx(ctx, r.db, "RestoreUser", func(tx *sqlx.Tx) error {
+		user = &models.User{}
+		err := tx.GetContext(ctx, user, "SELECT * FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NOT NULL FOR UPDATE", id, organizationID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		var count int
+		err = tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE email = $1 AND id != $2 AND organization_id = $3 AND deleted_at IS NULL", user.Email, id, organizationID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrEmailInUse
+		}
+
+		user.DeletedAt = sql.NullTime{}
+		user.UpdatedAt = time.Now()
+		user.Version++
+		_, err = tx.ExecContext(ctx, "UPDATE users SET deleted_at = NULL, updated_at = $1, version = version + 1 WHERE id = $2", user.UpdatedAt, id)
+		if err != nil {
+			return err
+		}
+
+		return writeEvent(ctx, tx, user, events.UserRestored, models.NewUserResponse(user))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func (r *PostgresUserRepository) DeleteUser(id uuid.UUID) error {
-	result, err := r.db.Exec("DELETE FROM users WHERE id = $1", id)
+func (r *PostgresUserRepository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, phoneNumber string) (user *models.User, err error) {
+	ctx, span := startSpan(ctx, "MarkPhoneVerified")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = inTx(ctx, r.db, "MarkPhoneVerified", func(tx *sqlx.Tx) error {
+		user = &models.User{}
+		err := tx.GetContext(ctx, user, "SELECT * FROM users WHERE id = $1 AND organization_id = $2 AND deleted_at IS NULL FOR UPDATE", id, organizationID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		if !user.PhoneNumber.Valid || user.PhoneNumber.String != phoneNumber {
+			return ErrPhoneChanged
+		}
+
+		user.PhoneVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		user.UpdatedAt = user.PhoneVerifiedAt.Time
+		user.Version++
+		_, err = tx.ExecContext(ctx, "UPDATE users SET phone_verified_at = $1, updated_at = $1, version = version + 1 WHERE id = $2",
+			user.PhoneVerifiedAt.Time, id)
+		if err != nil {
+			return err
+		}
+
+		return writeEvent(ctx, tx, user, events.UserPhoneVerified, models.NewUserResponse(user))
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return user, nil
+}
+
+// PurgeDeletedUsers permanently removes users soft deleted before the given
+// time. It is maintenance across every organization and ignores the tenant.
+func (r *PostgresUserRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (purged int64, err error) {
+	ctx, span := startSpan(ctx, "PurgeDeletedUsers")
+	defer func() { tracing.End(span, err) }()
+
+	err = retry(ctx, "PurgeDeletedUsers", func() error {
+		result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1", deletedBefore)
+		if err != nil {
+			return err
+		}
+		purged, err = result.RowsAffected()
+		return err
+	})
+	return purged, err
+}
 
-	if rowsAffected == 0 {
-		return errors.New("user not found")
+// writeEvent records a lifecycle event about user in the outbox as part of tx,
+// so the event exists exactly when the change it describes commits
+func writeEvent(ctx context.Context, tx *sqlx.Tx, user *models.User, eventType string, data interface{}) error {
+	event, err := events.New(eventType, data)
+	if err != nil {
+		return err
 	}
+	event.OrganizationID = user.OrganizationID
+	return outbox.Write(ctx, tx, user.ID, event)
+}
+
+// startSpan starts a client span for one user repository operation
+func startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return startRepositorySpan(ctx, "UserRepository", operation)
+}
+
+// startRepositorySpan starts a client span for one operation of repository
+func startRepositorySpan(ctx context.Context, repository, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, repository+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+}
 
-	return nil
+// hashPassword hashes a new user's password inside its own span, since
+// bcrypt dominates the cost of creating a user
+func (r *PostgresUserRepository) hashPassword(ctx context.Context, password string) (hash string, err error) {
+	_, span := tracing.Tracer().Start(ctx, "bcrypt.hash")
+	defer func() { tracing.End(span, err) }()
+	return r.hasher.HashPassword(password)
 }
 
 func (r *PostgresUserRepository) Close() error {
 	return r.db.Close()
 }
 
-func (r *PostgresUserRepository) UpdatePassword(id uuid.UUID, passwordHash string) error {
-	_, err := r.db.Exec(`
-		UPDATE users 
-		SET password_hash = $1,
-			updated_at = NOW()
-		WHERE id = $2
-	`, passwordHash, id)
-	return err
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) (err error) {
+	ctx, span := startSpan(ctx, "UpdatePassword")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+
+	return retry(ctx, "UpdatePassword", func() error {
+		_, err := r.db.ExecContext(ctx, `
+			UPDATE users 
+			SET password_hash = $1,
+				updated_at = NOW(),
+				version = version + 1
+			WHERE id = $2 AND organization_id = $3 AND deleted_at IS NULL
+		`, passwordHash, id, organizationID)
+		return err
+	})
 }
 
-func (r *PostgresUserRepository) GetUsers(ctx context.Context, page, pageSize int) ([]*models.User, int, error) {
+func (r *PostgresUserRepository) GetUsers(ctx context.Context, page, pageSize int) (users []*models.User, total int, err error) {
+	ctx, span := startSpan(ctx, "GetUsers")
+	defer func() { tracing.End(span, err) }()
+
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	offset := (page - 1) * pageSize
-	users, err := r.ListUsers(pageSize, offset)
+	users, err = r.ListUsers(ctx, pageSize, offset)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	var total int
-	err = r.db.Get(&total, "SELECT COUNT(*) FROM users")
+	err = retry(ctx, "GetUsers", func() error {
+		return r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users WHERE organization_id = $1 AND deleted_at IS NULL", organizationID)
+	})
 	if err != nil {
 		return nil, 0, err
 	}
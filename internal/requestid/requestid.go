@@ -0,0 +1,46 @@
+// Package requestid generates and validates the correlation IDs that tie a
+// request's logs, audit records and downstream calls together.
+package requestid
+
+import (
+	"github.com/google/uuid"
+)
+
+const (
+	// Header carries the request ID on HTTP requests and responses
+	Header = "X-Request-ID"
+	// MetadataKey carries the request ID in gRPC metadata
+	MetadataKey = "x-request-id"
+
+	maxLength = 128
+)
+
+// New returns a fresh request ID
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether a caller-supplied ID is safe to adopt: non-empty,
+// at most 128 characters and limited to letters, digits and -_.:/+=
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '/', r == '+', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve returns id when it is valid and a new ID otherwise
+func Resolve(id string) string {
+	if Valid(id) {
+		return id
+	}
+	return New()
+}
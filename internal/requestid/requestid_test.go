@@ -0,0 +1,36 @@
+package requestid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"3f1c2a9e-5d4b-4c6f-9a1e-2b7d8c0e4f11", true},
+		{"req_01HZX3.trace:7/abc+def=", true},
+		{"", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{"<script>", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Valid(tt.id), "%q", tt.id)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert.Equal(t, "abc-123", Resolve("abc-123"))
+
+	generated := Resolve("bad id")
+	assert.NotEqual(t, "bad id", generated)
+	assert.True(t, Valid(generated))
+	assert.NotEqual(t, generated, Resolve(""))
+}
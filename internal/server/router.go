@@ -1,65 +1,185 @@
 package server
 
 import (
-	"github.com/atulsm/user-service/internal/config"
 	"github.com/atulsm/user-service/internal/handlers"
+	"github.com/atulsm/user-service/internal/logging"
+	"github.com/atulsm/user-service/internal/metrics"
 	"github.com/atulsm/user-service/internal/middleware"
-	"github.com/atulsm/user-service/internal/repository"
-	"github.com/atulsm/user-service/pkg/utils"
+	"github.com/atulsm/user-service/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRouter initializes and returns the Gin router with all routes configured
-func SetupRouter() (*gin.Engine, error) {
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		return nil, err
-	}
-
-	// Initialize repository
-	repo := repository.NewUserRepository(cfg.DatabaseURL)
+// routes builds the HTTP API. This is the only route table; everything is
+// served under /api/v1.
+func (s *Server) routes() *gin.Engine {
+	router := gin.New()
 
-	// Initialize router
-	router := gin.Default()
+	// Probes come before the global middleware, which only applies to routes
+	// registered after it, so kubelet checks from the node's IP are never
+	// rate limited or refused by CORS
+	router.GET("/livez", s.health.LiveHandler())
+	router.GET("/readyz", s.health.ReadyHandler())
 
 	// Apply global middleware
+	router.Use(middleware.RequestID())
 	router.Use(gin.Recovery())
-	router.Use(gin.Logger())
-	router.Use(middleware.CORSMiddleware())
+	router.Use(tracing.GinMiddleware())
+	router.Use(logging.GinMiddleware())
+	router.Use(metrics.GinMiddleware())
+	router.Use(s.cors.Handler())
+	router.Use(s.limiter.Handler())
 
 	// Initialize handlers with all required dependencies
-	userHandler := handlers.NewUserHandler(
-		repo,
-		middleware.NewTokenGenerator(cfg.JWTSecret),
-		utils.NewPasswordHasher(),
-	)
+	userOptions := []handlers.Option{
+		handlers.WithAuditor(s.audit),
+		handlers.WithOrganizations(s.orgs),
+	}
+	if s.cfg.JWTGroupClaims {
+		userOptions = append(userOptions, handlers.WithGroupClaims(s.groups))
+	}
+	signedTokens := middleware.NewSignedTokens(s.jwtKeys)
+	userOptions = append(userOptions, handlers.WithMagicLinks(s.codes, signedTokens, s.notifier, handlers.MagicLinkSettings{
+		TTL:            s.cfg.MagicLinkTTL,
+		URL:            s.cfg.MagicLinkURL,
+		MaxAttempts:    s.cfg.MagicLinkMaxAttempts,
+		ResendInterval: s.cfg.MagicLinkResendInterval,
+	}))
+	userOptions = append(userOptions, handlers.WithFederation(s.idps, s.relyingParty, handlers.FederationSettings{
+		CallbackURL: s.cfg.SSOCallbackURL,
+		LoginTTL:    s.cfg.SSOLoginTTL,
+	}))
+	tokenGen := middleware.NewTokenGenerator(s.jwtKeys, s.cfg.AccessTokenTTL)
+	userHandler := handlers.NewUserHandler(s.users, tokenGen, s.hasher, userOptions...)
+	organizationHandler := handlers.NewOrganizationHandler(s.orgs, s.audit)
+	groupHandler := handlers.NewGroupHandler(s.groups, s.users, s.audit)
+	invitationHandler := handlers.NewInvitationHandler(s.invites, signedTokens, tokenGen, s.notifier, s.audit,
+		handlers.InvitationSettings{TTL: s.cfg.InvitationTTL, AcceptURL: s.cfg.InvitationURL})
+	phoneHandler := handlers.NewPhoneHandler(s.users, s.codes, s.notifier, s.audit, handlers.PhoneSettings{
+		CodeTTL:        s.cfg.PhoneCodeTTL,
+		MaxAttempts:    s.cfg.PhoneCodeMaxAttempts,
+		ResendInterval: s.cfg.PhoneCodeResendInterval,
+	})
+	oauthHandler := handlers.NewOAuthHandler(s.oauth, s.users, s.oidcSigner, s.audit, handlers.OAuthSettings{
+		Issuer:         s.cfg.OIDCIssuer,
+		ConsentURL:     s.cfg.OIDCConsentURL,
+		CodeTTL:        s.cfg.OIDCCodeTTL,
+		AccessTokenTTL: s.cfg.OIDCAccessTokenTTL,
+	})
+	oauthClientHandler := handlers.NewOAuthClientHandler(s.oauth, s.audit)
+	identityProviderHandler := handlers.NewIdentityProviderHandler(s.idps, s.audit)
+	auditHandler := handlers.NewAuditHandler(s.audit)
+	webhookHandler := handlers.NewWebhookHandler(s.webhooks)
+
+	requireAuth := middleware.AuthMiddleware(s.jwtKeys)
+	// Changing or deleting an account other than your own takes an admin
+	requireSelfOrAdmin := middleware.RequireSelfOrAdmin(s.users, "id")
 
 	// Public routes
-	router.POST("/api/v1/auth/register", userHandler.Register)
-	router.POST("/api/v1/auth/login", userHandler.Login)
-	router.POST("/api/v1/auth/reset-password", userHandler.ResetPassword)
-	router.GET("/users/:id", userHandler.GetUser)
-	router.GET("/users", userHandler.ListUsers)
+	public := router.Group("/api/v1")
+	{
+		public.POST("/auth/register", userHandler.Register)
+		public.POST("/auth/login", userHandler.Login)
+		public.POST("/auth/reset-password", userHandler.ResetPassword)
+		public.POST("/auth/magic-link", userHandler.RequestMagicLink)
+		public.POST("/auth/magic-link/verify", userHandler.MagicLinkLogin)
+		public.GET("/auth/sso/providers", userHandler.ListSignInProviders)
+		public.POST("/auth/sso/login", userHandler.StartFederatedLogin)
+		public.POST("/auth/sso/callback", userHandler.FederatedLogin)
+		public.POST("/invitations/accept", invitationHandler.AcceptInvitation)
+
+		// OpenID Connect provider; /api/v1 is the issuer
+		public.GET("/.well-known/openid-configuration", oauthHandler.Discovery)
+		public.GET("/.well-known/jwks.json", oauthHandler.JWKS)
+		public.GET("/oauth/authorize", oauthHandler.Authorize)
+		public.POST("/oauth/token", oauthHandler.Token)
+		public.GET("/oauth/userinfo", oauthHandler.UserInfo)
+		public.POST("/oauth/userinfo", oauthHandler.UserInfo)
+		public.POST("/oauth/introspect", oauthHandler.Introspect)
+		public.POST("/oauth/revoke", oauthHandler.Revoke)
+	}
 
 	// Protected routes
 	authorized := router.Group("/api/v1")
-	authorized.Use(middleware.AuthMiddleware())
+	authorized.Use(requireAuth)
 	{
 		authorized.GET("/users/profile", userHandler.GetProfile)
 		authorized.PUT("/users/profile", userHandler.UpdateProfile)
+		authorized.PATCH("/users/profile", userHandler.PatchProfile)
+		authorized.POST("/users/profile/phone/verification", phoneHandler.SendVerification)
+		authorized.POST("/users/profile/phone/verification/confirm", phoneHandler.ConfirmVerification)
+		authorized.GET("/users/profile/identities", userHandler.ListIdentities)
+		authorized.DELETE("/users/profile/identities/:id", userHandler.UnlinkIdentity)
 		authorized.GET("/users", userHandler.ListUsers)
-		authorized.POST("/users", userHandler.CreateUser)
-		authorized.PUT("/users/:id", userHandler.UpdateUser)
-		authorized.DELETE("/users/:id", userHandler.DeleteUser)
+		authorized.GET("/users/:id", userHandler.GetUser)
+		authorized.PUT("/users/:id", requireSelfOrAdmin, userHandler.UpdateUser)
+		authorized.PATCH("/users/:id", requireSelfOrAdmin, userHandler.PatchUser)
+		authorized.DELETE("/users/:id", requireSelfOrAdmin, userHandler.DeleteUser)
 		authorized.POST("/auth/logout", userHandler.Logout)
+		authorized.GET("/organization", organizationHandler.GetCurrent)
+		authorized.GET("/oauth/consent", oauthHandler.AuthorizationPrompt)
+		authorized.POST("/oauth/consent", oauthHandler.Decide)
+
+		authorized.GET("/users/:id/groups", groupHandler.ListUserGroups)
+		authorized.POST("/groups", groupHandler.CreateGroup)
+		authorized.GET("/groups", groupHandler.ListGroups)
+		authorized.GET("/groups/:id", groupHandler.GetGroup)
+		authorized.PUT("/groups/:id", groupHandler.UpdateGroup)
+		authorized.DELETE("/groups/:id", groupHandler.DeleteGroup)
+		authorized.GET("/groups/:id/members", groupHandler.ListMembers)
+		authorized.PUT("/groups/:id/members/:userId", groupHandler.SetMember)
+		authorized.DELETE("/groups/:id/members/:userId", groupHandler.RemoveMember)
+		authorized.GET("/groups/:id/subgroups", groupHandler.ListSubgroups)
+		authorized.PUT("/groups/:id/subgroups/:childId", groupHandler.AddSubgroup)
+		authorized.DELETE("/groups/:id/subgroups/:childId", groupHandler.RemoveSubgroup)
 	}
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Admin routes
+	admin := router.Group("/api/v1")
+	admin.Use(requireAuth, middleware.RequireAdmin(s.users))
+	{
+		admin.POST("/users", userHandler.CreateUser)
+		admin.GET("/users/deleted", userHandler.ListDeletedUsers)
+		admin.POST("/users/:id/restore", userHandler.RestoreUser)
+		admin.GET("/audit", auditHandler.ListEvents)
+
+		admin.POST("/invitations", invitationHandler.CreateInvitation)
+		admin.GET("/invitations", invitationHandler.ListInvitations)
+		admin.GET("/invitations/:id", invitationHandler.GetInvitation)
+		admin.POST("/invitations/:id/resend", invitationHandler.ResendInvitation)
+		admin.DELETE("/invitations/:id", invitationHandler.RevokeInvitation)
+
+		admin.POST("/oauth/clients", oauthClientHandler.CreateClient)
+		admin.GET("/oauth/clients", oauthClientHandler.ListClients)
+		admin.GET("/oauth/clients/:id", oauthClientHandler.GetClient)
+		admin.PUT("/oauth/clients/:id", oauthClientHandler.UpdateClient)
+		admin.DELETE("/oauth/clients/:id", oauthClientHandler.DeleteClient)
+
+		admin.POST("/identity-providers", identityProviderHandler.CreateProvider)
+		admin.GET("/identity-providers", identityProviderHandler.ListProviders)
+		admin.GET("/identity-providers/:id", identityProviderHandler.GetProvider)
+		admin.PUT("/identity-providers/:id", identityProviderHandler.UpdateProvider)
+		admin.DELETE("/identity-providers/:id", identityProviderHandler.DeleteProvider)
+
+		admin.POST("/webhooks", webhookHandler.CreateSubscription)
+		admin.GET("/webhooks", webhookHandler.ListSubscriptions)
+		admin.GET("/webhooks/:id", webhookHandler.GetSubscription)
+		admin.PUT("/webhooks/:id", webhookHandler.UpdateSubscription)
+		admin.DELETE("/webhooks/:id", webhookHandler.DeleteSubscription)
+		admin.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+		admin.GET("/webhooks/:id/deliveries/:deliveryId/attempts", webhookHandler.ListAttempts)
+		admin.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", webhookHandler.Redeliver)
+	}
+
+	// Platform admin routes, for admins of the default organization
+	platform := router.Group("/api/v1")
+	platform.Use(requireAuth, middleware.RequireAdmin(s.users), middleware.RequirePlatformAdmin())
+	{
+		platform.POST("/organizations", organizationHandler.CreateOrganization)
+		platform.GET("/organizations", organizationHandler.ListOrganizations)
+		platform.GET("/organizations/:id", organizationHandler.GetOrganization)
+		platform.PUT("/organizations/:id", organizationHandler.UpdateOrganization)
+	}
 
-	return router, nil
+	return router
 }
@@ -0,0 +1,405 @@
+// Package server assembles the service. A Server owns the configuration,
+// database pool, repositories, the HTTP, gRPC and metrics servers and the
+// background workers, and shuts them down in order. The binary and the API
+// tests build it the same way.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atulsm/user-service/db/migrations"
+	"github.com/atulsm/user-service/internal/audit"
+	"github.com/atulsm/user-service/internal/config"
+	usergrpc "github.com/atulsm/user-service/internal/grpc"
+	"github.com/atulsm/user-service/internal/health"
+	"github.com/atulsm/user-service/internal/metrics"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/migrate"
+	"github.com/atulsm/user-service/internal/notify"
+	"github.com/atulsm/user-service/internal/oidc"
+	"github.com/atulsm/user-service/internal/outbox"
+	"github.com/atulsm/user-service/internal/purger"
+	"github.com/atulsm/user-service/internal/reload"
+	"github.com/atulsm/user-service/internal/repository"
+	"github.com/atulsm/user-service/internal/webhook"
+	"github.com/atulsm/user-service/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// smsGatewayTimeout bounds a single request to the SMS gateway
+const smsGatewayTimeout = 10 * time.Second
+
+// Server is the assembled application
+type Server struct {
+	cfg *config.Config
+	db  *sqlx.DB
+
+	hasher   *utils.PasswordHasher
+	users    *repository.PostgresUserRepository
+	orgs     *repository.PostgresOrganizationRepository
+	groups   *repository.PostgresGroupRepository
+	invites  *repository.PostgresInvitationRepository
+	codes    *repository.PostgresCodeRepository
+	oauth    *repository.PostgresOAuthRepository
+	idps     *repository.PostgresIdentityRepository
+	notifier notify.Notifier
+	audit    *audit.PostgresStore
+	webhooks *webhook.PostgresStore
+	outbox   *outbox.PostgresStore
+	migrator *migrate.Migrator
+	health   *health.Registry
+
+	// Components that follow configuration reloads
+	reloader *reload.Reloader
+	cors     *middleware.CORS
+	limiter  *middleware.RateLimiter
+	jwtKeys  *middleware.JWTKeys
+	// oidcSigner signs the ID tokens of the OpenID Connect provider
+	oidcSigner *oidc.Signer
+	// relyingParty signs users in with external identity providers
+	relyingParty *oidc.RelyingParty
+
+	// started is set once the database is reachable and its schema current
+	started atomic.Bool
+
+	router     *gin.Engine
+	grpc       *usergrpc.Server
+	purger     *purger.Purger
+	dispatcher *webhook.Dispatcher
+	relay      *outbox.Relay
+	// notifications is the queue behind notifier
+	notifications *notify.Queue
+}
+
+// New opens the database pool and wires every component. It does not wait
+// for the database: Run starts serving straight away and reports ready once
+// the database answers and its schema is current.
+func New(ctx context.Context, cfg *config.Config) (*Server, error) {
+	if cfg.InsecureDevMode {
+		slog.Warn("Insecure development mode is enabled; never use it in production")
+	}
+	if cfg.OIDCSigningKey == "" {
+		slog.Warn("OIDC_SIGNING_KEY is not set; ID tokens are signed with a generated key that changes on every restart")
+	}
+
+	db, err := repository.Open(cfg.DatabaseURL, repository.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	s, err := newServer(cfg, db, migrator)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// newServer wires the components. db and migrator may be nil in tests that
+// never reach the database; the dependency health checks are then skipped.
+func newServer(cfg *config.Config, db *sqlx.DB, migrator *migrate.Migrator) (*Server, error) {
+	s := &Server{
+		cfg:      cfg,
+		db:       db,
+		hasher:   utils.NewPasswordHasherWithCost(cfg.BcryptCost),
+		audit:    audit.NewPostgresStore(db),
+		webhooks: webhook.NewPostgresStore(db),
+		outbox:   outbox.NewPostgresStore(db),
+		migrator: migrator,
+		health:   health.NewRegistry(cfg.HealthCheckTimeout),
+	}
+	s.users = repository.NewPostgresUserRepository(db, repository.WithPasswordHasher(s.hasher))
+	s.orgs = repository.NewPostgresOrganizationRepository(s.users)
+	s.groups = repository.NewPostgresGroupRepository(db)
+	s.invites = repository.NewPostgresInvitationRepository(s.users)
+	s.codes = repository.NewPostgresCodeRepository(db)
+	s.oauth = repository.NewPostgresOAuthRepository(db)
+	s.idps = repository.NewPostgresIdentityRepository(s.users)
+	s.notifications = notify.NewQueue(notifier(cfg), cfg.NotifyQueueSize, cfg.NotifyMaxAttempts)
+	s.notifier = s.notifications
+
+	s.cors = middleware.NewCORS(corsPolicy(cfg))
+	s.limiter = middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	s.jwtKeys = middleware.NewJWTKeys(cfg.JWTSecret, cfg.JWTPreviousSecrets...)
+	signer, err := oidc.NewSigner(cfg.OIDCSigningKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OIDC signer: %w", err)
+	}
+	s.oidcSigner = signer
+	s.relyingParty = oidc.NewRelyingParty(nil)
+	s.reloader = reload.New(cfg, func() (*config.Config, error) { return config.LoadFile(cfg.File) })
+	s.reloader.Register("CORS", func(cfg *config.Config) error {
+		s.cors.Update(corsPolicy(cfg))
+		return nil
+	})
+	s.reloader.Register("rate limiter", func(cfg *config.Config) error {
+		s.limiter.Update(cfg.RateLimitRPS, cfg.RateLimitBurst)
+		return nil
+	})
+	s.reloader.Register("JWT keys", func(cfg *config.Config) error {
+		s.jwtKeys.Set(cfg.JWTSecret, cfg.JWTPreviousSecrets...)
+		return nil
+	})
+
+	s.purger = purger.New(s.users, cfg.SoftDeleteRetention, cfg.PurgeInterval)
+	s.dispatcher = webhook.NewDispatcher(s.webhooks, webhook.NewHTTPClient(cfg.WebhookTimeout),
+		cfg.WebhookMaxAttempts, cfg.WebhookPollInterval)
+	// The repository writes events to the outbox; the relay hands them to
+	// the webhook dispatcher
+	s.relay = outbox.NewRelay(s.outbox, s.dispatcher, cfg.OutboxPollInterval)
+
+	s.registerHealthChecks()
+	s.grpc = usergrpc.NewServer(s.users, s.groups, s.jwtKeys, s.audit)
+	s.router = s.routes()
+	// Without trusted proxies gin would believe X-Forwarded-For from anyone,
+	// letting clients pick the IP they are rate limited and audited as
+	if err := s.router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	return s, nil
+}
+
+// registerHealthChecks adds the dependencies readiness depends on
+func (s *Server) registerHealthChecks() {
+	s.health.Register("jwt_keys", func(ctx context.Context) (string, error) {
+		if s.jwtKeys.Signing() == "" {
+			return "", errors.New("no signing key")
+		}
+		return fmt.Sprintf("%d verification keys", len(s.jwtKeys.Verification())), nil
+	})
+	if s.db == nil {
+		return
+	}
+
+	s.health.Register("startup", func(ctx context.Context) (string, error) {
+		if !s.started.Load() {
+			return "", errors.New("waiting for the database")
+		}
+		return "", nil
+	})
+	s.health.Register("database", func(ctx context.Context) (string, error) {
+		if err := s.db.PingContext(ctx); err != nil {
+			return "", err
+		}
+		stats := s.db.Stats()
+		return fmt.Sprintf("%d open connections, %d in use", stats.OpenConnections, stats.InUse), nil
+	})
+	s.health.Register("migrations", func(ctx context.Context) (string, error) {
+		if err := s.migrator.Check(ctx); err != nil {
+			return "", err
+		}
+		all := s.migrator.Migrations()
+		return fmt.Sprintf("schema at version %d", all[len(all)-1].Version), nil
+	})
+	// Every replica relays the same outbox, so a stuck event would make them
+	// all unready at once; lag is reported without gating readiness
+	s.health.RegisterInformational("outbox", func(ctx context.Context) (string, error) {
+		lag, err := s.outbox.Lag(ctx, time.Now())
+		if err != nil {
+			return "", err
+		}
+		lag = lag.Round(time.Second)
+		if lag > s.cfg.OutboxMaxLag {
+			return "", fmt.Errorf("oldest unpublished event is %s old, over the %s limit", lag, s.cfg.OutboxMaxLag)
+		}
+		return fmt.Sprintf("lag %s", lag), nil
+	})
+}
+
+// notifier returns the transports that deliver messages to users, by channel
+func notifier(cfg *config.Config) notify.Notifier {
+	var file *notify.File
+	if cfg.NotifyTransport == "file" || cfg.SMSTransport == "file" {
+		// Email and SMS share the file, and its lock
+		file = notify.NewFile(cfg.NotifyFile)
+	}
+
+	var email notify.Notifier = notify.Log{}
+	switch cfg.NotifyTransport {
+	case "smtp":
+		email = notify.NewSMTP(notify.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.NotifyFrom,
+		})
+	case "file":
+		email = file
+	}
+
+	var sms notify.Notifier = notify.Log{}
+	switch cfg.SMSTransport {
+	case "gateway":
+		sms = notify.NewSMSGateway(notify.SMSGatewayConfig{
+			URL:   cfg.SMSGatewayURL,
+			Token: cfg.SMSGatewayToken,
+			From:  cfg.SMSFrom,
+		}, &http.Client{Timeout: smsGatewayTimeout})
+	case "file":
+		sms = file
+	}
+
+	return notify.Channels{notify.Email: email, notify.SMS: sms}
+}
+
+// corsPolicy is the CORS part of cfg
+func corsPolicy(cfg *config.Config) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		AllowedHeaders: cfg.CORSAllowedHeaders,
+		AllowedMethods: cfg.CORSAllowedMethods,
+		ExposedHeaders: cfg.CORSExposedHeaders,
+		MaxAge:         cfg.CORSMaxAge,
+	}
+}
+
+// Handler returns the HTTP API, for serving or for tests
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Reloader returns the reloader applying configuration changes, so callers
+// can register components of their own
+func (s *Server) Reloader() *reload.Reloader {
+	return s.reloader
+}
+
+// Run serves the HTTP API, gRPC and metrics and runs the background workers
+// until ctx is cancelled or a server fails, then shuts everything down.
+func (s *Server) Run(ctx context.Context) error {
+	if err := metrics.RegisterDB(s.db.DB, "userservice"); err != nil {
+		return fmt.Errorf("failed to register database metrics: %w", err)
+	}
+
+	httpSrv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", s.cfg.Port),
+		Handler: s.router,
+	}
+
+	// Metrics are served on their own port so they are not exposed with the API
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	metricsSrv := &http.Server{
+		Addr:    fmt.Sprintf(":%s", s.cfg.MetricsPort),
+		Handler: metricsMux,
+	}
+
+	failed := make(chan error, 4)
+	serve := func(name string, fn func() error) {
+		go func() {
+			if err := fn(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				failed <- fmt.Errorf("%s server: %w", name, err)
+			}
+		}()
+	}
+	serve("HTTP", httpSrv.ListenAndServe)
+	serve("metrics", metricsSrv.ListenAndServe)
+	serve("gRPC", func() error { return s.grpc.Start(s.cfg.GRPCPort) })
+
+	slog.Info("Serving", "http_port", s.cfg.Port, "grpc_port", s.cfg.GRPCPort, "metrics_port", s.cfg.MetricsPort)
+
+	// Workers get their own context so they keep running while requests
+	// drain. They start once the database is up; until then /readyz fails.
+	workerCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	var workers sync.WaitGroup
+	startupDone := make(chan struct{})
+	go func() {
+		defer close(startupDone)
+		if err := s.start(workerCtx); err != nil {
+			failed <- err
+			return
+		}
+
+		watch := func(ctx context.Context) { s.reloader.Watch(ctx, s.cfg.File, s.cfg.ConfigWatchInterval) }
+		for _, run := range []func(context.Context){s.purger.Run, s.dispatcher.Run, s.relay.Run, s.notifications.Run, watch} {
+			workers.Add(1)
+			go func(run func(context.Context)) {
+				defer workers.Done()
+				run(workerCtx)
+			}(run)
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-failed:
+	}
+
+	// Fail readiness first so load balancers stop routing new requests here
+	// before the listeners close
+	s.health.SetDraining(true)
+	if s.cfg.ShutdownDrainDelay > 0 {
+		slog.Info("Draining", "delay", s.cfg.ShutdownDrainDelay)
+		time.Sleep(s.cfg.ShutdownDrainDelay)
+	}
+
+	slog.Info("Shutting down", "timeout", s.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("HTTP server shutdown: %w", err))
+	}
+	s.grpc.Stop()
+
+	stopWorkers()
+	<-startupDone
+	workers.Wait()
+
+	if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("metrics server shutdown: %w", err))
+	}
+	if err := s.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("database close: %w", err))
+	}
+	return errors.Join(runErr, errors.Join(errs...))
+}
+
+// start waits for the database and checks that its schema is one this
+// binary understands
+func (s *Server) start(ctx context.Context) error {
+	err := repository.WaitForDB(ctx, s.db, repository.ConnectRetry{
+		Timeout:        s.cfg.DBConnectTimeout,
+		InitialBackoff: s.cfg.DBConnectBackoff,
+		MaxBackoff:     s.cfg.DBConnectMaxBackoff,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Refuse to serve against a schema this binary does not understand
+	if err := s.migrator.Check(ctx); err != nil {
+		return fmt.Errorf("schema check failed: %w (run \"server migrate up\")", err)
+	}
+
+	s.started.Store(true)
+	slog.InfoContext(ctx, "Database is ready")
+	return nil
+}
+
+// Close releases the database pool of a Server that was never Run
+func (s *Server) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/config"
+	"github.com/atulsm/user-service/internal/middleware"
+	"github.com/atulsm/user-service/internal/requestid"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer wires a Server without a database; nothing here issues queries
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s, err := newServer(&config.Config{
+		JWTSecret:           "test-secret",
+		AccessTokenTTL:      time.Hour,
+		BcryptCost:          4,
+		SoftDeleteRetention: time.Hour,
+		PurgeInterval:       time.Hour,
+		WebhookMaxAttempts:  1,
+		WebhookPollInterval: time.Second,
+		WebhookTimeout:      time.Second,
+		OutboxPollInterval:  time.Second,
+		HealthCheckTimeout:  time.Second,
+	}, nil, nil)
+	require.NoError(t, err)
+	return s
+}
+
+func TestRoutesAreVersioned(t *testing.T) {
+	s := newTestServer(t)
+
+	routes := map[string]bool{}
+	for _, route := range s.router.Routes() {
+		routes[route.Method+" "+route.Path] = true
+		if route.Path != "/livez" && route.Path != "/readyz" {
+			assert.True(t, strings.HasPrefix(route.Path, "/api/v1/"), route.Path)
+		}
+	}
+
+	for _, want := range []string{
+		"POST /api/v1/auth/register",
+		"POST /api/v1/auth/login",
+		"GET /api/v1/users/profile",
+		"GET /api/v1/users/:id",
+		"GET /api/v1/users/deleted",
+		"GET /api/v1/audit",
+		"POST /api/v1/webhooks",
+	} {
+		assert.True(t, routes[want], "missing route %s", want)
+	}
+}
+
+func TestProtectedRoutesRequireValidToken(t *testing.T) {
+	s := newTestServer(t)
+
+	foreign, err := middleware.NewTokenGenerator(middleware.NewJWTKeys("some-other-secret"), time.Hour).GenerateToken("3f1c2a9e-5d4b-4c6f-9a1e-2b7d8c0e4f11", tenant.DefaultOrganizationID.String())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"no token", ""},
+		{"placeholder token", "Bearer dummy-token"},
+		{"token signed with another secret", "Bearer " + foreign},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/profile", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			s.Handler().ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, w.Header().Get(requestid.Header), body["requestId"])
+		})
+	}
+}
+
+func TestLegacyRoutesAreGone(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, path := range []string{"/api/users/login", "/api/users/profile", "/users"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	s := newTestServer(t)
+
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := get("/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["status"])
+
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body["checks"], "jwt_keys")
+
+	// Readiness fails while draining; liveness does not
+	s.health.SetDraining(true)
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, true, body["draining"])
+	code, _ = get("/livez")
+	assert.Equal(t, http.StatusOK, code)
+
+	// Probes are exempt from the rate limit the API is subject to
+	s.limiter.Update(1, 1)
+	for i := 0; i < 3; i++ {
+		code, _ = get("/livez")
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+	}
+	code, _ = get("/api/v1/groups")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = get("/api/v1/groups")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+}
+
+func TestRateLimitIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	s := newTestServer(t)
+	s.limiter.Update(1, 1)
+
+	// Each request claims a different client; without trusted proxies they
+	// all come from the peer address and share its bucket
+	codes := []int{}
+	for _, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/groups", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusTooManyRequests}, codes)
+}
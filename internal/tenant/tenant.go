@@ -0,0 +1,45 @@
+// Package tenant carries the organization a request acts in. The
+// authentication middleware and the gRPC interceptor put it in the request
+// context, and the tenant-scoped stores refuse to run without it, so a query
+// can never see another organization's rows by accident.
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// DefaultOrganizationID is the organization every account belonged to before
+// organizations existed. Its admins manage the other organizations.
+var DefaultOrganizationID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// DefaultOrganizationSlug is the slug of the default organization
+const DefaultOrganizationSlug = "default"
+
+// ErrMissing is returned by tenant-scoped operations called without an
+// organization in the context
+var ErrMissing = errors.New("no organization in context")
+
+type contextKey struct{}
+
+// WithOrganization returns a copy of ctx acting in the given organization
+func WithOrganization(ctx context.Context, organizationID uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// Organization returns the organization carried by ctx
+func Organization(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(contextKey{}).(uuid.UUID)
+	return id, ok && id != uuid.Nil
+}
+
+// Require returns the organization carried by ctx, or ErrMissing
+func Require(ctx context.Context) (uuid.UUID, error) {
+	id, ok := Organization(ctx)
+	if !ok {
+		return uuid.Nil, ErrMissing
+	}
+	return id, nil
+}
@@ -0,0 +1,23 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequire(t *testing.T) {
+	_, err := Require(context.Background())
+	assert.ErrorIs(t, err, ErrMissing)
+
+	_, err = Require(WithOrganization(context.Background(), uuid.Nil))
+	assert.ErrorIs(t, err, ErrMissing)
+
+	id := uuid.New()
+	got, err := Require(WithOrganization(context.Background(), id))
+	require.NoError(t, err)
+	assert.Equal(t, id, got)
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestGinMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := useRecorder(t)
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(GinMiddleware())
+	router.GET("/users/:id", func(c *gin.Context) {
+		_, span := Tracer().Start(c.Request.Context(), "UserRepository.GetUserByID")
+		span.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+
+	assert.Equal(t, "GET /users/:id", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+}
+
+func TestEnd(t *testing.T) {
+	recorder := useRecorder(t)
+
+	_, ok := Tracer().Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := Tracer().Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "boom", spans[1].Status().Description)
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), Config{
+		ServiceName: "user-service",
+		Exporter:    ExporterFile,
+		FilePath:    path,
+		SampleRatio: 1,
+	})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "bcrypt.hash")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"bcrypt.hash"`)
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "zipkin"})
+	assert.EqualError(t, err, `unknown trace exporter "zipkin"`)
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned for webhook URLs that point into the
+// service's own network
+var ErrForbiddenAddress = errors.New("webhook URL must not point to a private or special-purpose address")
+
+// forbiddenNetworks are the IANA special-purpose address ranges (RFC 6890
+// and its updates) plus private, shared and multicast space. None of them
+// is a public webhook endpoint, and many reach the service's own network:
+// loopback, private and carrier-grade NAT ranges, link-local cloud metadata
+// endpoints, and the IPv6 translation prefixes that embed IPv4 addresses.
+var forbiddenNetworks = mustParseCIDRs(
+	// IPv4
+	"0.0.0.0/8",       // "this network"
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // shared address space (carrier-grade NAT)
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local, including cloud metadata endpoints
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation (TEST-NET-1)
+	"192.31.196.0/24", // AS112-v4
+	"192.52.193.0/24", // AMT
+	"192.88.99.0/24",  // deprecated 6to4 relay anycast
+	"192.168.0.0/16",  // private
+	"192.175.48.0/24", // direct delegation AS112 service
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation (TEST-NET-2)
+	"203.0.113.0/24",  // documentation (TEST-NET-3)
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved, including limited broadcast
+
+	// IPv6; IPv4-mapped addresses are checked against the IPv4 ranges
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // IPv4/IPv6 translation
+	"64:ff9b:1::/48", // local-use IPv4/IPv6 translation
+	"100::/64",       // discard-only
+	"2001::/23",      // IETF protocol assignments, including Teredo
+	"2001:db8::/32",  // documentation
+	"2002::/16",      // 6to4
+	"3fff::/20",      // documentation
+	"5f00::/16",      // segment routing SIDs
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"fec0::/10",      // deprecated site-local
+	"ff00::/8",       // multicast
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// forbiddenIP reports whether ip is in one of forbiddenNetworks
+func forbiddenIP(ip net.IP) bool {
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL rejects webhook URLs whose host is localhost or a forbidden IP
+// address. Host names are not resolved here since their records can change
+// after the check; the client returned by NewHTTPClient refuses forbidden
+// addresses when it connects.
+func CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && forbiddenIP(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewHTTPClient returns the client the dispatcher should post with. Its
+// dialer checks every address it connects to, so host names that resolve to
+// a forbidden address and redirects to one fail as well. Proxies from the
+// environment are ignored since they would bypass the check.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+	"github.com/atulsm/user-service/internal/outbox"
+	"github.com/atulsm/user-service/internal/tenant"
+)
+
+const (
+	defaultBatchSize = 20
+	// lease must comfortably exceed the HTTP timeout so a slow attempt is not
+	// picked up again by another dispatcher while it is still running
+	defaultLease       = 2 * time.Minute
+	defaultBaseBackoff = 30 * time.Second
+	defaultMaxBackoff  = 6 * time.Hour
+)
+
+// Dispatcher delivers queued webhooks. It implements outbox.EventPublisher,
+// so the outbox relay can hand it events directly.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	maxAttempts  int
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	now          func() time.Time
+	wake         chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher that polls the queue every pollInterval
+// and gives up on a delivery after maxAttempts failed attempts.
+func NewDispatcher(store Store, client *http.Client, maxAttempts int, pollInterval time.Duration) *Dispatcher {
+	return &Dispatcher{
+		store:        store,
+		client:       client,
+		maxAttempts:  maxAttempts,
+		pollInterval: pollInterval,
+		batchSize:    defaultBatchSize,
+		lease:        defaultLease,
+		baseBackoff:  defaultBaseBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+var _ outbox.EventPublisher = (*Dispatcher)(nil)
+
+// Publish queues event for every subscription that wants it and wakes the
+// delivery loop. Publishing the same event again is a no-op.
+func (d *Dispatcher) Publish(ctx context.Context, event *events.Event) error {
+	if err := d.store.Enqueue(ctx, event); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers due webhooks until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Delivering webhooks", "interval", d.pollInterval, "max_attempts", d.maxAttempts)
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back so a backlog drains quickly
+		for {
+			n, err := d.DeliverDue(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to deliver webhooks", "error", err)
+			}
+			if err != nil || n < d.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// DeliverDue attempts one batch of due deliveries and returns how many were
+// attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimDue(ctx, d.now(), d.lease, d.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		if err := d.attempt(ctx, delivery); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// attempt posts delivery once and records the result
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) error {
+	// The dispatcher works across organizations; the subscription is looked
+	// up in the one the delivery belongs to
+	sub, err := d.store.GetSubscription(tenant.WithOrganization(ctx, delivery.OrganizationID), delivery.SubscriptionID)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		// Deleting a subscription cascades to its deliveries
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	attempt := &Attempt{
+		DeliveryID:  delivery.ID,
+		Attempt:     delivery.Attempts + 1,
+		AttemptedAt: d.now(),
+	}
+
+	if sub.Active {
+		attempt.StatusCode, err = d.post(ctx, sub, delivery)
+	} else {
+		err = errors.New("subscription is disabled")
+	}
+	attempt.Duration = d.now().Sub(attempt.AttemptedAt)
+
+	outcome := Outcome{Status: StatusSucceeded, NextAttemptAt: attempt.AttemptedAt}
+	if err != nil {
+		attempt.Error = err.Error()
+		if attempt.Attempt >= d.maxAttempts || !sub.Active {
+			outcome.Status = StatusDead
+			slog.WarnContext(ctx, "Webhook delivery is dead", "delivery_id", delivery.ID,
+				"url", sub.URL, "attempts", attempt.Attempt, "error", err)
+		} else {
+			outcome.Status = StatusPending
+			outcome.NextAttemptAt = attempt.AttemptedAt.Add(d.backoff(attempt.Attempt))
+		}
+	}
+
+	return d.store.CompleteAttempt(ctx, attempt, outcome)
+}
+
+// post sends the signed payload. Any non-2xx response is an error.
+func (d *Dispatcher) post(ctx context.Context, sub *Subscription, delivery *Delivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "user-service-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderEventID, delivery.EventID.String())
+	req.Header.Set(HeaderIdempotencyKey, delivery.EventID.String())
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, d.now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	status := resp.StatusCode
+	if status < 200 || status >= 300 {
+		return &status, fmt.Errorf("unexpected response status %d", status)
+	}
+	return &status, nil
+}
+
+// backoff returns the delay before the attempt following attempt n:
+// baseBackoff doubled for every previous failure, capped at maxBackoff
+func (d *Dispatcher) backoff(n int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < n && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
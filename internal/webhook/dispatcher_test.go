@@ -0,0 +1,421 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is an in-memory Store for tests
+type memoryStore struct {
+	mu            sync.Mutex
+	subscriptions map[uuid.UUID]*Subscription
+	deliveries    []*Delivery
+	attempts      []*Attempt
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{subscriptions: map[uuid.UUID]*Subscription{}}
+}
+
+func (m *memoryStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub.ID = uuid.New()
+	sub.OrganizationID = organizationID
+	m.subscriptions[sub.ID] = sub
+	return nil
+}
+
+func (m *memoryStore) GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subscriptions[id]
+	if !ok || sub.OrganizationID != organizationID {
+		return nil, ErrSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func (m *memoryStore) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := []*Subscription{}
+	for _, sub := range m.subscriptions {
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (m *memoryStore) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[sub.ID] = sub
+	return nil
+}
+
+func (m *memoryStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subscriptions, id)
+	return nil
+}
+
+func (m *memoryStore) Enqueue(ctx context.Context, event *events.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payload, _ := json.Marshal(event)
+	for _, sub := range m.subscriptions {
+		if sub.OrganizationID != event.OrganizationID || !sub.Wants(event.Type) || m.find(sub.ID, event.ID) != nil {
+			continue
+		}
+		m.deliveries = append(m.deliveries, &Delivery{
+			ID:             uuid.New(),
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         StatusPending,
+		})
+	}
+	return nil
+}
+
+func (m *memoryStore) find(subscriptionID, eventID uuid.UUID) *Delivery {
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID && d.EventID == eventID {
+			return d
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	due := []*Delivery{}
+	for _, d := range m.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) && len(due) < limit {
+			d.NextAttemptAt = now.Add(lease)
+			copied := *d
+			copied.OrganizationID = m.subscriptions[d.SubscriptionID].OrganizationID
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryStore) CompleteAttempt(ctx context.Context, attempt *Attempt, outcome Outcome) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, attempt)
+	for _, d := range m.deliveries {
+		if d.ID == attempt.DeliveryID {
+			d.Status = outcome.Status
+			d.Attempts = attempt.Attempt
+			d.NextAttemptAt = outcome.NextAttemptAt
+			d.LastStatusCode = attempt.StatusCode
+			d.LastError = attempt.Error
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := []*Delivery{}
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *memoryStore) ListAttempts(ctx context.Context, subscriptionID, deliveryID uuid.UUID) ([]*Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempts := []*Attempt{}
+	for _, a := range m.attempts {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts, nil
+}
+
+func (m *memoryStore) Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		if d.ID == deliveryID && d.SubscriptionID == subscriptionID && d.Status != StatusPending {
+			d.Status = StatusPending
+			return d, nil
+		}
+	}
+	return nil, ErrDeliveryNotFound
+}
+
+// receiver is an httptest server that fails the first failures requests
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, failures int) *receiver {
+	r := &receiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		if len(r.requests) <= r.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func newTestDispatcher(store Store, maxAttempts int) (*Dispatcher, *time.Time) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDispatcher(store, http.DefaultClient, maxAttempts, time.Second)
+	d.now = func() time.Time { return clock }
+	return d, &clock
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	recv := newReceiver(t, 2)
+
+	// Subscriptions are managed in an organization; the dispatcher runs
+	// without one
+	organizationID := uuid.New()
+	sub := &Subscription{URL: recv.URL, Events: []string{events.UserRegistered}, Secret: "s3cret", Active: true}
+	require.NoError(t, store.CreateSubscription(tenant.WithOrganization(ctx, organizationID), sub))
+
+	d, clock := newTestDispatcher(store, 5)
+
+	event, err := events.New(events.UserRegistered, map[string]string{"email": "test@example.com"})
+	require.NoError(t, err)
+	event.OrganizationID = organizationID
+	require.NoError(t, d.Publish(ctx, event))
+	// Duplicate publishes and unsubscribed event types create no deliveries
+	require.NoError(t, d.Publish(ctx, event))
+	other, _ := events.New(events.UserDeleted, nil)
+	other.OrganizationID = organizationID
+	require.NoError(t, d.Publish(ctx, other))
+	// Events of other organizations are not delivered
+	elsewhere, _ := events.New(events.UserRegistered, nil)
+	elsewhere.OrganizationID = uuid.New()
+	require.NoError(t, d.Publish(ctx, elsewhere))
+	require.Len(t, store.deliveries, 1)
+
+	for i := 0; i < 3; i++ {
+		n, err := d.DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n, "attempt %d", i+1)
+
+		// Nothing is due again until the backoff has elapsed
+		n, _ = d.DeliverDue(ctx)
+		assert.Equal(t, 0, n)
+		*clock = clock.Add(d.backoff(i + 1))
+	}
+
+	delivery := store.deliveries[0]
+	assert.Equal(t, StatusSucceeded, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, *delivery.LastStatusCode)
+	assert.Len(t, store.attempts, 3)
+	assert.Equal(t, "unexpected response status 503", store.attempts[0].Error)
+
+	req, body := recv.requests[2], recv.bodies[2]
+	assert.Equal(t, events.UserRegistered, req.Header.Get(HeaderEvent))
+	assert.Equal(t, event.ID.String(), req.Header.Get(HeaderEventID))
+	assert.Equal(t, event.ID.String(), req.Header.Get(HeaderIdempotencyKey))
+	assert.NoError(t, Verify("s3cret", req.Header.Get(HeaderSignature), body, 0, time.Now()))
+	assert.ErrorIs(t, Verify("wrong", req.Header.Get(HeaderSignature), body, 0, time.Now()), ErrInvalidSignature)
+
+	var received events.Event
+	require.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, event.ID, received.ID)
+	assert.JSONEq(t, `{"email":"test@example.com"}`, string(received.Data))
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	recv := newReceiver(t, 100)
+
+	organizationID := uuid.New()
+	sub := &Subscription{URL: recv.URL, Events: []string{events.UserDeleted}, Secret: "s3cret", Active: true}
+	require.NoError(t, store.CreateSubscription(tenant.WithOrganization(ctx, organizationID), sub))
+
+	d, clock := newTestDispatcher(store, 3)
+	event, _ := events.New(events.UserDeleted, nil)
+	event.OrganizationID = organizationID
+	require.NoError(t, d.Publish(ctx, event))
+
+	for i := 0; i < 5; i++ {
+		_, err := d.DeliverDue(ctx)
+		require.NoError(t, err)
+		*clock = clock.Add(d.maxBackoff)
+	}
+
+	delivery := store.deliveries[0]
+	assert.Equal(t, StatusDead, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Len(t, recv.requests, 3)
+
+	// A dead delivery can be put back in the queue by an admin
+	_, err := store.Redeliver(ctx, sub.ID, delivery.ID)
+	require.NoError(t, err)
+	recv.mu.Lock()
+	recv.failures = 0
+	recv.mu.Unlock()
+	n, err := d.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, StatusSucceeded, delivery.Status)
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(newMemoryStore(), http.DefaultClient, 10, time.Second)
+	assert.Equal(t, 30*time.Second, d.backoff(1))
+	assert.Equal(t, time.Minute, d.backoff(2))
+	assert.Equal(t, 4*time.Minute, d.backoff(4))
+	assert.Equal(t, defaultMaxBackoff, d.backoff(30))
+}
+
+func TestVerifyRejectsStaleSignatures(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	signedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := Sign("s3cret", signedAt, body)
+
+	assert.NoError(t, Verify("s3cret", header, body, 5*time.Minute, signedAt.Add(time.Minute)))
+	assert.ErrorIs(t, Verify("s3cret", header, body, 5*time.Minute, signedAt.Add(time.Hour)), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("s3cret", header, []byte(`{"id":"2"}`), 0, signedAt), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("s3cret", "garbage", body, 0, signedAt), ErrInvalidSignature)
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, rawURL := range []string{
+		"http://localhost:8080/hook",
+		"http://api.localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hook",
+		"https://172.16.3.4/hook",
+		"https://192.168.1.10/hook",
+		"https://[fd00::1]/hook",
+	} {
+		assert.ErrorIs(t, CheckURL(rawURL), ErrForbiddenAddress, rawURL)
+	}
+	assert.NoError(t, CheckURL("https://hooks.example.com/user-service"))
+	assert.NoError(t, CheckURL("https://93.184.216.34/hook"))
+}
+
+func TestForbiddenIP(t *testing.T) {
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{"0.1.2.3", true},
+		{"10.20.30.40", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"172.31.255.255", true},
+		{"192.0.0.8", true},
+		{"192.0.2.10", true},
+		{"192.31.196.1", true},
+		{"192.52.193.1", true},
+		{"192.88.99.1", true},
+		{"192.168.0.1", true},
+		{"192.175.48.1", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"198.51.100.7", true},
+		{"203.0.113.9", true},
+		{"224.0.0.251", true},
+		{"239.255.255.250", true},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::", true},
+		{"::1", true},
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b:1::1", true},
+		{"100::1", true},
+		{"2001::1", true},
+		{"2001:2::1", true},
+		{"2001:db8::1", true},
+		{"2002:a00:1::1", true},
+		{"3fff::1", true},
+		{"5f00::1", true},
+		{"fd12:3456::1", true},
+		{"fe80::1", true},
+		{"fec0::1", true},
+		{"ff02::1", true},
+
+		// Public addresses, including the neighbours of forbidden ranges
+		{"93.184.216.34", false},
+		{"100.63.255.255", false},
+		{"100.128.0.0", false},
+		{"172.32.0.1", false},
+		{"192.0.1.1", false},
+		{"198.17.255.255", false},
+		{"198.20.0.0", false},
+		{"223.255.255.255", false},
+		{"::ffff:93.184.216.34", false},
+		{"2606:2800:220:1::1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			require.NotNil(t, ip)
+			assert.Equal(t, tt.forbidden, forbiddenIP(ip))
+		})
+	}
+}
+
+func TestHTTPClientRefusesForbiddenAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := NewHTTPClient(time.Second).Post(srv.URL, "application/json", nil)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+}
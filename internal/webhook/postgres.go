@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+	"github.com/atulsm/user-service/internal/tenant"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresStore keeps subscriptions and deliveries in the webhook_* tables
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+// NewPostgresStore creates a webhook store on top of an existing connection pool
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+type subscriptionRow struct {
+	Subscription
+	Events pq.StringArray `db:"events"`
+}
+
+func (r *subscriptionRow) toSubscription() *Subscription {
+	sub := r.Subscription
+	sub.Events = []string(r.Events)
+	return &sub
+}
+
+func (s *PostgresStore) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	sub.OrganizationID = organizationID
+	if sub.ID == uuid.Nil {
+		sub.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	sub.CreatedAt, sub.UpdatedAt = now, now
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO webhook_subscriptions (id, organization_id, url, events, secret, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, sub.ID, sub.OrganizationID, sub.URL, pq.StringArray(sub.Events), sub.Secret, sub.Active, sub.CreatedAt, sub.UpdatedAt)
+	return err
+}
+
+func (s *PostgresStore) GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var row subscriptionRow
+	err = s.db.GetContext(ctx, &row, `SELECT * FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.toSubscription(), nil
+}
+
+func (s *PostgresStore) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows := []subscriptionRow{}
+	if err := s.db.SelectContext(ctx, &rows, `SELECT * FROM webhook_subscriptions WHERE organization_id = $1 ORDER BY created_at`, organizationID); err != nil {
+		return nil, err
+	}
+	subs := make([]*Subscription, len(rows))
+	for i := range rows {
+		subs[i] = rows[i].toSubscription()
+	}
+	return subs, nil
+}
+
+func (s *PostgresStore) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	sub.UpdatedAt = time.Now().UTC()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_subscriptions
+		SET url = $2, events = $3, secret = $4, active = $5, updated_at = $6
+		WHERE id = $1 AND organization_id = $7
+	`, sub.ID, sub.URL, pq.StringArray(sub.Events), sub.Secret, sub.Active, sub.UpdatedAt, organizationID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result, ErrSubscriptionNotFound)
+}
+
+func (s *PostgresStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	organizationID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1 AND organization_id = $2`, id, organizationID)
+	if err != nil {
+		return err
+	}
+	return requireRow(result, ErrSubscriptionNotFound)
+}
+
+func (s *PostgresStore) Enqueue(ctx context.Context, event *events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var subscriptionIDs []uuid.UUID
+	err = tx.SelectContext(ctx, &subscriptionIDs, `
+		SELECT id FROM webhook_subscriptions WHERE active AND $1 = ANY (events) AND organization_id = $2
+	`, event.Type, event.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	for _, subscriptionID := range subscriptionIDs {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT ON CONSTRAINT webhook_deliveries_event_key DO NOTHING
+		`, uuid.New(), subscriptionID, event.ID, event.Type, payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+	err := s.db.SelectContext(ctx, &deliveries, `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = $2, updated_at = $1
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= $1
+				ORDER BY next_attempt_at
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT claimed.*, s.organization_id
+		FROM claimed
+		JOIN webhook_subscriptions s ON s.id = claimed.subscription_id
+	`, now, now.Add(lease), limit)
+	return deliveries, err
+}
+
+func (s *PostgresStore) CompleteAttempt(ctx context.Context, attempt *Attempt, outcome Outcome) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, attempt.DeliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error,
+		attempt.Duration.Milliseconds(), attempt.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4,
+		    last_status_code = $5, last_error = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, attempt.DeliveryID, outcome.Status, attempt.Attempt, outcome.NextAttemptAt,
+		attempt.StatusCode, attempt.Error)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, limit int) ([]*Delivery, error) {
+	deliveries := []*Delivery{}
+	err := s.db.SelectContext(ctx, &deliveries, `
+		SELECT * FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, subscriptionID, status, limit)
+	return deliveries, err
+}
+
+func (s *PostgresStore) ListAttempts(ctx context.Context, subscriptionID, deliveryID uuid.UUID) ([]*Attempt, error) {
+	rows := []struct {
+		DeliveryID  uuid.UUID `db:"delivery_id"`
+		Attempt     int       `db:"attempt"`
+		StatusCode  *int      `db:"status_code"`
+		Error       string    `db:"error"`
+		DurationMS  int64     `db:"duration_ms"`
+		AttemptedAt time.Time `db:"attempted_at"`
+	}{}
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT a.delivery_id, a.attempt, a.status_code, a.error, a.duration_ms, a.attempted_at
+		FROM webhook_delivery_attempts a
+		JOIN webhook_deliveries d ON d.id = a.delivery_id
+		WHERE a.delivery_id = $1 AND d.subscription_id = $2
+		ORDER BY a.attempt
+	`, deliveryID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]*Attempt, len(rows))
+	for i, row := range rows {
+		attempts[i] = &Attempt{
+			DeliveryID:  row.DeliveryID,
+			Attempt:     row.Attempt,
+			StatusCode:  row.StatusCode,
+			Error:       row.Error,
+			Duration:    time.Duration(row.DurationMS) * time.Millisecond,
+			AttemptedAt: row.AttemptedAt,
+		}
+	}
+	return attempts, nil
+}
+
+func (s *PostgresStore) Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, error) {
+	var delivery Delivery
+	err := s.db.GetContext(ctx, &delivery, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND subscription_id = $2 AND status <> 'pending'
+		RETURNING *
+	`, deliveryID, subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// requireRow turns "no rows affected" into notFound
+func requireRow(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	// HeaderIdempotencyKey carries the event ID, which stays the same when an
+	// event is delivered more than once
+	HeaderIdempotencyKey = "Idempotency-Key"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header value for body sent at timestamp. The
+// signed message is "<unix timestamp>.<body>", so a captured request cannot be
+// replayed with a different timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac(secret, ts, body)))
+}
+
+// Verify checks a signature header produced by Sign. Signatures older than
+// tolerance are rejected; a zero tolerance disables the age check.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && now.Sub(time.Unix(unix, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac(secret, ts, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// GenerateSecret returns a random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,119 @@
+// Package webhook delivers user lifecycle events to subscriber URLs.
+//
+// Emitted events are fanned out into one delivery per matching subscription
+// and stored in a durable queue. The Dispatcher posts each delivery with an
+// HMAC-SHA256 signature, retries failures with exponential backoff and moves
+// deliveries that keep failing to the dead letter state.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/atulsm/user-service/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// Delivery states
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+// Subscription is an endpoint that wants to receive some event types of one
+// organization
+type Subscription struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	OrganizationID uuid.UUID `json:"organizationId" db:"organization_id"`
+	URL            string    `json:"url" db:"url"`
+	Events         []string  `json:"events" db:"-"`
+	Secret         string    `json:"-" db:"secret"`
+	Active         bool      `json:"active" db:"active"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Wants reports whether the subscription receives events of eventType
+func (s *Subscription) Wants(eventType string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event queued for one subscription. OrganizationID is the
+// subscription's organization and is only filled in by ClaimDue.
+type Delivery struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	SubscriptionID uuid.UUID       `json:"subscriptionId" db:"subscription_id"`
+	OrganizationID uuid.UUID       `json:"-" db:"organization_id"`
+	EventID        uuid.UUID       `json:"eventId" db:"event_id"`
+	EventType      string          `json:"eventType" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt" db:"next_attempt_at"`
+	LastStatusCode *int            `json:"lastStatusCode,omitempty" db:"last_status_code"`
+	LastError      string          `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt      time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updatedAt" db:"updated_at"`
+}
+
+// Attempt is the outcome of a single HTTP request for a delivery
+type Attempt struct {
+	DeliveryID  uuid.UUID     `json:"deliveryId"`
+	Attempt     int           `json:"attempt"`
+	StatusCode  *int          `json:"statusCode,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"-"`
+	AttemptedAt time.Time     `json:"attemptedAt"`
+}
+
+// Outcome is what the dispatcher decided after an attempt
+type Outcome struct {
+	Status        string
+	NextAttemptAt time.Time
+}
+
+// Store persists subscriptions and the delivery queue. The subscription
+// methods, ListAttempts and Redeliver only see the organization carried by
+// the context (see package tenant); the queue methods used by the dispatcher
+// work across organizations.
+type Store interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *Subscription) error
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+
+	// Enqueue creates a pending delivery of event for every active
+	// subscription of the event's organization that wants it. Enqueueing the
+	// same event twice is a no-op.
+	Enqueue(ctx context.Context, event *events.Event) error
+	// ClaimDue leases up to limit pending deliveries that are due at now by
+	// pushing their next attempt to now+lease, so that concurrent
+	// dispatchers do not pick them up again. The deliveries carry their
+	// subscription's organization.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+	// CompleteAttempt appends attempt to the delivery log and applies outcome
+	CompleteAttempt(ctx context.Context, attempt *Attempt, outcome Outcome) error
+
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, limit int) ([]*Delivery, error)
+	ListAttempts(ctx context.Context, subscriptionID, deliveryID uuid.UUID) ([]*Attempt, error)
+	// Redeliver puts a dead or succeeded delivery back in the queue
+	Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, error)
+}
@@ -34,7 +34,7 @@ async def root():
 async def guess_last_name(request: GuessRequest):
     try:
         # Fetch users from the API
-        response = requests.get("http://localhost:8080/api/users")
+        response = requests.get("http://localhost:8080/api/v1/users")
         response.raise_for_status()
         users = response.json()
 
@@ -1,20 +1,35 @@
 package utils
 
 import (
+	"time"
+
+	"github.com/atulsm/user-service/internal/metrics"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// DefaultCost is the bcrypt work factor used unless one is configured
+const DefaultCost = 14
+
 // PasswordHasher handles password hashing operations
-type PasswordHasher struct{}
+type PasswordHasher struct {
+	cost int
+}
 
-// NewPasswordHasher creates a new PasswordHasher
+// NewPasswordHasher creates a new PasswordHasher using DefaultCost
 func NewPasswordHasher() *PasswordHasher {
-	return &PasswordHasher{}
+	return NewPasswordHasherWithCost(DefaultCost)
+}
+
+// NewPasswordHasherWithCost creates a PasswordHasher with the given bcrypt
+// cost. Existing hashes keep verifying whatever cost they were made with.
+func NewPasswordHasherWithCost(cost int) *PasswordHasher {
+	return &PasswordHasher{cost: cost}
 }
 
 // HashPassword creates a bcrypt hash of the password
 func (p *PasswordHasher) HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	defer metrics.ObservePasswordHash("hash", time.Now())
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), p.cost)
 	if err != nil {
 		return "", err
 	}
@@ -23,6 +38,7 @@ func (p *PasswordHasher) HashPassword(password string) (string, error) {
 
 // CheckPasswordHash compares a bcrypt hashed password with its possible plaintext equivalent
 func (p *PasswordHasher) CheckPasswordHash(password, hash string) bool {
+	defer metrics.ObservePasswordHash("compare", time.Now())
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
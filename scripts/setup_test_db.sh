@@ -35,10 +35,10 @@ DATABASE_URL="postgres://$DB_USER:$DB_PASSWORD@$DB_HOST:$DB_PORT/$DB_NAME?sslmod
 echo "export DATABASE_URL=\"$DATABASE_URL\"" > env.sh
 chmod +x env.sh
 
-# Run Liquibase migrations with test context
+# Run the embedded migrations with test context
 echo "Running migrations with test data..."
 export DATABASE_URL
-liquibase --contexts=test update
+go run ./cmd/server migrate -contexts=test up
 
 echo "Test database setup complete!"
 echo "Test database connection string: $DATABASE_URL"
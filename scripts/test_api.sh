@@ -15,11 +15,11 @@ echo "=========================="
 
 # Test health endpoint
 echo -e "\n1. Testing Health Check"
-curl -s "$API_URL/health" | jq .
+curl -s "$API_URL/readyz" | jq .
 
 # Register new user
 echo -e "\n2. Testing User Registration"
-REGISTER_RESPONSE=$(curl -s -X POST "$API_URL/api/users/register" \
+REGISTER_RESPONSE=$(curl -s -X POST "$API_URL/api/v1/auth/register" \
   -H "Content-Type: application/json" \
   -d "{
     \"email\": \"$EMAIL\",
@@ -35,7 +35,7 @@ USER_ID=$(echo "$REGISTER_RESPONSE" | jq -r '.user.id')
 
 # Login
 echo -e "\n3. Testing Login"
-LOGIN_RESPONSE=$(curl -s -X POST "$API_URL/api/users/login" \
+LOGIN_RESPONSE=$(curl -s -X POST "$API_URL/api/v1/auth/login" \
   -H "Content-Type: application/json" \
   -d "{
     \"email\": \"$EMAIL\",
@@ -51,12 +51,12 @@ if [ "$TOKEN" != "null" ]; then
 
     # Get profile
     echo -e "\n4. Testing Get Profile"
-    curl -s "$API_URL/api/users/profile" \
+    curl -s "$API_URL/api/v1/users/profile" \
       -H "Authorization: Bearer $TOKEN" | jq .
 
     # Update profile
     echo -e "\n5. Testing Update Profile"
-    curl -s -X PUT "$API_URL/api/users/profile" \
+    curl -s -X PUT "$API_URL/api/v1/users/profile" \
       -H "Authorization: Bearer $TOKEN" \
       -H "Content-Type: application/json" \
       -d '{
@@ -67,17 +67,17 @@ if [ "$TOKEN" != "null" ]; then
 
     # List users
     echo -e "\n6. Testing List Users"
-    curl -s "$API_URL/api/users?limit=10&offset=0" \
+    curl -s "$API_URL/api/v1/users?limit=10&offset=0" \
       -H "Authorization: Bearer $TOKEN" | jq .
 
     # Get specific user
     echo -e "\n7. Testing Get Specific User"
-    curl -s "$API_URL/api/users/$USER_ID" \
+    curl -s "$API_URL/api/v1/users/$USER_ID" \
       -H "Authorization: Bearer $TOKEN" | jq .
 
     # Delete user
     echo -e "\n8. Testing Delete User"
-    curl -s -X DELETE "$API_URL/api/users/$USER_ID" \
+    curl -s -X DELETE "$API_URL/api/v1/users/$USER_ID" \
       -H "Authorization: Bearer $TOKEN" | jq .
 else
     echo -e "${RED}✗ Login failed, cannot continue with authenticated requests${NC}"
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,17 +10,18 @@ import (
 	"os"
 	"testing"
 
+	"github.com/atulsm/user-service/internal/config"
 	"github.com/atulsm/user-service/internal/models"
 	"github.com/atulsm/user-service/internal/server"
 
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
 type APITestSuite struct {
 	suite.Suite
-	router     *gin.Engine
+	server     *server.Server
+	router     http.Handler
 	authToken  string
 	adminToken string
 }
@@ -41,18 +43,27 @@ func (s *APITestSuite) SetupSuite() {
 	// Set a consistent JWT secret for tests
 	os.Setenv("JWT_SECRET", "test-jwt-secret")
 
-	// Initialize the router
-	router, err := server.SetupRouter()
+	// Build the application exactly as the binary does
+	cfg, err := config.Load()
 	if err != nil {
-		s.T().Fatalf("Failed to setup router: %v", err)
+		s.T().Fatalf("Failed to load configuration: %v", err)
 	}
-	s.router = router
+	srv, err := server.New(context.Background(), cfg)
+	if err != nil {
+		s.T().Fatalf("Failed to build server: %v", err)
+	}
+	s.server = srv
+	s.router = srv.Handler()
 
 	// Login as regular user and admin to get tokens
 	s.authToken = s.loginAndGetToken("user@example.com", "User123!")
 	s.adminToken = s.loginAndGetToken("admin@example.com", "Admin123!")
 }
 
+func (s *APITestSuite) TearDownSuite() {
+	s.server.Close()
+}
+
 func (s *APITestSuite) loginAndGetToken(email, password string) string {
 	loginReq := models.LoginRequest{
 		Email:    email,
@@ -60,7 +71,7 @@ func (s *APITestSuite) loginAndGetToken(email, password string) string {
 	}
 	body, _ := json.Marshal(loginReq)
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/users/login", bytes.NewBuffer(body))
+	req, _ := http.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	s.router.ServeHTTP(w, req)
 
@@ -116,7 +127,7 @@ func (s *APITestSuite) TestRegisterUser() {
 		s.Run(tt.name, func() {
 			body, _ := json.Marshal(tt.input)
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("POST", "/api/users/register", bytes.NewBuffer(body))
+			req, _ := http.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(body))
 			req.Header.Set("Content-Type", "application/json")
 			s.router.ServeHTTP(w, req)
 
@@ -172,7 +183,7 @@ func (s *APITestSuite) TestLogin() {
 		s.Run(tt.name, func() {
 			body, _ := json.Marshal(tt.input)
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("POST", "/api/users/login", bytes.NewBuffer(body))
+			req, _ := http.NewRequest("POST", "/api/v1/auth/login", bytes.NewBuffer(body))
 			req.Header.Set("Content-Type", "application/json")
 			s.router.ServeHTTP(w, req)
 
@@ -215,7 +226,7 @@ func (s *APITestSuite) TestGetProfile() {
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/api/users/profile", nil)
+			req, _ := http.NewRequest("GET", "/api/v1/users/profile", nil)
 			if tt.token != "" {
 				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tt.token))
 			}
@@ -271,7 +282,7 @@ func (s *APITestSuite) TestUpdateProfile() {
 		s.Run(tt.name, func() {
 			body, _ := json.Marshal(tt.input)
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("PUT", "/api/users/profile", bytes.NewBuffer(body))
+			req, _ := http.NewRequest("PUT", "/api/v1/users/profile", bytes.NewBuffer(body))
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tt.token))
 			req.Header.Set("Content-Type", "application/json")
 			s.router.ServeHTTP(w, req)
@@ -330,7 +341,7 @@ func (s *APITestSuite) TestListUsers() {
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("GET", "/api/users"+tt.query, nil)
+			req, _ := http.NewRequest("GET", "/api/v1/users"+tt.query, nil)
 			if tt.token != "" {
 				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tt.token))
 			}
@@ -358,7 +369,7 @@ func (s *APITestSuite) TestDeleteUser() {
 	}
 	body, _ := json.Marshal(registerReq)
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/users/register", bytes.NewBuffer(body))
+	req, _ := http.NewRequest("POST", "/api/v1/auth/register", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
 	s.router.ServeHTTP(w, req)
 
@@ -394,7 +405,7 @@ func (s *APITestSuite) TestDeleteUser() {
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
 			w := httptest.NewRecorder()
-			req, _ := http.NewRequest("DELETE", "/api/users/"+tt.userID, nil)
+			req, _ := http.NewRequest("DELETE", "/api/v1/users/"+tt.userID, nil)
 			if tt.token != "" {
 				req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tt.token))
 			}